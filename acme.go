@@ -0,0 +1,215 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ACMEConfig enables the ACME DNS-01 helper: endpoints on the HTTP listener
+// compatible with lego's httpreq provider, which create and remove the
+// _acme-challenge TXT records for certificates of Domains with the
+// CloudFlare token of Job.
+type ACMEConfig struct {
+	Domains  []string `yaml:"domains"`
+	Job      string   `yaml:"job"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+}
+
+func (a ACMEConfig) enabled() bool {
+	return len(a.Domains) > 0
+}
+
+func (a ACMEConfig) equal(b ACMEConfig) bool {
+	return a.Job == b.Job && a.Username == b.Username && a.Password == b.Password && slices.Equal(a.Domains, b.Domains)
+}
+
+// acmeTTL is the TTL of challenge records, the lowest CloudFlare allows
+// for them.
+const acmeTTL = 60
+
+// acmeValue matches a DNS-01 challenge value, the base64url encoded SHA-256
+// digest of the key authorization.
+var acmeValue = regexp.MustCompile(`^[A-Za-z0-9_-]{1,255}$`)
+
+func validateACME(config Config) error {
+	a := config.ACME
+	if !a.enabled() {
+		if a.Job != "" || a.Username != "" || a.Password != "" {
+			return fmt.Errorf("acme.domains is required to use the ACME helper")
+		}
+		return nil
+	}
+	if a.Username == "" || a.Password == "" {
+		return fmt.Errorf("acme.username and acme.password are required when acme.domains is set")
+	}
+	for _, domain := range a.Domains {
+		if strings.Trim(domain, ".") == "" {
+			return fmt.Errorf("acme.domains must not contain empty names")
+		}
+	}
+
+	var matches []JobConfig
+	for _, job := range config.jobs() {
+		if job.enabled() && (a.Job == "" || job.Name == a.Job) {
+			matches = append(matches, job)
+		}
+	}
+	switch {
+	case a.Job != "" && len(matches) == 0:
+		return fmt.Errorf("acme.job: there is no enabled job named %s", a.Job)
+	case len(matches) != 1:
+		return fmt.Errorf("acme.job is required when there are several jobs")
+	}
+	if provider := matches[0].Provider; provider != "" && provider != "cloudflare" {
+		return fmt.Errorf("acme is only supported with the cloudflare provider")
+	}
+	return nil
+}
+
+// acmeName checks that fqdn is the challenge name of one of domains, or of
+// a name below one, and returns it without the trailing dot.
+func acmeName(fqdn string, domains []string) (string, bool) {
+	name := strings.ToLower(strings.TrimSuffix(fqdn, "."))
+	host, ok := strings.CutPrefix(name, "_acme-challenge.")
+	if !ok {
+		return "", false
+	}
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.Trim(domain, "."))
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// acmeAuthorized checks the basic auth credentials of an ACME request.
+func (h *httpHandler) acmeAuthorized(r *http.Request) bool {
+	user, password, ok := r.BasicAuth()
+	return ok &&
+		subtle.ConstantTimeCompare([]byte(user), []byte(h.acme.Username)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(h.acme.Password)) == 1
+}
+
+// acmeProvider returns the CloudFlare zone of the job the helper uses.
+func (h *httpHandler) acmeProvider() (*DDNSService, *cloudflareProvider, error) {
+	for _, s := range h.services.list() {
+		if s.recordType == "A" || (h.acme.Job != "" && s.name != h.acme.Job) {
+			continue
+		}
+		if s.config.Observe || s.config.DryRun {
+			return nil, nil, fmt.Errorf("records are not written in observe mode or a dry run")
+		}
+		if p, ok := s.provider.(*cloudflareProvider); ok {
+			return s, p, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("the ACME job is not running")
+}
+
+// acmeRequest handles POST /acme/present and /acme/cleanup, taking lego's
+// httpreq request body {"fqdn": ..., "value": ...}.
+func (h *httpHandler) acmeRequest(w http.ResponseWriter, r *http.Request, present bool) {
+	if !allowPost(w, r) {
+		return
+	}
+	if !h.acmeAuthorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="acme"`)
+		writeError(w, http.StatusUnauthorized, "invalid or missing credentials")
+		return
+	}
+
+	var req struct {
+		FQDN  string `json:"fqdn"`
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	name, ok := acmeName(req.FQDN, h.acme.Domains)
+	if !ok {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("%s is not a challenge name of acme.domains", req.FQDN))
+		return
+	}
+	if !acmeValue.MatchString(req.Value) {
+		writeError(w, http.StatusBadRequest, "value is not a DNS-01 challenge value")
+		return
+	}
+
+	s, p, err := h.acmeProvider()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	action, done := "creating", "created"
+	if present {
+		err = acmePresent(p, name, req.Value)
+	} else {
+		action, done = "removing", "removed"
+		err = acmeCleanup(p, name, req.Value)
+	}
+	if err != nil {
+		s.errorf("ACME helper: %s %s: %v", action, name, err)
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	s.logf("ACME helper: %s challenge record %s", done, name)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// acmePresent creates the challenge record unless it exists already. A name
+// can hold several challenges at once, e.g. for a certificate covering both
+// a domain and its wildcard.
+func acmePresent(p *cloudflareProvider, name, value string) error {
+	records, err := p.listRecords("TXT", name)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if recordValue("TXT", record.Content) == value {
+			return nil
+		}
+	}
+	_, err = p.CreateRecord(DNSRecord{Type: "TXT", Name: name, Content: value, TTL: acmeTTL, Comment: stampPrefix + " acme-challenge"})
+	return err
+}
+
+// acmeCleanup removes the challenge records holding value.
+func acmeCleanup(p *cloudflareProvider, name, value string) error {
+	records, err := p.listRecords("TXT", name)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if recordValue("TXT", record.Content) != value {
+			continue
+		}
+		if err := p.deleteRecord(record.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateACME(t *testing.T) {
+	single := Config{CloudFlare: CloudFlareConfig{RecordName: "home.example.com"}}
+	jobs := Config{Jobs: []JobConfig{{Name: "home"}, {Name: "office", Provider: "route53"}}}
+	acme := ACMEConfig{Domains: []string{"example.com"}, Username: "lego", Password: "secret"}
+	tests := []struct {
+		name    string
+		config  Config
+		acme    ACMEConfig
+		wantErr string
+	}{
+		{name: "disabled", config: single},
+		{name: "single job", config: single, acme: acme},
+		{name: "named job", config: jobs, acme: ACMEConfig{Domains: acme.Domains, Username: "lego", Password: "secret", Job: "home"}},
+		{name: "no job with several", config: jobs, acme: acme, wantErr: "acme.job is required"},
+		{name: "unknown job", config: jobs, acme: ACMEConfig{Domains: acme.Domains, Username: "lego", Password: "secret", Job: "lab"}, wantErr: "no enabled job named lab"},
+		{name: "other provider", config: jobs, acme: ACMEConfig{Domains: acme.Domains, Username: "lego", Password: "secret", Job: "office"}, wantErr: "only supported with the cloudflare provider"},
+		{name: "no credentials", config: single, acme: ACMEConfig{Domains: acme.Domains}, wantErr: "acme.username and acme.password are required"},
+		{name: "no domains", config: single, acme: ACMEConfig{Username: "lego", Password: "secret"}, wantErr: "acme.domains is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.ACME = tt.acme
+			err := validateACME(tt.config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateACME() = %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateACME() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestACMEName(t *testing.T) {
+	domains := []string{"example.com", "Example.NET."}
+	tests := []struct {
+		fqdn string
+		want string
+		ok   bool
+	}{
+		{"_acme-challenge.example.com.", "_acme-challenge.example.com", true},
+		{"_acme-challenge.www.example.com", "_acme-challenge.www.example.com", true},
+		{"_acme-challenge.example.net.", "_acme-challenge.example.net", true},
+		{"_acme-challenge.badexample.com.", "", false},
+		{"www.example.com.", "", false},
+		{"_acme-challenge.example.org.", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := acmeName(tt.fqdn, domains); got != tt.want || ok != tt.ok {
+			t.Errorf("acmeName(%q) = %q, %v, want %q, %v", tt.fqdn, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestACMEHelper(t *testing.T) {
+	type txt struct{ id, content string }
+	var records []txt
+	nextID := 0
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/zones/zone/dns_records":
+			var result []DNSRecord
+			for _, rec := range records {
+				result = append(result, DNSRecord{ID: rec.id, Type: "TXT", Name: r.URL.Query().Get("name"), Content: `"` + rec.content + `"`})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "result": result})
+		case r.Method == "POST" && r.URL.Path == "/zones/zone/dns_records":
+			var body DNSRecord
+			json.NewDecoder(r.Body).Decode(&body)
+			if body.Type != "TXT" || body.Name != "_acme-challenge.example.com" || body.TTL != acmeTTL {
+				t.Errorf("unexpected record %+v", body)
+			}
+			nextID++
+			records = append(records, txt{fmt.Sprintf("rec-%d", nextID), body.Content})
+			fmt.Fprintf(w, `{"success": true, "result": {"id": "rec-%d"}}`, nextID)
+		case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/zones/zone/dns_records/"):
+			id := strings.TrimPrefix(r.URL.Path, "/zones/zone/dns_records/")
+			for i, rec := range records {
+				if rec.id == id {
+					records = append(records[:i], records[i+1:]...)
+					break
+				}
+			}
+			fmt.Fprintf(w, `{"success": true, "result": {"id": %q}}`, id)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	}))
+	defer api.Close()
+
+	s := &DDNSService{provider: &cloudflareProvider{client: api.Client(), baseURL: api.URL, zoneID: "zone", token: "token"}}
+	acme := ACMEConfig{Domains: []string{"example.com"}, Username: "lego", Password: "secret"}
+	handler := newHTTPHandler(HTTPConfig{}, acme, newServiceSet([]*DDNSService{s}))
+
+	call := func(path, fqdn, value, password string) int {
+		body := fmt.Sprintf(`{"fqdn": %q, "value": %q}`, fqdn, value)
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.SetBasicAuth("lego", password)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	const value1, value2 = "LoqXcYV8q5ONbJQxbmR7SCTNo3tiAXDfowyjxAjEuX0", "Bl5YbBmmXTGWuKwyxGFhWqEiMLuF-_4XaAtn3DjTuVM"
+	if code := call("/acme/present", "_acme-challenge.example.com.", value1, "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("present with a wrong password = %d, want 401", code)
+	}
+	if code := call("/acme/present", "_acme-challenge.example.org.", value1, "secret"); code != http.StatusForbidden {
+		t.Errorf("present outside acme.domains = %d, want 403", code)
+	}
+	if code := call("/acme/present", "_acme-challenge.example.com.", "bad value", "secret"); code != http.StatusBadRequest {
+		t.Errorf("present with a bad value = %d, want 400", code)
+	}
+
+	// A wildcard certificate needs two challenges at the same name
+	for _, value := range []string{value1, value2, value1} {
+		if code := call("/acme/present", "_acme-challenge.example.com.", value, "secret"); code != http.StatusOK {
+			t.Fatalf("present = %d, want 200", code)
+		}
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d challenge records, want 2", len(records))
+	}
+
+	if code := call("/acme/cleanup", "_acme-challenge.example.com.", value1, "secret"); code != http.StatusOK {
+		t.Fatalf("cleanup = %d, want 200", code)
+	}
+	if len(records) != 1 || records[0].content != value2 {
+		t.Errorf("records after cleanup = %+v, want only %s", records, value2)
+	}
+}
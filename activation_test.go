@@ -0,0 +1,65 @@
+//go:build unix
+
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestActivationListeners(t *testing.T) {
+	t.Run("not activated", func(t *testing.T) {
+		t.Setenv("LISTEN_PID", "1")
+		t.Setenv("LISTEN_FDS", "1")
+		listeners, err := activationListeners()
+		if err != nil || listeners != nil {
+			t.Errorf("activationListeners() = %v, %v, want nothing", listeners, err)
+		}
+		if os.Getenv("LISTEN_FDS") != "" {
+			t.Error("LISTEN_FDS should be removed from the environment")
+		}
+	})
+
+	t.Run("inherited socket", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		f, err := ln.(*net.TCPListener).File()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// activationListeners takes ownership of the descriptor
+		fd, err := syscall.Dup(int(f.Fd()))
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer func(start int) { listenFDsStart = start }(listenFDsStart)
+		listenFDsStart = fd
+		t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+		t.Setenv("LISTEN_FDS", "1")
+
+		listeners, err := activationListeners()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(listeners) != 1 || listeners[0].Addr().String() != ln.Addr().String() {
+			t.Fatalf("listeners = %v, want one on %s", listeners, ln.Addr())
+		}
+		listeners[0].Close()
+	})
+
+	t.Run("invalid count", func(t *testing.T) {
+		t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+		t.Setenv("LISTEN_FDS", "zero")
+		if _, err := activationListeners(); err == nil || err.Error() != `invalid LISTEN_FDS "zero"` {
+			t.Errorf("expected invalid LISTEN_FDS error, got %v", err)
+		}
+	})
+}
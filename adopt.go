@@ -0,0 +1,208 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// adoptedJob is one entry of the jobs list printed by the adopt command.
+// Only the settings taken from the existing record are included.
+type adoptedJob struct {
+	Name       string        `yaml:"name" json:"name"`
+	Interface  string        `yaml:"interface" json:"interface"`
+	CloudFlare adoptedRecord `yaml:"cloudflare" json:"cloudflare"`
+}
+
+type adoptedRecord struct {
+	APIToken        string `yaml:"api_token,omitempty" json:"api_token,omitempty"`
+	APITokenFile    string `yaml:"api_token_file,omitempty" json:"api_token_file,omitempty"`
+	APITokenEnv     string `yaml:"api_token_env,omitempty" json:"api_token_env,omitempty"`
+	APITokenCommand string `yaml:"api_token_command,omitempty" json:"api_token_command,omitempty"`
+	APITokenSecret  string `yaml:"api_token_secret,omitempty" json:"api_token_secret,omitempty"`
+	ZoneID          string `yaml:"zone_id,omitempty" json:"zone_id,omitempty"`
+	RecordName      string `yaml:"record_name" json:"record_name"`
+	TTL             int    `yaml:"ttl" json:"ttl"`
+	Proxied         bool   `yaml:"proxied" json:"proxied"`
+
+	// Content is only informational; it is not a config setting.
+	Content string `yaml:"-" json:"content"`
+}
+
+// listAAAARecords returns every AAAA record in the zone, following pages.
+func listAAAARecords(client *http.Client, baseURL string, cf CloudFlareConfig) ([]DNSRecord, error) {
+	p := newCloudFlareProvider(cf, client)
+	p.baseURL = baseURL
+	return p.listRecords("AAAA", "")
+}
+
+// adoptJobs turns the records whose names match pattern into jobs, leaving
+// out names the config already manages.
+func adoptJobs(config Config, cf CloudFlareConfig, records []DNSRecord, pattern, iface string) ([]adoptedJob, error) {
+	managed := make(map[string]bool)
+	for _, job := range config.jobs() {
+		managed[strings.ToLower(job.CloudFlare.RecordName)] = true
+		for _, alias := range job.CloudFlare.Aliases {
+			managed[strings.ToLower(alias)] = true
+		}
+		for _, record := range job.CloudFlare.Records {
+			managed[strings.ToLower(record.Name)] = true
+		}
+		for _, zone := range job.CloudFlare.Zones {
+			for _, record := range zone.Records {
+				managed[strings.ToLower(record.Name)] = true
+			}
+		}
+	}
+
+	var jobs []adoptedJob
+	for _, rec := range records {
+		ok, err := path.Match(pattern, rec.Name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		if !ok || managed[strings.ToLower(rec.Name)] {
+			continue
+		}
+		jobs = append(jobs, adoptedJob{
+			Name:      rec.Name,
+			Interface: iface,
+			CloudFlare: adoptedRecord{
+				APIToken:        cf.APIToken,
+				APITokenFile:    cf.APITokenFile,
+				APITokenEnv:     cf.APITokenEnv,
+				APITokenCommand: cf.APITokenCommand,
+				APITokenSecret:  cf.APITokenSecret,
+				ZoneID:          cf.ZoneID,
+				RecordName:      rec.Name,
+				TTL:             rec.TTL,
+				Proxied:         rec.Proxied,
+				Content:         rec.Content,
+			},
+		})
+	}
+	return jobs, nil
+}
+
+// writeAdopted prints jobs as a YAML jobs list ready to paste into the
+// config, or as JSON.
+func writeAdopted(out io.Writer, jobs []adoptedJob, output string) error {
+	switch output {
+	case "json":
+		if jobs == nil {
+			jobs = []adoptedJob{}
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(map[string]interface{}{"jobs": jobs})
+	case "yaml":
+		if len(jobs) == 0 {
+			_, err := fmt.Fprintln(out, "# no unmanaged AAAA records matched")
+			return err
+		}
+		for _, job := range jobs {
+			if _, err := fmt.Fprintf(out, "# %s currently points to %s\n", job.CloudFlare.RecordName, job.CloudFlare.Content); err != nil {
+				return err
+			}
+		}
+		enc := yaml.NewEncoder(out)
+		enc.SetIndent(2)
+		if err := enc.Encode(map[string]interface{}{"jobs": jobs}); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return fmt.Errorf("unknown output format %q (use yaml or json)", output)
+	}
+}
+
+func runAdopt(args []string) error {
+	fs := flag.NewFlagSet("adopt", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/ipv6-ddns-cloudflare/config.yaml", "Path to configuration file with the CloudFlare credentials")
+	jobName := fs.String("job", "", "Job whose zone and token to use (default: the first job)")
+	pattern := fs.String("pattern", "*", "Only adopt records whose name matches this glob, e.g. \"*.dyn.example.com\"")
+	iface := fs.String("interface", "", "Interface for the adopted jobs (default: the selected job's interface)")
+	outputFormat := outputFlag(fs, "yaml", "json")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s adopt [flags]\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Lists AAAA records in the zone that the config does not manage yet and prints")
+		fmt.Fprintln(fs.Output(), "them as a jobs list to add to the config.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	output, err := outputFormat()
+	if err != nil {
+		return err
+	}
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	jobs := config.jobs()
+	job := jobs[0]
+	if *jobName != "" {
+		found := false
+		for _, j := range jobs {
+			if j.Name == *jobName {
+				job, found = j, true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown job %q", *jobName)
+		}
+	}
+	// The jobs printed get the token the way the config has it, not the
+	// token read from a file or command
+	cf := job.CloudFlare
+	if err := resolveAPIToken(&cf); err != nil {
+		return err
+	}
+	if cf.APIToken == "" || cf.ZoneID == "" && cf.RecordName == "" {
+		return fmt.Errorf("cloudflare.api_token and cloudflare.zone_id or cloudflare.record_name are required")
+	}
+	if *iface == "" {
+		*iface = job.Interface
+	}
+	if *iface == "" {
+		return fmt.Errorf("-interface is required when the config does not set one")
+	}
+
+	resolver, _ := newResolver(config.Resolvers)
+	client := newHTTPClient(config.HTTPClient, resolver)
+	records, err := listAAAARecords(client, cloudflareAPI, cf)
+	if err != nil {
+		return fmt.Errorf("listing records: %w", err)
+	}
+	adopted, err := adoptJobs(config, job.CloudFlare, records, *pattern, *iface)
+	if err != nil {
+		return err
+	}
+	return writeAdopted(os.Stdout, adopted, output)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestListAAAARecords(t *testing.T) {
+	pages := [][]DNSRecord{
+		{{ID: "1", Name: "home.example.com", Content: "2001:db8::1", TTL: 1}},
+		{{ID: "2", Name: "nas.dyn.example.com", Content: "2001:db8::2", TTL: 300}},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/zones/zone/dns_records" || r.URL.Query().Get("type") != "AAAA" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		var page int
+		fmt.Sscan(r.URL.Query().Get("page"), &page)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":     true,
+			"result":      pages[page-1],
+			"result_info": map[string]int{"page": page, "total_pages": len(pages)},
+		})
+	}))
+	defer server.Close()
+
+	records, err := listAAAARecords(server.Client(), server.URL, CloudFlareConfig{APIToken: "token", ZoneID: "zone"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 2 || records[1].Name != "nas.dyn.example.com" {
+		t.Errorf("records = %+v", records)
+	}
+}
+
+func TestAdoptJobs(t *testing.T) {
+	cf := CloudFlareConfig{APIToken: "token", ZoneID: "zone", RecordName: "home.example.com", Aliases: []string{"www.dyn.example.com"}}
+	config := Config{Interface: "eth0", CloudFlare: cf}
+	records := []DNSRecord{
+		{Name: "home.example.com", Content: "2001:db8::1", TTL: 1},
+		{Name: "nas.dyn.example.com", Content: "2001:db8::2", TTL: 300},
+		{Name: "www.dyn.example.com", Content: "2001:db8::1", TTL: 1},
+		{Name: "printer.example.com", Content: "2001:db8::3", TTL: 1, Proxied: true},
+	}
+
+	tests := []struct {
+		pattern string
+		want    []string
+		wantErr string
+	}{
+		{pattern: "*", want: []string{"nas.dyn.example.com", "printer.example.com"}},
+		{pattern: "*.dyn.example.com", want: []string{"nas.dyn.example.com"}},
+		{pattern: "nomatch", want: nil},
+		{pattern: "[", wantErr: `invalid pattern "["`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			jobs, err := adoptJobs(config, cf, records, tt.pattern, "wan0")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var names []string
+			for _, job := range jobs {
+				names = append(names, job.CloudFlare.RecordName)
+				if job.Interface != "wan0" || job.CloudFlare.ZoneID != "zone" {
+					t.Errorf("job %s: interface %q zone %q", job.Name, job.Interface, job.CloudFlare.ZoneID)
+				}
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("adopted %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteAdopted(t *testing.T) {
+	jobs := []adoptedJob{{
+		Name:      "nas.example.com",
+		Interface: "eth0",
+		CloudFlare: adoptedRecord{
+			APIToken:   "token",
+			ZoneID:     "zone",
+			RecordName: "nas.example.com",
+			TTL:        300,
+			Content:    "2001:db8::2",
+		},
+	}}
+
+	var buf bytes.Buffer
+	if err := writeAdopted(&buf, jobs, "yaml"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `# nas.example.com currently points to 2001:db8::2
+jobs:
+  - name: nas.example.com
+    interface: eth0
+    cloudflare:
+      api_token: token
+      zone_id: zone
+      record_name: nas.example.com
+      ttl: 300
+      proxied: false
+`
+	if buf.String() != want {
+		t.Errorf("yaml output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := writeAdopted(&buf, nil, "json"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != "{\n  \"jobs\": []\n}" {
+		t.Errorf("json output = %q", got)
+	}
+
+	if err := writeAdopted(&buf, nil, "xml"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
@@ -0,0 +1,111 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// ChangeLimitConfig flags records that are rewritten more often than a
+// working setup would, e.g. because of a detection bug or a misconfigured
+// second instance, before they keep rewriting public DNS.
+type ChangeLimitConfig struct {
+	// MaxChanges is how many writes of a record are expected within Window
+	// seconds (default 3600); 0 disables the check.
+	MaxChanges int `yaml:"max_changes"`
+	Window     int `yaml:"window"`
+
+	// Freeze refuses further writes of a record for this many seconds once
+	// it changed more often; 0 only warns.
+	Freeze int `yaml:"freeze"`
+}
+
+func validateChangeLimit(c ChangeLimitConfig) error {
+	if c.MaxChanges < 0 || c.Window < 0 || c.Freeze < 0 {
+		return fmt.Errorf("change_limit settings must not be negative")
+	}
+	if c.MaxChanges == 0 && c.Freeze != 0 {
+		return fmt.Errorf("change_limit.max_changes is required when change_limit.freeze is set")
+	}
+	return nil
+}
+
+// frozenError refuses a write of a record that changed too often. It is
+// retryable: the retries publish the pending address once the freeze ends.
+type frozenError struct {
+	name  string
+	until time.Time
+}
+
+func (e *frozenError) Error() string {
+	return fmt.Sprintf("%s changed too often, writes are frozen until %s", e.name, e.until.Format(time.RFC3339))
+}
+
+// checkFrozen returns a frozenError while writes of record, one of the
+// records of s, are frozen.
+func (s *DDNSService) checkFrozen(record *DDNSService) error {
+	record.mu.Lock()
+	until := record.frozenUntil
+	record.mu.Unlock()
+	if s.clock().Now().Before(until) {
+		return &frozenError{name: record.config.CloudFlare.RecordName, until: until}
+	}
+	return nil
+}
+
+// countChange counts a write of record, one of the records of s, and warns
+// once it changed more than change_limit.max_changes times within the
+// window. With change_limit.freeze, the record's writes are frozen then,
+// and counting starts over after the freeze.
+func (s *DDNSService) countChange(record *DDNSService, ip string) {
+	limit := s.config.ChangeLimit
+	if limit.MaxChanges == 0 {
+		return
+	}
+	now := s.clock().Now()
+	window := time.Duration(limit.Window) * time.Second
+
+	record.mu.Lock()
+	recent := record.changes[:0]
+	for _, t := range record.changes {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	record.changes = append(recent, now)
+	count := len(record.changes)
+	if count != limit.MaxChanges+1 {
+		record.mu.Unlock()
+		return
+	}
+	if limit.Freeze > 0 {
+		record.frozenUntil = now.Add(time.Duration(limit.Freeze) * time.Second)
+		record.changes = nil
+	}
+	record.mu.Unlock()
+
+	name := record.config.CloudFlare.RecordName
+	problem := fmt.Sprintf("%s changed %d times within %d seconds, more than the %d expected",
+		name, count, limit.Window, limit.MaxChanges)
+	if limit.Freeze > 0 {
+		s.warnf("Warning: %s; freezing its writes for %d seconds", problem, limit.Freeze)
+	} else {
+		s.warnf("Warning: %s", problem)
+	}
+	s.notify(webhookEvent{Event: "change_rate_exceeded", Severity: "error", Record: name, Address: ip, Error: problem})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChangeLimit(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	clock := newFakeClock()
+	provider := memProvider{}
+	config := Config{
+		CloudFlare:  CloudFlareConfig{RecordName: "home.example.com"},
+		ChangeLimit: ChangeLimitConfig{MaxChanges: 2, Window: 3600, Freeze: 600},
+	}
+	alias := &DDNSService{config: config, provider: provider}
+	alias.config.CloudFlare.RecordName = "www.example.com"
+	service := &DDNSService{config: config, provider: provider, timeSource: clock, aliases: []*DDNSService{alias}}
+
+	// An old change has left the window by the time the limit is reached
+	for i := 1; i <= 4; i++ {
+		if err := service.publishAll(fmt.Sprintf("2001:db8::%d", i)); err != nil {
+			t.Fatalf("change %d: %v", i, err)
+		}
+		if i == 1 {
+			clock.Advance(time.Hour)
+		} else {
+			clock.Advance(time.Minute)
+		}
+	}
+	if !strings.Contains(buf.String(), "home.example.com changed 3 times within 3600 seconds, more than the 2 expected; freezing its writes for 600 seconds") ||
+		!strings.Contains(buf.String(), "www.example.com changed 3 times") {
+		t.Errorf("no warning about the change rate, log:\n%s", buf.String())
+	}
+
+	err := service.publishAll("2001:db8::5")
+	var frozen *frozenError
+	if !errors.As(err, &frozen) || !retryable(err) {
+		t.Fatalf("publishAll() while frozen = %v, want a retryable frozenError", err)
+	}
+	for _, key := range []string{"AAAA home.example.com", "AAAA www.example.com"} {
+		if got := provider[key].Content; got != "2001:db8::4" {
+			t.Errorf("%s = %s while frozen, want 2001:db8::4", key, got)
+		}
+	}
+
+	// Forced updates ignore the freeze, and it ends on its own
+	service.forced = true
+	if err := service.publishAll("2001:db8::5"); err != nil {
+		t.Errorf("forced publishAll() while frozen: %v", err)
+	}
+	service.forced = false
+	clock.Advance(10 * time.Minute)
+	if err := service.publishAll("2001:db8::6"); err != nil {
+		t.Errorf("publishAll() after the freeze: %v", err)
+	}
+}
+
+func TestChangeLimitWarnOnly(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	service := &DDNSService{
+		config: Config{
+			CloudFlare:  CloudFlareConfig{RecordName: "home.example.com"},
+			ChangeLimit: ChangeLimitConfig{MaxChanges: 1, Window: 3600},
+		},
+		provider:   memProvider{},
+		timeSource: newFakeClock(),
+	}
+	for i := 1; i <= 4; i++ {
+		if err := service.publishAll(fmt.Sprintf("2001:db8::%d", i)); err != nil {
+			t.Fatalf("change %d without freeze: %v", i, err)
+		}
+	}
+	if n := strings.Count(buf.String(), "changed 2 times"); n != 1 || strings.Contains(buf.String(), "freezing") {
+		t.Errorf("want one warning without a freeze, log:\n%s", buf.String())
+	}
+}
+
+func TestValidateChangeLimit(t *testing.T) {
+	tests := []struct {
+		limit   ChangeLimitConfig
+		wantErr bool
+	}{
+		{ChangeLimitConfig{}, false},
+		{ChangeLimitConfig{MaxChanges: 6, Window: 3600}, false},
+		{ChangeLimitConfig{MaxChanges: 6, Window: 3600, Freeze: 1800}, false},
+		{ChangeLimitConfig{MaxChanges: -1}, true},
+		{ChangeLimitConfig{Freeze: 1800}, true},
+	}
+	for _, tt := range tests {
+		if err := validateChangeLimit(tt.limit); (err != nil) != tt.wantErr {
+			t.Errorf("validateChangeLimit(%+v) = %v, want error %v", tt.limit, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// bundleFile is one file of a support bundle.
+type bundleFile struct {
+	Name string
+	Data []byte
+}
+
+// secretKeys are the config settings replaced in the bundled config.
+var secretKeys = map[string]bool{
+	"api_token":         true,
+	"token":             true,
+	"trigger_token":     true,
+	"secret":            true,
+	"secret_access_key": true,
+	"key_secret":        true,
+	"community":         true,
+	"password":          true,
+}
+
+// journalLines returns the service's most recent log lines. Replaced in
+// tests.
+var journalLines = func(service string, n int) ([]byte, error) {
+	return exec.Command("journalctl", "-u", service, "-n", strconv.Itoa(n), "--no-pager", "-o", "short-iso").CombinedOutput()
+}
+
+func runSupportBundle(args []string) error {
+	fs := flag.NewFlagSet("support-bundle", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/ipv6-ddns-cloudflare/config.yaml", "Path to configuration file")
+	output := fs.String("o", "", "Path of the bundle (default: ipv6-ddns-support-<time>.tar.gz)")
+	name := fs.String("name", defaultServiceName, "Name of the systemd service to include logs of")
+	logLines := fs.Int("log-lines", 500, "Number of recent log lines to include")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s support-bundle [flags]\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Collects the config with secrets removed, recent service logs, the interface")
+		fmt.Fprintln(fs.Output(), "addresses and the result of read-only checks of every job into a tarball to")
+		fmt.Fprintln(fs.Output(), "attach to bug reports. Review it before sharing; log lines are included as is.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	now := time.Now()
+	if *output == "" {
+		*output = "ipv6-ddns-support-" + now.Format("20060102-150405") + ".tar.gz"
+	}
+
+	files := collectSupportBundle(*configPath, *name, *logLines)
+	f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := writeSupportBundle(f, files, now); err != nil {
+		f.Close()
+		os.Remove(*output)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s\n", *output)
+	return nil
+}
+
+// collectSupportBundle gathers the bundle's files. Failures to collect
+// something are written into the bundle rather than returned, since a
+// broken setup is what the bundle is for.
+func collectSupportBundle(configPath, service string, logLines int) []bundleFile {
+	files := []bundleFile{{Name: "version.txt", Data: versionReport()}}
+
+	data, err := os.ReadFile(configPath)
+	if err == nil {
+		data, err = redactConfig(data)
+	}
+	if err != nil {
+		// The raw file may hold secrets, so it is left out
+		data = []byte(fmt.Sprintf("# config not included: %v\n", err))
+	}
+	files = append(files, bundleFile{Name: "config.yaml", Data: data})
+
+	files = append(files, bundleFile{Name: "addresses.txt", Data: addressReport()})
+	files = append(files, bundleFile{Name: "checks.txt", Data: checkReport(configPath)})
+
+	logs, err := journalLines(service, logLines)
+	if err != nil {
+		logs = append(logs, fmt.Sprintf("\nreading the journal of %s failed: %v\n", service, err)...)
+	}
+	files = append(files, bundleFile{Name: "journal.txt", Data: logs})
+	return files
+}
+
+func writeSupportBundle(w io.Writer, files []bundleFile, now time.Time) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	dir := "ipv6-ddns-support-" + now.Format("20060102-150405") + "/"
+	for _, file := range files {
+		hdr := &tar.Header{Name: dir + file.Name, Mode: 0600, Size: int64(len(file.Data)), ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(file.Data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// redactConfig replaces the values of secret settings and drops comments,
+// which often hold commented-out secrets.
+func redactConfig(data []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing config file: %w", err)
+	}
+	redactNode(&doc)
+	return yaml.Marshal(&doc)
+}
+
+func redactNode(n *yaml.Node) {
+	n.HeadComment, n.LineComment, n.FootComment = "", "", ""
+	if n.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			key.HeadComment, key.LineComment, key.FootComment = "", "", ""
+			if secretKeys[key.Value] && value.Kind == yaml.ScalarNode && value.Value != "" {
+				value.Value = "REDACTED"
+				value.Tag = "!!str"
+				value.Style = 0
+				value.LineComment = ""
+				continue
+			}
+			redactNode(value)
+		}
+		return
+	}
+	for _, child := range n.Content {
+		redactNode(child)
+	}
+}
+
+func versionReport() []byte {
+	var buf bytes.Buffer
+	version := "(unknown)"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		version = info.Main.Version
+	}
+	fmt.Fprintf(&buf, "ipv6-ddns-cloudflare %s\n", version)
+	fmt.Fprintf(&buf, "%s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return buf.Bytes()
+}
+
+// addressReport lists every interface with its addresses and whether the
+// updater would consider them.
+func addressReport() []byte {
+	var buf bytes.Buffer
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		fmt.Fprintf(&buf, "listing interfaces failed: %v\n", err)
+		return buf.Bytes()
+	}
+	for _, iface := range ifaces {
+		fmt.Fprintf(&buf, "%s (%s)\n", iface.Name, iface.Flags)
+		addrs, err := iface.Addrs()
+		if err != nil {
+			fmt.Fprintf(&buf, "  listing addresses failed: %v\n", err)
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			usable := ""
+			if ipnet.IP.To4() == nil && isValidPublicIPv6(ipnet.IP) {
+				usable = " public"
+			}
+			fmt.Fprintf(&buf, "  %s%s\n", ipnet, usable)
+		}
+	}
+	return buf.Bytes()
+}
+
+// checkReport validates the config and, for every enabled job, detects the
+// address and reads the record. Nothing is written.
+func checkReport(configPath string) []byte {
+	var buf bytes.Buffer
+	config, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(&buf, "config: %v\n", err)
+		return buf.Bytes()
+	}
+	if err := resolveAPITokens(&config); err != nil {
+		fmt.Fprintf(&buf, "config: invalid: %v\n", err)
+		return buf.Bytes()
+	}
+	if err := validateConfig(config); err != nil {
+		fmt.Fprintf(&buf, "config: invalid: %v\n", err)
+		return buf.Bytes()
+	}
+	fmt.Fprintln(&buf, "config: valid")
+
+	for _, job := range config.jobs() {
+		label := job.Name
+		if label == "" {
+			label = "(default)"
+		}
+		if !job.enabled() {
+			fmt.Fprintf(&buf, "job %s: disabled\n", label)
+			continue
+		}
+		s := newDDNSService(config, job)
+		fmt.Fprintf(&buf, "job %s: provider %s, interface %s\n", label, s.config.provider(), job.Interface)
+		if ip, err := s.detectAddress(); err != nil {
+			fmt.Fprintf(&buf, "  address: %v\n", err)
+		} else {
+			fmt.Fprintf(&buf, "  address: %s\n", ip)
+		}
+		for _, r := range append([]*DDNSService{s}, s.aliases...) {
+			name := r.config.CloudFlare.RecordName
+			record, err := r.provider.FetchRecord(r.typ(), name)
+			switch {
+			case err != nil:
+				fmt.Fprintf(&buf, "  record %s: %v\n", name, err)
+			case record == nil:
+				fmt.Fprintf(&buf, "  record %s: not found\n", name)
+			default:
+				fmt.Fprintf(&buf, "  record %s: %s %s ttl %d\n", name, record.Type, record.Content, record.TTL)
+			}
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactConfig(t *testing.T) {
+	config := `interface: eth0
+cloudflare:
+  api_token: "cf-secret" # the real one
+  zone_id: zone
+  # api_token: "old-secret"
+webhooks:
+  - url: https://hooks.example.com
+    secret: hook-secret
+http:
+  trigger_token: trigger-secret
+acme:
+  password: acme-secret
+`
+	got, err := redactConfig([]byte(config))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, secret := range []string{"cf-secret", "old-secret", "hook-secret", "trigger-secret", "acme-secret", "the real one"} {
+		if strings.Contains(string(got), secret) {
+			t.Errorf("redacted config still contains %q:\n%s", secret, got)
+		}
+	}
+	for _, kept := range []string{"interface: eth0", "zone_id: zone", "api_token: REDACTED", "url: https://hooks.example.com"} {
+		if !strings.Contains(string(got), kept) {
+			t.Errorf("redacted config lacks %q:\n%s", kept, got)
+		}
+	}
+
+	if _, err := redactConfig([]byte("{invalid")); err == nil {
+		t.Error("expected an error for invalid YAML")
+	}
+}
+
+func TestSupportBundle(t *testing.T) {
+	oldJournal := journalLines
+	defer func() { journalLines = oldJournal }()
+	journalLines = func(service string, n int) ([]byte, error) {
+		return []byte(fmt.Sprintf("%d lines of %s\n", n, service)), nil
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`jobs:
+  - name: home
+    enabled: false
+    cloudflare:
+      api_token: "cf-secret"
+`), 0600)
+
+	var buf bytes.Buffer
+	files := collectSupportBundle(path, "ddns", 50)
+	if err := writeSupportBundle(&buf, files, time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		contents[hdr.Name] = string(data)
+	}
+
+	dir := "ipv6-ddns-support-20250102-030405/"
+	for _, name := range []string{"version.txt", "config.yaml", "addresses.txt", "checks.txt", "journal.txt"} {
+		if _, ok := contents[dir+name]; !ok {
+			t.Errorf("bundle lacks %s; has %v", name, contents)
+		}
+	}
+	if c := contents[dir+"config.yaml"]; strings.Contains(c, "cf-secret") || !strings.Contains(c, "REDACTED") {
+		t.Errorf("config.yaml = %q", c)
+	}
+	if c := contents[dir+"checks.txt"]; c != "config: valid\njob home: disabled\n" {
+		t.Errorf("checks.txt = %q", c)
+	}
+	if c := contents[dir+"journal.txt"]; c != "50 lines of ddns\n" {
+		t.Errorf("journal.txt = %q", c)
+	}
+}
@@ -0,0 +1,243 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+)
+
+func runCheck(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/ipv6-ddns-cloudflare/config.yaml", "Path to configuration file")
+	profile := fs.String("profile", os.Getenv("IPV6_DDNS_PROFILE"), "Name of the profile to check (default from IPV6_DDNS_PROFILE)")
+	outputFormat := outputFlag(fs, "text", "json")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s check [flags]\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Checks that every enabled job can work before the daemon is started: the")
+		fmt.Fprintln(fs.Output(), "interface exists and has an address, the CloudFlare token is active, can")
+		fmt.Fprintln(fs.Output(), "access the zone and edit its DNS records, and the records can be read.")
+		fmt.Fprintln(fs.Output(), "No record is changed.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	output, err := outputFormat()
+	if err != nil {
+		return err
+	}
+
+	config, err := readConfig(*configPath, *profile, commandLine{})
+	if err != nil {
+		return err
+	}
+	p := &preflight{w: os.Stdout, baseURL: cloudflareAPI}
+	if output == "json" {
+		p.w = io.Discard
+	}
+	p.run(config)
+	if output == "json" {
+		if p.results == nil {
+			p.results = []checkResult{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(map[string]interface{}{"total": p.total, "failed": p.failed, "checks": p.results}); err != nil {
+			return err
+		}
+	}
+	if p.failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", p.failed, p.total)
+	}
+	if output == "text" {
+		fmt.Printf("All %d checks passed\n", p.total)
+	}
+	return nil
+}
+
+// checkResult is one check in the JSON report of the check command.
+type checkResult struct {
+	Job   string `json:"job"`
+	Check string `json:"check"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// preflight prints the outcome of every check of the check command.
+type preflight struct {
+	w       io.Writer
+	baseURL string // of the CloudFlare API
+
+	total, failed int
+	tokens        map[string]error
+
+	job     string // being checked, for results
+	results []checkResult
+}
+
+func (p *preflight) pass(format string, args ...interface{}) {
+	p.total++
+	check := fmt.Sprintf(format, args...)
+	p.results = append(p.results, checkResult{Job: p.job, Check: check, OK: true})
+	fmt.Fprintf(p.w, "  ok    %s\n", check)
+}
+
+func (p *preflight) fail(err error, format string, args ...interface{}) {
+	p.total++
+	p.failed++
+	check := fmt.Sprintf(format, args...)
+	p.results = append(p.results, checkResult{Job: p.job, Check: check, Error: err.Error()})
+	fmt.Fprintf(p.w, "  FAIL  %s: %v\n", check, err)
+}
+
+func (p *preflight) run(config Config) {
+	p.tokens = make(map[string]error)
+	for _, job := range config.jobs() {
+		label := job.Name
+		if label == "" {
+			label = "(default)"
+		}
+		if !job.enabled() {
+			fmt.Fprintf(p.w, "job %s: disabled, not checked\n", label)
+			continue
+		}
+		p.job = job.Name
+		s := newDDNSService(config, job)
+		fmt.Fprintf(p.w, "job %s: provider %s, interface %s\n", label, s.config.provider(), job.Interface)
+		p.checkJob(s)
+		if job.IPv4.Enabled {
+			p.checkAddress(newIPv4Service(config, job))
+		}
+	}
+}
+
+func (p *preflight) checkJob(s *DDNSService) {
+	if s.config.SNMP.Target == "" {
+		if _, err := net.InterfaceByName(s.config.Interface); err != nil {
+			p.fail(err, "interface %s", s.config.Interface)
+		} else {
+			p.pass("interface %s exists", s.config.Interface)
+		}
+	}
+	p.checkAddress(s)
+
+	if s.config.provider() == "cloudflare" {
+		zones := make(map[string]bool)
+		for _, r := range s.records() {
+			cf := r.config.CloudFlare
+			provider := newCloudFlareProvider(cf, s.httpClient)
+			provider.baseURL = p.baseURL
+			r.provider = provider
+			zoneID, err := provider.zone()
+			if err != nil {
+				p.fail(err, "finding the zone of %s", cf.RecordName)
+				continue
+			}
+			if cf.ZoneID == "" {
+				p.pass("zone %s of %s found", zoneID, cf.RecordName)
+			}
+			if !zones[zoneID+" "+cf.APIToken] {
+				zones[zoneID+" "+cf.APIToken] = true
+				p.checkCloudFlare(provider, cf.RecordName)
+			}
+		}
+	}
+
+	for _, r := range s.records() {
+		name := r.config.CloudFlare.RecordName
+		record, err := r.provider.FetchRecord(r.typ(), name)
+		switch {
+		case err != nil:
+			p.fail(err, "reading record %s", name)
+		case record == nil:
+			p.pass("record %s can be read; it doesn't exist yet and will be created", name)
+		default:
+			p.pass("record %s can be read: %s %s", name, record.Type, record.Content)
+		}
+	}
+}
+
+func (p *preflight) checkAddress(s *DDNSService) {
+	if ip, err := s.detectAddress(); err != nil {
+		p.fail(err, "detecting the %s address", s.family())
+	} else {
+		p.pass("%s address %s detected", s.family(), ip)
+	}
+}
+
+// CloudFlare error codes for a token that isn't allowed to do something.
+const (
+	cfAuthenticationError = 10000
+	cfUnauthorized        = 9109
+)
+
+// checkCloudFlare checks the token, the zone and the permission to edit
+// DNS records; name is a record of the job in the zone.
+func (p *preflight) checkCloudFlare(cf *cloudflareProvider, name string) {
+	err, checked := p.tokens[cf.token]
+	if !checked {
+		var token struct {
+			Status string `json:"status"`
+		}
+		err = cf.callAPI("GET", "/user/tokens/verify", nil, &token)
+		if err == nil && token.Status != "active" {
+			err = fmt.Errorf("the token is %s", token.Status)
+		}
+		p.tokens[cf.token] = err
+		if err != nil {
+			p.fail(err, "verifying the API token")
+		} else {
+			p.pass("API token is active")
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	var zone struct {
+		Name string `json:"name"`
+	}
+	if err := cf.call("GET", "", nil, &zone); err != nil {
+		p.fail(err, "accessing zone %s", cf.zoneID)
+		return
+	}
+	p.pass("zone %s (%s) is accessible", zone.Name, cf.zoneID)
+
+	// Creating a record with invalid content is rejected as unauthorized
+	// without edit permission and as invalid with it, and changes nothing
+	var created DNSRecord
+	err = cf.call("POST", "/dns_records", map[string]interface{}{
+		"type": "AAAA", "name": name, "content": "not-an-address", "ttl": 1,
+	}, &created)
+	var cfErr *cloudflareError
+	switch {
+	case err == nil:
+		p.fail(fmt.Errorf("a record with invalid content was accepted; delete record %s", created.ID),
+			"checking DNS edit permission in %s", zone.Name)
+	case errors.As(err, &cfErr) && cfErr.hasCode(cfAuthenticationError, cfUnauthorized):
+		p.fail(err, "the token may not edit DNS records in %s", zone.Name)
+	case errors.As(err, &cfErr):
+		p.pass("the token may edit DNS records in %s", zone.Name)
+	default:
+		p.fail(err, "checking DNS edit permission in %s", zone.Name)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPreflight(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		fail := func(code int, msg string) {
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "errors": []CFError{{Code: code, Message: msg}}})
+		}
+		switch {
+		case token == "expired":
+			fail(1000, "Invalid API Token")
+		case r.URL.Path == "/user/tokens/verify":
+			w.Write([]byte(`{"success": true, "result": {"status": "active"}}`))
+		case r.URL.Path == "/zones/other":
+			fail(7003, "Could not route to /zones/other, perhaps your object identifier is invalid?")
+		case r.URL.Path == "/zones/zone":
+			w.Write([]byte(`{"success": true, "result": {"name": "example.com"}}`))
+		case r.Method == "POST" && token == "read-only":
+			fail(10000, "Authentication error")
+		case r.Method == "POST":
+			fail(9005, "Content for AAAA record is invalid.")
+		case r.URL.Query().Get("name") == "home.example.com":
+			w.Write([]byte(`{"success": true, "result": [{"id": "rec", "type": "AAAA", "name": "home.example.com", "content": "2001:db8::1"}]}`))
+		default:
+			w.Write([]byte(`{"success": true, "result": []}`))
+		}
+	}))
+	defer server.Close()
+
+	var loopback string
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			loopback = iface.Name
+		}
+	}
+	if loopback == "" {
+		t.Skip("no loopback interface")
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		zone  string
+		want  []string
+	}{
+		{"all good", "token", "zone", []string{
+			"ok    interface " + loopback + " exists",
+			"ok    IPv6 address 2001:db8::2 detected",
+			"ok    API token is active",
+			"ok    zone example.com (zone) is accessible",
+			"ok    the token may edit DNS records in example.com",
+			"ok    record home.example.com can be read: AAAA 2001:db8::1",
+			"ok    record www.example.com can be read; it doesn't exist yet and will be created",
+		}},
+		{"expired token", "expired", "zone", []string{
+			"FAIL  verifying the API token: CloudFlare API error: Invalid API Token",
+		}},
+		{"wrong zone", "token", "other", []string{
+			"FAIL  accessing zone other: CloudFlare API error: Could not route",
+		}},
+		{"read-only token", "read-only", "zone", []string{
+			"FAIL  the token may not edit DNS records in example.com: CloudFlare API error: Authentication error",
+			"ok    record home.example.com can be read",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{Interface: loopback, CloudFlare: CloudFlareConfig{
+				APIToken: tt.token, ZoneID: tt.zone, RecordName: "home.example.com", Aliases: []string{"www.example.com"},
+			}}
+			s := newDDNSService(config, config.jobs()[0])
+			s.getIPv6 = func(string) (string, error) { return "2001:db8::2", nil }
+
+			var buf bytes.Buffer
+			p := &preflight{w: &buf, baseURL: server.URL, tokens: make(map[string]error)}
+			p.checkJob(s)
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("report lacks %q:\n%s", want, buf.String())
+				}
+			}
+			wantFailed := strings.Count(strings.Join(tt.want, "\n"), "FAIL")
+			if p.failed < wantFailed || wantFailed == 0 && p.failed != 0 {
+				t.Errorf("failed = %d, want %d", p.failed, wantFailed)
+			}
+			// -output json reports the same checks
+			failed := 0
+			for _, r := range p.results {
+				if !r.OK {
+					failed++
+					if r.Error == "" {
+						t.Errorf("failed check %q has no error", r.Check)
+					}
+				}
+			}
+			if len(p.results) != p.total || failed != p.failed {
+				t.Errorf("results = %+v, want %d checks with %d failed", p.results, p.total, p.failed)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import "time"
+
+// churnThreshold is how many times in a row the address may change before
+// the stability window settles it, before the link counts as unstable and
+// every further change doubles the window.
+const churnThreshold = 3
+
+// defaultMaxStabilityDelay caps the lengthened stability window, in seconds,
+// unless max_stability_delay is set.
+const defaultMaxStabilityDelay = 600
+
+func (s *DDNSService) maxStabilityDelay() int {
+	if s.config.MaxStabilityDelay == 0 {
+		return defaultMaxStabilityDelay
+	}
+	return s.config.MaxStabilityDelay
+}
+
+// stabilityDelayLocked returns the stability window for the next change:
+// stability_delay while the link is stable, or known_prefix_stability_delay
+// for a prefix seen before, doubled for every change beyond churnThreshold
+// up to max_stability_delay.
+func (s *DDNSService) stabilityDelayLocked() time.Duration {
+	if _, ok := s.knownPrefixLocked(); ok {
+		return time.Duration(s.config.KnownPrefixStabilityDelay) * time.Second
+	}
+	delay := time.Duration(s.config.StabilityDelay) * time.Second
+	limit := time.Duration(s.maxStabilityDelay()) * time.Second
+	for i := churnThreshold; i <= s.churn && delay < limit; i++ {
+		delay = min(delay*2, limit)
+	}
+	return delay
+}
+
+// churnLocked records that a pending address changed or reverted before the
+// stability window ran out. Once that happened churnThreshold times in a
+// row, the link is reported unstable, once, and later changes log quietly
+// until an address outlasts the window again.
+func (s *DDNSService) churnLocked(ip string) {
+	s.churn++
+	s.lastChurn = s.clock().Now()
+	if s.unstable || s.churn < churnThreshold {
+		return
+	}
+	s.unstable = true
+	s.warnf("Link unstable: address changed %d times within the stability window, lengthening it up to %d seconds",
+		s.churn, s.maxStabilityDelay())
+	s.notify(webhookEvent{Event: "link_unstable", Severity: "error", Address: ip, Previous: s.lastKnownIP})
+}
+
+// settleLocked resets the churn count once an address has outlasted the
+// stability window.
+func (s *DDNSService) settleLocked() {
+	if s.unstable {
+		s.logf("Link stable again after %d address changes, stability delay back to %d seconds",
+			s.churn, s.config.StabilityDelay)
+	}
+	s.churn = 0
+	s.unstable = false
+	s.lastChurn = time.Time{}
+}
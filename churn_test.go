@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestStabilityWindowUnderChurn(t *testing.T) {
+	clock := newFakeClock()
+	provider := &flakyProvider{memProvider: memProvider{}, clock: clock}
+	address := "2001:db8::1"
+	service := &DDNSService{
+		config: Config{
+			Interface:         "eth0",
+			StabilityDelay:    60,
+			MaxStabilityDelay: 300,
+			CloudFlare:        CloudFlareConfig{RecordName: "home.example.com"},
+		},
+		getIPv6:    func(string) (string, error) { return address, nil },
+		provider:   provider,
+		timeSource: clock,
+	}
+
+	// A new address every 30 seconds never outlasts the window; from the
+	// third change on, every change doubles it up to the cap
+	want := []time.Duration{60, 60, 60, 120, 240, 300, 300}
+	for i, delay := range want {
+		address = fmt.Sprintf("2001:db8::%d", i+1)
+		service.checkAndUpdate()
+		if service.stabilityDelay != delay*time.Second {
+			t.Errorf("change %d: stability delay = %s, want %ds", i, service.stabilityDelay, delay)
+		}
+		if unstable := i >= churnThreshold; service.unstable != unstable {
+			t.Errorf("change %d: unstable = %v, want %v", i, service.unstable, unstable)
+		}
+		clock.Advance(30 * time.Second)
+	}
+	if len(provider.writes) != 0 {
+		t.Fatalf("updated DNS %d times while the address kept changing", len(provider.writes))
+	}
+
+	// The last address outlasts the lengthened window and is published
+	clock.Advance(269 * time.Second)
+	if len(provider.writes) != 0 {
+		t.Fatal("updated DNS before the lengthened window ran out")
+	}
+	clock.Advance(time.Second)
+	if len(provider.writes) != 1 {
+		t.Fatalf("updated DNS %d times, want once", len(provider.writes))
+	}
+	if service.unstable || service.churn != 0 {
+		t.Errorf("unstable = %v, churn = %d after the address settled", service.unstable, service.churn)
+	}
+
+	// The next change waits stability_delay again
+	address = "2001:db8::99"
+	service.checkAndUpdate()
+	if service.stabilityDelay != 60*time.Second {
+		t.Errorf("stability delay = %s after settling, want 60s", service.stabilityDelay)
+	}
+}
+
+func TestStabilityDelayCap(t *testing.T) {
+	tests := []struct {
+		delay, max, churn int
+		want              time.Duration
+	}{
+		{60, 0, 2, 60 * time.Second},
+		{60, 0, 3, 120 * time.Second},
+		{60, 0, 10, defaultMaxStabilityDelay * time.Second},
+		{60, 100, 3, 100 * time.Second},
+		// stability_delay above the cap is never lengthened nor shortened
+		{900, 300, 5, 900 * time.Second},
+	}
+	for _, tt := range tests {
+		s := &DDNSService{config: Config{StabilityDelay: tt.delay, MaxStabilityDelay: tt.max}, churn: tt.churn}
+		if got := s.stabilityDelayLocked(); got != tt.want {
+			t.Errorf("delay %d, max %d, churn %d: got %s, want %s", tt.delay, tt.max, tt.churn, got, tt.want)
+		}
+	}
+}
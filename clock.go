@@ -0,0 +1,99 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import "time"
+
+// Clock is the source of time for the update engine: the poll and verify
+// tickers, the stability timer, retry backoff and the timestamps kept for
+// error summaries and leases. Tests substitute a fake clock to step through
+// timing behaviour deterministically, and simulate runs scenarios faster
+// than real time with a scaledClock.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Ticker delivers ticks on C until stopped.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Timer is a pending AfterFunc call.
+type Timer interface {
+	Stop() bool
+}
+
+// realClock is the wall clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTicker(d time.Duration) Ticker { return realTicker{time.NewTicker(d)} }
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+
+type realTicker struct{ t *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.t.C }
+func (t realTicker) Stop()               { t.t.Stop() }
+
+// scaledClock runs speed times faster than the wall clock, counting from
+// start. Durations are divided by speed before they reach the real timers,
+// so a 30s poll interval at speed 10 ticks every 3s.
+type scaledClock struct {
+	start time.Time
+	speed float64
+}
+
+// newScaledClock starts a scaledClock now. A speed of 0 runs in real time.
+func newScaledClock(speed float64) scaledClock {
+	if speed <= 0 {
+		speed = 1
+	}
+	return scaledClock{start: time.Now(), speed: speed}
+}
+
+func (c scaledClock) Now() time.Time {
+	return c.start.Add(time.Duration(float64(time.Since(c.start)) * c.speed))
+}
+
+func (c scaledClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(c.scale(d))}
+}
+
+func (c scaledClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(c.scale(d), f)
+}
+
+func (c scaledClock) scale(d time.Duration) time.Duration {
+	if d = time.Duration(float64(d) / c.speed); d <= 0 {
+		d = 1
+	}
+	return d
+}
+
+// clock returns the service's clock, the wall clock unless a test or
+// simulation set its own.
+func (s *DDNSService) clock() Clock {
+	if s.timeSource == nil {
+		return realClock{}
+	}
+	return s.timeSource
+}
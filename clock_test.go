@@ -0,0 +1,273 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves when advanced. Timers and tickers that come due
+// fire in order from Advance, on the caller's goroutine.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock  *fakeClock
+	at     time.Time
+	period time.Duration // tickers only
+	f      func()
+	c      chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	return c.add(&fakeTimer{clock: c, at: c.Now().Add(d), f: f})
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) Ticker {
+	return fakeTicker{c.add(&fakeTimer{clock: c, at: c.Now().Add(d), period: d, c: make(chan time.Time, 1)})}
+}
+
+func (c *fakeClock) add(t *fakeTimer) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward by d, firing everything due on the way.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	for {
+		sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].at.Before(c.timers[j].at) })
+		if len(c.timers) == 0 || c.timers[0].at.After(end) {
+			break
+		}
+		t := c.timers[0]
+		c.now = t.at
+		if t.period > 0 {
+			t.at = t.at.Add(t.period)
+			select {
+			case t.c <- c.now:
+			default:
+			}
+			continue
+		}
+		c.timers = c.timers[1:]
+		c.mu.Unlock()
+		t.f()
+		c.mu.Lock()
+	}
+	c.now = end
+	c.mu.Unlock()
+}
+
+// Pending returns how many timers and tickers are waiting to fire.
+func (c *fakeClock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	for i, other := range t.clock.timers {
+		if other == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTicker struct{ t *fakeTimer }
+
+func (t fakeTicker) C() <-chan time.Time { return t.t.c }
+func (t fakeTicker) Stop()               { t.t.Stop() }
+
+// flakyProvider fails the first failures writes.
+type flakyProvider struct {
+	memProvider
+	failures int
+	writes   []time.Time
+	clock    Clock
+}
+
+func (p *flakyProvider) UpdateRecord(record DNSRecord) (DNSRecord, error) {
+	return p.CreateRecord(record)
+}
+
+func (p *flakyProvider) CreateRecord(record DNSRecord) (DNSRecord, error) {
+	p.writes = append(p.writes, p.clock.Now())
+	if len(p.writes) <= p.failures {
+		return DNSRecord{}, errors.New("simulated outage")
+	}
+	return p.memProvider.CreateRecord(record)
+}
+
+func TestFakeClockTiming(t *testing.T) {
+	origInitial, origMax := retryInitialDelay, retryMaxDelay
+	retryInitialDelay, retryMaxDelay = 10*time.Second, 30*time.Second
+	defer func() { retryInitialDelay, retryMaxDelay = origInitial, origMax }()
+
+	clock := newFakeClock()
+	start := clock.Now()
+	provider := &flakyProvider{memProvider: memProvider{}, failures: 3, clock: clock}
+	address := "2001:db8::1"
+	service := &DDNSService{
+		config: Config{
+			Interface:      "eth0",
+			StabilityDelay: 60,
+			CloudFlare:     CloudFlareConfig{RecordName: "home.example.com"},
+		},
+		getIPv6:    func(string) (string, error) { return address, nil },
+		provider:   provider,
+		timeSource: clock,
+	}
+
+	service.checkAndUpdate()
+	clock.Advance(59 * time.Second)
+	if len(provider.writes) != 0 {
+		t.Fatalf("updated %s before the stability delay", provider.writes[0].Sub(start))
+	}
+
+	// A change within the window restarts it from the time of the change
+	address = "2001:db8::2"
+	service.checkAndUpdate()
+	clock.Advance(2 * time.Second)
+	if len(provider.writes) != 0 {
+		t.Fatalf("updated %s after start despite the restart", provider.writes[0].Sub(start))
+	}
+
+	// Three failures back off 10s, 20s, then the 30s cap
+	clock.Advance(10 * time.Minute)
+	var got []time.Duration
+	for _, at := range provider.writes {
+		got = append(got, at.Sub(start))
+	}
+	want := []time.Duration{119 * time.Second, 129 * time.Second, 149 * time.Second, 179 * time.Second}
+	if len(got) != len(want) {
+		t.Fatalf("writes at %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("writes at %v, want %v", got, want)
+			break
+		}
+	}
+
+	if rec := provider.memProvider["AAAA home.example.com"]; rec.Content != "2001:db8::2" {
+		t.Errorf("record content = %q, want 2001:db8::2", rec.Content)
+	}
+	if service.retryDelay != 0 || clock.Pending() != 0 {
+		t.Errorf("retryDelay = %s with %d timers pending after success", service.retryDelay, clock.Pending())
+	}
+}
+
+func TestJobRetryDelays(t *testing.T) {
+	clock := newFakeClock()
+	start := clock.Now()
+	provider := &flakyProvider{memProvider: memProvider{}, failures: 4, clock: clock}
+	service := &DDNSService{
+		config: Config{
+			Interface:      "wwan0",
+			StabilityDelay: 5,
+			CloudFlare:     CloudFlareConfig{RecordName: "lte.example.com"},
+			Retry:          RetryConfig{InitialDelay: 2, MaxDelay: 5},
+		},
+		getIPv6:    func(string) (string, error) { return "2001:db8::1", nil },
+		provider:   provider,
+		timeSource: clock,
+	}
+
+	service.checkAndUpdate()
+	clock.Advance(time.Minute)
+
+	// The job's own backoff: 2s, 4s, then its 5s cap
+	var got []time.Duration
+	for _, at := range provider.writes {
+		got = append(got, at.Sub(start))
+	}
+	want := []time.Duration{5 * time.Second, 7 * time.Second, 11 * time.Second, 16 * time.Second, 21 * time.Second}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("writes at %v, want %v", got, want)
+	}
+}
+
+func TestRetryDetectionError(t *testing.T) {
+	origInitial, origMax := retryInitialDelay, retryMaxDelay
+	retryInitialDelay, retryMaxDelay = 10*time.Second, 30*time.Second
+	defer func() { retryInitialDelay, retryMaxDelay = origInitial, origMax }()
+
+	clock := newFakeClock()
+	provider := &flakyProvider{memProvider: memProvider{}, failures: 1, clock: clock}
+	var detectErr error
+	service := &DDNSService{
+		config: Config{
+			Interface:      "eth0",
+			StabilityDelay: 60,
+			CloudFlare:     CloudFlareConfig{RecordName: "home.example.com"},
+		},
+		getIPv6:    func(string) (string, error) { return "2001:db8::1", detectErr },
+		provider:   provider,
+		timeSource: clock,
+	}
+
+	// The first update fails, and detection fails when the retry is due
+	service.checkAndUpdate()
+	clock.Advance(60 * time.Second)
+	if len(provider.writes) != 1 {
+		t.Fatalf("%d writes after the stability delay, want 1", len(provider.writes))
+	}
+	detectErr = fmt.Errorf("interface eth0 is down")
+	clock.Advance(10 * time.Second)
+
+	service.mu.Lock()
+	pending := service.pendingIP
+	service.mu.Unlock()
+	if pending != "2001:db8::1" || clock.Pending() != 1 {
+		t.Fatalf("pendingIP = %q with %d timers after a detection error, want the address kept and a retry", pending, clock.Pending())
+	}
+
+	detectErr = nil
+	clock.Advance(20 * time.Second)
+	if rec := provider.memProvider["AAAA home.example.com"]; rec.Content != "2001:db8::1" {
+		t.Errorf("record content = %q after the retry, want 2001:db8::1", rec.Content)
+	}
+}
+
+func TestScaledClock(t *testing.T) {
+	clock := newScaledClock(1000)
+	if d := clock.scale(30 * time.Second); d != 30*time.Millisecond {
+		t.Errorf("scale(30s) = %s, want 30ms", d)
+	}
+
+	fired := make(chan time.Time, 1)
+	clock.AfterFunc(5*time.Second, func() { fired <- clock.Now() })
+	select {
+	case at := <-fired:
+		if elapsed := at.Sub(clock.start); elapsed < 5*time.Second {
+			t.Errorf("timer fired at %s on the scaled clock, want at least 5s", elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timer did not fire within a second of real time")
+	}
+}
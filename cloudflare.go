@@ -0,0 +1,303 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// cloudflareAPI is the base URL of the CloudFlare v4 API.
+const cloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+type CloudFlareResponse struct {
+	Success bool        `json:"success"`
+	Errors  []CFError   `json:"errors"`
+	Result  interface{} `json:"result"`
+}
+
+type CFError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// planLimitError is a CloudFlare rejection caused by the zone's plan or
+// quota. Retrying cannot fix it, so the update is held until the address
+// changes again instead of being retried with backoff.
+type planLimitError struct {
+	CFError
+	hint string
+}
+
+func (e *planLimitError) Error() string {
+	return fmt.Sprintf("CloudFlare plan limit: %s (code %d); %s", e.Message, e.Code, e.hint)
+}
+
+// planLimitHints maps known plan and quota error codes to what the user
+// can do about them.
+var planLimitHints = map[int]string{
+	81045: "delete unused records in the zone or upgrade its plan",
+}
+
+// planLimitWords are matched, as whole words, against the messages of
+// errors whose code isn't in planLimitHints, for plan errors CloudFlare
+// adds or reports under a generic code.
+var planLimitWords = regexp.MustCompile(`(?i)\b(quotas?|plan)\b`)
+
+// planLimit returns a planLimitError for the first plan or quota error in
+// errs, or nil if there is none. The error codes are checked first, for
+// all errs, and the messages only when no code matches.
+func planLimit(errs []CFError) error {
+	for _, e := range errs {
+		if hint, ok := planLimitHints[e.Code]; ok {
+			return &planLimitError{CFError: e, hint: hint}
+		}
+	}
+	for _, e := range errs {
+		if planLimitWords.MatchString(e.Message) {
+			return &planLimitError{CFError: e, hint: "check the zone's plan and quotas in the CloudFlare dashboard"}
+		}
+	}
+	return nil
+}
+
+// cloudflareProvider manages records in one CloudFlare zone.
+type cloudflareProvider struct {
+	client  *http.Client
+	baseURL string
+	token   string
+
+	// zoneID is looked up from recordName when the config leaves it out;
+	// see zone.
+	zoneMu     sync.Mutex
+	zoneID     string
+	recordName string
+}
+
+func newCloudFlareProvider(cf CloudFlareConfig, client *http.Client) *cloudflareProvider {
+	return &cloudflareProvider{client: client, baseURL: cloudflareAPI, zoneID: cf.ZoneID, recordName: cf.RecordName, token: cf.APIToken}
+}
+
+// Capabilities of CloudFlare: TTLs go down to 30 seconds on Enterprise
+// plans, 1 means automatic.
+func (p *cloudflareProvider) Capabilities() Capabilities {
+	return Capabilities{Comments: true, Proxied: true, MinTTL: 30, AutoTTL: 1}
+}
+
+func (p *cloudflareProvider) FetchRecord(recordType, name string) (*DNSRecord, error) {
+	records, err := p.listRecords(recordType, name)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return &records[0], nil
+}
+
+// cloudflarePageSize is the number of records asked for per page when
+// listing records.
+const cloudflarePageSize = 100
+
+// listRecords returns all records of the given type and name, following
+// pages. An empty type or name matches any.
+func (p *cloudflareProvider) listRecords(recordType, name string) ([]DNSRecord, error) {
+	query := url.Values{"per_page": {strconv.Itoa(cloudflarePageSize)}}
+	if recordType != "" {
+		query.Set("type", recordType)
+	}
+	if name != "" {
+		query.Set("name", name)
+	}
+
+	zoneID, err := p.zone()
+	if err != nil {
+		return nil, err
+	}
+	var records []DNSRecord
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		var result []DNSRecord
+		var info resultInfo
+		if err := p.send("GET", "/zones/"+zoneID+"/dns_records?"+query.Encode(), nil, &result, &info); err != nil {
+			return nil, err
+		}
+		records = append(records, result...)
+		// Stop at an empty page too, so a response without result_info
+		// can't keep us asking for more
+		if page >= info.TotalPages || len(result) == 0 {
+			return records, nil
+		}
+	}
+}
+
+func (p *cloudflareProvider) CreateRecord(record DNSRecord) (DNSRecord, error) {
+	var created DNSRecord
+	err := p.call("POST", "/dns_records", recordBody(record), &created)
+	return created, err
+}
+
+func (p *cloudflareProvider) UpdateRecord(record DNSRecord) (DNSRecord, error) {
+	var updated DNSRecord
+	err := p.call("PUT", "/dns_records/"+url.PathEscape(record.ID), recordBody(record), &updated)
+	var cfErr *cloudflareError
+	if errors.As(err, &cfErr) && cfErr.hasCode(cloudflareNotFoundCodes...) {
+		return updated, fmt.Errorf("%w: %v", errRecordNotFound, err)
+	}
+	return updated, err
+}
+
+// cloudflareNotFoundCodes are the errors for a record ID that doesn't
+// exist: "Record does not exist" and "Could not route to ..., perhaps your
+// object identifier is invalid?".
+var cloudflareNotFoundCodes = []int{81044, 7003}
+
+// deleteRecord deletes the record with the given ID.
+func (p *cloudflareProvider) deleteRecord(id string) error {
+	return p.call("DELETE", "/dns_records/"+url.PathEscape(id), nil, nil)
+}
+
+// recordBody is the request body for writing record. The comment is only
+// sent when set, so comments written by hand survive updates.
+func recordBody(record DNSRecord) map[string]interface{} {
+	body := map[string]interface{}{
+		"type":    record.Type,
+		"name":    record.Name,
+		"content": record.Content,
+		"ttl":     record.TTL,
+		"proxied": record.Proxied,
+	}
+	if record.Comment != "" {
+		body["comment"] = record.Comment
+	}
+	return body
+}
+
+// cloudflareError is an unsuccessful CloudFlare API response.
+type cloudflareError struct {
+	errors []CFError
+}
+
+func (e *cloudflareError) Error() string {
+	var msgs []string
+	for _, err := range e.errors {
+		msgs = append(msgs, err.Message)
+	}
+	return fmt.Sprintf("CloudFlare API error: %s", strings.Join(msgs, ", "))
+}
+
+// hasCode reports whether the response contains an error with one of codes.
+func (e *cloudflareError) hasCode(codes ...int) bool {
+	for _, err := range e.errors {
+		for _, code := range codes {
+			if err.Code == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// call sends a request for path below the zone and decodes the result of a
+// successful response into result.
+func (p *cloudflareProvider) call(method, path string, payload, result interface{}) error {
+	zoneID, err := p.zone()
+	if err != nil {
+		return err
+	}
+	return p.callAPI(method, "/zones/"+zoneID+path, payload, result)
+}
+
+// callAPI is call for any path of the API.
+func (p *cloudflareProvider) callAPI(method, path string, payload, result interface{}) error {
+	return p.send(method, path, payload, result, nil)
+}
+
+// resultInfo is the pagination of a CloudFlare list response.
+type resultInfo struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	TotalPages int `json:"total_pages"`
+	TotalCount int `json:"total_count"`
+}
+
+// send is callAPI that also decodes the response's result_info into info,
+// if not nil.
+func (p *cloudflareProvider) send(method, path string, payload, result interface{}, info *resultInfo) error {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, p.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+
+	var cfResp struct {
+		Success    bool            `json:"success"`
+		Errors     []CFError       `json:"errors"`
+		Result     json.RawMessage `json:"result"`
+		ResultInfo *resultInfo     `json:"result_info"`
+	}
+
+	if err := json.Unmarshal(respBody, &cfResp); err != nil {
+		return fmt.Errorf("parsing response: %w", err)
+	}
+
+	if !cfResp.Success {
+		if err := planLimit(cfResp.Errors); err != nil {
+			return err
+		}
+		return &cloudflareError{errors: cfResp.Errors}
+	}
+
+	if info != nil && cfResp.ResultInfo != nil {
+		*info = *cfResp.ResultInfo
+	}
+	if result == nil || len(cfResp.Result) == 0 || string(cfResp.Result) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(cfResp.Result, result); err != nil {
+		return fmt.Errorf("parsing response: %w", err)
+	}
+	return nil
+}
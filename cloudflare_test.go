@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCloudFlareProvider(t *testing.T) {
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer token" {
+			t.Errorf("unexpected auth header %q", auth)
+		}
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/zones/zone/dns_records":
+			if r.URL.Query().Get("name") == "missing.example.com" {
+				w.Write([]byte(`{"success": true, "result": []}`))
+				return
+			}
+			w.Write([]byte(`{"success": true, "result": [{"id": "rec-1", "type": "AAAA", "content": "2001:db8::1"}]}`))
+		case r.Method == "POST" && r.URL.Path == "/zones/zone/dns_records",
+			r.Method == "PUT" && r.URL.Path == "/zones/zone/dns_records/rec-1":
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			bodies = append(bodies, body)
+			w.Write([]byte(`{"success": true, "result": {"id": "rec-1"}}`))
+		case r.Method == "PUT" && r.URL.EscapedPath() == "/zones/zone/dns_records/rec%2F..%2F2":
+			w.Write([]byte(`{"success": true, "result": {"id": "rec/../2"}}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	}))
+	defer server.Close()
+
+	p := newCloudFlareProvider(CloudFlareConfig{APIToken: "token", ZoneID: "zone"}, server.Client())
+	p.baseURL = server.URL
+
+	record, err := p.FetchRecord("AAAA", "home.example.com")
+	if err != nil || record == nil || record.ID != "rec-1" || record.Content != "2001:db8::1" {
+		t.Errorf("FetchRecord() = %+v, %v", record, err)
+	}
+	record, err = p.FetchRecord("AAAA", "missing.example.com")
+	if err != nil || record != nil {
+		t.Errorf("FetchRecord() of missing record = %+v, %v, want nil", record, err)
+	}
+
+	created, err := p.CreateRecord(DNSRecord{Type: "AAAA", Name: "home.example.com", Content: "2001:db8::2", TTL: 1})
+	if err != nil || created.ID != "rec-1" {
+		t.Errorf("CreateRecord() = %+v, %v", created, err)
+	}
+	_, err = p.UpdateRecord(DNSRecord{ID: "rec-1", Type: "AAAA", Name: "home.example.com", Content: "2001:db8::3", TTL: 1, Comment: "note"})
+	if err != nil {
+		t.Errorf("UpdateRecord() failed: %v", err)
+	}
+
+	// The ID stays one path segment, whatever it holds
+	if _, err := p.UpdateRecord(DNSRecord{ID: "rec/../2", Type: "AAAA", Name: "home.example.com", Content: "2001:db8::3"}); err != nil {
+		t.Errorf("UpdateRecord() of an ID with slashes failed: %v", err)
+	}
+
+	if len(bodies) != 2 {
+		t.Fatalf("got %d writes, want 2", len(bodies))
+	}
+	// A comment is only sent when set, so hand-written comments survive
+	if _, ok := bodies[0]["comment"]; ok {
+		t.Errorf("create sent a comment: %v", bodies[0])
+	}
+	if bodies[1]["comment"] != "note" || bodies[1]["content"] != "2001:db8::3" {
+		t.Errorf("update sent %v", bodies[1])
+	}
+}
+
+func TestCloudFlareListRecordsPages(t *testing.T) {
+	pages := [][]DNSRecord{
+		{{ID: "1", Content: "2001:db8::1"}, {ID: "2", Content: "2001:db8::2"}},
+		{{ID: "3", Content: "2001:db8::3"}},
+	}
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("type") != "AAAA" || q.Get("name") != "home.example.com" || q.Get("per_page") != "100" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		requested = append(requested, q.Get("page"))
+		var page int
+		fmt.Sscan(q.Get("page"), &page)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":     true,
+			"result":      pages[page-1],
+			"result_info": map[string]int{"page": page, "per_page": 100, "total_pages": len(pages), "total_count": 3},
+		})
+	}))
+	defer server.Close()
+
+	p := newCloudFlareProvider(CloudFlareConfig{APIToken: "token", ZoneID: "zone"}, server.Client())
+	p.baseURL = server.URL
+
+	records, err := p.listRecords("AAAA", "home.example.com")
+	if err != nil {
+		t.Fatalf("listRecords() failed: %v", err)
+	}
+	if len(records) != 3 || records[2].ID != "3" {
+		t.Errorf("listRecords() = %+v, want all 3 records", records)
+	}
+	if strings.Join(requested, ",") != "1,2" {
+		t.Errorf("requested pages %v, want 1,2", requested)
+	}
+}
@@ -0,0 +1,101 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// expandEnv replaces ${VAR} and ${VAR:-default} in the values of a parsed
+// config with the environment variable, or default when it is unset or
+// empty; $${ stands for a literal ${. Keys and comments are left alone, and
+// a value can't add YAML structure. Unquoted values are typed again after
+// expanding, so poll_interval: ${POLL} is a number.
+func expandEnv(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode && strings.Contains(n.Value, "${") {
+		value, err := expandEnvString(n.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		n.Value = value
+		if n.Style == 0 {
+			n.Tag = ""
+		}
+	}
+	for i, child := range n.Content {
+		// Mapping keys are every other node
+		if n.Kind == yaml.MappingNode && i%2 == 0 {
+			continue
+		}
+		if err := expandEnv(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expandEnvString expands the variable references in s.
+func expandEnvString(s string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1] + "${")
+			s = s[i+2:]
+			continue
+		}
+		b.WriteString(s[:i])
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated ${ in %q", s[i:])
+		}
+		ref := s[i+2 : i+end]
+		name, def, hasDefault := strings.Cut(ref, ":-")
+		if !isEnvName(name) {
+			return "", fmt.Errorf("invalid variable reference ${%s}; write $${ for a literal ${", ref)
+		}
+		value := os.Getenv(name)
+		if value == "" && hasDefault {
+			value = def
+		} else if _, ok := os.LookupEnv(name); !ok {
+			return "", fmt.Errorf("environment variable %s is not set; give a default with ${%s:-...}", name, name)
+		}
+		b.WriteString(value)
+		s = s[i+end+1:]
+	}
+}
+
+// isEnvName reports whether name is a valid environment variable name.
+func isEnvName(name string) bool {
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return false
+	}
+	for _, c := range name {
+		if !(c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandEnvString(t *testing.T) {
+	t.Setenv("DDNS_TEST_IF", "eth0")
+	t.Setenv("DDNS_TEST_EMPTY", "")
+
+	tests := []struct {
+		in      string
+		want    string
+		wantErr string
+	}{
+		{in: "${DDNS_TEST_IF}", want: "eth0"},
+		{in: "wan-${DDNS_TEST_IF}.example.com", want: "wan-eth0.example.com"},
+		{in: "${DDNS_TEST_EMPTY}", want: ""},
+		{in: "${DDNS_TEST_EMPTY:-eth1}", want: "eth1"},
+		{in: "${DDNS_TEST_UNSET:-eth1}", want: "eth1"},
+		{in: "${DDNS_TEST_IF:-eth1}", want: "eth0"},
+		{in: "$${DDNS_TEST_IF}", want: "${DDNS_TEST_IF}"},
+		{in: "$DDNS_TEST_IF", want: "$DDNS_TEST_IF"},
+		{in: "${DDNS_TEST_UNSET}", wantErr: "DDNS_TEST_UNSET is not set"},
+		{in: "${DDNS_TEST_IF", wantErr: "unterminated"},
+		{in: "${1X}", wantErr: "invalid variable reference"},
+	}
+	for _, tt := range tests {
+		got, err := expandEnvString(tt.in)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expandEnvString(%q) error = %v, want %q", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("expandEnvString(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigEnv(t *testing.T) {
+	t.Setenv("DDNS_TEST_IF", "eth0")
+	t.Setenv("DDNS_TEST_POLL", "60")
+	t.Setenv("DDNS_TEST_TOKEN", "token: with a colon")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	content := `# ${DDNS_TEST_UNSET} in a comment is left alone
+interface: ${DDNS_TEST_IF}
+poll_interval: ${DDNS_TEST_POLL}
+cloudflare:
+  api_token: ${DDNS_TEST_TOKEN}
+  record_name: "${DDNS_TEST_HOST:-home}.example.com"
+`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig() failed: %v", err)
+	}
+	if config.Interface != "eth0" || config.PollInterval != 60 ||
+		config.CloudFlare.APIToken != "token: with a colon" || config.CloudFlare.RecordName != "home.example.com" {
+		t.Errorf("config = %+v", config)
+	}
+
+	if err := os.WriteFile(path, []byte("interface: eth0\npoll_interval: ${DDNS_TEST_UNSET}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(path); err == nil || !strings.Contains(err.Error(), "line 2: environment variable DDNS_TEST_UNSET is not set") {
+		t.Errorf("loadConfig() with an unset variable: %v", err)
+	}
+
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(path); err != nil {
+		t.Errorf("loadConfig() of an empty file: %v", err)
+	}
+}
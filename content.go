@@ -0,0 +1,206 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"text/template"
+)
+
+// contentFuncs are the only functions available in record content
+// templates. They take the address last, so they can be used in pipelines
+// such as {{ .IP | host 64 "::10" }}.
+var contentFuncs = template.FuncMap{
+	"prefix":    prefixFunc,
+	"host":      hostFunc,
+	"translate": translateFunc,
+}
+
+// contentData is what a record content template can refer to.
+type contentData struct {
+	IP   string
+	Name string
+}
+
+// sampleAddress is rendered when the config is checked, so templates that
+// fail or produce an invalid value are reported at startup.
+const sampleAddress = "2001:db8:1:2:3:4:5:6"
+
+// parseContent parses a record content template.
+func parseContent(field, text string) (*template.Template, error) {
+	tmpl, err := template.New(field).Funcs(contentFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", field, err)
+	}
+	return tmpl, nil
+}
+
+// plain reports whether the record holds the detected address as is, so
+// it can stand in for record_name.
+func (r RecordConfig) plain() bool {
+	return r.Content == "" && (r.Type == "" || r.Type == "AAAA")
+}
+
+// validateContent checks the type and content template of a record.
+func validateContent(field string, record RecordConfig) error {
+	switch record.Type {
+	case "", "AAAA":
+	case "TXT":
+		if record.Content == "" {
+			return fmt.Errorf("%s: content is required for TXT records", field)
+		}
+		if record.Proxied != nil && *record.Proxied {
+			return fmt.Errorf("%s: TXT records cannot be proxied", field)
+		}
+	default:
+		return fmt.Errorf("%s: type must be AAAA or TXT, not %q", field, record.Type)
+	}
+	if record.Content == "" {
+		return nil
+	}
+	tmpl, err := parseContent(field+".content", record.Content)
+	if err != nil {
+		return err
+	}
+	value, err := renderContent(tmpl, record.Type, sampleAddress, record.Name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", field, err)
+	}
+	if value == "" {
+		return fmt.Errorf("%s: content renders to an empty value", field)
+	}
+	return nil
+}
+
+// renderContent executes a content template for ip. AAAA records must
+// come out as a canonical address.
+func renderContent(tmpl *template.Template, recordType, ip, name string) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, contentData{IP: ip, Name: name}); err != nil {
+		return "", fmt.Errorf("rendering content: %w", err)
+	}
+	value := b.String()
+	if recordType != "TXT" {
+		value = strings.TrimSpace(value)
+		if addr, err := canonicalAddress(value); err != nil || addr != value {
+			return "", fmt.Errorf("content %q is not an IPv6 address", value)
+		}
+	}
+	return value, nil
+}
+
+// value returns what the record should hold for the detected address ip:
+// ip itself, unless the record has a content template.
+func (s *DDNSService) value(ip string) (string, error) {
+	if s.contentTemplate == nil {
+		return ip, nil
+	}
+	return renderContent(s.contentTemplate, s.typ(), ip, s.config.CloudFlare.RecordName)
+}
+
+// recordValue returns the content of a record as written, without the
+// quotes some providers put around TXT values.
+func recordValue(recordType, content string) string {
+	if recordType == "TXT" {
+		return unquoteTXT(content)
+	}
+	return remoteAddress(content)
+}
+
+// quoteTXT puts a TXT value in quotes for providers that take TXT records
+// in zone file syntax.
+func quoteTXT(value string) string {
+	if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// unquoteTXT reverses quoteTXT.
+func unquoteTXT(content string) string {
+	if len(content) < 2 || !strings.HasPrefix(content, `"`) || !strings.HasSuffix(content, `"`) {
+		return content
+	}
+	return strings.NewReplacer(`\\`, `\`, `\"`, `"`).Replace(content[1 : len(content)-1])
+}
+
+// parseIPv6 parses an IPv6 address for the content functions.
+func parseIPv6(s string) (net.IP, error) {
+	ip := net.ParseIP(s)
+	if ip == nil || ip.To4() != nil {
+		return nil, fmt.Errorf("%q is not an IPv6 address", s)
+	}
+	return ip.To16(), nil
+}
+
+// mergeBits returns the first bits of high followed by the rest of low.
+func mergeBits(high, low net.IP, bits int) net.IP {
+	mask := net.CIDRMask(bits, 128)
+	out := make(net.IP, net.IPv6len)
+	for i := range out {
+		out[i] = high[i]&mask[i] | low[i]&^mask[i]
+	}
+	return out
+}
+
+// prefixFunc returns the network of ip with the given prefix length, e.g.
+// 2001:db8:1:2::/64.
+func prefixFunc(bits int, ip string) (string, error) {
+	addr, err := parseIPv6(ip)
+	if err != nil {
+		return "", err
+	}
+	if bits < 0 || bits > 128 {
+		return "", fmt.Errorf("prefix length %d is out of range", bits)
+	}
+	network := net.IPNet{IP: addr.Mask(net.CIDRMask(bits, 128)), Mask: net.CIDRMask(bits, 128)}
+	return network.String(), nil
+}
+
+// hostFunc keeps the first bits of ip and takes the rest from suffix,
+// e.g. to point at another host in the detected prefix.
+func hostFunc(bits int, suffix, ip string) (string, error) {
+	addr, err := parseIPv6(ip)
+	if err != nil {
+		return "", err
+	}
+	low, err := parseIPv6(suffix)
+	if err != nil {
+		return "", err
+	}
+	if bits < 0 || bits > 128 {
+		return "", fmt.Errorf("prefix length %d is out of range", bits)
+	}
+	return mergeBits(addr, low, bits).String(), nil
+}
+
+// translateFunc replaces the leading bits of ip with the network given in
+// CIDR notation, mapping the detected prefix into another one.
+func translateFunc(network, ip string) (string, error) {
+	addr, err := parseIPv6(ip)
+	if err != nil {
+		return "", err
+	}
+	_, to, err := net.ParseCIDR(network)
+	if err != nil || to.IP.To4() != nil {
+		return "", fmt.Errorf("%q is not an IPv6 network", network)
+	}
+	bits, _ := to.Mask.Size()
+	return mergeBits(to.IP.To16(), addr, bits).String(), nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestContentFuncs(t *testing.T) {
+	tests := []struct {
+		content string
+		typ     string
+		want    string
+		wantErr bool
+	}{
+		{content: "{{ .IP }}", want: "2001:db8:1:2:3:4:5:6"},
+		{content: `{{ .IP | host 64 "::10" }}`, want: "2001:db8:1:2::10"},
+		{content: `{{ .IP | host 56 "::10:0:0:0:1" }}`, want: "2001:db8:1:10::1"},
+		{content: `{{ .IP | translate "2001:db8:beef::/48" }}`, want: "2001:db8:beef:2:3:4:5:6"},
+		{content: `v=1 net={{ .IP | prefix 56 }} host={{ .Name }}`, typ: "TXT", want: "v=1 net=2001:db8:1::/56 host=home.example.com"},
+		{content: `{{ .IP | prefix 64 }}`, wantErr: true},
+		{content: `{{ .IP | host 200 "::1" }}`, wantErr: true},
+		{content: `{{ .IP | translate "192.0.2.0/24" }}`, wantErr: true},
+		{content: `{{ .Missing }}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		tmpl, err := parseContent("content", tt.content)
+		if err != nil {
+			t.Fatalf("parseContent(%q): %v", tt.content, err)
+		}
+		got, err := renderContent(tmpl, tt.typ, sampleAddress, "home.example.com")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("renderContent(%q) error = %v, wantErr %v", tt.content, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("renderContent(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestValidateContent(t *testing.T) {
+	proxied := true
+	tests := []struct {
+		record  RecordConfig
+		wantErr string
+	}{
+		{record: RecordConfig{Name: "a", Content: `{{ .IP | host 64 "::1" }}`}},
+		{record: RecordConfig{Name: "a", Type: "TXT", Content: "ip={{ .IP }}"}},
+		{record: RecordConfig{Name: "a", Type: "TXT"}, wantErr: "content is required"},
+		{record: RecordConfig{Name: "a", Type: "TXT", Content: "x", Proxied: &proxied}, wantErr: "cannot be proxied"},
+		{record: RecordConfig{Name: "a", Type: "CNAME", Content: "x"}, wantErr: "type must be AAAA or TXT"},
+		{record: RecordConfig{Name: "a", Content: "{{ .IP"}, wantErr: "unclosed action"},
+		{record: RecordConfig{Name: "a", Content: "host-{{ .IP }}"}, wantErr: "not an IPv6 address"},
+		{record: RecordConfig{Name: "a", Content: "{{ .IP | exec }}"}, wantErr: "function \"exec\" not defined"},
+	}
+	for _, tt := range tests {
+		err := validateContent("records[0]", tt.record)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("validateContent(%+v) = %v", tt.record, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("validateContent(%+v) = %v, want %q", tt.record, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPublishContent(t *testing.T) {
+	remote := memProvider{}
+	s := newDDNSService(Config{}, JobConfig{Interface: "eth0", PollInterval: 30,
+		CloudFlare: CloudFlareConfig{RecordName: "home.example.com", Records: []RecordConfig{
+			{Name: "nas.example.com", Content: `{{ .IP | host 64 "::20" }}`},
+			{Name: "_prefix.example.com", Type: "TXT", Content: "{{ .IP | prefix 64 }}"},
+		}}})
+	for _, r := range s.records() {
+		r.provider = remote
+	}
+	s.timeSource = newFakeClock()
+
+	if err := s.publishAll("2001:db8:1:2::1"); err != nil {
+		t.Fatalf("publishAll: %v", err)
+	}
+	want := map[string]string{
+		"AAAA home.example.com":   "2001:db8:1:2::1",
+		"AAAA nas.example.com":    "2001:db8:1:2::20",
+		"TXT _prefix.example.com": "2001:db8:1:2::/64",
+	}
+	for key, content := range want {
+		if got := remote[key].Content; got != content {
+			t.Errorf("%s = %q, want %q", key, got, content)
+		}
+	}
+
+	// Records that already hold the rendered value are not written again
+	delete(remote, "AAAA nas.example.com")
+	s.lastKnownIP = ""
+	if err := s.publishAll("2001:db8:1:2::1"); err != nil {
+		t.Fatalf("publishAll: %v", err)
+	}
+	if _, ok := remote["AAAA nas.example.com"]; ok {
+		t.Errorf("record holding the rendered value was written again")
+	}
+
+	v4 := newIPv4Service(Config{}, JobConfig{Interface: "eth0", PollInterval: 30,
+		CloudFlare: CloudFlareConfig{RecordName: "home.example.com", Aliases: []string{"www.example.com"}, Records: []RecordConfig{
+			{Name: "nas.example.com", Content: `{{ .IP | host 64 "::20" }}`},
+		}}})
+	if len(v4.aliases) != 1 || v4.aliases[0].config.CloudFlare.RecordName != "www.example.com" {
+		t.Errorf("A updater manages %d aliases, want only www.example.com", len(v4.aliases))
+	}
+}
+
+func TestQuoteTXT(t *testing.T) {
+	for _, value := range []string{"v=1", `say "hi"`, `back\slash`} {
+		if got := unquoteTXT(quoteTXT(value)); got != value {
+			t.Errorf("unquoteTXT(quoteTXT(%q)) = %q", value, got)
+		}
+	}
+	if got := txtContent(txtRdata(strings.Repeat("x", 300))); got != `"`+strings.Repeat("x", 300)+`"` {
+		t.Errorf("txtRdata() of a long value does not round trip")
+	}
+}
+
+func TestRecordDefaultsContent(t *testing.T) {
+	cf := CloudFlareConfig{APIToken: "token", ZoneID: "zone", Records: []RecordConfig{
+		{Name: "_prefix.example.com", Type: "TXT", Content: "{{ .IP }}"},
+	}}
+	setRecordDefaults(&cf)
+	if cf.RecordName != "" {
+		t.Errorf("a TXT record was made the main record")
+	}
+	if err := validateCloudFlare(cf); err == nil || !strings.Contains(err.Error(), "record_name is required") {
+		t.Errorf("validateCloudFlare() = %v, want record_name is required", err)
+	}
+}
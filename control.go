@@ -0,0 +1,450 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runtimeControlSocket is the suggested control_socket, in the directory
+// the shipped unit creates with RuntimeDirectory.
+const runtimeControlSocket = "/run/ipv6-ddns-cloudflare/control.sock"
+
+func validateControlSocket(path string) error {
+	if path != "" && !filepath.IsAbs(path) {
+		return fmt.Errorf("control_socket must be an absolute path")
+	}
+	return nil
+}
+
+// controlHandler serves the control socket: GET /status, and POST /force,
+// /pause and /resume, for every job or the one named by ?job=, and POST
+// /reload. Only users that can open the socket reach it, so unlike the HTTP
+// listener it takes no token.
+type controlHandler struct {
+	services *serviceSet
+	reload   func() error
+}
+
+func newControlHandler(services *serviceSet, reload func() error) http.Handler {
+	h := &controlHandler{services: services, reload: reload}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		if allowGet(w, r) {
+			serveStatus(w, r, services)
+		}
+	})
+	mux.HandleFunc("/force", h.force)
+	mux.HandleFunc("/pause", h.pause)
+	mux.HandleFunc("/resume", h.resume)
+	mux.HandleFunc("/reload", h.reloadConfig)
+	return mux
+}
+
+func allowPost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return false
+	}
+	return true
+}
+
+// selectJob returns the services the request is for, answering 404 for an
+// unknown job.
+func (h *controlHandler) selectJob(w http.ResponseWriter, r *http.Request) ([]*DDNSService, bool) {
+	if !allowPost(w, r) {
+		return nil, false
+	}
+	services, ok := h.services.selectJob(r.URL.Query().Get("job"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown job")
+	}
+	return services, ok
+}
+
+func (h *controlHandler) force(w http.ResponseWriter, r *http.Request) {
+	services, ok := h.selectJob(w, r)
+	if !ok {
+		return
+	}
+	var names []string
+	for _, s := range services {
+		names = append(names, s.jobLabel())
+		go s.forceUpdate()
+	}
+	writeMessage(w, "Forcing an update of %s; the log tells the outcome", strings.Join(names, ", "))
+}
+
+func (h *controlHandler) pause(w http.ResponseWriter, r *http.Request) {
+	services, ok := h.selectJob(w, r)
+	if !ok {
+		return
+	}
+	h.toggle(w, services, (*DDNSService).pause, "Paused", "already paused")
+}
+
+func (h *controlHandler) resume(w http.ResponseWriter, r *http.Request) {
+	services, ok := h.selectJob(w, r)
+	if !ok {
+		return
+	}
+	h.toggle(w, services, (*DDNSService).resume, "Resumed", "not paused")
+}
+
+// toggle applies pause or resume and reports which jobs it changed.
+func (h *controlHandler) toggle(w http.ResponseWriter, services []*DDNSService, apply func(*DDNSService) bool, done, skipped string) {
+	var changed, unchanged []string
+	for _, s := range services {
+		if apply(s) {
+			changed = append(changed, s.jobLabel())
+		} else {
+			unchanged = append(unchanged, s.jobLabel())
+		}
+	}
+	var parts []string
+	if len(changed) > 0 {
+		parts = append(parts, done+" "+strings.Join(changed, ", "))
+	}
+	if len(unchanged) > 0 {
+		parts = append(parts, skipped+": "+strings.Join(unchanged, ", "))
+	}
+	writeMessage(w, "%s", strings.Join(parts, "; "))
+}
+
+func (h *controlHandler) reloadConfig(w http.ResponseWriter, r *http.Request) {
+	if !allowPost(w, r) {
+		return
+	}
+	if h.reload == nil {
+		writeError(w, http.StatusServiceUnavailable, "reloading is not available")
+		return
+	}
+	if err := h.reload(); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("reload failed, keeping the running configuration: %v", err))
+		return
+	}
+	writeMessage(w, "Configuration reloaded")
+}
+
+func writeMessage(w http.ResponseWriter, format string, args ...interface{}) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "message": fmt.Sprintf(format, args...)})
+}
+
+// jobLabel names the job in messages: its name, or the interface of a
+// config without a jobs list.
+func (s *DDNSService) jobLabel() string {
+	if s.name != "" {
+		return s.name
+	}
+	return s.config.Interface
+}
+
+// startControlServer serves the control socket at path, accessible to the
+// members of group as well when it is set. It returns nil if the socket is
+// disabled.
+func startControlServer(path, group string, services *serviceSet, reload func() error) (*http.Server, error) {
+	if path == "" {
+		return nil, nil
+	}
+	ln, err := listenControl(path, group)
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{
+		Handler:           newControlHandler(services, reload),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logError("Control socket error: %v", err)
+		}
+	}()
+	logInfo("Listening for control commands on %s", path)
+	return server, nil
+}
+
+// listenControl creates the control socket, accessible to its owner and,
+// with a group, to the group's members. A socket left behind by a daemon
+// that didn't shut down cleanly is replaced; one that still answers
+// belongs to another running daemon.
+func listenControl(path, group string) (net.Listener, error) {
+	gid := -1
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			return nil, fmt.Errorf("control_group: %w", err)
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return nil, fmt.Errorf("control_group: group %s has gid %q", group, g.Gid)
+		}
+	}
+
+	os.MkdirAll(filepath.Dir(path), 0755)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		if _, statErr := os.Stat(path); statErr != nil {
+			return nil, err
+		}
+		if conn, dialErr := net.Dial("unix", path); dialErr == nil {
+			conn.Close()
+			return nil, fmt.Errorf("another daemon is listening on %s", path)
+		}
+		os.Remove(path)
+		if ln, err = net.Listen("unix", path); err != nil {
+			return nil, err
+		}
+	}
+
+	mode := os.FileMode(0600)
+	if gid >= 0 {
+		if err := os.Chown(path, -1, gid); err != nil {
+			ln.Close()
+			return nil, err
+		}
+		mode = 0660
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// controlFlags adds the flags locating the control socket to fs. The
+// returned function gives the socket path once fs is parsed.
+func controlFlags(fs *flag.FlagSet) func() (string, error) {
+	configPath := fs.String("config", "/etc/ipv6-ddns-cloudflare/config.yaml", "Path to configuration file, read for control_socket")
+	socket := fs.String("socket", "", "Path of the daemon's control socket (default from the config)")
+	return func() (string, error) {
+		if *socket != "" {
+			return *socket, nil
+		}
+		// The config is only read for the socket path; a config the daemon
+		// would reject still names it.
+		config, err := loadConfig(*configPath)
+		if err != nil {
+			config = Config{}
+		}
+		path := config.ControlSocket
+		if path == "" {
+			return "", fmt.Errorf("control_socket is not set in %s", *configPath)
+		}
+		return path, nil
+	}
+}
+
+func runStatus(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	socketPath := controlFlags(fs)
+	outputFormat := outputFlag(fs, "text", "json")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s status [flags]\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Asks the running daemon for the state of every job: the detected and")
+		fmt.Fprintln(fs.Output(), "pending address, the address in each record, when it last changed and")
+		fmt.Fprintln(fs.Output(), "how many detection and update errors there have been.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	output, err := outputFormat()
+	if err != nil {
+		return err
+	}
+
+	path, err := socketPath()
+	if err != nil {
+		return err
+	}
+	body, err := controlRequest(path, http.MethodGet, fmt.Sprintf("/status?schema=%d", statusSchema))
+	if err != nil {
+		return err
+	}
+	// json prints the answer as GET /status returns it
+	if output == "json" {
+		_, err := os.Stdout.Write(body)
+		return err
+	}
+	var status struct {
+		Jobs []jobStatus `json:"jobs"`
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return fmt.Errorf("decoding status: %w", err)
+	}
+	printStatus(os.Stdout, status.Jobs, time.Now())
+	return nil
+}
+
+var (
+	runPause = controlCommand("pause", "/pause",
+		"Stops the running daemon from checking the address and writing records\nuntil resume, e.g. during maintenance of the network.", true)
+	runResume = controlCommand("resume", "/resume",
+		"Lets paused jobs check the address again, right away.", true)
+	runForceUpdate = controlCommand("force-update", "/force",
+		"Detects the address again and writes it to every record right away, like\nSIGUSR1.", true)
+	runReload = controlCommand("reload", "/reload",
+		"Reloads the configuration of the running daemon, like SIGHUP, and reports\nwhether it was accepted.", false)
+)
+
+// controlCommand returns a subcommand that sends a POST to target on the
+// control socket and prints the daemon's answer. With job, it takes -job
+// to limit the command to one job.
+func controlCommand(name, target, description string, job bool) func(args []string) error {
+	return func(args []string) error {
+		fs := flag.NewFlagSet(name, flag.ExitOnError)
+		socketPath := controlFlags(fs)
+		var jobName *string
+		if job {
+			jobName = fs.String("job", "", "Name of the job (default: every job)")
+		}
+		fs.Usage = func() {
+			fmt.Fprintf(fs.Output(), "Usage: %s %s [flags]\n\n", os.Args[0], name)
+			fmt.Fprintln(fs.Output(), description)
+			fmt.Fprintln(fs.Output())
+			fs.PrintDefaults()
+		}
+		fs.Parse(args)
+
+		path, err := socketPath()
+		if err != nil {
+			return err
+		}
+		if jobName != nil && *jobName != "" {
+			target += "?job=" + url.QueryEscape(*jobName)
+		}
+		body, err := controlRequest(path, http.MethodPost, target)
+		if err != nil {
+			return err
+		}
+		var answer struct {
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(body, &answer); err != nil {
+			return fmt.Errorf("decoding answer: %w", err)
+		}
+		fmt.Println(answer.Message)
+		return nil
+	}
+}
+
+// controlRequest sends a request to the daemon listening on the control
+// socket at path and returns the body of a successful answer.
+func controlRequest(path, method, target string) ([]byte, error) {
+	client := &http.Client{
+		// A reload looks up the records of every job
+		Timeout: 2 * time.Minute,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+	req, err := http.NewRequest(method, "http://daemon"+target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("is the daemon running? %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var answer struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &answer) == nil && answer.Error != "" {
+			return nil, fmt.Errorf("%s", answer.Error)
+		}
+		return nil, fmt.Errorf("daemon answered %s: %s", resp.Status, body)
+	}
+	return body, nil
+}
+
+func printStatus(w io.Writer, jobs []jobStatus, now time.Time) {
+	for i, job := range jobs {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		name := job.Job
+		if name == "" {
+			name = "default"
+		}
+		fmt.Fprintf(w, "%s (%s)\n", name, job.Interface)
+		if job.Invalid {
+			fmt.Fprintf(w, "  not running: %s\n", job.LastError)
+			continue
+		}
+		if job.Paused {
+			fmt.Fprintf(w, "  paused, not checking the address until resumed\n")
+		}
+		if job.Standby {
+			fmt.Fprintf(w, "  standby, another instance holds the leader lease\n")
+		}
+		fmt.Fprintf(w, "  detected:  %s\n", orNone(job.Detected))
+		pending := orNone(job.Pending)
+		if job.UpdateAt != nil {
+			pending += fmt.Sprintf(", update in %s", max(job.UpdateAt.Sub(now), 0).Round(time.Second))
+		}
+		if job.StaleSince != nil {
+			pending += fmt.Sprintf(", records stale for %s", now.Sub(*job.StaleSince).Round(time.Second))
+		}
+		fmt.Fprintf(w, "  pending:   %s\n", pending)
+		if p := job.Prefix; p != nil {
+			fmt.Fprintf(w, "  prefix:    %s%s\n", p, p.describeLifetimes())
+		}
+		fmt.Fprintf(w, "  errors:    %d detection, %d update\n", job.DetectErrors, job.UpdateErrors)
+		if job.LastError != "" {
+			fmt.Fprintf(w, "  failing:   %s\n", job.LastError)
+		}
+		if job.Unhealthy != "" {
+			fmt.Fprintf(w, "  unhealthy: %s\n", job.Unhealthy)
+		}
+		for _, rec := range job.Records {
+			changed := "last change unknown"
+			if !rec.LastChanged.IsZero() {
+				changed = fmt.Sprintf("changed %s (%s ago)", rec.LastChanged.Local().Format("2006-01-02 15:04:05"),
+					now.Sub(rec.LastChanged).Round(time.Second))
+			}
+			fmt.Fprintf(w, "  %s %s %s, %s\n", rec.Type, rec.Record, orNone(rec.Address), changed)
+		}
+	}
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
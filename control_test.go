@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestControlSocket(t *testing.T) {
+	service := &DDNSService{
+		name:        "fiber",
+		config:      Config{Interface: "eth0", CloudFlare: CloudFlareConfig{RecordName: "home.example.com"}},
+		lastKnownIP: "2001:db8::1",
+		detectedIP:  "2001:db8::2",
+		pendingIP:   "2001:db8::2",
+	}
+	logf := func(string, ...interface{}) {}
+	service.updateErrors.print(logf, "Failed to update DNS: timeout", time.Now())
+	service.updateErrors.print(logf, "Failed to update DNS: timeout", time.Now())
+	service.updateErrors.reset(logf, time.Now())
+
+	path := filepath.Join(t.TempDir(), "control.sock")
+	server, err := startControlServer(path, "", newServiceSet([]*DDNSService{service}), nil)
+	if err != nil {
+		t.Fatalf("startControlServer: %v", err)
+	}
+	defer server.Close()
+
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %v (%v), want 0600", info.Mode().Perm(), err)
+	}
+
+	body, err := controlRequest(path, "GET", "/status")
+	if err != nil {
+		t.Fatalf("controlRequest: %v", err)
+	}
+	var status struct {
+		Schema int         `json:"schema"`
+		Jobs   []jobStatus `json:"jobs"`
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		t.Fatalf("decoding status: %v", err)
+	}
+	if status.Schema != statusSchema || len(status.Jobs) != 1 {
+		t.Fatalf("status = %s", body)
+	}
+	job := status.Jobs[0]
+	if job.Detected != "2001:db8::2" || job.UpdateErrors != 2 || job.DetectErrors != 0 || job.LastError != "" {
+		t.Errorf("job status = %+v", job)
+	}
+
+	// A second daemon must not take over the socket of a running one
+	if _, err := startControlServer(path, "", newServiceSet(nil), nil); err == nil {
+		t.Errorf("second control server started on a socket in use")
+	}
+}
+
+func TestControlCommands(t *testing.T) {
+	clock := newFakeClock()
+	detected := make(chan struct{}, 10)
+	service := &DDNSService{
+		name:   "fiber",
+		config: Config{Interface: "eth0", StabilityDelay: 5, CloudFlare: CloudFlareConfig{RecordName: "home.example.com"}},
+		getIPv6: func(string) (string, error) {
+			detected <- struct{}{}
+			return "2001:db8::2", nil
+		},
+		provider:    memProvider{},
+		lastKnownIP: "2001:db8::1",
+		timeSource:  clock,
+	}
+	reloads := 0
+	reload := func() error {
+		reloads++
+		if reloads > 1 {
+			return errors.New("job \"office\": interface is required")
+		}
+		return nil
+	}
+
+	path := filepath.Join(t.TempDir(), "control.sock")
+	server, err := startControlServer(path, "", newServiceSet([]*DDNSService{service}), reload)
+	if err != nil {
+		t.Fatalf("startControlServer: %v", err)
+	}
+	defer server.Close()
+
+	// A change waiting for the stability delay is dropped by pause
+	service.checkAndUpdate()
+	<-detected
+	if clock.Pending() != 1 {
+		t.Fatalf("%d timers pending, want the stability timer", clock.Pending())
+	}
+
+	command := func(target string) string {
+		t.Helper()
+		body, err := controlRequest(path, "POST", target)
+		if err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+		var answer struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(body, &answer)
+		return answer.Message
+	}
+
+	if got := command("/pause?job=fiber"); got != "Paused fiber" {
+		t.Errorf("pause = %q", got)
+	}
+	if got := command("/pause"); got != "already paused: fiber" {
+		t.Errorf("second pause = %q", got)
+	}
+	if service.pendingIP != "" || clock.Pending() != 0 {
+		t.Errorf("pending update %q (%d timers) survived pause", service.pendingIP, clock.Pending())
+	}
+	service.checkAndUpdate()
+	select {
+	case <-detected:
+		t.Errorf("paused job checked its address")
+	default:
+	}
+	if st := service.status(); !st.Paused {
+		t.Errorf("status = %+v, want paused", st)
+	}
+
+	if got := command("/resume"); got != "Resumed fiber" {
+		t.Errorf("resume = %q", got)
+	}
+	select {
+	case <-detected:
+	case <-time.After(5 * time.Second):
+		t.Errorf("resume didn't check the address")
+	}
+
+	if _, err := controlRequest(path, "POST", "/pause?job=lte"); err == nil || !strings.Contains(err.Error(), "unknown job") {
+		t.Errorf("pause of an unknown job: %v", err)
+	}
+	if _, err := controlRequest(path, "GET", "/pause"); err == nil {
+		t.Errorf("GET /pause succeeded")
+	}
+
+	if got := command("/reload"); got != "Configuration reloaded" {
+		t.Errorf("reload = %q", got)
+	}
+	if _, err := controlRequest(path, "POST", "/reload"); err == nil || !strings.Contains(err.Error(), "interface is required") {
+		t.Errorf("failed reload: %v", err)
+	}
+}
+
+func TestControlSocketStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "control.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Leave the socket file behind, as a killed daemon would
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	server, err := startControlServer(path, "", newServiceSet(nil), nil)
+	if err != nil {
+		t.Fatalf("stale socket not replaced: %v", err)
+	}
+	server.Close()
+}
+
+func TestControlSocketConfig(t *testing.T) {
+	tests := []struct {
+		socket  string
+		wantErr bool
+	}{
+		{"", false},
+		{"/var/lib/ddns/control.sock", false},
+		{"control.sock", true},
+	}
+	for _, tt := range tests {
+		if err := validateControlSocket(tt.socket); (err != nil) != tt.wantErr {
+			t.Errorf("validateControlSocket(%q) error = %v, wantErr %v", tt.socket, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPrintStatus(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.Local)
+	jobs := []jobStatus{{
+		Job:          "fiber",
+		Interface:    "eth0",
+		Detected:     "2001:db8::2",
+		Pending:      "2001:db8::2",
+		LastError:    "Failed to update DNS: timeout",
+		DetectErrors: 1,
+		UpdateErrors: 4,
+		Records: []recordStatus{
+			{Record: "home.example.com", Type: "AAAA", Address: "2001:db8::1", LastChanged: now.Add(-90 * time.Minute)},
+			{Record: "www.example.com", Type: "AAAA"},
+		},
+	}}
+
+	var buf bytes.Buffer
+	printStatus(&buf, jobs, now)
+	want := strings.Join([]string{
+		"fiber (eth0)",
+		"  detected:  2001:db8::2",
+		"  pending:   2001:db8::2",
+		"  errors:    1 detection, 4 update",
+		"  failing:   Failed to update DNS: timeout",
+		"  AAAA home.example.com 2001:db8::1, changed 2025-01-01 10:30:00 (1h30m0s ago)",
+		"  AAAA www.example.com -, last change unknown",
+		"",
+	}, "\n")
+	if buf.String() != want {
+		t.Errorf("printStatus:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestControlSocketGroup(t *testing.T) {
+	u, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	g, err := user.LookupGroupId(u.Gid)
+	if err != nil {
+		t.Skip(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "control.sock")
+	ln, err := listenControl(path, g.Name)
+	if err != nil {
+		t.Fatalf("listenControl: %v", err)
+	}
+	defer ln.Close()
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0660 {
+		t.Errorf("socket mode = %v (%v), want 0660", info.Mode().Perm(), err)
+	}
+
+	if _, err := listenControl(filepath.Join(t.TempDir(), "other.sock"), "no-such-group-ddns"); err == nil {
+		t.Errorf("listenControl() with an unknown group succeeded")
+	}
+}
@@ -0,0 +1,266 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// CustomConfig describes the update request of a job using the custom
+// provider. URL, header values and body are Go templates receiving a
+// customRecord.
+type CustomConfig struct {
+	URL             string            `yaml:"url"`
+	Method          string            `yaml:"method"`
+	Headers         map[string]string `yaml:"headers"`
+	Body            string            `yaml:"body"`
+	SuccessContains string            `yaml:"success_contains"`
+	RecordName      string            `yaml:"record_name"`
+	TTL             int               `yaml:"ttl"`
+	Aliases         []string          `yaml:"aliases"`
+	Records         []RecordConfig    `yaml:"records"`
+	Adopt           bool              `yaml:"adopt"`
+}
+
+// customRecord is the data the request templates are executed with.
+type customRecord struct {
+	IP   string
+	Name string
+	Type string
+	TTL  int
+}
+
+// customFuncs are available in the request templates; json quotes a value
+// for use in a JSON body.
+var customFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// recordSettings returns the records in the form the updater works with.
+func (c CustomConfig) recordSettings() CloudFlareConfig {
+	return CloudFlareConfig{
+		RecordName: c.RecordName,
+		TTL:        c.TTL,
+		Aliases:    c.Aliases,
+		Records:    c.Records,
+		Adopt:      c.Adopt,
+	}
+}
+
+func setCustomDefaults(c *CustomConfig) {
+	if c.URL == "" {
+		return
+	}
+	if c.Method == "" {
+		c.Method = "GET"
+	}
+	if c.TTL == 0 {
+		c.TTL = 300
+	}
+	if c.RecordName == "" && len(c.Records) > 0 && c.Records[0].plain() {
+		c.RecordName = c.Records[0].Name
+		if c.Records[0].TTL != 0 {
+			c.TTL = c.Records[0].TTL
+		}
+		c.Records = c.Records[1:]
+	}
+}
+
+func validateCustom(c CustomConfig) error {
+	if c.URL == "" {
+		return fmt.Errorf("custom.url is required")
+	}
+	if c.RecordName == "" {
+		return fmt.Errorf("custom.record_name is required")
+	}
+	switch c.Method {
+	case "GET", "POST", "PUT", "PATCH", "DELETE":
+	default:
+		return fmt.Errorf("custom.method must be GET, POST, PUT, PATCH or DELETE")
+	}
+	if _, err := parseCustomTemplates(c); err != nil {
+		return err
+	}
+	seen := map[string]bool{strings.ToLower(c.RecordName): true}
+	for _, alias := range c.Aliases {
+		if alias == "" {
+			return fmt.Errorf("custom.aliases must not contain empty names")
+		}
+		if seen[strings.ToLower(alias)] {
+			return fmt.Errorf("custom.aliases: %s is listed more than once", alias)
+		}
+		seen[strings.ToLower(alias)] = true
+	}
+	for _, record := range c.Records {
+		if record.Proxied != nil {
+			return fmt.Errorf("custom.records: %s: proxied is not supported by the custom provider", record.Name)
+		}
+	}
+	return validateRecords("custom.records", c.Records, false, seen)
+}
+
+// customTemplates are the parsed request templates; headers maps header
+// names to their value templates.
+type customTemplates struct {
+	url     *template.Template
+	body    *template.Template
+	headers map[string]*template.Template
+}
+
+func parseCustomTemplates(c CustomConfig) (customTemplates, error) {
+	parse := func(field, text string) (*template.Template, error) {
+		tmpl, err := template.New(field).Funcs(customFuncs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field, err)
+		}
+		return tmpl, nil
+	}
+
+	t := customTemplates{headers: make(map[string]*template.Template)}
+	var err error
+	if t.url, err = parse("custom.url", c.URL); err != nil {
+		return t, err
+	}
+	if t.body, err = parse("custom.body", c.Body); err != nil {
+		return t, err
+	}
+	for name, value := range c.Headers {
+		if t.headers[name], err = parse("custom.headers."+name, value); err != nil {
+			return t, err
+		}
+	}
+	return t, nil
+}
+
+// customProvider sends a user-defined HTTP request for every update. The
+// API behind it can't be read, so records are never found and every
+// address is sent.
+type customProvider struct {
+	client    *http.Client
+	config    CustomConfig
+	templates customTemplates
+	err       error
+}
+
+func newCustomProvider(config CustomConfig, client *http.Client) *customProvider {
+	templates, err := parseCustomTemplates(config)
+	return &customProvider{client: client, config: config, templates: templates, err: err}
+}
+
+func (p *customProvider) Capabilities() Capabilities {
+	return Capabilities{}
+}
+
+func (p *customProvider) FetchRecord(recordType, name string) (*DNSRecord, error) {
+	return nil, nil
+}
+
+func (p *customProvider) CreateRecord(record DNSRecord) (DNSRecord, error) {
+	return p.send(record)
+}
+
+func (p *customProvider) UpdateRecord(record DNSRecord) (DNSRecord, error) {
+	return p.send(record)
+}
+
+func (p *customProvider) send(record DNSRecord) (DNSRecord, error) {
+	if p.err != nil {
+		return DNSRecord{}, p.err
+	}
+	data := customRecord{IP: record.Content, Name: record.Name, Type: record.Type, TTL: record.TTL}
+	execute := func(tmpl *template.Template) (string, error) {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+
+	url, err := execute(p.templates.url)
+	if err != nil {
+		return DNSRecord{}, err
+	}
+	body, err := execute(p.templates.body)
+	if err != nil {
+		return DNSRecord{}, err
+	}
+	var reqBody io.Reader
+	if body != "" {
+		reqBody = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(p.config.Method, url, reqBody)
+	if err != nil {
+		return DNSRecord{}, err
+	}
+
+	names := make([]string, 0, len(p.templates.headers))
+	for name := range p.templates.headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, err := execute(p.templates.headers[name])
+		if err != nil {
+			return DNSRecord{}, err
+		}
+		req.Header.Set(name, value)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return DNSRecord{}, fmt.Errorf("API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return DNSRecord{}, fmt.Errorf("reading response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return DNSRecord{}, fmt.Errorf("custom API error: %s: %s", resp.Status, truncate(strings.TrimSpace(string(respBody)), 200))
+	}
+	if p.config.SuccessContains != "" && !strings.Contains(string(respBody), p.config.SuccessContains) {
+		return DNSRecord{}, fmt.Errorf("custom API error: response does not contain %q: %s",
+			p.config.SuccessContains, truncate(strings.TrimSpace(string(respBody)), 200))
+	}
+
+	record.ID = record.Name
+	return record, nil
+}
+
+// truncate shortens s to at most n bytes for error messages, without
+// splitting a UTF-8 character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
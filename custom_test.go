@@ -0,0 +1,142 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCustomProvider(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.String()+" "+r.Header.Get("Authorization")+" "+string(body))
+		if r.URL.Query().Get("host") == "bad.example.com" {
+			w.Write([]byte("badauth"))
+			return
+		}
+		if r.URL.Query().Get("host") == "down.example.com" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("maintenance"))
+			return
+		}
+		w.Write([]byte("good 2001:db8::1"))
+	}))
+	defer server.Close()
+
+	p := newCustomProvider(CustomConfig{
+		URL:             server.URL + "/update?host={{.Name | urlquery}}&ip={{.IP}}",
+		Method:          "POST",
+		Headers:         map[string]string{"Authorization": "Bearer secret"},
+		Body:            `{"name": {{json .Name}}, "type": "{{.Type}}", "ttl": {{.TTL}}}`,
+		SuccessContains: "good",
+	}, server.Client())
+
+	if record, err := p.FetchRecord("AAAA", "home.example.com"); err != nil || record != nil {
+		t.Errorf("FetchRecord() = %+v, %v, want nil", record, err)
+	}
+
+	record, err := p.UpdateRecord(DNSRecord{Type: "AAAA", Name: "home.example.com", Content: "2001:db8::1", TTL: 300})
+	if err != nil || record.ID != "home.example.com" {
+		t.Errorf("UpdateRecord() = %+v, %v", record, err)
+	}
+	want := `POST /update?host=home.example.com&ip=2001:db8::1 Bearer secret {"name": "home.example.com", "type": "AAAA", "ttl": 300}`
+	if len(requests) != 1 || requests[0] != want {
+		t.Errorf("requests = %q, want %q", requests, want)
+	}
+
+	_, err = p.CreateRecord(DNSRecord{Type: "AAAA", Name: "bad.example.com", Content: "2001:db8::1", TTL: 300})
+	if err == nil || err.Error() != `custom API error: response does not contain "good": badauth` {
+		t.Errorf("expected badauth error, got %v", err)
+	}
+	_, err = p.CreateRecord(DNSRecord{Type: "AAAA", Name: "down.example.com", Content: "2001:db8::1", TTL: 300})
+	if err == nil || err.Error() != "custom API error: 503 Service Unavailable: maintenance" {
+		t.Errorf("expected 503 error, got %v", err)
+	}
+}
+
+func TestValidateCustom(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  CustomConfig
+		wantErr string
+	}{
+		{"valid", CustomConfig{URL: "https://example.com/?ip={{.IP}}", Method: "GET", RecordName: "home.example.com"}, ""},
+		{"missing url", CustomConfig{Method: "GET", RecordName: "home.example.com"}, "custom.url is required"},
+		{"missing record", CustomConfig{URL: "https://example.com/", Method: "GET"}, "custom.record_name is required"},
+		{"bad method", CustomConfig{URL: "https://example.com/", Method: "FETCH", RecordName: "home.example.com"},
+			"custom.method must be GET, POST, PUT, PATCH or DELETE"},
+		{"bad template", CustomConfig{URL: "https://example.com/", Method: "POST", Body: "{{.IP", RecordName: "home.example.com"},
+			"custom.body: template: custom.body:1: unclosed action"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCustom(tt.config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCustomJob(t *testing.T) {
+	job := JobConfig{
+		Name:      "home",
+		Interface: "eth0",
+		Provider:  "custom",
+		Custom: CustomConfig{
+			URL:        "https://dyn.example.net/update?host={{.Name}}&ip={{.IP}}",
+			RecordName: "home.example.com",
+			Aliases:    []string{"www.example.com"},
+		},
+	}
+	setCustomDefaults(&job.Custom)
+	if err := validateJob(job); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	service := newDDNSService(Config{}, job)
+	p, ok := service.provider.(*customProvider)
+	if !ok {
+		t.Fatalf("provider = %T, want *customProvider", service.provider)
+	}
+	if p.config.Method != "GET" || !strings.HasPrefix(p.config.URL, "https://dyn.example.net/") {
+		t.Errorf("provider config = %+v", p.config)
+	}
+	if cf := service.config.CloudFlare; cf.RecordName != "home.example.com" || cf.TTL != 300 {
+		t.Errorf("record settings = %+v", cf)
+	}
+	if len(service.aliases) != 1 {
+		t.Fatalf("aliases = %+v", service.aliases)
+	}
+	if _, ok := service.aliases[0].provider.(*customProvider); !ok {
+		t.Errorf("alias provider = %T, want *customProvider", service.aliases[0].provider)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"abcdef", 3, "abc..."},
+		{"aéb", 2, "a..."}, // é is two bytes
+		{"日本", 4, "日..."},
+		{"日本", 2, "..."},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// desecAPI is the base URL of the deSEC API.
+const desecAPI = "https://desec.io/api/v1"
+
+// DeSECConfig selects the domain and token of a job using the desec
+// provider, and the records kept up to date in the domain.
+type DeSECConfig struct {
+	Token      string         `yaml:"token"`
+	Domain     string         `yaml:"domain"`
+	RecordName string         `yaml:"record_name"`
+	TTL        int            `yaml:"ttl"`
+	Aliases    []string       `yaml:"aliases"`
+	Records    []RecordConfig `yaml:"records"`
+	Adopt      bool           `yaml:"adopt"`
+}
+
+// recordSettings returns the records in the form the updater works with.
+func (d DeSECConfig) recordSettings() CloudFlareConfig {
+	return CloudFlareConfig{
+		ZoneID:     d.Domain,
+		RecordName: d.RecordName,
+		TTL:        d.TTL,
+		Aliases:    d.Aliases,
+		Records:    d.Records,
+		Adopt:      d.Adopt,
+	}
+}
+
+func setDeSECDefaults(d *DeSECConfig) {
+	if d.Domain == "" {
+		return
+	}
+	// deSEC rejects TTLs below the domain's minimum, 3600 unless lowered
+	// on request
+	if d.TTL == 0 {
+		d.TTL = 3600
+	}
+	if d.RecordName == "" && len(d.Records) > 0 && d.Records[0].plain() {
+		d.RecordName = d.Records[0].Name
+		if d.Records[0].TTL != 0 {
+			d.TTL = d.Records[0].TTL
+		}
+		d.Records = d.Records[1:]
+	}
+}
+
+func validateDeSEC(d DeSECConfig) error {
+	if d.Token == "" {
+		return fmt.Errorf("desec.token is required")
+	}
+	if d.Domain == "" {
+		return fmt.Errorf("desec.domain is required")
+	}
+	if d.RecordName == "" {
+		return fmt.Errorf("desec.record_name is required")
+	}
+	seen := map[string]bool{strings.ToLower(d.RecordName): true}
+	for _, alias := range d.Aliases {
+		if alias == "" {
+			return fmt.Errorf("desec.aliases must not contain empty names")
+		}
+		if seen[strings.ToLower(alias)] {
+			return fmt.Errorf("desec.aliases: %s is listed more than once", alias)
+		}
+		seen[strings.ToLower(alias)] = true
+	}
+	names := append([]string{d.RecordName}, d.Aliases...)
+	for _, record := range d.Records {
+		if record.Proxied != nil {
+			return fmt.Errorf("desec.records: %s: proxied is not supported by deSEC", record.Name)
+		}
+		names = append(names, record.Name)
+	}
+	for _, name := range names {
+		if _, ok := desecSubname(name, d.Domain); !ok && name != "" {
+			return fmt.Errorf("desec: %s is not in domain %s", name, d.Domain)
+		}
+	}
+	return validateRecords("desec.records", d.Records, false, seen)
+}
+
+// desecSubname returns the part of name below domain, which deSEC uses to
+// address records.
+func desecSubname(name, domain string) (string, bool) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if name == domain {
+		return "", true
+	}
+	subname := strings.TrimSuffix(name, "."+domain)
+	return subname, subname != name
+}
+
+// desecProvider manages RRsets in one deSEC domain. deSEC has no record
+// IDs; the record name stands in for one.
+type desecProvider struct {
+	client  *http.Client
+	baseURL string
+	config  DeSECConfig
+}
+
+func newDeSECProvider(config DeSECConfig, client *http.Client) *desecProvider {
+	return &desecProvider{client: client, baseURL: desecAPI, config: config}
+}
+
+type desecRRset struct {
+	Subname string   `json:"subname"`
+	Type    string   `json:"type"`
+	TTL     int      `json:"ttl"`
+	Records []string `json:"records"`
+}
+
+// Capabilities of deSEC. The minimum TTL is set per domain, so deSEC
+// itself checks it.
+func (p *desecProvider) Capabilities() Capabilities {
+	return Capabilities{}
+}
+
+func (p *desecProvider) FetchRecord(recordType, name string) (*DNSRecord, error) {
+	subname, ok := desecSubname(name, p.config.Domain)
+	if !ok {
+		return nil, fmt.Errorf("%s is not in %s", name, p.config.Domain)
+	}
+	if subname == "" {
+		subname = "@"
+	}
+	var set desecRRset
+	found, err := p.call("GET", "/rrsets/"+url.PathEscape(subname)+"/"+recordType+"/", nil, &set)
+	if err != nil || !found {
+		return nil, err
+	}
+	record := &DNSRecord{ID: name, Type: set.Type, Name: name, TTL: set.TTL}
+	if len(set.Records) > 0 {
+		record.Content = set.Records[0]
+	}
+	return record, nil
+}
+
+func (p *desecProvider) CreateRecord(record DNSRecord) (DNSRecord, error) {
+	return p.put(record)
+}
+
+func (p *desecProvider) UpdateRecord(record DNSRecord) (DNSRecord, error) {
+	return p.put(record)
+}
+
+// put replaces the record's RRset, creating it if needed, with a bulk PUT
+// of the single set.
+func (p *desecProvider) put(record DNSRecord) (DNSRecord, error) {
+	subname, ok := desecSubname(record.Name, p.config.Domain)
+	if !ok {
+		return DNSRecord{}, fmt.Errorf("%s is not in %s", record.Name, p.config.Domain)
+	}
+	content := record.Content
+	if record.Type == "TXT" {
+		content = quoteTXT(content)
+	}
+	sets := []desecRRset{{Subname: subname, Type: record.Type, TTL: record.TTL, Records: []string{content}}}
+	if _, err := p.call("PUT", "/rrsets/", sets, nil); err != nil {
+		return DNSRecord{}, err
+	}
+	record.ID = record.Name
+	return record, nil
+}
+
+// call sends a request for path below the domain and decodes a successful
+// response into result, if given. A 404 is reported as not found rather
+// than as an error.
+func (p *desecProvider) call(method, path string, payload, result interface{}) (bool, error) {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return false, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, p.baseURL+"/domains/"+url.PathEscape(p.config.Domain)+path, body)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "Token "+p.config.Token)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, fmt.Errorf("reading response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound && method == "GET" {
+		return false, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var errResp struct {
+			Detail string `json:"detail"`
+		}
+		if json.Unmarshal(respBody, &errResp) == nil && errResp.Detail != "" {
+			return false, fmt.Errorf("deSEC API error: %s", errResp.Detail)
+		}
+		// Validation errors come back per field, e.g. for a too low TTL
+		if detail := strings.TrimSpace(string(respBody)); detail != "" && len(detail) < 500 {
+			return false, fmt.Errorf("deSEC API error: %s: %s", resp.Status, detail)
+		}
+		return false, fmt.Errorf("deSEC API error: %s", resp.Status)
+	}
+
+	if result == nil {
+		return true, nil
+	}
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return false, fmt.Errorf("parsing response: %w", err)
+	}
+	return true, nil
+}
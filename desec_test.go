@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDeSECProvider(t *testing.T) {
+	var puts [][]desecRRset
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token secret" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/domains/example.com/rrsets/home/AAAA/":
+			w.Write([]byte(`{"domain": "example.com", "subname": "home", "name": "home.example.com.",
+				"type": "AAAA", "ttl": 3600, "records": ["2001:db8::1"]}`))
+		case r.Method == "GET" && r.URL.Path == "/domains/example.com/rrsets/@/AAAA/":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"detail": "Not found."}`))
+		case r.Method == "PUT" && r.URL.Path == "/domains/example.com/rrsets/":
+			var sets []desecRRset
+			json.NewDecoder(r.Body).Decode(&sets)
+			puts = append(puts, sets)
+			if sets[0].TTL < 3600 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`[{"ttl": ["Ensure this value is greater than or equal to 3600."]}]`))
+				return
+			}
+			w.Write([]byte(`[]`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	}))
+	defer server.Close()
+
+	p := newDeSECProvider(DeSECConfig{Token: "secret", Domain: "example.com"}, server.Client())
+	p.baseURL = server.URL
+
+	record, err := p.FetchRecord("AAAA", "home.example.com")
+	if err != nil || record == nil || record.Content != "2001:db8::1" || record.ID != "home.example.com" || record.TTL != 3600 {
+		t.Errorf("FetchRecord() = %+v, %v", record, err)
+	}
+	record, err = p.FetchRecord("AAAA", "example.com")
+	if err != nil || record != nil {
+		t.Errorf("FetchRecord() of missing record = %+v, %v, want nil", record, err)
+	}
+
+	created, err := p.CreateRecord(DNSRecord{Type: "AAAA", Name: "example.com", Content: "2001:db8::2", TTL: 3600})
+	if err != nil || created.ID != "example.com" {
+		t.Errorf("CreateRecord() = %+v, %v", created, err)
+	}
+	if len(puts) != 1 || len(puts[0]) != 1 || puts[0][0].Subname != "" || puts[0][0].Type != "AAAA" ||
+		len(puts[0][0].Records) != 1 || puts[0][0].Records[0] != "2001:db8::2" {
+		t.Errorf("PUT bodies = %+v", puts)
+	}
+
+	_, err = p.UpdateRecord(DNSRecord{ID: "home.example.com", Type: "AAAA", Name: "home.example.com", Content: "2001:db8::2", TTL: 60})
+	want := `deSEC API error: 400 Bad Request: [{"ttl": ["Ensure this value is greater than or equal to 3600."]}]`
+	if err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got %v", want, err)
+	}
+}
+
+func TestValidateDeSEC(t *testing.T) {
+	proxied := true
+	tests := []struct {
+		name    string
+		config  DeSECConfig
+		wantErr string
+	}{
+		{"valid", DeSECConfig{Token: "t", Domain: "example.com", RecordName: "home.example.com", Aliases: []string{"example.com"}}, ""},
+		{"missing token", DeSECConfig{Domain: "example.com", RecordName: "home.example.com"}, "desec.token is required"},
+		{"missing domain", DeSECConfig{Token: "t", RecordName: "home.example.com"}, "desec.domain is required"},
+		{"missing record", DeSECConfig{Token: "t", Domain: "example.com"}, "desec.record_name is required"},
+		{"outside domain", DeSECConfig{Token: "t", Domain: "example.com", RecordName: "home.example.net"},
+			"desec: home.example.net is not in domain example.com"},
+		{"proxied record", DeSECConfig{Token: "t", Domain: "example.com", RecordName: "home.example.com",
+			Records: []RecordConfig{{Name: "www.example.com", Proxied: &proxied}}},
+			"desec.records: www.example.com: proxied is not supported by deSEC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDeSEC(tt.config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDeSECJob(t *testing.T) {
+	job := JobConfig{
+		Name:      "home",
+		Interface: "eth0",
+		Provider:  "desec",
+		DeSEC: DeSECConfig{
+			Token:   "secret",
+			Domain:  "example.com",
+			Records: []RecordConfig{{Name: "home.example.com"}, {Name: "www.example.com"}},
+		},
+	}
+	setDeSECDefaults(&job.DeSEC)
+	if err := validateJob(job); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	service := newDDNSService(Config{}, job)
+	if _, ok := service.provider.(*desecProvider); !ok {
+		t.Errorf("provider = %T, want *desecProvider", service.provider)
+	}
+	if cf := service.config.CloudFlare; cf.RecordName != "home.example.com" || cf.TTL != 3600 {
+		t.Errorf("record settings = %+v", cf)
+	}
+	if len(service.aliases) != 1 || service.aliases[0].config.CloudFlare.RecordName != "www.example.com" {
+		t.Fatalf("aliases = %+v", service.aliases)
+	}
+	if _, ok := service.aliases[0].provider.(*desecProvider); !ok {
+		t.Errorf("alias provider = %T, want *desecProvider", service.aliases[0].provider)
+	}
+}
@@ -0,0 +1,77 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// dryRunProvider looks records up at the real provider but only logs the
+// writes. Records it pretended to write are served from memory afterwards,
+// so the update logic sees the state the writes would have produced.
+type dryRunProvider struct {
+	Provider
+	logf func(format string, args ...interface{})
+
+	mu      sync.Mutex
+	written map[string]DNSRecord
+}
+
+func newDryRunProvider(p Provider, logf func(string, ...interface{})) *dryRunProvider {
+	return &dryRunProvider{Provider: p, logf: logf, written: make(map[string]DNSRecord)}
+}
+
+func (p *dryRunProvider) FetchRecord(recordType, name string) (*DNSRecord, error) {
+	p.mu.Lock()
+	record, ok := p.written[recordType+" "+name]
+	p.mu.Unlock()
+	if ok {
+		return &record, nil
+	}
+	return p.Provider.FetchRecord(recordType, name)
+}
+
+func (p *dryRunProvider) CreateRecord(record DNSRecord) (DNSRecord, error) {
+	p.logf("Dry run: would create %s", describeRecord(record))
+	record.ID = "dry-run"
+	return p.remember(record), nil
+}
+
+func (p *dryRunProvider) UpdateRecord(record DNSRecord) (DNSRecord, error) {
+	p.logf("Dry run: would update record %s to %s", record.ID, describeRecord(record))
+	return p.remember(record), nil
+}
+
+func (p *dryRunProvider) remember(record DNSRecord) DNSRecord {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.written[record.Type+" "+record.Name] = record
+	return record
+}
+
+// describeRecord formats the fields a write would send.
+func describeRecord(r DNSRecord) string {
+	s := fmt.Sprintf("%s %s %s ttl=%d", r.Type, r.Name, r.Content, r.TTL)
+	if r.Proxied {
+		s += " proxied"
+	}
+	if r.Comment != "" {
+		s += fmt.Sprintf(" comment=%q", r.Comment)
+	}
+	return s
+}
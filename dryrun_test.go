@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDryRunProvider(t *testing.T) {
+	remote := memProvider{"AAAA home.example.com": {ID: "rec-1", Type: "AAAA", Name: "home.example.com", Content: "2001:db8::1"}}
+	var logged []string
+	logf := func(format string, args ...interface{}) { logged = append(logged, fmt.Sprintf(format, args...)) }
+	newRecord := func(name string) *DDNSService {
+		return &DDNSService{
+			config: Config{
+				DryRun:     true,
+				CloudFlare: CloudFlareConfig{RecordName: name, TTL: 300, GuardRemoteChanges: true},
+			},
+			provider: newDryRunProvider(remote, logf),
+		}
+	}
+	service := newRecord("home.example.com")
+	service.aliases = []*DDNSService{newRecord("www.example.com")}
+	if err := service.fetchRecordIDs(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := service.publishAll("2001:db8::2"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		"Dry run: would update record rec-1 to AAAA home.example.com 2001:db8::2 ttl=300",
+		"Dry run: would create AAAA www.example.com 2001:db8::2 ttl=300",
+	}
+	if fmt.Sprint(logged) != fmt.Sprint(want) {
+		t.Errorf("logged %q, want %q", logged, want)
+	}
+	if got := remote["AAAA home.example.com"].Content; got != "2001:db8::1" {
+		t.Errorf("record was changed to %s", got)
+	}
+	if _, ok := remote["AAAA www.example.com"]; ok {
+		t.Error("alias was created")
+	}
+
+	// The guard sees the pretended writes, not a conflicting remote change
+	logged = nil
+	if err := service.publishAll("2001:db8::3"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(logged) != 2 {
+		t.Errorf("logged %q, want both writes", logged)
+	}
+}
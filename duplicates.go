@@ -0,0 +1,137 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import "strings"
+
+// duplicateRemover is implemented by providers whose zones can hold several
+// records of the same name and type, such as CloudFlare's.
+type duplicateRemover interface {
+	listRecords(recordType, name string) ([]DNSRecord, error)
+	deleteRecord(id string) error
+}
+
+// dryRunRemover lists duplicates at the real provider but only logs their
+// deletion.
+type dryRunRemover struct {
+	duplicateRemover
+	logf func(format string, args ...interface{})
+}
+
+func (r dryRunRemover) deleteRecord(id string) error {
+	r.logf("Dry run: would delete record %s", id)
+	return nil
+}
+
+// duplicateRemover returns the job's provider as a duplicateRemover, if it
+// can hold duplicates.
+func (s *DDNSService) duplicateRemover() (duplicateRemover, bool) {
+	switch p := s.provider.(type) {
+	case *dryRunProvider:
+		if inner, ok := p.Provider.(duplicateRemover); ok {
+			return dryRunRemover{duplicateRemover: inner, logf: p.logf}, true
+		}
+	case duplicateRemover:
+		return p, true
+	}
+	return nil, false
+}
+
+// lookupRecord returns the job's record, or nil if there is none. Where the
+// provider can hold duplicates, it also returns every record of the name
+// and type, listed once for checkDuplicates, and picks the record the job
+// last wrote, as known from before a reload or from the state store, over
+// the others.
+func (s *DDNSService) lookupRecord() (*DNSRecord, []DNSRecord, error) {
+	name := s.config.CloudFlare.RecordName
+	remover, ok := s.duplicateRemover()
+	if !ok {
+		record, err := s.provider.FetchRecord(s.typ(), name)
+		return record, nil, err
+	}
+	records, err := remover.listRecords(s.typ(), name)
+	if err != nil || len(records) == 0 {
+		return nil, nil, err
+	}
+
+	s.mu.Lock()
+	written := s.recordID
+	s.mu.Unlock()
+	if written == "" && s.state != nil {
+		rec, _ := s.state.get(s.recordKey())
+		written = rec.RecordID
+	}
+	for i := range records {
+		if records[i].ID == written {
+			return &records[i], records, nil
+		}
+	}
+	return &records[0], records, nil
+}
+
+// checkDuplicates looks among records, as listed by lookupRecord, for
+// further records of the same name and type as keep, the record the job
+// manages, e.g. left behind by older tools or for earlier privacy addresses,
+// which resolvers would hand out alongside it. They are reported, and
+// deleted with remove_duplicates, except those whose comment names another
+// tool. Observe mode only reports them. A failed deletion is logged and
+// tried again at the next start or reload.
+func (s *DDNSService) checkDuplicates(keep *DNSRecord, records []DNSRecord) {
+	remover, ok := s.duplicateRemover()
+	if !ok || keep == nil {
+		return
+	}
+	name := s.config.CloudFlare.RecordName
+	var extra []DNSRecord
+	for _, record := range records {
+		if record.ID != keep.ID {
+			extra = append(extra, record)
+		}
+	}
+	if len(extra) == 0 {
+		return
+	}
+
+	var contents []string
+	for _, record := range extra {
+		contents = append(contents, record.Content)
+	}
+	if !s.config.CloudFlare.RemoveDuplicates || s.config.Observe {
+		s.warnf("WARNING: %s has %d more %s records besides the managed one (%s): %s; set remove_duplicates: true to delete them",
+			name, len(extra), s.typ(), keep.Content, strings.Join(contents, ", "))
+		return
+	}
+
+	s.mu.Lock()
+	manager := s.manager
+	s.mu.Unlock()
+	if manager != "" && !s.config.CloudFlare.Adopt {
+		// checkManager has warned about it; nothing of it is ours to delete
+		return
+	}
+	for _, record := range extra {
+		if manager := commentManager(record.Comment); manager != "" {
+			s.warnf("Warning: not deleting duplicate %s %s %s, it is managed by %s", s.typ(), name, record.Content, manager)
+			continue
+		}
+		if err := remover.deleteRecord(record.ID); err != nil {
+			s.errorf("Failed to delete duplicate %s %s %s: %v", s.typ(), name, record.Content, err)
+			continue
+		}
+		s.logf("Deleted duplicate %s %s %s", s.typ(), name, record.Content)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// dupProvider is a zone holding several AAAA records of one name.
+type dupProvider struct {
+	memProvider
+	records []DNSRecord
+	deleted []string
+	lists   int
+}
+
+func (p *dupProvider) listRecords(recordType, name string) ([]DNSRecord, error) {
+	p.lists++
+	return p.records, nil
+}
+
+func (p *dupProvider) deleteRecord(id string) error {
+	p.deleted = append(p.deleted, id)
+	return nil
+}
+
+func TestCheckDuplicates(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	tests := []struct {
+		name        string
+		remove      bool
+		dryRun      bool
+		observe     bool
+		wantDeleted string
+		wantLog     string
+	}{
+		{name: "reported by default", wantLog: "home.example.com has 2 more AAAA records besides the managed one (2001:db8::1): 2001:db8::2, 2001:db8::3"},
+		{name: "deleted with remove_duplicates", remove: true, wantDeleted: "b", wantLog: "not deleting duplicate AAAA home.example.com 2001:db8::3, it is managed by"},
+		{name: "dry run", remove: true, dryRun: true, wantLog: "Dry run: would delete record b"},
+		{name: "observe mode", remove: true, observe: true, wantLog: "set remove_duplicates: true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			keep := DNSRecord{ID: "a", Type: "AAAA", Name: "home.example.com", Content: "2001:db8::1"}
+			provider := &dupProvider{memProvider: memProvider{}, records: []DNSRecord{
+				keep,
+				{ID: "b", Type: "AAAA", Name: "home.example.com", Content: "2001:db8::2"},
+				{ID: "c", Type: "AAAA", Name: "home.example.com", Content: "2001:db8::3", Comment: "Managed by Terraform"},
+			}}
+			service := &DDNSService{
+				config: Config{Observe: tt.observe, CloudFlare: CloudFlareConfig{RecordName: "home.example.com", RemoveDuplicates: tt.remove}},
+			}
+			service.provider = provider
+			if tt.dryRun {
+				service.provider = newDryRunProvider(provider, service.logf)
+			}
+
+			service.checkDuplicates(&keep, provider.records)
+			if got := strings.Join(provider.deleted, " "); got != tt.wantDeleted {
+				t.Errorf("deleted %q, want %q", got, tt.wantDeleted)
+			}
+			if !strings.Contains(buf.String(), tt.wantLog) {
+				t.Errorf("log lacks %q:\n%s", tt.wantLog, buf.String())
+			}
+		})
+	}
+
+	// Providers that can't hold duplicates aren't asked
+	service := &DDNSService{config: Config{CloudFlare: CloudFlareConfig{RecordName: "home.example.com", RemoveDuplicates: true}}, provider: memProvider{}}
+	record, records, err := service.lookupRecord()
+	if err != nil || record != nil || records != nil {
+		t.Errorf("lookupRecord() without a duplicateRemover = %v, %v, %v", record, records, err)
+	}
+}
+
+func TestDuplicatesKeepWrittenRecord(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	// The record the job wrote before the restart isn't the first listed
+	provider := &dupProvider{memProvider: memProvider{}, records: []DNSRecord{
+		{ID: "old", Type: "AAAA", Name: "home.example.com", Content: "2001:db8::1"},
+		{ID: "written", Type: "AAAA", Name: "home.example.com", Content: "2001:db8::2"},
+	}}
+	st, _ := loadState(filepath.Join(t.TempDir(), "state.json"))
+	service := &DDNSService{
+		config:   Config{CloudFlare: CloudFlareConfig{ZoneID: "zone", RecordName: "home.example.com", RemoveDuplicates: true}},
+		provider: provider,
+	}
+	service.useState(st)
+	st.update(map[string]recordState{service.recordKey(): {RecordID: "written", Address: "2001:db8::2"}})
+
+	if err := service.fetchRecordID(); err != nil {
+		t.Fatalf("fetchRecordID: %v", err)
+	}
+	if service.recordID != "written" || service.lastKnownIP != "2001:db8::2" {
+		t.Errorf("took over %s holding %s, want the written record", service.recordID, service.lastKnownIP)
+	}
+	if got := strings.Join(provider.deleted, " "); got != "old" {
+		t.Errorf("deleted %q, want old", got)
+	}
+	if provider.lists != 1 {
+		t.Errorf("records listed %d times, want once", provider.lists)
+	}
+}
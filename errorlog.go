@@ -0,0 +1,90 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// errorRepeatWindow is how often a repeating error is summarised.
+const errorRepeatWindow = 10 * time.Minute
+
+// errorLog collapses an error that repeats on every poll into one summary
+// line per errorRepeatWindow, so a missing interface or an API outage does
+// not fill the journal with identical lines.
+type errorLog struct {
+	mu      sync.Mutex
+	msg     string
+	since   time.Time
+	repeats int
+	total   int
+}
+
+// print logs msg unless it repeats the previous error within the window.
+func (e *errorLog) print(logf func(string, ...interface{}), msg string, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.total++
+	if msg == e.msg {
+		e.repeats++
+		if now.Sub(e.since) >= errorRepeatWindow {
+			e.summarizeLocked(logf, now)
+			e.since = now
+			e.repeats = 0
+		}
+		return
+	}
+
+	e.summarizeLocked(logf, now)
+	logf("%s", msg)
+	e.msg = msg
+	e.since = now
+	e.repeats = 0
+}
+
+// reset ends a run of repeated errors, reporting any suppressed repeats.
+func (e *errorLog) reset(logf func(string, ...interface{}), now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.summarizeLocked(logf, now)
+	e.msg = ""
+	e.repeats = 0
+}
+
+func (e *errorLog) summarizeLocked(logf func(string, ...interface{}), now time.Time) {
+	if e.repeats == 0 {
+		return
+	}
+	logf("%s (repeated %d times in the last %s)", e.msg, e.repeats, now.Sub(e.since).Round(time.Second))
+}
+
+// current returns the error being reported, or "" once it has been reset.
+func (e *errorLog) current() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.msg
+}
+
+// count returns how many errors have been printed, repeats included.
+func (e *errorLog) count() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.total
+}
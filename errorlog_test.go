@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestErrorLog(t *testing.T) {
+	var lines []string
+	logf := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+
+	var e errorLog
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// First occurrence is logged, repeats inside the window are not
+	for i := 0; i < 5; i++ {
+		e.print(logf, "interface eth0 not found", start.Add(time.Duration(i)*time.Minute))
+	}
+	// Past the window a summary is logged
+	e.print(logf, "interface eth0 not found", start.Add(10*time.Minute))
+	// A different error reports the new message right away
+	e.print(logf, "network down", start.Add(11*time.Minute))
+	e.print(logf, "network down", start.Add(12*time.Minute))
+	// Recovery summarises the suppressed repeats
+	e.reset(logf, start.Add(13*time.Minute))
+	// After a reset the same error is logged again
+	e.print(logf, "network down", start.Add(14*time.Minute))
+
+	want := []string{
+		"interface eth0 not found",
+		"interface eth0 not found (repeated 5 times in the last 10m0s)",
+		"network down",
+		"network down (repeated 1 times in the last 2m0s)",
+		"network down",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("logged lines:\n%q\nwant:\n%q", lines, want)
+	}
+}
+
+func TestErrorLogCount(t *testing.T) {
+	logf := func(string, ...interface{}) {}
+	var e errorLog
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	e.print(logf, "network down", now)
+	e.print(logf, "network down", now.Add(time.Minute))
+	e.reset(logf, now.Add(2*time.Minute))
+	e.print(logf, "interface eth0 not found", now.Add(3*time.Minute))
+	if got := e.count(); got != 3 {
+		t.Errorf("count() = %d, want 3 (errors survive a reset)", got)
+	}
+}
@@ -0,0 +1,98 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ResolverFlushConfig selects the local caching resolvers to flush after
+// an update, so clients on the LAN see the new address right away instead
+// of a cached old or negative answer.
+type ResolverFlushConfig struct {
+	Unbound         bool   `yaml:"unbound"`
+	SystemdResolved bool   `yaml:"systemd_resolved"`
+	Dnsmasq         bool   `yaml:"dnsmasq"`
+	DnsmasqPIDFile  string `yaml:"dnsmasq_pid_file"`
+}
+
+func (c ResolverFlushConfig) enabled() bool {
+	return c.Unbound || c.SystemdResolved || c.Dnsmasq
+}
+
+// runCommand runs a resolver control command. Replaced in tests.
+var runCommand = func(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// signalProcess sends sig to the process pid. Replaced in tests.
+var signalProcess = func(pid int, sig os.Signal) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Signal(sig)
+}
+
+// flushResolvers drops the updated names from the configured resolvers'
+// caches. Failures are only logged; DNS itself is already up to date.
+func (s *DDNSService) flushResolvers(names []string) {
+	c := s.config.FlushResolver
+	if c.Unbound {
+		for _, name := range names {
+			if err := runCommand("unbound-control", "flush", name); err != nil {
+				s.errorf("Failed to flush %s from unbound: %v", name, err)
+			}
+		}
+	}
+	if c.SystemdResolved {
+		// resolved can only flush its whole cache
+		if err := runCommand("resolvectl", "flush-caches"); err != nil {
+			s.errorf("Failed to flush the systemd-resolved cache: %v", err)
+		}
+	}
+	if c.Dnsmasq {
+		// dnsmasq clears its cache on SIGHUP
+		if err := signalDnsmasq(c.DnsmasqPIDFile); err != nil {
+			s.errorf("Failed to flush the dnsmasq cache: %v", err)
+		}
+	}
+}
+
+func signalDnsmasq(pidFile string) error {
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		return err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return fmt.Errorf("%s does not hold a process ID", pidFile)
+	}
+	return signalProcess(pid, syscall.SIGHUP)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+func TestFlushResolvers(t *testing.T) {
+	oldRun, oldSignal := runCommand, signalProcess
+	defer func() { runCommand, signalProcess = oldRun, oldSignal }()
+	var mu sync.Mutex
+	var calls []string
+	runCommand = func(name string, args ...string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, name+" "+strings.Join(args, " "))
+		return nil
+	}
+	signalProcess = func(pid int, sig os.Signal) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, fmt.Sprintf("signal %d %v", pid, sig == syscall.SIGHUP))
+		return nil
+	}
+
+	pidFile := filepath.Join(t.TempDir(), "dnsmasq.pid")
+	os.WriteFile(pidFile, []byte("4242\n"), 0644)
+
+	config := Config{FlushResolver: ResolverFlushConfig{Unbound: true, SystemdResolved: true, Dnsmasq: true, DnsmasqPIDFile: pidFile}}
+	service := newDDNSService(config, JobConfig{Interface: "eth0",
+		CloudFlare: CloudFlareConfig{RecordName: "home.example.com", Aliases: []string{"www.example.com"}}})
+	records := memProvider{}
+	service.provider = records
+	for _, alias := range service.aliases {
+		alias.provider = records
+	}
+
+	if err := service.publishAll("2001:db8::1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	service.shutdown()
+
+	want := []string{
+		"unbound-control flush home.example.com",
+		"unbound-control flush www.example.com",
+		"resolvectl flush-caches",
+		"signal 4242 true",
+	}
+	if got := strings.Join(calls, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("calls:\n%s\nwant:\n%s", got, strings.Join(want, "\n"))
+	}
+
+	// Nothing changed, so nothing is flushed
+	calls = nil
+	service.publishAll("2001:db8::1")
+	service.shutdown()
+	if len(calls) != 0 {
+		t.Errorf("flushed without an update: %v", calls)
+	}
+}
+
+func TestSignalDnsmasq(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "dnsmasq.pid")
+	os.WriteFile(pidFile, []byte("not a pid\n"), 0644)
+	if err := signalDnsmasq(pidFile); err == nil || !strings.Contains(err.Error(), "does not hold a process ID") {
+		t.Errorf("expected an error for a bad PID file, got %v", err)
+	}
+	if err := signalDnsmasq(filepath.Join(t.TempDir(), "missing.pid")); err == nil {
+		t.Error("expected an error for a missing PID file")
+	}
+}
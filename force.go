@@ -0,0 +1,51 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+// forceUpdate detects the address again and writes it to every record of
+// the job right away: without the stability delay, also to records that
+// hold it already, and without the guard_remote_changes check. It is the
+// SIGUSR1 handler, for after a record was edited by hand. A failed update
+// is retried like any other.
+func (s *DDNSService) forceUpdate() {
+	defer s.recoverPanic("forced update", s.cancelPendingUpdate)
+
+	ip, err := s.detectAddress()
+	if err != nil {
+		s.logf("Not forcing an update: error getting %s address: %v", s.family(), err)
+		return
+	}
+
+	s.mu.Lock()
+	if s.paused {
+		s.mu.Unlock()
+		s.logf("Not forcing an update: the job is paused")
+		return
+	}
+	if s.standingByLocked() {
+		s.mu.Unlock()
+		s.logf("Not forcing an update: another instance holds the leader lease")
+		return
+	}
+	s.cancelPendingUpdateLocked()
+	s.pendingIP = ip
+	s.pendingReason = reasonForced
+	s.forced = true
+	s.mu.Unlock()
+
+	s.stabilityTimerFired()
+}
@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestForceUpdate(t *testing.T) {
+	clock := newFakeClock()
+	provider := &flakyProvider{memProvider: memProvider{}, clock: clock}
+	newRecord := func(name string) *DDNSService {
+		return &DDNSService{
+			config: Config{
+				StabilityDelay: 60,
+				CloudFlare:     CloudFlareConfig{RecordName: name, GuardRemoteChanges: true},
+			},
+			getIPv6:     func(string) (string, error) { return "2001:db8::1", nil },
+			provider:    provider,
+			timeSource:  clock,
+			recordID:    name,
+			lastKnownIP: "2001:db8::1",
+		}
+	}
+	service := newRecord("home.example.com")
+	service.aliases = []*DDNSService{newRecord("www.example.com")}
+
+	// Both records were edited by hand; the service still thinks they hold
+	// its address, so a poll changes nothing
+	provider.memProvider["AAAA home.example.com"] = DNSRecord{ID: "home.example.com", Content: "2001:db8::99"}
+	provider.memProvider["AAAA www.example.com"] = DNSRecord{ID: "www.example.com", Content: "2001:db8::99"}
+	service.checkAndUpdate()
+	if len(provider.writes) != 0 {
+		t.Fatalf("poll wrote %d records", len(provider.writes))
+	}
+
+	service.forceUpdate()
+	if len(provider.writes) != 2 {
+		t.Fatalf("forced update wrote %d records, want 2", len(provider.writes))
+	}
+	for _, name := range []string{"home.example.com", "www.example.com"} {
+		if got := provider.memProvider["AAAA "+name].Content; got != "2001:db8::1" {
+			t.Errorf("%s = %q, want 2001:db8::1", name, got)
+		}
+	}
+	if service.forced || service.pendingIP != "" || clock.Pending() != 0 {
+		t.Errorf("forced = %v, pendingIP = %q, %d timers pending after the update", service.forced, service.pendingIP, clock.Pending())
+	}
+
+	// The next change goes through the stability delay again
+	service.lastKnownIP = "2001:db8::2"
+	service.checkAndUpdate()
+	if clock.Pending() != 1 {
+		t.Errorf("%d timers pending, want the stability timer", clock.Pending())
+	}
+}
@@ -0,0 +1,98 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// HealthConfig sets when a job counts as unhealthy for GET /readyz and the
+// job_unhealthy webhook event.
+type HealthConfig struct {
+	// MaxFailures is the number of failed checks and updates in a row
+	// tolerated before the job is unhealthy; 0 tolerates none.
+	MaxFailures int `yaml:"max_failures"`
+
+	// MaxUpdateAge, in seconds, is how long the job may go without
+	// confirming that its records hold the detected address; 0 disables
+	// the check.
+	MaxUpdateAge int `yaml:"max_update_age"`
+
+	// Optional jobs, e.g. a backup uplink, are reported but never make
+	// the daemon unready.
+	Optional bool `yaml:"optional"`
+}
+
+func validateHealth(health HealthConfig) error {
+	if health.MaxFailures < 0 || health.MaxUpdateAge < 0 {
+		return fmt.Errorf("health settings must not be negative")
+	}
+	return nil
+}
+
+// healthSucceededLocked records that the records hold the detected
+// address, ending a failure streak.
+func (s *DDNSService) healthSucceededLocked() {
+	s.failures = 0
+	s.lastSuccess = s.clock().Now()
+}
+
+// healthFailedLocked counts a failed check or update.
+func (s *DDNSService) healthFailedLocked() {
+	s.failures++
+}
+
+// healthProblemLocked returns why the job breaks its health criteria, or
+// "" while it meets them. Paused and standby jobs are healthy.
+func (s *DDNSService) healthProblemLocked(now time.Time) string {
+	if s.paused || s.standingByLocked() {
+		return ""
+	}
+	health := s.config.Health
+	if s.failures > health.MaxFailures {
+		return fmt.Sprintf("%d failures in a row", s.failures)
+	}
+	if health.MaxUpdateAge > 0 {
+		since := s.lastSuccess
+		if since.IsZero() {
+			since = s.started
+		}
+		if age := now.Sub(since); !since.IsZero() && age > time.Duration(health.MaxUpdateAge)*time.Second {
+			return fmt.Sprintf("records not confirmed for %s", age.Round(time.Second))
+		}
+	}
+	return ""
+}
+
+// checkHealth compares the job with its health criteria after every poll
+// and reports when it becomes unhealthy or recovers.
+func (s *DDNSService) checkHealth() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	problem := s.healthProblemLocked(s.clock().Now())
+	switch {
+	case problem != "" && s.unhealthy == "":
+		s.warnf("Job unhealthy: %s", problem)
+		s.notify(webhookEvent{Event: "job_unhealthy", Severity: "error", Address: s.detectedIP, Error: problem})
+	case problem == "" && s.unhealthy != "":
+		s.logf("Job healthy again")
+		s.notify(webhookEvent{Event: "job_recovered", Severity: "info", Address: s.detectedIP})
+	}
+	s.unhealthy = problem
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthProblem(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		health   HealthConfig
+		failures int
+		success  time.Time
+		paused   bool
+		want     string
+	}{
+		{"healthy", HealthConfig{}, 0, start, false, ""},
+		{"any failure by default", HealthConfig{}, 1, start, false, "1 failures in a row"},
+		{"streak within limit", HealthConfig{MaxFailures: 3}, 3, start, false, ""},
+		{"streak over limit", HealthConfig{MaxFailures: 3}, 4, start, false, "4 failures in a row"},
+		{"recent success", HealthConfig{MaxUpdateAge: 3600}, 0, start.Add(90 * time.Minute), false, ""},
+		{"stale", HealthConfig{MaxUpdateAge: 3600}, 0, start, false, "records not confirmed for 2h0m0s"},
+		{"stale since start", HealthConfig{MaxUpdateAge: 3600}, 0, time.Time{}, false, "records not confirmed for 2h0m0s"},
+		{"paused", HealthConfig{}, 5, start, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &DDNSService{
+				config:      Config{Health: tt.health},
+				failures:    tt.failures,
+				lastSuccess: tt.success,
+				started:     start,
+				paused:      tt.paused,
+			}
+			if got := s.healthProblemLocked(start.Add(2 * time.Hour)); got != tt.want {
+				t.Errorf("healthProblemLocked() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckHealth(t *testing.T) {
+	clock := newFakeClock()
+	var detect error
+	s := &DDNSService{
+		name:        "lte",
+		config:      Config{Interface: "wwan0", Health: HealthConfig{MaxFailures: 2}},
+		getIPv6:     func(string) (string, error) { return "2001:db8::1", detect },
+		provider:    memProvider{},
+		lastKnownIP: "2001:db8::1",
+		timeSource:  clock,
+	}
+
+	poll := func() string {
+		s.checkAndUpdate()
+		s.checkHealth()
+		return s.status().Unhealthy
+	}
+
+	detect = errors.New("no address")
+	for i := 0; i < 2; i++ {
+		if got := poll(); got != "" {
+			t.Fatalf("unhealthy after %d failures: %s", i+1, got)
+		}
+	}
+	if got := poll(); got != "3 failures in a row" {
+		t.Errorf("unhealthy = %q after 3 failures", got)
+	}
+
+	detect = nil
+	if got := poll(); got != "" {
+		t.Errorf("still unhealthy after a successful check: %s", got)
+	}
+	if s.lastSuccess != clock.Now() {
+		t.Errorf("lastSuccess = %v, want %v", s.lastSuccess, clock.Now())
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	primary := &DDNSService{name: "fiber", config: Config{Interface: "eth0"}}
+	backup := &DDNSService{name: "lte", config: Config{Interface: "wwan0", Health: HealthConfig{Optional: true}}}
+	set := newServiceSet([]*DDNSService{primary, backup})
+	handler := newHTTPHandler(HTTPConfig{}, ACMEConfig{}, set)
+
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+		return rec
+	}
+
+	backup.unhealthy = "5 failures in a row"
+	if rec := get(); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"degraded":["lte"]`) {
+		t.Errorf("readyz with an unhealthy optional job = %d %s", rec.Code, rec.Body.String())
+	}
+
+	primary.unhealthy = "records not confirmed for 2h0m0s"
+	if rec := get(); rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"unhealthy":["fiber"]`) {
+		t.Errorf("readyz with an unhealthy job = %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,179 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTPClientConfig tunes the client used for provider API calls. Slow or
+// lossy uplinks (satellite, LTE) may need longer timeouts or retries.
+type HTTPClientConfig struct {
+	Timeout             int `yaml:"timeout"`
+	DialTimeout         int `yaml:"dial_timeout"`
+	TLSHandshakeTimeout int `yaml:"tls_handshake_timeout"`
+	MaxRetries          int `yaml:"max_retries"`
+
+	// MaxRetryTime bounds the retries of a request, in seconds from its
+	// first attempt; unset, only Timeout does.
+	MaxRetryTime int `yaml:"max_retry_time"`
+}
+
+// retryBaseDelay is the wait before the first retry of a failed request; it
+// doubles for every further attempt, and each wait is randomly shortened by
+// up to half so clients failing together don't retry together. A variable
+// so tests can shorten it.
+var retryBaseDelay = time.Second
+
+// newHTTPClient builds the provider API client. Unset timeouts keep the
+// previous defaults: 30 seconds overall, 30 to connect and 10 for TLS. API
+// host names are resolved with resolver, or the system resolver if nil.
+func newHTTPClient(config HTTPClientConfig, resolver *net.Resolver) *http.Client {
+	timeout := seconds(config.Timeout, 30)
+	dialer := &net.Dialer{
+		Timeout:   seconds(config.DialTimeout, 30),
+		KeepAlive: 30 * time.Second,
+		Resolver:  resolver,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = seconds(config.TLSHandshakeTimeout, 10)
+
+	var rt http.RoundTripper = transport
+	if config.MaxRetries > 0 {
+		rt = &retryTransport{
+			base:       transport,
+			maxRetries: config.MaxRetries,
+			maxElapsed: time.Duration(config.MaxRetryTime) * time.Second,
+		}
+	}
+	return &http.Client{Timeout: timeout, Transport: rt}
+}
+
+func seconds(n, def int) time.Duration {
+	if n == 0 {
+		n = def
+	}
+	return time.Duration(n) * time.Second
+}
+
+// retryTransport repeats requests that failed in transit or were answered
+// with a server error or rate limit, as far as shouldRetry allows, waiting
+// as long as a Retry-After header asks. The client timeout still bounds the
+// whole exchange, retries included, and maxElapsed, if set, the retries; a
+// wait that would run past either returns the failure right away instead.
+type retryTransport struct {
+	base       http.RoundTripper
+	maxRetries int
+	maxElapsed time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	delay := retryBaseDelay
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if !shouldRetry(req, resp, err) || attempt == t.maxRetries || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+
+		wait := jitter(delay)
+		if after, ok := retryAfter(resp, time.Now()); ok {
+			wait = after
+		}
+		resume := time.Now().Add(wait)
+		if t.maxElapsed > 0 && resume.Sub(start) > t.maxElapsed {
+			return resp, err
+		}
+		if deadline, ok := req.Context().Deadline(); ok && resume.After(deadline) {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+		delay *= 2
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// shouldRetry reports whether a request that got resp or err may be sent
+// again. Idempotent requests are repeated after any failure in transit,
+// server error or rate limit. Anything else, such as the POST creating a
+// record or a PATCH, may already have been carried out when the answer got
+// lost or the server failed afterwards, and repeating it could apply the
+// write twice; it is only repeated when it was rate limited or the
+// connection couldn't even be made.
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if err == nil && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	if err != nil {
+		var opErr *net.OpError
+		return errors.As(err, &opErr) && opErr.Op == "dial"
+	}
+	return resp.StatusCode == http.StatusTooManyRequests
+}
+
+// jitter shortens delay by a random amount of up to half.
+func jitter(delay time.Duration) time.Duration {
+	if delay < 2 {
+		return delay
+	}
+	return delay - time.Duration(rand.Int63n(int64(delay/2)))
+}
+
+// retryAfter returns the wait a Retry-After header of resp asks for, given
+// in seconds or as a date.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
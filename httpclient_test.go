@@ -0,0 +1,199 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	client := newHTTPClient(HTTPClientConfig{}, nil)
+	if client.Timeout != 30*time.Second {
+		t.Errorf("default timeout = %s, want 30s", client.Timeout)
+	}
+	if _, ok := client.Transport.(*http.Transport); !ok {
+		t.Errorf("expected a plain transport without retries, got %T", client.Transport)
+	}
+
+	client = newHTTPClient(HTTPClientConfig{Timeout: 90, TLSHandshakeTimeout: 40, MaxRetries: 2}, nil)
+	if client.Timeout != 90*time.Second {
+		t.Errorf("timeout = %s, want 90s", client.Timeout)
+	}
+	rt, ok := client.Transport.(*retryTransport)
+	if !ok {
+		t.Fatalf("expected retryTransport, got %T", client.Transport)
+	}
+	if got := rt.base.(*http.Transport).TLSHandshakeTimeout; got != 40*time.Second {
+		t.Errorf("TLS handshake timeout = %s, want 40s", got)
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	orig := retryBaseDelay
+	retryBaseDelay = time.Millisecond
+	defer func() { retryBaseDelay = orig }()
+
+	tests := []struct {
+		name         string
+		method       string
+		statuses     []int
+		maxRetries   int
+		wantStatus   int
+		wantAttempts int
+	}{
+		{"success first time", "PUT", []int{200}, 2, 200, 1},
+		{"recovers from server error", "PUT", []int{502, 503, 200}, 2, 200, 3},
+		{"retries rate limit", "PUT", []int{429, 200}, 1, 200, 2},
+		{"gives up after max retries", "PUT", []int{500, 500, 500}, 1, 500, 2},
+		{"client error not retried", "PUT", []int{400, 200}, 2, 400, 1},
+		{"post not retried after server error", "POST", []int{502, 200}, 2, 502, 1},
+		{"post retried after rate limit", "POST", []int{429, 200}, 2, 200, 2},
+		{"patch not retried after server error", "PATCH", []int{502, 200}, 2, 502, 1},
+		{"patch retried after rate limit", "PATCH", []int{429, 200}, 2, 200, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if string(body) != `{"content":"2001:db8::1"}` {
+					t.Errorf("attempt %d: body = %q", attempts+1, body)
+				}
+				w.WriteHeader(tt.statuses[attempts])
+				attempts++
+			}))
+			defer server.Close()
+
+			client := &http.Client{Transport: &retryTransport{base: http.DefaultTransport, maxRetries: tt.maxRetries}}
+			req, _ := http.NewRequest(tt.method, server.URL, strings.NewReader(`{"content":"2001:db8::1"}`))
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+
+	t.Run("connection error", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		url := server.URL
+		server.Close()
+
+		client := &http.Client{Transport: &retryTransport{base: http.DefaultTransport, maxRetries: 2}}
+		if _, err := client.Get(url); err == nil {
+			t.Error("expected error from closed server")
+		}
+	})
+
+	// A POST is only repeated when it can't have reached the server
+	for _, tt := range []struct {
+		name         string
+		err          error
+		wantAttempts int
+	}{
+		{"post retried after dial error", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, 3},
+		{"post not retried after connection reset", &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, 1},
+		{"post not retried after lost answer", io.ErrUnexpectedEOF, 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			base := roundTripFunc(func(*http.Request) (*http.Response, error) {
+				attempts++
+				return nil, tt.err
+			})
+			client := &http.Client{Transport: &retryTransport{base: base, maxRetries: 2}}
+			if _, err := client.Post("http://api.example.com/dns_records", "application/json", strings.NewReader("{}")); err == nil {
+				t.Error("expected an error")
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"120", 2 * time.Minute, true},
+		{"0", 0, true},
+		{"Wed, 01 Jan 2025 12:00:30 GMT", 30 * time.Second, true},
+		{"Wed, 01 Jan 2025 11:00:00 GMT", 0, true},
+		{"soon", 0, false},
+		{"-5", 0, false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		if tt.header != "" {
+			resp.Header.Set("Retry-After", tt.header)
+		}
+		got, ok := retryAfter(resp, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %s, %v, want %s, %v", tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if got := jitter(time.Second); got <= 500*time.Millisecond || got > time.Second {
+			t.Fatalf("jitter(1s) = %s, want within (500ms, 1s]", got)
+		}
+	}
+}
+
+func TestRetryTransportRetryAfter(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	// The first answer asks for no wait at all, so the retry is sent
+	// although the backoff would outlast maxElapsed; the second asks for
+	// an hour, past maxElapsed, so it is returned right away
+	orig := retryBaseDelay
+	retryBaseDelay = time.Hour
+	defer func() { retryBaseDelay = orig }()
+	client := &http.Client{Transport: &retryTransport{base: http.DefaultTransport, maxRetries: 5, maxElapsed: time.Minute}}
+	start := time.Now()
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || attempts != 2 {
+		t.Errorf("status %d after %d attempts, want 503 after 2", resp.StatusCode, attempts)
+	}
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("took %s, want no waiting", took)
+	}
+}
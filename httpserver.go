@@ -0,0 +1,390 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type HTTPConfig struct {
+	Listen       string `yaml:"listen"`
+	TriggerToken string `yaml:"trigger_token"`
+}
+
+type httpHandler struct {
+	config   HTTPConfig
+	acme     ACMEConfig
+	services *serviceSet
+}
+
+func newHTTPHandler(config HTTPConfig, acme ACMEConfig, services *serviceSet) http.Handler {
+	h := &httpHandler{config: config, acme: acme, services: services}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/trigger", h.trigger)
+	mux.HandleFunc("/healthz", h.healthz)
+	mux.HandleFunc("/readyz", h.readyz)
+	mux.HandleFunc("/status", h.status)
+	if acme.enabled() {
+		mux.HandleFunc("/acme/present", func(w http.ResponseWriter, r *http.Request) { h.acmeRequest(w, r, true) })
+		mux.HandleFunc("/acme/cleanup", func(w http.ResponseWriter, r *http.Request) { h.acmeRequest(w, r, false) })
+	}
+	return mux
+}
+
+// startHTTPServer serves the HTTP endpoints on the sockets passed by systemd
+// socket activation or, without those, on http.listen. It returns nil if
+// there is nothing to listen on.
+func startHTTPServer(config HTTPConfig, acme ACMEConfig, services *serviceSet) (*http.Server, error) {
+	listeners, err := activationListeners()
+	if err != nil {
+		return nil, fmt.Errorf("systemd socket activation: %w", err)
+	}
+	if len(listeners) > 0 {
+		if config.Listen != "" {
+			logInfo("Using sockets passed by systemd instead of http.listen %s", config.Listen)
+		}
+		if config.TriggerToken == "" {
+			for _, ln := range listeners {
+				ln.Close()
+			}
+			return nil, fmt.Errorf("http.trigger_token is required for sockets passed by systemd")
+		}
+	} else if config.Listen != "" {
+		ln, err := net.Listen("tcp", config.Listen)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, ln)
+	} else {
+		if acme.enabled() {
+			logWarn("Warning: the ACME helper is not available without http.listen")
+		}
+		return nil, nil
+	}
+
+	server := &http.Server{
+		Handler:           newHTTPHandler(config, acme, services),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	for _, ln := range listeners {
+		go func(ln net.Listener) {
+			if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+				logError("HTTP server error: %v", err)
+			}
+		}(ln)
+		logInfo("Listening for HTTP requests on %s", ln.Addr())
+	}
+	return server, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// authorized checks the trigger token, given either as a bearer token or,
+// for routers that can only call a plain URL, as the token query parameter.
+func (h *httpHandler) authorized(r *http.Request) bool {
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.config.TriggerToken)) == 1
+}
+
+// trigger starts an immediate address check instead of waiting for the next
+// poll. The optional ip parameter (JSON body, form or query) is the address
+// the caller saw change; it is validated and logged, and limits the check to
+// the jobs' services of its family, but the published address is still read
+// from the job's interface.
+func (h *httpHandler) trigger(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !h.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "invalid or missing token")
+		return
+	}
+
+	var payload struct {
+		IP string `json:"ip"`
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+	} else {
+		payload.IP = r.FormValue("ip")
+	}
+
+	services, ok := h.services.selectJob(r.URL.Query().Get("job"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown job")
+		return
+	}
+
+	if payload.IP != "" {
+		ip := net.ParseIP(payload.IP)
+		recordType := "AAAA"
+		switch {
+		case ip != nil && ip.To4() != nil && isValidPublicIPv4(ip):
+			recordType = "A"
+		case ip == nil || !isValidPublicIPv6(ip):
+			writeError(w, http.StatusBadRequest, "ip is not a public IPv4 or IPv6 address")
+			return
+		}
+		var matching []*DDNSService
+		for _, s := range services {
+			if s.typ() == recordType {
+				matching = append(matching, s)
+			}
+		}
+		if len(matching) == 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("no selected job keeps %s records for ip", recordType))
+			return
+		}
+		services = matching
+		logInfo("Trigger received from %s (reported address %s)", r.RemoteAddr, payload.IP)
+	} else {
+		logInfo("Trigger received from %s", r.RemoteAddr)
+	}
+	for _, s := range services {
+		go s.safeCheckAndUpdate()
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "accepted"})
+}
+
+// statusSchema is the version of the layout of GET /status and of the
+// status page's status.json. Fields may be added within a version;
+// renaming, removing or changing the meaning of one needs a new version.
+const statusSchema = 1
+
+// minStatusSchema is the oldest layout GET /status can still produce for
+// clients that ask for it with ?schema=N.
+const minStatusSchema = 1
+
+// jobStatus is the state of one job as reported by GET /status.
+type jobStatus struct {
+	Job       string         `json:"job,omitempty"`
+	Interface string         `json:"interface"`
+	Detected  string         `json:"detected,omitempty"`
+	Pending   string         `json:"pending,omitempty"`
+	Standby   bool           `json:"standby,omitempty"`
+	Paused    bool           `json:"paused,omitempty"`
+	Invalid   bool           `json:"invalid,omitempty"`
+	Unhealthy string         `json:"unhealthy,omitempty"`
+	LastError string         `json:"last_error,omitempty"`
+	Records   []recordStatus `json:"records"`
+
+	DetectErrors int `json:"detect_errors"`
+	UpdateErrors int `json:"update_errors"`
+
+	// StaleSince is when an update first failed, while it keeps failing
+	StaleSince *time.Time `json:"stale_since,omitempty"`
+
+	// UpdateAt is when the pending address is written next, once the
+	// stability delay or the backoff of a failed update has passed
+	UpdateAt *time.Time `json:"update_at,omitempty"`
+
+	// Prefix is the prefix of the last stable address, and Prefixes the
+	// history of the ones it was in
+	Prefix   *Prefix      `json:"prefix,omitempty"`
+	Prefixes []prefixSeen `json:"prefixes,omitempty"`
+}
+
+// status returns the job's current state. LastError is the detection or
+// update error currently being reported; it clears once the job recovers.
+// DetectErrors and UpdateErrors count the failures since the daemon started.
+// Invalid marks a job left out by soft_fail, which never runs. Unhealthy
+// is why the job breaks its health criteria.
+func (s *DDNSService) status() jobStatus {
+	s.mu.Lock()
+	st := jobStatus{
+		Job:       s.name,
+		Interface: s.config.Interface,
+		Detected:  s.detectedIP,
+		Pending:   s.pendingIP,
+		Standby:   s.standingByLocked(),
+		Paused:    s.paused,
+		Unhealthy: s.unhealthy,
+	}
+	if since := s.staleSince; !since.IsZero() {
+		st.StaleSince = &since
+	}
+	if at := s.updateAt; s.stabilityTimer != nil {
+		st.UpdateAt = &at
+	}
+	prefix := s.prefix
+	st.Prefixes = append([]prefixSeen(nil), s.prefixes...)
+	s.mu.Unlock()
+
+	if prefix.Network.IsValid() {
+		prefix = prefix.withLifetimes()
+		st.Prefix = &prefix
+	}
+
+	if msg := s.detectErrors.current(); msg != "" {
+		st.LastError = msg
+	} else {
+		st.LastError = s.updateErrors.current()
+	}
+	st.DetectErrors = s.detectErrors.count()
+	st.UpdateErrors = s.updateErrors.count()
+	st.Records = s.recordStatuses()
+	return st
+}
+
+// readyz answers 200 while every job meets its health criteria and 503
+// otherwise. Jobs with health.optional are listed as degraded but don't
+// make the daemon unready. Like /healthz it needs no token.
+func (h *httpHandler) readyz(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	unhealthy, degraded := []string{}, []string{}
+	add := func(name string, optional bool) {
+		if optional {
+			degraded = append(degraded, name)
+		} else {
+			unhealthy = append(unhealthy, name)
+		}
+	}
+	for _, s := range h.services.list() {
+		s.mu.Lock()
+		problem, optional := s.unhealthy, s.config.Health.Optional
+		s.mu.Unlock()
+		if problem != "" {
+			add(s.jobLabel(), optional)
+		}
+	}
+	for _, b := range h.services.brokenJobs() {
+		add(b.Name, b.Optional)
+	}
+
+	if len(unhealthy) > 0 {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"status": "unready", "unhealthy": unhealthy, "degraded": degraded})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ready", "degraded": degraded})
+}
+
+func allowGet(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return false
+	}
+	return true
+}
+
+// healthz answers 200 while every job detects and publishes its address
+// without errors and 503 otherwise. It needs no token so load balancers and
+// container runtimes can poll it.
+func (h *httpHandler) healthz(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	failing := []string{}
+	for _, s := range h.services.list() {
+		if s.detectErrors.current() != "" || s.updateErrors.current() != "" {
+			failing = append(failing, s.jobLabel())
+		}
+	}
+	for _, b := range h.services.brokenJobs() {
+		failing = append(failing, b.Name)
+	}
+	if len(failing) > 0 {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"status": "failing", "failing": failing})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// status reports the state of every job. It shows addresses and error
+// messages, so it takes the trigger token like /trigger.
+//
+// Clients name the newest layout they understand with ?schema=N and get the
+// newest one the daemon has up to N, so a client that is newer than the
+// running daemon, e.g. halfway through a package upgrade, still gets an
+// answer it can read. The layout used is in the schema field.
+func (h *httpHandler) status(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	if !h.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "invalid or missing token")
+		return
+	}
+	serveStatus(w, r, h.services)
+}
+
+// serveStatus writes the status of every job in the layout asked for, for
+// GET /status and the control socket.
+func serveStatus(w http.ResponseWriter, r *http.Request, services *serviceSet) {
+	schema := statusSchema
+	if v := r.URL.Query().Get("schema"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "schema must be a number")
+			return
+		}
+		if n < minStatusSchema {
+			writeJSON(w, http.StatusNotAcceptable, map[string]interface{}{
+				"error":      fmt.Sprintf("schema %d is no longer supported", n),
+				"min_schema": minStatusSchema,
+				"schema":     statusSchema,
+			})
+			return
+		}
+		if n < schema {
+			schema = n
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"schema": schema, "jobs": jobStatuses(services)})
+}
+
+// jobStatuses returns the status of every job, running or left out by
+// soft_fail.
+func jobStatuses(services *serviceSet) []jobStatus {
+	jobs := []jobStatus{}
+	for _, s := range services.list() {
+		jobs = append(jobs, s.status())
+	}
+	for _, b := range services.brokenJobs() {
+		jobs = append(jobs, b.status())
+	}
+	return jobs
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTriggerHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		auth        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantChecks  []string
+	}{
+		{
+			name:       "bearer token",
+			method:     "POST",
+			target:     "/trigger",
+			auth:       "Bearer secret",
+			wantStatus: http.StatusAccepted,
+			wantChecks: []string{"eth0", "eth0 A", "wwan0"},
+		},
+		{
+			name:       "query token and job",
+			method:     "POST",
+			target:     "/trigger?token=secret&job=lte",
+			wantStatus: http.StatusAccepted,
+			wantChecks: []string{"wwan0"},
+		},
+		{
+			name:        "json payload",
+			method:      "POST",
+			target:      "/trigger?job=fiber",
+			auth:        "Bearer secret",
+			contentType: "application/json",
+			body:        `{"ip": "2001:db8::1"}`,
+			wantStatus:  http.StatusAccepted,
+			wantChecks:  []string{"eth0"},
+		},
+		{
+			name:        "ipv4 address",
+			method:      "POST",
+			target:      "/trigger",
+			auth:        "Bearer secret",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "ip=203.0.113.7",
+			wantStatus:  http.StatusAccepted,
+			wantChecks:  []string{"eth0 A"},
+		},
+		{
+			name:        "ipv4 address for a job without A records",
+			method:      "POST",
+			target:      "/trigger?job=lte",
+			auth:        "Bearer secret",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "ip=203.0.113.7",
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "private ipv4 address",
+			method:      "POST",
+			target:      "/trigger",
+			auth:        "Bearer secret",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "ip=192.168.1.1",
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:       "wrong method",
+			method:     "GET",
+			target:     "/trigger?token=secret",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "missing token",
+			method:     "POST",
+			target:     "/trigger",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "wrong token",
+			method:     "POST",
+			target:     "/trigger",
+			auth:       "Bearer nope",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:        "non-public address",
+			method:      "POST",
+			target:      "/trigger",
+			auth:        "Bearer secret",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "ip=fe80::1",
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:       "unknown job",
+			method:     "POST",
+			target:     "/trigger?job=dsl",
+			auth:       "Bearer secret",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checked := make(chan string, 3)
+			newService := func(name, iface, recordType string) *DDNSService {
+				return &DDNSService{
+					name:       name,
+					config:     Config{Interface: iface},
+					recordType: recordType,
+					getIPv6: func(ifaceName string) (string, error) {
+						checked <- strings.TrimSpace(ifaceName + " " + recordType)
+						return "", fmt.Errorf("no address")
+					},
+				}
+			}
+			handler := newHTTPHandler(HTTPConfig{TriggerToken: "secret"}, ACMEConfig{}, newServiceSet([]*DDNSService{
+				newService("fiber", "eth0", ""),
+				newService("fiber", "eth0", "A"),
+				newService("lte", "wwan0", ""),
+			}))
+
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body: %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			got := make(map[string]bool)
+			for range tt.wantChecks {
+				select {
+				case iface := <-checked:
+					got[iface] = true
+				case <-time.After(2 * time.Second):
+					t.Fatalf("timeout waiting for address checks, got %v", got)
+				}
+			}
+			for _, iface := range tt.wantChecks {
+				if !got[iface] {
+					t.Errorf("expected check on %s, got %v", iface, got)
+				}
+			}
+			select {
+			case iface := <-checked:
+				t.Errorf("unexpected check on %s", iface)
+			default:
+			}
+		})
+	}
+}
+
+func TestStatusHandlers(t *testing.T) {
+	healthy := &DDNSService{
+		name:        "fiber",
+		config:      Config{Interface: "eth0", CloudFlare: CloudFlareConfig{RecordName: "home.example.com"}},
+		lastKnownIP: "2001:db8::1",
+		detectedIP:  "2001:db8::2",
+		pendingIP:   "2001:db8::2",
+	}
+	failing := &DDNSService{
+		name:   "lte",
+		config: Config{Interface: "wwan0", CloudFlare: CloudFlareConfig{RecordName: "backup.example.com"}},
+	}
+	handler := newHTTPHandler(HTTPConfig{TriggerToken: "secret"}, ACMEConfig{}, newServiceSet([]*DDNSService{healthy, failing}))
+
+	get := func(target, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := get("/healthz", ""); rec.Code != http.StatusOK {
+		t.Errorf("healthz = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+
+	failing.detectErrors.print(func(string, ...interface{}) {}, "Error getting IPv6 address: no address", time.Now())
+	rec := get("/healthz", "")
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"failing":["lte"]`) {
+		t.Errorf("healthz = %d %s, want 503 naming lte", rec.Code, rec.Body.String())
+	}
+
+	if rec := get("/status", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("status without token = %d, want 401", rec.Code)
+	}
+	rec = get("/status", "Bearer secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body: %s)", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		Schema int         `json:"schema"`
+		Jobs   []jobStatus `json:"jobs"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding status: %v", err)
+	}
+	if body.Schema != statusSchema {
+		t.Errorf("schema = %d, want %d", body.Schema, statusSchema)
+	}
+	if len(body.Jobs) != 2 {
+		t.Fatalf("got %d jobs, want 2", len(body.Jobs))
+	}
+	fiber, lte := body.Jobs[0], body.Jobs[1]
+	if fiber.Pending != "2001:db8::2" || fiber.LastError != "" || len(fiber.Records) != 1 || fiber.Records[0].Address != "2001:db8::1" {
+		t.Errorf("fiber status = %+v", fiber)
+	}
+	if lte.LastError != "Error getting IPv6 address: no address" {
+		t.Errorf("lte last_error = %q", lte.LastError)
+	}
+
+	if rec := get("/status?token=secret", ""); rec.Code != http.StatusOK {
+		t.Errorf("status with query token = %d, want 200", rec.Code)
+	}
+
+	// A newer client gets the newest layout this daemon has
+	rec = get(fmt.Sprintf("/status?schema=%d", statusSchema+1), "Bearer secret")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), fmt.Sprintf(`"schema":%d`, statusSchema)) {
+		t.Errorf("status for a newer client = %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := get(fmt.Sprintf("/status?schema=%d", minStatusSchema-1), "Bearer secret"); rec.Code != http.StatusNotAcceptable {
+		t.Errorf("status for a retired schema = %d, want 406", rec.Code)
+	}
+	if rec := get("/status?schema=latest", "Bearer secret"); rec.Code != http.StatusBadRequest {
+		t.Errorf("status with a malformed schema = %d, want 400", rec.Code)
+	}
+	req := httptest.NewRequest("POST", "/healthz", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /healthz = %d, want 405", rec.Code)
+	}
+}
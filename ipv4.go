@@ -0,0 +1,140 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// IPv4Config adds an A record next to the job's AAAA record. The address is
+// read from the job's interface, or from URL when the host is behind NAT.
+// The A record has its own stability and retry state.
+type IPv4Config struct {
+	Enabled bool   `yaml:"enabled"`
+	URL     string `yaml:"url"`
+}
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598); addresses
+// in it are not reachable from the Internet.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0).To4(), Mask: net.CIDRMask(10, 32)}
+
+func isValidPublicIPv4(ip net.IP) bool {
+	return ip.To4() != nil && ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+// getPublicIPv4 returns the lowest public IPv4 address of the interface.
+func getPublicIPv4(ifaceName string) (string, error) {
+	iface, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return "", fmt.Errorf("interface %s not found: %w", ifaceName, err)
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("getting addresses for %s: %w", ifaceName, err)
+	}
+
+	var candidates []net.IP
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && isValidPublicIPv4(ipNet.IP) {
+			candidates = append(candidates, ipNet.IP.To4())
+		}
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no public IPv4 address found on interface %s", ifaceName)
+	}
+	sort.Slice(candidates, func(i, j int) bool { return bytes.Compare(candidates[i], candidates[j]) < 0 })
+	return candidates[0].String(), nil
+}
+
+// newIPv4URLSource returns an address source that asks a web service for
+// the host's public IPv4 address. The connection is forced over IPv4. The
+// response is either the bare address or, as returned by CloudFlare's
+// /cdn-cgi/trace, an "ip=<address>" line.
+func newIPv4URLSource(url string) func(string) (string, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "tcp4", addr)
+	}
+	client := &http.Client{Timeout: 15 * time.Second, Transport: transport}
+
+	return func(string) (string, error) {
+		resp, err := client.Get(url)
+		if err != nil {
+			return "", fmt.Errorf("querying %s: %w", url, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("querying %s: %s", url, resp.Status)
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if err != nil {
+			return "", fmt.Errorf("reading response from %s: %w", url, err)
+		}
+		return parseIPv4Response(body)
+	}
+}
+
+func parseIPv4Response(body []byte) (string, error) {
+	text := strings.TrimSpace(string(body))
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "ip="); ok {
+			text = value
+			break
+		}
+	}
+	ip := net.ParseIP(text)
+	if ip == nil || !isValidPublicIPv4(ip) {
+		return "", fmt.Errorf("response is not a public IPv4 address: %q", text)
+	}
+	return ip.String(), nil
+}
+
+// newIPv4Service creates the A record updater for a job. It manages the
+// same names as the AAAA updater, including aliases, records and zones,
+// except records that publish content of their own.
+func newIPv4Service(config Config, job JobConfig) *DDNSService {
+	s := newDDNSService(config, job)
+	s.recordType = "A"
+	s.getIPv6 = getPublicIPv4
+	if job.IPv4.URL != "" {
+		s.getIPv6 = newIPv4URLSource(job.IPv4.URL)
+	}
+	s.lookupIP = newLookupIP(verifyResolver(s.config), "ip4")
+	// Records with content of their own are only published over IPv6
+	aliases := s.aliases[:0]
+	for _, alias := range s.aliases {
+		if alias.content != "" || alias.recordType == "TXT" {
+			continue
+		}
+		alias.recordType = "A"
+		aliases = append(aliases, alias)
+	}
+	s.aliases = aliases
+	return s
+}
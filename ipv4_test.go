@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestIsValidPublicIPv4(t *testing.T) {
+	tests := map[string]bool{
+		"203.0.113.5": true,
+		"192.168.1.1": false,
+		"10.0.0.1":    false,
+		"100.64.0.1":  false, // carrier-grade NAT
+		"127.0.0.1":   false,
+		"169.254.1.1": false,
+		"2001:db8::1": false,
+	}
+	for addr, want := range tests {
+		if got := isValidPublicIPv4(net.ParseIP(addr)); got != want {
+			t.Errorf("isValidPublicIPv4(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestParseIPv4Response(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{"bare address", "203.0.113.5\n", "203.0.113.5", false},
+		{"cdn-cgi trace", "fl=1f1\nh=cloudflare.com\nip=203.0.113.5\nts=1700000000.1\n", "203.0.113.5", false},
+		{"private address", "192.168.1.2", "", true},
+		{"IPv6 address", "2001:db8::1", "", true},
+		{"garbage", "<html>", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseIPv4Response([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseIPv4Response() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseIPv4Response() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPv4URLSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ip=203.0.113.5\n"))
+	}))
+	defer server.Close()
+
+	got, err := newIPv4URLSource(server.URL)("eth0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "203.0.113.5" {
+		t.Errorf("address = %q, want 203.0.113.5", got)
+	}
+}
+
+func TestIPv4Service(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == "GET" {
+			requests = append(requests, "GET "+r.URL.Query().Get("type")+" "+r.URL.Query().Get("name"))
+			w.Write([]byte(`{"success": true, "result": []}`))
+			return
+		}
+		var rec DNSRecord
+		json.NewDecoder(r.Body).Decode(&rec)
+		requests = append(requests, r.Method+" "+rec.Type+" "+rec.Name+" "+rec.Content)
+		w.Write([]byte(`{"success": true, "result": {"id": "rec"}}`))
+	}))
+	defer server.Close()
+
+	job := JobConfig{
+		Name:      "home",
+		Interface: "eth0",
+		IPv4:      IPv4Config{Enabled: true},
+		CloudFlare: CloudFlareConfig{
+			APIToken:   "token",
+			ZoneID:     "zone",
+			RecordName: "home.example.com",
+			TTL:        1,
+			Aliases:    []string{"www.example.com"},
+		},
+	}
+	service := newIPv4Service(Config{}, job)
+	service.httpClient = server.Client()
+	cloudflareAt(service, server.Client(), server.URL)
+	for _, alias := range service.aliases {
+		alias.httpClient = server.Client()
+		cloudflareAt(alias, server.Client(), server.URL)
+	}
+
+	if err := service.fetchRecordIDs(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := service.publishAll("203.0.113.5"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		"GET A home.example.com",
+		"GET TXT home.example.com",
+		"GET TXT a-home.example.com",
+		"GET A www.example.com",
+		"GET TXT www.example.com",
+		"GET TXT a-www.example.com",
+		"POST A home.example.com 203.0.113.5",
+		"POST A www.example.com 203.0.113.5",
+	}
+	if got := strings.Join(requests, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("requests:\n%s\nwant:\n%s", got, strings.Join(want, "\n"))
+	}
+}
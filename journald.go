@@ -0,0 +1,89 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// journalSocket is where journald takes entries in its native protocol.
+// Replaced in tests.
+var journalSocket = "/run/systemd/journal/socket"
+
+// journal sends log entries to journald, so they carry their priority and
+// fields such as RECORD and NEW_IP that journalctl can filter on.
+type journal struct {
+	conn       *net.UnixConn
+	identifier string
+}
+
+func dialJournal() (*journal, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journal{conn: conn, identifier: filepath.Base(os.Args[0])}, nil
+}
+
+// journalPriority maps a level to a syslog priority.
+func journalPriority(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3 // err
+	case level >= slog.LevelWarn:
+		return 4 // warning
+	case level >= slog.LevelInfo:
+		return 6 // info
+	}
+	return 7 // debug
+}
+
+// send writes one entry with msg and fields, whose keys are upper-cased
+// to journal field names.
+func (j *journal) send(level slog.Level, msg string, fields []slog.Attr) error {
+	var b bytes.Buffer
+	appendJournalField(&b, "MESSAGE", msg)
+	appendJournalField(&b, "PRIORITY", strconv.Itoa(journalPriority(level)))
+	appendJournalField(&b, "SYSLOG_IDENTIFIER", j.identifier)
+	for _, field := range fields {
+		appendJournalField(&b, strings.ToUpper(field.Key), field.Value.String())
+	}
+	if _, err := j.conn.Write(b.Bytes()); err != nil {
+		return fmt.Errorf("writing to the journal: %w", err)
+	}
+	return nil
+}
+
+// appendJournalField encodes a field in the native protocol: KEY=value, or
+// for values with newlines the key, the length and the raw value.
+func appendJournalField(b *bytes.Buffer, key, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(b, "%s=%s\n", key, value)
+		return
+	}
+	b.WriteString(key + "\n")
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value + "\n")
+}
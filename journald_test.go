@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseJournalEntry decodes an entry of the native journal protocol.
+func parseJournalEntry(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	fields := make(map[string]string)
+	for len(data) > 0 {
+		line, rest, _ := bytes.Cut(data, []byte("\n"))
+		if key, value, ok := bytes.Cut(line, []byte("=")); ok {
+			fields[string(key)] = string(value)
+			data = rest
+			continue
+		}
+		if len(rest) < 8 {
+			t.Fatalf("truncated binary field %s", line)
+		}
+		n := binary.LittleEndian.Uint64(rest)
+		fields[string(line)] = string(rest[8 : 8+n])
+		data = rest[8+n+1:]
+	}
+	return fields
+}
+
+func TestJournalLogging(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	ln, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	defer func(orig string) { journalSocket = orig }(journalSocket)
+	journalSocket = path
+	defer setupLogging(LogConfig{})
+	setupLogging(LogConfig{Format: "journald"})
+
+	receive := func() map[string]string {
+		t.Helper()
+		buf := make([]byte, 65536)
+		ln.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, err := ln.Read(buf)
+		if err != nil {
+			t.Fatalf("no journal entry: %v", err)
+		}
+		return parseJournalEntry(t, buf[:n])
+	}
+
+	s := &DDNSService{name: "home"}
+	s.logFields(slog.LevelInfo, updateFields("home.example.com", "2001:db8::1", "2001:db8::2", 0), "Successfully updated DNS record to %s", "2001:db8::2")
+	got := receive()
+	want := map[string]string{
+		"MESSAGE":  "[home] Successfully updated DNS record to 2001:db8::2",
+		"PRIORITY": "6",
+		"JOB":      "home",
+		"RECORD":   "home.example.com",
+		"OLD_IP":   "2001:db8::1",
+		"NEW_IP":   "2001:db8::2",
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %q, want %q", key, got[key], value)
+		}
+	}
+
+	s.errorf("Recovered from panic in test: boom\nstack")
+	got = receive()
+	if got["PRIORITY"] != "3" || got["MESSAGE"] != "[home] Recovered from panic in test: boom\nstack" {
+		t.Errorf("multi-line error entry = %q", got)
+	}
+}
+
+func TestJournalPriority(t *testing.T) {
+	for level, want := range map[slog.Level]int{slog.LevelDebug: 7, slog.LevelInfo: 6, slog.LevelWarn: 4, slog.LevelError: 3} {
+		if got := journalPriority(level); got != want {
+			t.Errorf("journalPriority(%v) = %d, want %d", level, got, want)
+		}
+	}
+	if !strings.Contains(validateLog(LogConfig{Format: "syslog"}).Error(), "journald") {
+		t.Errorf("validateLog() doesn't mention journald")
+	}
+}
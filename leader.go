@@ -0,0 +1,195 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LeaderConfig enables active/passive redundancy: instances sharing a lease
+// record elect one leader, and only the leader writes DNS.
+type LeaderConfig struct {
+	Record     string `yaml:"record"`
+	InstanceID string `yaml:"instance_id"`
+	Lease      int    `yaml:"lease"`
+}
+
+// leaderLease is the content of the lease record: the instance holding it
+// and when its lease runs out.
+type leaderLease struct {
+	Instance string
+	Until    time.Time
+}
+
+func (l leaderLease) String() string {
+	return fmt.Sprintf("%s leader=%s until=%d", stampPrefix, l.Instance, l.Until.Unix())
+}
+
+// parseLease reads a lease record. Records not written by this tool are
+// reported as not ok and may be taken over.
+func parseLease(content string) (leaderLease, bool) {
+	fields := strings.Fields(strings.Trim(content, `"`))
+	if len(fields) == 0 || fields[0] != stampPrefix {
+		return leaderLease{}, false
+	}
+
+	var l leaderLease
+	for _, field := range fields[1:] {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "leader":
+			l.Instance = value
+		case "until":
+			until, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return leaderLease{}, false
+			}
+			l.Until = time.Unix(until, 0)
+		}
+	}
+	if l.Instance == "" || l.Until.IsZero() {
+		return leaderLease{}, false
+	}
+	return l, true
+}
+
+func validateLeader(config Config) error {
+	if config.Leader.Lease <= 0 {
+		return fmt.Errorf("leader.lease must be positive")
+	}
+	for _, job := range config.jobs() {
+		if !job.enabled() {
+			continue
+		}
+		if job.Provider != "" && job.Provider != "cloudflare" {
+			return fmt.Errorf("leader is only supported with the cloudflare provider")
+		}
+		if config.Leader.Lease < 2*job.PollInterval {
+			return fmt.Errorf("leader.lease must be at least twice poll_interval (%ds)", job.PollInterval)
+		}
+	}
+	return nil
+}
+
+// leaderElection is a job's view of the lease. The lease is renewed from
+// the poll loop, so a leader that stops polling loses it after lease
+// seconds and a standby takes over.
+type leaderElection struct {
+	record   string
+	instance string
+	lease    time.Duration
+	errors   errorLog
+
+	// Guarded by the service's mu
+	leading bool
+	holder  string
+	expires time.Time
+}
+
+// claim renews the lease, or takes it over when it has run out, and
+// returns the instance holding it afterwards.
+func (l *leaderElection) claim(p Provider, now time.Time) (string, time.Time, error) {
+	rec, err := p.FetchRecord("TXT", l.record)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if rec != nil {
+		if lease, ok := parseLease(rec.Content); ok && lease.Instance != l.instance && now.Before(lease.Until) {
+			return lease.Instance, lease.Until, nil
+		}
+	}
+
+	until := now.Add(l.lease).Truncate(time.Second)
+	record := DNSRecord{Type: "TXT", Name: l.record, Content: leaderLease{l.instance, until}.String(), TTL: 60}
+	if rec == nil {
+		_, err = p.CreateRecord(record)
+	} else {
+		record.ID = rec.ID
+		_, err = p.UpdateRecord(record)
+	}
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	// A standby may have taken over an expired lease at the same moment;
+	// whichever write landed last holds it.
+	rec, err = p.FetchRecord("TXT", l.record)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if rec == nil {
+		return "", time.Time{}, fmt.Errorf("lease record %s disappeared", l.record)
+	}
+	lease, ok := parseLease(rec.Content)
+	if !ok {
+		return "", time.Time{}, fmt.Errorf("lease record %s holds %q", l.record, rec.Content)
+	}
+	return lease.Instance, lease.Until, nil
+}
+
+// campaign renews or contends for the lease and reports whether this
+// instance may write DNS. A leader renews once half its lease has passed.
+func (s *DDNSService) campaign(now time.Time) bool {
+	l := s.leader
+	s.mu.Lock()
+	if l.leading && now.Before(l.expires.Add(-l.lease/2)) {
+		s.mu.Unlock()
+		return true
+	}
+	s.mu.Unlock()
+
+	holder, until, err := l.claim(s.provider, now)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		l.errors.print(s.logf, fmt.Sprintf("Error renewing leader lease: %v", err), now)
+		// Keep writing until our lease would have run out, so a provider
+		// outage doesn't leave both instances standing by
+		if l.leading && now.After(l.expires) {
+			s.logf("Leader lease expired, standing by")
+			l.leading = false
+		}
+		return l.leading
+	}
+	l.errors.reset(s.logf, now)
+
+	leading := holder == l.instance
+	switch {
+	case leading && !l.leading:
+		s.logf("Became leader, holding %s until %s", l.record, until.Format(time.RFC3339))
+	case !leading && l.leading:
+		s.warnf("Lost leadership to %s, standing by", holder)
+	case !leading && holder != l.holder:
+		s.logf("Standing by: %s is the leader until %s", holder, until.Format(time.RFC3339))
+	}
+	l.leading = leading
+	l.holder = holder
+	if leading {
+		l.expires = until
+	}
+	return leading
+}
+
+// standingByLocked reports whether another instance holds the lease. The caller
+// holds s.mu.
+func (s *DDNSService) standingByLocked() bool {
+	return s.leader != nil && !s.leader.leading
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// memProvider keeps records in memory, keyed by type and name.
+type memProvider map[string]DNSRecord
+
+func (m memProvider) Capabilities() Capabilities {
+	return Capabilities{Comments: true, Proxied: true, AutoTTL: 1}
+}
+
+func (m memProvider) FetchRecord(recordType, name string) (*DNSRecord, error) {
+	if rec, ok := m[recordType+" "+name]; ok {
+		return &rec, nil
+	}
+	return nil, nil
+}
+
+func (m memProvider) CreateRecord(record DNSRecord) (DNSRecord, error) {
+	record.ID = record.Name
+	m[record.Type+" "+record.Name] = record
+	return record, nil
+}
+
+func (m memProvider) UpdateRecord(record DNSRecord) (DNSRecord, error) {
+	m[record.Type+" "+record.Name] = record
+	return record, nil
+}
+
+func TestParseLease(t *testing.T) {
+	lease := leaderLease{Instance: "router-a", Until: time.Unix(1700000000, 0)}
+	got, ok := parseLease(`"` + lease.String() + `"`)
+	if !ok || got.Instance != "router-a" || !got.Until.Equal(lease.Until) {
+		t.Errorf("parseLease(%q) = %+v, %v", lease.String(), got, ok)
+	}
+	for _, content := range []string{"", "v=spf1 -all", stampPrefix + " leader=router-a", stampPrefix + " until=1700000000"} {
+		if _, ok := parseLease(content); ok {
+			t.Errorf("parseLease(%q) accepted", content)
+		}
+	}
+}
+
+func TestLeaderElection(t *testing.T) {
+	records := memProvider{}
+	newInstance := func(id string) *DDNSService {
+		config := Config{Leader: LeaderConfig{Record: "_leader.example.com", InstanceID: id, Lease: 60}}
+		s := newDDNSService(config, JobConfig{Interface: "eth0", PollInterval: 30,
+			CloudFlare: CloudFlareConfig{RecordName: "home.example.com"}})
+		s.provider = records
+		return s
+	}
+	a, b := newInstance("router-a"), newInstance("router-b")
+
+	start := time.Now()
+	if !a.campaign(start) {
+		t.Fatal("first instance did not become leader")
+	}
+	if b.campaign(start.Add(10 * time.Second)) {
+		t.Fatal("second instance became leader while the lease was held")
+	}
+
+	// The standby tracks the address but leaves DNS alone
+	b.getIPv6 = func(string) (string, error) { return "2001:db8::b", nil }
+	b.checkAndUpdate()
+	if b.pendingIP != "" || b.detectedIP != "2001:db8::b" {
+		t.Errorf("standby pendingIP = %q, detectedIP = %q", b.pendingIP, b.detectedIP)
+	}
+
+	// Within the first half of its lease the leader doesn't touch the record
+	held := records["TXT _leader.example.com"]
+	delete(records, "TXT _leader.example.com")
+	if !a.campaign(start.Add(20 * time.Second)) {
+		t.Error("leader gave up its lease early")
+	}
+	if _, ok := records["TXT _leader.example.com"]; ok {
+		t.Error("leader renewed its lease early")
+	}
+	records["TXT _leader.example.com"] = held
+
+	// The leader stops renewing; the standby takes over once the lease ends
+	if !b.campaign(start.Add(61 * time.Second)) {
+		t.Fatal("standby did not take over an expired lease")
+	}
+	if a.campaign(start.Add(62 * time.Second)) {
+		t.Error("old leader kept leading after the standby took over")
+	}
+	lease, ok := parseLease(records["TXT _leader.example.com"].Content)
+	if !ok || lease.Instance != "router-b" || !lease.Until.Equal(start.Add(121*time.Second).Truncate(time.Second)) {
+		t.Errorf("lease = %+v", lease)
+	}
+}
+
+func TestValidateLeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{"valid", Config{Leader: LeaderConfig{Record: "_leader.example.com", Lease: 120}, PollInterval: 30}, ""},
+		{"lease too short", Config{Leader: LeaderConfig{Record: "_leader.example.com", Lease: 30}, PollInterval: 30},
+			"leader.lease must be at least twice poll_interval (30s)"},
+		{"route53", Config{Leader: LeaderConfig{Record: "_leader.example.com", Lease: 120}, Provider: "route53"},
+			"leader is only supported with the cloudflare provider"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateLeader(tt.config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
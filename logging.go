@@ -0,0 +1,187 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// LogConfig selects how much is logged and in which format.
+type LogConfig struct {
+	// Level is the least severe level logged: debug, info (the default),
+	// warn or error.
+	Level string `yaml:"level"`
+	// Format is text (the default), the usual log lines; json, one object
+	// per line with the details of updates as separate fields; or
+	// journald, entries sent straight to the journal with their priority
+	// and the same details as journal fields.
+	Format string `yaml:"format"`
+}
+
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+func validateLog(c LogConfig) error {
+	if _, ok := logLevels[c.Level]; !ok && c.Level != "" {
+		return fmt.Errorf("log.level must be one of %s", strings.Join(logLevelNames(), ", "))
+	}
+	switch c.Format {
+	case "", "text", "json", "journald":
+	default:
+		return fmt.Errorf("log.format must be text, json or journald")
+	}
+	return nil
+}
+
+func logLevelNames() []string {
+	names := make([]string, 0, len(logLevels))
+	for name := range logLevels {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return logLevels[names[i]] < logLevels[names[j]] })
+	return names
+}
+
+// logSettings are the settings in effect; setupLogging changes them, also
+// on reload.
+var logSettings struct {
+	level   slog.LevelVar
+	json    atomic.Bool
+	journal atomic.Pointer[journal]
+}
+
+// setupLogging applies validated log settings.
+func setupLogging(c LogConfig) {
+	level, ok := logLevels[c.Level]
+	if !ok {
+		level = slog.LevelInfo
+	}
+	logSettings.level.Set(level)
+	logSettings.json.Store(c.Format == "json")
+
+	if c.Format != "journald" {
+		if j := logSettings.journal.Swap(nil); j != nil {
+			j.conn.Close()
+		}
+		return
+	}
+	if logSettings.journal.Load() != nil {
+		return
+	}
+	j, err := dialJournal()
+	if err != nil {
+		logWarn("Warning: logging to stderr, journald is not available: %v", err)
+		return
+	}
+	logSettings.journal.Store(j)
+}
+
+// stdWriter writes to the standard logger's output, so JSON lines follow
+// log.SetOutput like the text ones.
+type stdWriter struct{}
+
+func (stdWriter) Write(p []byte) (int, error) { return log.Writer().Write(p) }
+
+var jsonLogger = slog.New(slog.NewJSONHandler(stdWriter{}, &slog.HandlerOptions{Level: &logSettings.level}))
+
+// logAt logs a message at level. In text output, prefix is put in front of
+// the message in brackets and fields are left out, since the message says
+// the same; in JSON output, they are fields of the line. The journal gets
+// the text message with prefix and fields as journal fields.
+func logAt(level slog.Level, prefix []slog.Attr, fields []slog.Attr, format string, args ...interface{}) {
+	if level < logSettings.level.Level() {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	if logSettings.json.Load() {
+		jsonLogger.LogAttrs(context.Background(), level, msg, append(prefix, fields...)...)
+		return
+	}
+	var tags []string
+	for _, attr := range prefix {
+		tags = append(tags, attr.Value.String())
+	}
+	if len(tags) > 0 {
+		msg = "[" + strings.Join(tags, " ") + "] " + msg
+	}
+	// Lines the journal doesn't take go to stderr instead of getting lost
+	if j := logSettings.journal.Load(); j != nil && j.send(level, msg, append(prefix, fields...)) == nil {
+		return
+	}
+	log.Print(msg)
+}
+
+// logDebug, logInfo, logWarn and logError log messages that don't belong to
+// a job.
+func logDebug(format string, args ...interface{}) { logAt(slog.LevelDebug, nil, nil, format, args...) }
+func logInfo(format string, args ...interface{})  { logAt(slog.LevelInfo, nil, nil, format, args...) }
+func logWarn(format string, args ...interface{})  { logAt(slog.LevelWarn, nil, nil, format, args...) }
+func logError(format string, args ...interface{}) { logAt(slog.LevelError, nil, nil, format, args...) }
+
+// logTags identifies the job in its log lines: its name, when running
+// named jobs, and the record type for A record services.
+func (s *DDNSService) logTags() []slog.Attr {
+	var tags []slog.Attr
+	if s.name != "" {
+		tags = append(tags, slog.String("job", s.name))
+	}
+	if s.recordType == "A" {
+		tags = append(tags, slog.String("type", "A"))
+	}
+	return tags
+}
+
+// logFields logs a message of the job with extra fields for JSON output.
+func (s *DDNSService) logFields(level slog.Level, fields []slog.Attr, format string, args ...interface{}) {
+	logAt(level, s.logTags(), fields, format, args...)
+}
+
+func (s *DDNSService) debugf(format string, args ...interface{}) {
+	s.logFields(slog.LevelDebug, nil, format, args...)
+}
+
+func (s *DDNSService) warnf(format string, args ...interface{}) {
+	s.logFields(slog.LevelWarn, nil, format, args...)
+}
+
+func (s *DDNSService) errorf(format string, args ...interface{}) {
+	s.logFields(slog.LevelError, nil, format, args...)
+}
+
+// updateFields describes a record update for JSON output; the duration is
+// in seconds.
+func updateFields(record, oldIP, newIP string, took time.Duration) []slog.Attr {
+	fields := []slog.Attr{slog.String("record", record), slog.String("new_ip", newIP)}
+	if oldIP != "" {
+		fields = append(fields, slog.String("old_ip", oldIP))
+	}
+	if took > 0 {
+		fields = append(fields, slog.Float64("duration", took.Seconds()))
+	}
+	return fields
+}
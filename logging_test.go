@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateLog(t *testing.T) {
+	tests := []struct {
+		config  LogConfig
+		wantErr bool
+	}{
+		{config: LogConfig{}},
+		{config: LogConfig{Level: "debug", Format: "json"}},
+		{config: LogConfig{Level: "warn", Format: "text"}},
+		{config: LogConfig{Level: "verbose"}, wantErr: true},
+		{config: LogConfig{Format: "logfmt"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := validateLog(tt.config); (err != nil) != tt.wantErr {
+			t.Errorf("validateLog(%+v) = %v, wantErr %v", tt.config, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLogLevels(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	defer setupLogging(LogConfig{})
+
+	s := &DDNSService{name: "home", recordType: "A"}
+	setupLogging(LogConfig{Level: "warn"})
+	s.debugf("debug line")
+	s.logf("info line")
+	s.warnf("Warning: warn line")
+	s.errorf("error line")
+	out := buf.String()
+	for _, skipped := range []string{"debug line", "info line"} {
+		if strings.Contains(out, skipped) {
+			t.Errorf("%q logged at level warn", skipped)
+		}
+	}
+	for _, logged := range []string{"[home A] Warning: warn line", "[home A] error line"} {
+		if !strings.Contains(out, logged) {
+			t.Errorf("%q missing from %q", logged, out)
+		}
+	}
+}
+
+// slowProvider takes a second of clock time for every write.
+type slowProvider struct {
+	memProvider
+	clock *fakeClock
+}
+
+func (p slowProvider) CreateRecord(record DNSRecord) (DNSRecord, error) {
+	p.clock.Advance(time.Second)
+	return p.memProvider.CreateRecord(record)
+}
+
+func (p slowProvider) UpdateRecord(record DNSRecord) (DNSRecord, error) {
+	p.clock.Advance(time.Second)
+	return p.memProvider.UpdateRecord(record)
+}
+
+func TestLogJSON(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	defer setupLogging(LogConfig{})
+	setupLogging(LogConfig{Format: "json"})
+
+	clock := newFakeClock()
+	remote := slowProvider{memProvider{}, clock}
+	s := newDDNSService(Config{}, JobConfig{Name: "home", Interface: "eth0", PollInterval: 30,
+		CloudFlare: CloudFlareConfig{RecordName: "home.example.com", Aliases: []string{"www.example.com"}}})
+	for _, r := range s.records() {
+		r.provider = remote
+	}
+	s.timeSource = clock
+	if err := s.publishAll("2001:db8::1"); err != nil {
+		t.Fatalf("publishAll: %v", err)
+	}
+
+	var line map[string]interface{}
+	for _, text := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if err := json.Unmarshal([]byte(text), &line); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", text, err)
+		}
+		if line["record"] == "www.example.com" {
+			break
+		}
+	}
+	if line["level"] != "INFO" || line["job"] != "home" || line["new_ip"] != "2001:db8::1" || line["msg"] != "Successfully updated www.example.com to 2001:db8::1" {
+		t.Errorf("alias update logged as %v", line)
+	}
+	if d, ok := line["duration"].(float64); !ok || d != 1 {
+		t.Errorf("duration missing from %v", line)
+	}
+}
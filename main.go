@@ -18,28 +18,138 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime/debug"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"text/template"
 	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
+	Interface      string              `yaml:"interface"`
+	PollInterval   int                 `yaml:"poll_interval"`
+	StabilityDelay int                 `yaml:"stability_delay"`
+	CloudFlare     CloudFlareConfig    `yaml:"cloudflare"`
+	Route53        Route53Config       `yaml:"route53"`
+	RFC2136        RFC2136Config       `yaml:"rfc2136"`
+	DeSEC          DeSECConfig         `yaml:"desec"`
+	Custom         CustomConfig        `yaml:"custom"`
+	SNMP           SNMPConfig          `yaml:"snmp"`
+	PreferDHCPv6   bool                `yaml:"prefer_dhcpv6"`
+	MinAddressAge  int                 `yaml:"min_address_age"`
+	IPv4           IPv4Config          `yaml:"ipv4"`
+	Provider       string              `yaml:"provider"`
+	Health         HealthConfig        `yaml:"health"`
+	Retry          RetryConfig         `yaml:"retry"`
+	Jobs           []JobConfig         `yaml:"jobs"`
+	HTTP           HTTPConfig          `yaml:"http"`
+	Verify         VerifyConfig        `yaml:"verify"`
+	Probe          ProbeConfig         `yaml:"probe"`
+	PrefixHook     PrefixHookConfig    `yaml:"prefix_hook"`
+	NetBox         NetBoxConfig        `yaml:"netbox"`
+	Webhook        WebhookConfig       `yaml:"webhook"`
+	Webhooks       []WebhookConfig     `yaml:"webhooks"`
+	StatusPage     StatusPageConfig    `yaml:"status_page"`
+	HTTPClient     HTTPClientConfig    `yaml:"http_client"`
+	Resolvers      []string            `yaml:"resolvers"`
+	Leader         LeaderConfig        `yaml:"leader"`
+	FlushResolver  ResolverFlushConfig `yaml:"flush_resolver"`
+	Log            LogConfig           `yaml:"log"`
+	ACME           ACMEConfig          `yaml:"acme"`
+	ChangeLimit    ChangeLimitConfig   `yaml:"change_limit"`
+
+	// Profiles are alternative job sets, selected at startup with -profile
+	// or IPV6_DDNS_PROFILE.
+	Profiles map[string]ProfileConfig `yaml:"profiles"`
+
+	// FlushOnShutdown performs a pending update immediately on SIGTERM/SIGINT
+	// instead of dropping it.
+	FlushOnShutdown bool `yaml:"flush_on_shutdown"`
+
+	// Observe detects and verifies but never writes, only reporting records
+	// that differ from the detected address.
+	Observe bool `yaml:"observe"`
+
+	// DryRun looks records up and runs the update logic as usual, but only
+	// logs the record writes instead of sending them.
+	DryRun bool `yaml:"dry_run"`
+
+	// ReconcileInterval is how often, in seconds, the records are read back
+	// and restored if they no longer hold the published address.
+	ReconcileInterval int `yaml:"reconcile_interval"`
+
+	// MaxStabilityDelay caps the stability window, in seconds, when it is
+	// lengthened because the address keeps changing within it.
+	MaxStabilityDelay int `yaml:"max_stability_delay"`
+
+	// KnownPrefixStabilityDelay shortens the stability window, in seconds,
+	// for an address in a prefix the job had before; 0 keeps it.
+	KnownPrefixStabilityDelay int `yaml:"known_prefix_stability_delay"`
+
+	// SoftFail starts the valid jobs of a jobs list when others are invalid
+	// or their records can't be looked up, reporting those as broken.
+	SoftFail bool `yaml:"soft_fail"`
+
+	// ControlSocket is the unix socket the status, pause, resume,
+	// force-update and reload commands talk to the daemon over, if set.
+	ControlSocket string `yaml:"control_socket"`
+
+	// StateFile keeps the last published records across restarts.
+	// StateRedis keeps them in Redis instead.
+	StateFile  string           `yaml:"state_file"`
+	StateRedis StateRedisConfig `yaml:"state_redis"`
+
+	// ControlGroup lets the members of this group use the control socket
+	// as well as the daemon's user.
+	ControlGroup string `yaml:"control_group"`
+}
+
+// JobConfig describes one independent updater. When a config has a jobs
+// list, every job gets its own detection loop and stability state.
+type JobConfig struct {
+	Name           string           `yaml:"name"`
+	Enabled        *bool            `yaml:"enabled"`
 	Interface      string           `yaml:"interface"`
 	PollInterval   int              `yaml:"poll_interval"`
 	StabilityDelay int              `yaml:"stability_delay"`
 	CloudFlare     CloudFlareConfig `yaml:"cloudflare"`
+	Route53        Route53Config    `yaml:"route53"`
+	RFC2136        RFC2136Config    `yaml:"rfc2136"`
+	DeSEC          DeSECConfig      `yaml:"desec"`
+	Custom         CustomConfig     `yaml:"custom"`
+	SNMP           SNMPConfig       `yaml:"snmp"`
+	PreferDHCPv6   bool             `yaml:"prefer_dhcpv6"`
+	MinAddressAge  int              `yaml:"min_address_age"`
+	IPv4           IPv4Config       `yaml:"ipv4"`
+	Provider       string           `yaml:"provider"`
+	Health         HealthConfig     `yaml:"health"`
+	Retry          RetryConfig      `yaml:"retry"`
+}
+
+// enabled reports whether the job should run. Jobs are enabled unless they
+// set enabled: false.
+func (j JobConfig) enabled() bool {
+	return j.Enabled == nil || *j.Enabled
+}
+
+type ProfileConfig struct {
+	Jobs []JobConfig `yaml:"jobs"`
 }
 
 type CloudFlareConfig struct {
@@ -48,98 +158,689 @@ type CloudFlareConfig struct {
 	RecordName string `yaml:"record_name"`
 	TTL        int    `yaml:"ttl"`
 	Proxied    bool   `yaml:"proxied"`
+
+	// APITokenFile, APITokenEnv and APITokenCommand read the API token
+	// from a file, an environment variable or a command's output instead,
+	// so it doesn't have to be in the config. APITokenSecret names a
+	// Docker or Podman secret, read from /run/secrets.
+	APITokenFile    string `yaml:"api_token_file"`
+	APITokenEnv     string `yaml:"api_token_env"`
+	APITokenCommand string `yaml:"api_token_command"`
+	APITokenSecret  string `yaml:"api_token_secret"`
+
+	// GuardRemoteChanges re-reads the record before every update and refuses
+	// to overwrite it if someone else changed it since we last saw it, so
+	// two instances with different addresses don't keep flipping it.
+	GuardRemoteChanges bool `yaml:"guard_remote_changes"`
+
+	// CommentStamp writes a machine-readable stamp (instance, sequence
+	// number, time) to the record comment on every update. InstanceID
+	// defaults to the host name.
+	CommentStamp bool   `yaml:"comment_stamp"`
+	InstanceID   string `yaml:"instance_id"`
+
+	// Aliases are further names kept pointing at the same address. They
+	// share the job's detection and stability window; each is updated (and
+	// retried) independently.
+	Aliases []string `yaml:"aliases"`
+
+	// Records are further names like Aliases, each optionally with its own
+	// TTL and proxied setting. Without a RecordName, the first record is
+	// the main one.
+	Records []RecordConfig `yaml:"records"`
+
+	// Zones adds records in other zones, updated from the same address.
+	Zones []ZoneConfig `yaml:"zones"`
+
+	// AliasesDependOnRecord only updates the aliases once the main record
+	// has been updated, e.g. so a bastion host moves before the names that
+	// are reached through it.
+	AliasesDependOnRecord bool `yaml:"aliases_depend_on_record"`
+
+	// Adopt allows updating records that carry the marker of another DNS
+	// automation tool, such as external-dns or Terraform.
+	Adopt bool `yaml:"adopt"`
+
+	// RemoveDuplicates deletes further records of the same name and type
+	// found next to a managed record, instead of only reporting them.
+	RemoveDuplicates bool `yaml:"remove_duplicates"`
+}
+
+// ZoneConfig is one entry of cloudflare.zones. The API token defaults to
+// the one of the cloudflare block.
+type ZoneConfig struct {
+	ZoneID   string         `yaml:"zone_id"`
+	APIToken string         `yaml:"api_token"`
+	Records  []RecordConfig `yaml:"records"`
 }
 
-type DNSRecord struct {
-	ID      string `json:"id"`
-	Type    string `json:"type"`
-	Name    string `json:"name"`
-	Content string `json:"content"`
-	TTL     int    `json:"ttl"`
-	Proxied bool   `json:"proxied"`
+// RecordConfig is one entry of cloudflare.records. Unset TTL and proxied
+// settings are taken from the cloudflare block. Content is a template for
+// the published value, in a record of Type AAAA (the default) or TXT.
+type RecordConfig struct {
+	Name    string `yaml:"name"`
+	TTL     int    `yaml:"ttl"`
+	Proxied *bool  `yaml:"proxied"`
+	Type    string `yaml:"type"`
+	Content string `yaml:"content"`
 }
 
-type CloudFlareResponse struct {
-	Success bool        `json:"success"`
-	Errors  []CFError   `json:"errors"`
-	Result  interface{} `json:"result"`
+// retryable reports whether a failed update may succeed if repeated. An
+// update of several records is retryable if any of its failures is.
+func retryable(err error) bool {
+	if errs, ok := err.(publishErrors); ok {
+		for _, e := range errs {
+			if retryable(e) {
+				return true
+			}
+		}
+		return false
+	}
+	var limit *planLimitError
+	var foreign *foreignRecordError
+	return !errors.As(err, &limit) && !errors.As(err, &foreign)
 }
 
-type CFError struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+// publishErrors collects the failures of publishAll.
+type publishErrors []error
+
+func (e publishErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
 }
 
+func (e publishErrors) Unwrap() []error { return e }
+
 func isValidPublicIPv6(ip net.IP) bool {
 	return ip.To4() == nil && ip.IsGlobalUnicast() && !ip.IsPrivate()
 }
 
 type DDNSService struct {
+	name           string
 	config         Config
 	httpClient     *http.Client
 	lastKnownIP    string
 	pendingIP      string
-	stabilityTimer *time.Timer
+	stabilityTimer Timer
+	retryDelay     time.Duration
 	recordID       string
+	stamp          recordStamp
+	manager        string
 	getIPv6        func(string) (string, error)
-	apiBaseURL     string
+	provider       Provider
+	leader         *leaderElection
 	mu             sync.Mutex
+	detectErrors   errorLog
+	updateErrors   errorLog
+	aliases        []*DDNSService
+	background     sync.WaitGroup
+	recordType     string
+	lastChanged    time.Time
+	timeSource     Clock
+
+	// stopping is set, under backgroundMu, once shutdown waits for the
+	// background work; goBackground starts no more after that. It has its
+	// own lock since notify runs both with and without mu held.
+	backgroundMu sync.Mutex
+	stopping     bool
+
+	// content is the record's content template, if any; contentTemplate
+	// is its parsed form
+	content         string
+	contentTemplate *template.Template
+
+	// Poll loop liveness for the systemd watchdog: the loop records the
+	// job clock's time (UnixNano) in lastBeat at least every heartbeat
+	heartbeat time.Duration
+	lastBeat  atomic.Int64
+
+	// retiring is set when a reload replaces the service, so its shutdown
+	// leaves a pending update to the replacement instead of flushing it.
+	// addedRecords marks records the reload added.
+	retiring     bool
+	addedRecords bool
+
+	// publishing counts the stability timer callbacks writing records, so
+	// a reload waits for them before taking over what they published. It
+	// is only added to under mu while not retiring.
+	publishing sync.WaitGroup
+
+	// Why pendingIP differs from lastKnownIP, and whether detection failed
+	// since the last address was published
+	pendingReason string
+	addressLost   bool
+
+	// staleSince is when an update of the job first failed; the records
+	// stay stale, and the update is retried, until one succeeds
+	staleSince time.Time
+
+	// retryAt is when the scheduled retry fires. savedBackoff is the retry
+	// that was scheduled before a restart, until the stability timer takes
+	// it over.
+	retryAt      time.Time
+	savedBackoff *backoffState
+
+	// updateAt is when the stability timer fires, while it is running
+	updateAt time.Time
+
+	// forced publishes pendingIP to every record, even those that hold it
+	// already, and without guard_remote_changes; see forceUpdate
+	forced bool
+
+	// Changes of the pending address before the stability window ran out,
+	// which lengthen the window once the link is unstable; see churn.go.
+	// stabilityDelay is the length of the running window.
+	churn          int
+	lastChurn      time.Time
+	unstable       bool
+	stabilityDelay time.Duration
+
+	// Writes of the record within change_limit.window, and the end of a
+	// write freeze after it changed too often; see anomaly.go
+	changes     []time.Time
+	frozenUntil time.Time
+
+	// prefix is the prefix of the last stable address, and prefixes the
+	// ones it was in before; see prefix.go
+	prefix   Prefix
+	prefixes []prefixSeen
+
+	// paused stops address checks until resumed over the control socket
+	paused bool
+
+	// state is the state file, if any; see state.go
+	state stateStore
+
+	// Health against the job's health criteria; see health.go. started is
+	// when the poll loop started, unhealthy the problem last reported.
+	failures    int
+	lastSuccess time.Time
+	started     time.Time
+	unhealthy   string
+
+	// DNS answer verification
+	detectedIP        string
+	lookupIP          func(context.Context, string) ([]net.IP, error)
+	verifyErrors      errorLog
+	divergedSince     time.Time
+	divergenceAlerted bool
+}
+
+// Backoff between retries of a failed update, unless the job's retry
+// settings say otherwise. Variables so tests can shorten them.
+var (
+	retryInitialDelay = 10 * time.Second
+	retryMaxDelay     = 5 * time.Minute
+)
+
+// RetryConfig sets the backoff between retries of a failed update, in
+// seconds; 0 keeps the default.
+type RetryConfig struct {
+	InitialDelay int `yaml:"initial_delay"`
+	MaxDelay     int `yaml:"max_delay"`
+}
+
+func validateRetry(retry RetryConfig) error {
+	if retry.InitialDelay < 0 || retry.MaxDelay < 0 {
+		return fmt.Errorf("retry delays must not be negative")
+	}
+	if retry.MaxDelay > 0 && retry.InitialDelay > retry.MaxDelay {
+		return fmt.Errorf("retry.initial_delay must not be longer than retry.max_delay")
+	}
+	return nil
+}
+
+// retryDelays returns the job's first retry delay and the longest one.
+func (s *DDNSService) retryDelays() (initial, max time.Duration) {
+	initial, max = retryInitialDelay, retryMaxDelay
+	if s.config.Retry.InitialDelay > 0 {
+		initial = time.Duration(s.config.Retry.InitialDelay) * time.Second
+	}
+	if s.config.Retry.MaxDelay > 0 {
+		max = time.Duration(s.config.Retry.MaxDelay) * time.Second
+	}
+	return initial, max
+}
+
+var subcommands = map[string]func(args []string) error{
+	"install-service":   runInstallService,
+	"uninstall-service": runUninstallService,
+	"simulate":          runSimulate,
+	"adopt":             runAdopt,
+	"support-bundle":    runSupportBundle,
+	"check":             runCheck,
+	"status":            runStatus,
+	"pause":             runPause,
+	"resume":            runResume,
+	"force-update":      runForceUpdate,
+	"reload":            runReload,
+	"watch":             runWatch,
+}
+
+// outputFlag adds the -output flag shared by the subcommands that print a
+// report: the first of formats is the default, and json is meant for
+// scripts. The returned function checks the value once fs is parsed.
+func outputFlag(fs *flag.FlagSet, formats ...string) func() (string, error) {
+	output := fs.String("output", formats[0], "Output format: "+strings.Join(formats, " or "))
+	return func() (string, error) {
+		for _, format := range formats {
+			if *output == format {
+				return format, nil
+			}
+		}
+		return "", fmt.Errorf("unknown output format %q (use %s)", *output, strings.Join(formats, " or "))
+	}
 }
 
 func main() {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		run, ok := subcommands[os.Args[1]]
+		if !ok {
+			log.Fatalf("Unknown command %q", os.Args[1])
+		}
+		if err := run(os.Args[2:]); err != nil {
+			log.Fatalf("%s: %v", os.Args[1], err)
+		}
+		return
+	}
+
 	configPath := flag.String("config", "/etc/ipv6-ddns-cloudflare/config.yaml", "Path to configuration file")
+	profile := flag.String("profile", os.Getenv("IPV6_DDNS_PROFILE"), "Name of the profile to run (default from IPV6_DDNS_PROFILE)")
+	var flags commandLine
+	flag.BoolVar(&flags.observe, "observe", false, "Detect and verify addresses but never write DNS records")
+	flag.BoolVar(&flags.dryRun, "dry-run", false, "Log the DNS record writes instead of sending them")
+	once := flag.Bool("once", false, "Check and update every job once, then exit with a code telling what happened")
 	flag.Parse()
 
-	config, err := loadConfig(*configPath)
+	config, err := readConfig(*configPath, *profile, flags)
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		log.Fatalf("Failed to start: %v", err)
 	}
-
-	if err := validateConfig(config); err != nil {
-		log.Fatalf("Invalid configuration: %v", err)
+	setupLogging(config.Log)
+	if config.Observe {
+		logInfo("Observe mode: records are compared with the detected addresses but never written")
+	}
+	if config.DryRun {
+		logInfo("Dry run: record writes are logged but not sent")
+	}
+	if *profile != "" {
+		logInfo("Using profile %s", *profile)
+	}
+	if *once {
+		os.Exit(runOnce(config))
 	}
 
-	service := &DDNSService{
-		config: config,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-		getIPv6:    getPublicIPv6,
-		apiBaseURL: "https://api.cloudflare.com/client/v4",
+	services, broken, err := prepareServices(config, nil)
+	if err != nil {
+		log.Fatalf("Failed to start: %v", err)
 	}
+	set := newServiceSet(services)
+	set.setBroken(broken)
 
-	// Get the current DNS record ID
-	if err := service.fetchRecordID(); err != nil {
-		log.Fatalf("Failed to fetch DNS record: %v", err)
+	server, err := startHTTPServer(config.HTTP, config.ACME, set)
+	if err != nil {
+		log.Fatalf("Failed to start HTTP listener: %v", err)
 	}
 
-	log.Printf("Starting IPv6 DDNS service for interface %s, updating %s",
-		config.Interface, config.CloudFlare.RecordName)
+	notify, err := newNotifier()
+	if err != nil {
+		logWarn("Warning: %v", err)
+	}
+	watchdog := watchdogInterval()
+	notify.send("READY=1\nSTATUS=" + notifyStatus(services))
 
-	// Handle graceful shutdown
+	// Handle graceful shutdown and reloads
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	force := forceSignals()
+	signal.Notify(sigChan, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}, force...)...)
+
+	sv := newSupervisor(set)
+	sv.heartbeat = watchdog / 2
+	sv.start()
+
+	// Reloads come from SIGHUP and the control socket
+	var reloading sync.Mutex
+	reload := func() error {
+		reloading.Lock()
+		defer reloading.Unlock()
+		logInfo("Reloading configuration from %s", *configPath)
+		notify.send("RELOADING=1")
+		defer notify.send("READY=1")
+		var err error
+		if config, err = reloadConfig(*configPath, *profile, flags, config, sv); err != nil {
+			logError("Reload failed, keeping the running configuration: %v", err)
+			return err
+		}
+		logInfo("Configuration reloaded")
+		return nil
+	}
+
+	control, err := startControlServer(config.ControlSocket, config.ControlGroup, set, reload)
+	if err != nil {
+		logWarn("Warning: control socket unavailable, control commands such as status won't work: %v", err)
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	if config.StatusPage.Dir != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runStatusPage(config.StatusPage, set, stop)
+		}()
+	}
+
+	if notify != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runNotifier(notify, set, watchdog, stop)
+		}()
+	}
+
+	for sig := range sigChan {
+		if slices.Contains(force, sig) {
+			logInfo("Forcing an update of every record")
+			for _, service := range set.list() {
+				go service.forceUpdate()
+			}
+			continue
+		}
+		if sig != syscall.SIGHUP {
+			break
+		}
+		reload()
+	}
+
+	logInfo("Shutting down...")
+	notify.send("STOPPING=1")
+	if server != nil {
+		server.Close()
+	}
+	if control != nil {
+		control.Close()
+	}
+	sv.stopAll()
+	close(stop)
+	wg.Wait()
+}
+
+// isHostname reports whether name is a DNS host name that CloudFlare can
+// proxy: LDH labels, optionally with a leading wildcard label. Service names
+// such as _acme-challenge are valid records but not proxiable.
+func isHostname(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	name = strings.TrimPrefix(name, "*.")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// newDDNSService creates the updater for a job. Global settings not covered
+// by the job are taken from config.
+func newDDNSService(config Config, job JobConfig) *DDNSService {
+	config.Interface = job.Interface
+	config.PollInterval = job.PollInterval
+	config.StabilityDelay = job.StabilityDelay
+	config.CloudFlare = job.CloudFlare
+	config.Route53 = job.Route53
+	config.RFC2136 = job.RFC2136
+	config.DeSEC = job.DeSEC
+	config.Custom = job.Custom
+	config.SNMP = job.SNMP
+	config.PreferDHCPv6 = job.PreferDHCPv6
+	config.MinAddressAge = job.MinAddressAge
+	config.IPv4 = job.IPv4
+	config.Provider = job.Provider
+	config.Health = job.Health
+	config.Retry = job.Retry
+	config.Jobs = nil
+	switch config.provider() {
+	case "route53":
+		config.CloudFlare = job.Route53.recordSettings()
+	case "rfc2136":
+		config.CloudFlare = job.RFC2136.recordSettings()
+	case "desec":
+		config.CloudFlare = job.DeSEC.recordSettings()
+	case "custom":
+		config.CloudFlare = job.Custom.recordSettings()
+	}
+
+	if config.CloudFlare.CommentStamp && config.CloudFlare.InstanceID == "" {
+		config.CloudFlare.InstanceID, _ = os.Hostname()
+	}
+
+	local := &localSource{
+		preferDHCPv6: config.PreferDHCPv6,
+		minAge:       time.Duration(config.MinAddressAge) * time.Second,
+	}
+	getIPv6 := local.getPublicIPv6
+	if config.SNMP.Target != "" {
+		getIPv6 = newSNMPSource(config.SNMP).getPublicIPv6
+	}
+
+	// Validated with the config
+	resolver, _ := newResolver(config.Resolvers)
+	s := &DDNSService{
+		name:       job.Name,
+		config:     config,
+		httpClient: newHTTPClient(config.HTTPClient, resolver),
+		getIPv6:    getIPv6,
+		lookupIP:   newLookupIP(verifyResolver(config), "ip6"),
+	}
+	s.provider = newProvider(s.config, s.httpClient, s.logf)
+	local.logf = s.logf
+	local.now = func() time.Time { return s.clock().Now() }
+	// Observers and dry runs hold no lease; they never write
+	if config.Leader.Record != "" && !config.Observe && !config.DryRun {
+		s.leader = &leaderElection{
+			record:   config.Leader.Record,
+			instance: config.Leader.InstanceID,
+			lease:    time.Duration(config.Leader.Lease) * time.Second,
+		}
+		if s.leader.instance == "" {
+			s.leader.instance, _ = os.Hostname()
+		}
+	}
+
+	s.fitToProvider(&s.config.CloudFlare, s.provider)
+
+	// zones holds the cloudflare.zones entry of each record, nil for the
+	// records in the job's own zone
+	var records []RecordConfig
+	var zones []*ZoneConfig
+	for _, name := range s.config.CloudFlare.Aliases {
+		records = append(records, RecordConfig{Name: name})
+		zones = append(zones, nil)
+	}
+	for _, record := range s.config.CloudFlare.Records {
+		records = append(records, record)
+		zones = append(zones, nil)
+	}
+	for i := range s.config.CloudFlare.Zones {
+		zone := &s.config.CloudFlare.Zones[i]
+		for _, record := range zone.Records {
+			records = append(records, record)
+			zones = append(zones, zone)
+		}
+	}
+	for i, record := range records {
+		alias := &DDNSService{
+			name:       s.name,
+			config:     s.config,
+			httpClient: s.httpClient,
+		}
+		cf := &alias.config.CloudFlare
+		cf.RecordName = record.Name
+		cf.Aliases = nil
+		cf.Records = nil
+		cf.Zones = nil
+		if zone := zones[i]; zone != nil {
+			// Without a zone_id, the zone is looked up from the record name
+			cf.ZoneID = zone.ZoneID
+			if zone.APIToken != "" {
+				cf.APIToken = zone.APIToken
+			}
+		}
+		if record.TTL != 0 {
+			cf.TTL = record.TTL
+		}
+		if record.Proxied != nil {
+			cf.Proxied = *record.Proxied
+		}
+		if record.Type == "TXT" {
+			// CloudFlare can't proxy TXT records
+			alias.recordType = "TXT"
+			cf.Proxied = false
+		}
+		if record.Content != "" {
+			// Validated with the config
+			alias.content = record.Content
+			alias.contentTemplate, _ = parseContent("content", record.Content)
+		}
+		alias.provider = newProvider(alias.config, alias.httpClient, s.logf)
+		s.fitToProvider(cf, alias.provider)
+		s.aliases = append(s.aliases, alias)
+	}
+
+	return s
+}
 
-	ticker := time.NewTicker(time.Duration(config.PollInterval) * time.Second)
+// run polls for address changes until stop is closed.
+func (s *DDNSService) run(stop <-chan struct{}) {
+	s.logf("Starting DDNS service for interface %s, updating %s %s",
+		s.config.Interface, s.typ(), s.config.CloudFlare.RecordName)
+
+	clock := s.clock()
+	ticker := clock.NewTicker(time.Duration(s.config.PollInterval) * time.Second)
 	defer ticker.Stop()
 
+	// A nil channel never fires, leaving verification disabled
+	var verifyC <-chan time.Time
+	if s.config.Verify.Interval > 0 {
+		if s.config.CloudFlare.Proxied {
+			s.logf("Not verifying DNS answers: proxied records resolve to the proxy's addresses")
+		} else {
+			verifyTicker := clock.NewTicker(time.Duration(s.config.Verify.Interval) * time.Second)
+			defer verifyTicker.Stop()
+			verifyC = verifyTicker.C()
+		}
+	}
+
+	var reconcileC <-chan time.Time
+	if s.config.ReconcileInterval > 0 {
+		reconcileTicker := clock.NewTicker(time.Duration(s.config.ReconcileInterval) * time.Second)
+		defer reconcileTicker.Stop()
+		reconcileC = reconcileTicker.C()
+	}
+
+	var beatC <-chan time.Time
+	if s.heartbeat > 0 {
+		beatTicker := clock.NewTicker(s.heartbeat)
+		defer beatTicker.Stop()
+		beatC = beatTicker.C()
+	}
+
+	s.mu.Lock()
+	if s.started.IsZero() {
+		s.started = clock.Now()
+	}
+	s.mu.Unlock()
+
 	// Initial check
-	service.checkAndUpdate()
+	s.safeCheckAndUpdate()
+	s.checkHealth()
 
 	for {
+		s.lastBeat.Store(clock.Now().UnixNano())
 		select {
-		case <-ticker.C:
-			service.checkAndUpdate()
-		case <-sigChan:
-			log.Println("Shutting down...")
-			if service.stabilityTimer != nil {
-				service.stabilityTimer.Stop()
-			}
+		case <-beatC:
+		case <-ticker.C():
+			s.safeCheckAndUpdate()
+			s.checkHealth()
+		case <-verifyC:
+			s.verifyDNS(clock.Now())
+		case <-reconcileC:
+			s.safeReconcileRecords()
+		case <-stop:
+			s.shutdown()
 			return
 		}
 	}
 }
 
+// shutdown cancels any pending update, or performs it right away when
+// flush_on_shutdown is enabled.
+func (s *DDNSService) shutdown() {
+	// Let NetBox and webhook deliveries finish before exiting
+	defer func() {
+		s.backgroundMu.Lock()
+		s.stopping = true
+		s.backgroundMu.Unlock()
+		s.background.Wait()
+	}()
+
+	s.mu.Lock()
+	pendingIP := s.pendingIP
+	previous := s.lastKnownIP
+	retiring := s.retiring
+	s.cancelPendingUpdateLocked()
+	s.mu.Unlock()
+
+	if pendingIP == "" || !s.config.FlushOnShutdown || s.config.Observe || retiring {
+		return
+	}
+
+	s.logf("Flushing pending update to %s before exiting", pendingIP)
+	start := s.clock().Now()
+	if err := s.publishAll(pendingIP); err != nil {
+		s.errorf("Failed to update DNS: %v", err)
+		return
+	}
+	s.logFields(slog.LevelInfo, updateFields(s.config.CloudFlare.RecordName, previous, pendingIP, s.clock().Now().Sub(start)),
+		"Successfully updated DNS record to %s", pendingIP)
+
+	s.mu.Lock()
+	s.lastKnownIP = pendingIP
+	s.mu.Unlock()
+}
+
+// logf logs a message at info level, prefixed with the job name when
+// running named jobs. A record services are marked with the record type.
+func (s *DDNSService) logf(format string, args ...interface{}) {
+	s.logFields(slog.LevelInfo, nil, format, args...)
+}
+
+// family names the address family of the managed record for log messages.
+func (s *DDNSService) family() string {
+	if s.recordType == "A" {
+		return "IPv4"
+	}
+	return "IPv6"
+}
+
+// typ returns the type of the managed record, AAAA unless set otherwise.
+func (s *DDNSService) typ() string {
+	if s.recordType == "" {
+		return "AAAA"
+	}
+	return s.recordType
+}
+
 func loadConfig(path string) (Config, error) {
 	var config Config
 
@@ -148,7 +849,14 @@ func loadConfig(path string) (Config, error) {
 		return config, fmt.Errorf("reading config file: %w", err)
 	}
 
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return config, fmt.Errorf("parsing config file: %w", err)
+	}
+	if err := expandEnv(&doc); err != nil {
+		return config, fmt.Errorf("config file: %w", err)
+	}
+	if err := doc.Decode(&config); err != nil {
 		return config, fmt.Errorf("parsing config file: %w", err)
 	}
 
@@ -162,67 +870,593 @@ func loadConfig(path string) (Config, error) {
 	if config.CloudFlare.TTL == 0 {
 		config.CloudFlare.TTL = 1 // Auto
 	}
+	setRecordDefaults(&config.CloudFlare)
+	setRoute53Defaults(&config.Route53)
+	setRFC2136Defaults(&config.RFC2136)
+	setDeSECDefaults(&config.DeSEC)
+	setCustomDefaults(&config.Custom)
+	setSNMPDefaults(&config.SNMP)
+	if config.Verify.Interval > 0 && config.Verify.Threshold == 0 {
+		config.Verify.Threshold = 600
+	}
+	if config.StatusPage.Dir != "" && config.StatusPage.Interval == 0 {
+		config.StatusPage.Interval = 60
+	}
+	if config.Probe.Port != 0 && config.Probe.Timeout == 0 {
+		config.Probe.Timeout = 5
+	}
+	if config.PrefixHook.Command != "" {
+		if config.PrefixHook.PrefixLength == 0 {
+			config.PrefixHook.PrefixLength = 64
+		}
+		if config.PrefixHook.Timeout == 0 {
+			config.PrefixHook.Timeout = 60
+		}
+	}
+	if config.ChangeLimit.MaxChanges > 0 && config.ChangeLimit.Window == 0 {
+		config.ChangeLimit.Window = 3600
+	}
+	if config.Leader.Record != "" && config.Leader.Lease == 0 {
+		config.Leader.Lease = 120
+	}
+	if config.FlushResolver.Dnsmasq && config.FlushResolver.DnsmasqPIDFile == "" {
+		config.FlushResolver.DnsmasqPIDFile = "/run/dnsmasq/dnsmasq.pid"
+	}
+	setJobDefaults(config, config.Jobs)
+	for _, profile := range config.Profiles {
+		setJobDefaults(config, profile.Jobs)
+	}
+
+	return config, nil
+}
+
+// setJobDefaults fills in unset job settings. Jobs inherit the top-level
+// scheduling settings unless they override them.
+func setJobDefaults(config Config, jobs []JobConfig) {
+	for i := range jobs {
+		job := &jobs[i]
+		if job.PollInterval == 0 {
+			job.PollInterval = config.PollInterval
+		}
+		if job.StabilityDelay == 0 {
+			job.StabilityDelay = config.StabilityDelay
+		}
+		if job.Health == (HealthConfig{}) {
+			job.Health = config.Health
+		}
+		if job.Retry.InitialDelay == 0 {
+			job.Retry.InitialDelay = config.Retry.InitialDelay
+		}
+		if job.Retry.MaxDelay == 0 {
+			job.Retry.MaxDelay = config.Retry.MaxDelay
+		}
+		if job.Provider == "" {
+			job.Provider = config.Provider
+		}
+		if job.MinAddressAge == 0 {
+			job.MinAddressAge = config.MinAddressAge
+		}
+		if job.CloudFlare.TTL == 0 {
+			job.CloudFlare.TTL = 1 // Auto
+		}
+		setRecordDefaults(&job.CloudFlare)
+		setRoute53Defaults(&job.Route53)
+		setRFC2136Defaults(&job.RFC2136)
+		setDeSECDefaults(&job.DeSEC)
+		setCustomDefaults(&job.Custom)
+		setSNMPDefaults(&job.SNMP)
+	}
+}
+
+// selectProfile replaces the jobs defined at the top level with those of
+// the named profile. An empty name keeps the top-level jobs.
+func selectProfile(config Config, name string) (Config, error) {
+	if name == "" {
+		return config, nil
+	}
+	profile, ok := config.Profiles[name]
+	if !ok {
+		return config, fmt.Errorf("unknown profile %q", name)
+	}
+	if len(profile.Jobs) == 0 {
+		return config, fmt.Errorf("profile %q has no jobs", name)
+	}
 
+	config.Interface = ""
+	config.CloudFlare = CloudFlareConfig{}
+	config.SNMP = SNMPConfig{}
+	config.Jobs = profile.Jobs
 	return config, nil
 }
 
+// jobs returns the jobs to run. Without a jobs list, the top-level settings
+// form a single unnamed job.
+func (c Config) jobs() []JobConfig {
+	if len(c.Jobs) > 0 {
+		return c.Jobs
+	}
+	return []JobConfig{{
+		Interface:      c.Interface,
+		PollInterval:   c.PollInterval,
+		StabilityDelay: c.StabilityDelay,
+		CloudFlare:     c.CloudFlare,
+		Route53:        c.Route53,
+		RFC2136:        c.RFC2136,
+		DeSEC:          c.DeSEC,
+		Custom:         c.Custom,
+		SNMP:           c.SNMP,
+		PreferDHCPv6:   c.PreferDHCPv6,
+		MinAddressAge:  c.MinAddressAge,
+		IPv4:           c.IPv4,
+		Provider:       c.Provider,
+		Health:         c.Health,
+		Retry:          c.Retry,
+	}}
+}
+
+// provider returns the name of the selected DNS provider.
+func (c Config) provider() string {
+	if c.Provider == "" {
+		return defaultProvider
+	}
+	return c.Provider
+}
+
+// setRecordDefaults makes the first of cloudflare.records the main record
+// when record_name is not set.
+func setRecordDefaults(cf *CloudFlareConfig) {
+	if cf.RecordName != "" || len(cf.Records) == 0 || !cf.Records[0].plain() {
+		return
+	}
+	first := cf.Records[0]
+	cf.RecordName = first.Name
+	if first.TTL != 0 {
+		cf.TTL = first.TTL
+	}
+	if first.Proxied != nil {
+		cf.Proxied = *first.Proxied
+	}
+	cf.Records = cf.Records[1:]
+}
+
+func setSNMPDefaults(snmp *SNMPConfig) {
+	if snmp.Target == "" {
+		return
+	}
+	if snmp.Community == "" {
+		snmp.Community = "public"
+	}
+	if snmp.Version == "" {
+		snmp.Version = "2c"
+	}
+	if snmp.Timeout == 0 {
+		snmp.Timeout = 2
+	}
+	if snmp.Retries == 0 {
+		snmp.Retries = 1
+	}
+}
+
 func validateConfig(config Config) error {
-	if config.Interface == "" {
-		return fmt.Errorf("interface is required")
+	if config.HTTP.Listen != "" && config.HTTP.TriggerToken == "" {
+		return fmt.Errorf("http.trigger_token is required when http.listen is set")
 	}
-	if config.CloudFlare.APIToken == "" {
-		return fmt.Errorf("cloudflare.api_token is required")
+	if err := validateControlSocket(config.ControlSocket); err != nil {
+		return err
+	}
+	if err := validateStateFile(config.StateFile); err != nil {
+		return err
+	}
+	if err := validateStateRedis(config); err != nil {
+		return err
+	}
+	if err := validateLog(config.Log); err != nil {
+		return err
+	}
+	if err := validateACME(config); err != nil {
+		return err
+	}
+	if config.NetBox.URL != "" && config.NetBox.Token == "" {
+		return fmt.Errorf("netbox.token is required when netbox.url is set")
+	}
+	if config.Probe.Port != 0 || config.Probe.URL != "" {
+		if err := validateProbe(config.Probe); err != nil {
+			return err
+		}
+	}
+	if _, err := newResolver(config.Resolvers); err != nil {
+		return fmt.Errorf("resolvers: %w", err)
+	}
+	if config.Verify.Resolver != "" {
+		if _, err := parseResolverServer(config.Verify.Resolver); err != nil {
+			return fmt.Errorf("verify.resolver: %w", err)
+		}
+	}
+	if config.PrefixHook.Command != "" {
+		if err := validatePrefixHook(config.PrefixHook); err != nil {
+			return err
+		}
+	}
+	if err := validateChangeLimit(config.ChangeLimit); err != nil {
+		return err
+	}
+	if config.ReconcileInterval < 0 {
+		return fmt.Errorf("reconcile_interval must not be negative")
+	}
+	if config.MaxStabilityDelay < 0 {
+		return fmt.Errorf("max_stability_delay must not be negative")
+	}
+	if config.KnownPrefixStabilityDelay < 0 {
+		return fmt.Errorf("known_prefix_stability_delay must not be negative")
+	}
+	if config.StatusPage.Dir != "" && config.StatusPage.Interval < 0 {
+		return fmt.Errorf("status_page.interval must not be negative")
+	}
+	if config.Webhook.URL != "" {
+		if err := validateWebhook("webhook", config.Webhook); err != nil {
+			return err
+		}
+	}
+	for i, hook := range config.Webhooks {
+		if err := validateWebhook(fmt.Sprintf("webhooks[%d]", i), hook); err != nil {
+			return err
+		}
+	}
+	if c := config.HTTPClient; c.Timeout < 0 || c.DialTimeout < 0 || c.TLSHandshakeTimeout < 0 || c.MaxRetries < 0 || c.MaxRetryTime < 0 {
+		return fmt.Errorf("http_client settings must not be negative")
+	}
+	if config.Leader.Record != "" {
+		if err := validateLeader(config); err != nil {
+			return err
+		}
 	}
-	if config.CloudFlare.ZoneID == "" {
-		return fmt.Errorf("cloudflare.zone_id is required")
+
+	if len(config.Jobs) == 0 {
+		return validateJob(config.jobs()[0])
+	}
+
+	if config.Interface != "" || len(config.CloudFlare.tokenSources()) > 0 ||
+		config.CloudFlare.ZoneID != "" || config.CloudFlare.RecordName != "" ||
+		len(config.CloudFlare.Aliases) > 0 || len(config.CloudFlare.Records) > 0 ||
+		len(config.CloudFlare.Zones) > 0 || config.Route53.HostedZoneID != "" || config.Route53.RecordName != "" ||
+		config.RFC2136.Server != "" || config.RFC2136.RecordName != "" ||
+		config.DeSEC.Domain != "" || config.DeSEC.RecordName != "" ||
+		config.Custom.URL != "" || config.Custom.RecordName != "" ||
+		config.SNMP.Target != "" || config.PreferDHCPv6 || config.IPv4.Enabled {
+		return fmt.Errorf("interface, cloudflare, route53, rfc2136, desec, custom, snmp, prefer_dhcpv6 and ipv4 must be set per job when jobs are used")
+	}
+
+	names := make(map[string]bool)
+	for i, job := range config.Jobs {
+		if job.Name == "" {
+			return fmt.Errorf("jobs[%d]: name is required", i)
+		}
+		if names[job.Name] {
+			return fmt.Errorf("duplicate job name %q", job.Name)
+		}
+		names[job.Name] = true
+
+		// Disabled jobs may be incomplete, e.g. while being set up
+		if !job.enabled() {
+			continue
+		}
+		if err := validateJob(job); err != nil && !config.SoftFail {
+			return fmt.Errorf("job %q: %w", job.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateRecords checks a records list; seen holds the names already used
+// by the job, in lower case.
+func validateRecords(field string, records []RecordConfig, proxiedDefault bool, seen map[string]bool) error {
+	for i, record := range records {
+		if record.Name == "" {
+			return fmt.Errorf("%s[%d]: name is required", field, i)
+		}
+		if seen[strings.ToLower(record.Name)] {
+			return fmt.Errorf("%s: %s is listed more than once", field, record.Name)
+		}
+		seen[strings.ToLower(record.Name)] = true
+		if err := validateContent(fmt.Sprintf("%s[%d]", field, i), record); err != nil {
+			return err
+		}
+		proxied := proxiedDefault && record.Type != "TXT"
+		if record.Proxied != nil {
+			proxied = *record.Proxied
+		}
+		if proxied && !isHostname(record.Name) {
+			return fmt.Errorf("%s: %q cannot be proxied: only host names (letters, digits and hyphens) can", field, record.Name)
+		}
+	}
+	return nil
+}
+
+// validateCloudFlare checks the cloudflare block of a job using the
+// cloudflare provider.
+func validateCloudFlare(cf CloudFlareConfig) error {
+	if cf.APIToken == "" {
+		return fmt.Errorf("cloudflare.api_token is required")
 	}
-	if config.CloudFlare.RecordName == "" {
+	if cf.RecordName == "" && (len(cf.Records) == 0 || !cf.Records[0].plain()) {
 		return fmt.Errorf("cloudflare.record_name is required")
 	}
+	if cf.Proxied && !isHostname(cf.RecordName) {
+		return fmt.Errorf("cloudflare.record_name %q cannot be proxied: only host names (letters, digits and hyphens) can", cf.RecordName)
+	}
+	seen := map[string]bool{strings.ToLower(cf.RecordName): true}
+	for _, alias := range cf.Aliases {
+		if alias == "" {
+			return fmt.Errorf("cloudflare.aliases must not contain empty names")
+		}
+		if seen[strings.ToLower(alias)] {
+			return fmt.Errorf("cloudflare.aliases: %s is listed more than once", alias)
+		}
+		seen[strings.ToLower(alias)] = true
+		if cf.Proxied && !isHostname(alias) {
+			return fmt.Errorf("cloudflare.aliases: %q cannot be proxied: only host names (letters, digits and hyphens) can", alias)
+		}
+	}
+	if err := validateRecords("cloudflare.records", cf.Records, cf.Proxied, seen); err != nil {
+		return err
+	}
+	for i, zone := range cf.Zones {
+		field := fmt.Sprintf("cloudflare.zones[%d]", i)
+		if len(zone.Records) == 0 {
+			return fmt.Errorf("%s: records is required", field)
+		}
+		if err := validateRecords(field+".records", zone.Records, cf.Proxied, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateJob(job JobConfig) error {
+	if job.Interface == "" {
+		return fmt.Errorf("interface is required")
+	}
+	if err := validateHealth(job.Health); err != nil {
+		return err
+	}
+	if err := validateRetry(job.Retry); err != nil {
+		return err
+	}
+	switch job.Provider {
+	case "", "cloudflare":
+		if err := validateCloudFlare(job.CloudFlare); err != nil {
+			return err
+		}
+	case "route53":
+		if err := validateRoute53(job.Route53); err != nil {
+			return err
+		}
+	case "rfc2136":
+		if err := validateRFC2136(job.RFC2136); err != nil {
+			return err
+		}
+	case "desec":
+		if err := validateDeSEC(job.DeSEC); err != nil {
+			return err
+		}
+	case "custom":
+		if err := validateCustom(job.Custom); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown provider %q", job.Provider)
+	}
+	if job.IPv4.Enabled && job.SNMP.Target != "" && job.IPv4.URL == "" {
+		return fmt.Errorf("ipv4.url is required when snmp is used, as the router's IPv4 address is not read over SNMP")
+	}
+	if job.SNMP.Target != "" && job.PreferDHCPv6 {
+		return fmt.Errorf("prefer_dhcpv6 only applies to local interfaces, not snmp")
+	}
+	if job.MinAddressAge < 0 {
+		return fmt.Errorf("min_address_age must not be negative")
+	}
+	if job.SNMP.Target != "" && job.MinAddressAge > 0 {
+		return fmt.Errorf("min_address_age only applies to local interfaces, not snmp")
+	}
+	if job.SNMP.Target != "" && job.SNMP.Version != "1" && job.SNMP.Version != "2c" {
+		return fmt.Errorf("snmp.version must be \"1\" or \"2c\" (SNMPv3 is not supported)")
+	}
 	return nil
 }
 
 func getPublicIPv6(ifaceName string) (string, error) {
+	candidates, err := localCandidates(ifaceName, false)
+	if err != nil {
+		return "", err
+	}
+	return candidates[0], nil
+}
+
+// localCandidates returns the public addresses of the interface in order of
+// preference; the first one is published.
+func localCandidates(ifaceName string, preferDHCPv6 bool) ([]string, error) {
 	iface, err := net.InterfaceByName(ifaceName)
 	if err != nil {
-		return "", fmt.Errorf("interface %s not found: %w", ifaceName, err)
+		return nil, fmt.Errorf("interface %s not found: %w", ifaceName, err)
 	}
 
 	addrs, err := iface.Addrs()
 	if err != nil {
-		return "", fmt.Errorf("getting addresses for %s: %w", ifaceName, err)
+		return nil, fmt.Errorf("getting addresses for %s: %w", ifaceName, err)
+	}
+
+	if candidates := rankAddresses(addrs, preferDHCPv6); len(candidates) > 0 {
+		return candidates, nil
 	}
 
+	return nil, fmt.Errorf("no public IPv6 address found on interface %s", ifaceName)
+}
+
+// rankAddresses returns the public IPv6 addresses sorted by address, so the
+// choice does not depend on the order the kernel lists them in and restarts
+// don't flip between two equally valid addresses. With preferDHCPv6, /128
+// addresses come first: DHCPv6 (IA_NA) leases carry no prefix length and are
+// installed as /128, while SLAAC addresses get the on-link prefix length.
+func rankAddresses(addrs []net.Addr, preferDHCPv6 bool) []string {
+	type candidate struct {
+		ip   net.IP
+		dhcp bool
+	}
+	var candidates []candidate
+	seen := make(map[string]bool)
 	for _, addr := range addrs {
-		ipNet, ok := addr.(*net.IPNet)
-		if !ok {
+		// Some platforms list addresses as *net.IPAddr with a zone; the
+		// zone is dropped and the address compared unscoped
+		var c candidate
+		switch a := addr.(type) {
+		case *net.IPNet:
+			ones, bits := a.Mask.Size()
+			c = candidate{ip: a.IP.To16(), dhcp: preferDHCPv6 && ones == 128 && bits == 128}
+		case *net.IPAddr:
+			c = candidate{ip: a.IP.To16()}
+		default:
+			continue
+		}
+
+		if !isValidPublicIPv6(c.ip) || seen[c.ip.String()] {
 			continue
 		}
+		seen[c.ip.String()] = true
+		candidates = append(candidates, c)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].dhcp != candidates[j].dhcp {
+			return candidates[i].dhcp
+		}
+		return bytes.Compare(candidates[i].ip, candidates[j].ip) < 0
+	})
+
+	var ranked []string
+	for _, c := range candidates {
+		ranked = append(ranked, c.ip.String())
+	}
+	return ranked
+}
+
+// localSource reads the address from a local interface and logs the
+// addresses that were passed over whenever the set of candidates changes.
+// With minAge, addresses are only used once they have been seen for that
+// long, so a transient address some CPEs assign while renegotiating is
+// never published.
+type localSource struct {
+	preferDHCPv6 bool
+	minAge       time.Duration
+	logf         func(string, ...interface{})
+	now          func() time.Time
+
+	mu        sync.Mutex
+	reported  string
+	firstSeen map[string]time.Time
+}
+
+func (l *localSource) getPublicIPv6(ifaceName string) (string, error) {
+	candidates, err := localCandidates(ifaceName, l.preferDHCPv6)
+	if err != nil {
+		return "", err
+	}
+	return l.choose(ifaceName, candidates, l.now())
+}
 
-		ip := ipNet.IP
+// choose picks the first candidate that is old enough.
+func (l *localSource) choose(ifaceName string, candidates []string, now time.Time) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	eligible, young := candidates, []string(nil)
+	if l.minAge > 0 {
+		seen := make(map[string]time.Time, len(candidates))
+		eligible = nil
+		for _, addr := range candidates {
+			first, ok := l.firstSeen[addr]
+			if !ok {
+				first = now
+			}
+			seen[addr] = first
+			if now.Sub(first) >= l.minAge {
+				eligible = append(eligible, addr)
+			} else {
+				young = append(young, addr)
+			}
+		}
+		// Forget addresses that went away, so they start over if they return
+		l.firstSeen = seen
+	}
 
-		if isValidPublicIPv6(ip) {
-			return ip.String(), nil
+	if key := strings.Join(eligible, " ") + "|" + strings.Join(young, " "); key != l.reported {
+		l.reported = key
+		if len(young) > 0 {
+			l.logf("Ignoring %s on %s until it has existed for %s", strings.Join(young, ", "), ifaceName, l.minAge)
+		}
+		if len(eligible) > 1 {
+			l.logf("Selected %s on %s; also available: %s", eligible[0], ifaceName, strings.Join(eligible[1:], ", "))
 		}
 	}
 
-	return "", fmt.Errorf("no public IPv6 address found on interface %s", ifaceName)
+	if len(eligible) == 0 {
+		return "", fmt.Errorf("no IPv6 address on %s has existed for %s yet", ifaceName, l.minAge)
+	}
+	return eligible[0], nil
+}
+
+// safeCheckAndUpdate runs checkAndUpdate, recovering from panics so the
+// next poll starts over.
+func (s *DDNSService) safeCheckAndUpdate() {
+	defer s.recoverPanic("address check", nil)
+	s.checkAndUpdate()
 }
 
 func (s *DDNSService) checkAndUpdate() {
-	currentIP, err := s.getIPv6(s.config.Interface)
+	if s.isPaused() {
+		return
+	}
+	currentIP, err := s.detectAddress()
 	if err != nil {
-		log.Printf("Error getting IPv6 address: %v", err)
+		s.detectErrors.print(s.errorf, fmt.Sprintf("Error getting %s address: %v", s.family(), err), s.clock().Now())
+		s.mu.Lock()
+		s.addressLost = true
+		s.healthFailedLocked()
+		s.mu.Unlock()
+		return
+	}
+	s.detectErrors.reset(s.errorf, s.clock().Now())
+
+	if s.leader != nil && !s.campaign(s.clock().Now()) {
+		s.mu.Lock()
+		s.detectedIP = currentIP
+		// Publish again after taking over; the old leader's address may
+		// still be in the record
+		s.lastKnownIP = ""
+		s.cancelPendingUpdateLocked()
+		s.mu.Unlock()
 		return
 	}
 
 	s.mu.Lock()
+	s.detectedIP = currentIP
+
 	// No change from last known stable IP
 	if currentIP == s.lastKnownIP {
+		s.debugf("%s address %s is unchanged", s.family(), currentIP)
+		s.addressLost = false
+		if s.pendingIP == "" {
+			s.healthSucceededLocked()
+			s.staleSince = time.Time{}
+		}
 		// If we had a pending change that reverted, cancel it
 		if s.pendingIP != "" && s.pendingIP != currentIP {
-			log.Printf("Address reverted to %s, cancelling pending update", currentIP)
+			if !s.unstable {
+				s.logf("Address reverted to %s, cancelling pending update", currentIP)
+			}
 			s.cancelPendingUpdateLocked()
+			s.churnLocked(currentIP)
+		} else if s.churn > 0 && s.pendingIP == "" && s.clock().Now().Sub(s.lastChurn) >= s.stabilityDelayLocked() {
+			s.settleLocked()
 		}
 		s.mu.Unlock()
 		return
@@ -230,13 +1464,24 @@ func (s *DDNSService) checkAndUpdate() {
 
 	// New IP detected
 	if currentIP != s.pendingIP {
-		if s.lastKnownIP == "" {
-			log.Printf("Detected IPv6 address: %s", currentIP)
+		if s.pendingIP != "" {
+			s.churnLocked(currentIP)
+		}
+		s.pendingReason = s.changeReason(s.lastKnownIP, currentIP, s.addressLost)
+		if s.unstable {
+			// Reported once by churnLocked
+		} else if s.lastKnownIP == "" {
+			s.logf("Detected %s address: %s", s.family(), currentIP)
 		} else {
-			log.Printf("Detected new IPv6 address: %s (was: %s)", currentIP, s.lastKnownIP)
+			fields := []slog.Attr{slog.String("old_ip", s.lastKnownIP), slog.String("new_ip", currentIP), slog.String("reason", s.pendingReason)}
+			s.logFields(slog.LevelInfo, fields, "Detected new %s address: %s (was: %s; %s)", s.family(), currentIP, s.lastKnownIP,
+				reasonDescriptions[s.pendingReason])
 		}
 		s.pendingIP = currentIP
 		s.startStabilityTimerLocked()
+		s.mu.Unlock()
+		s.checkDefaultRoute(currentIP)
+		return
 	}
 	s.mu.Unlock()
 }
@@ -252,43 +1497,244 @@ func (s *DDNSService) startStabilityTimerLocked() {
 	if s.stabilityTimer != nil {
 		s.stabilityTimer.Stop()
 	}
+	s.retryDelay = 0
+
+	delay := s.stabilityDelayLocked()
+	if seen, ok := s.knownPrefixLocked(); ok {
+		s.logf("Waiting %d seconds for address stability, prefix %s was last seen %s...", int(delay/time.Second),
+			seen.Network, seen.LastSeen.Format(time.RFC3339))
+	} else if !s.unstable || delay != s.stabilityDelay {
+		s.logf("Waiting %d seconds for address stability...", int(delay/time.Second))
+	}
+	s.stabilityDelay = delay
+
+	if b := s.savedBackoff; b != nil {
+		s.savedBackoff = nil
+		if wait := b.RetryAt.Sub(s.clock().Now()); b.Address == s.pendingIP && wait > delay {
+			// Go on with the backoff from before the restart rather than
+			// retry a failing update right away
+			s.logf("Retrying the update to %s in %s, as scheduled before the restart", b.Address, wait.Round(time.Second))
+			s.retryDelay = time.Duration(b.Delay) * time.Second
+			s.retryAt = b.RetryAt
+			s.updateAt = b.RetryAt
+			s.stabilityTimer = s.clock().AfterFunc(wait, s.stabilityTimerFired)
+			return
+		}
+	}
+	s.updateAt = s.clock().Now().Add(delay)
+	s.stabilityTimer = s.clock().AfterFunc(delay, s.stabilityTimerFired)
+}
 
-	log.Printf("Waiting %d seconds for address stability...", s.config.StabilityDelay)
+// stabilityTimerFired re-checks the pending address once the stability delay
+// has passed and updates DNS if it did not change in the meantime.
+func (s *DDNSService) stabilityTimerFired() {
+	defer s.recoverPanic("stability timer", s.cancelPendingUpdate)
 
-	s.stabilityTimer = time.AfterFunc(time.Duration(s.config.StabilityDelay)*time.Second, func() {
-		s.mu.Lock()
+	// Verify the address is still the same
+	currentIP, err := s.detectAddress()
 
-		// Verify the address is still the same
-		currentIP, err := s.getIPv6(s.config.Interface)
-		if err != nil {
-			log.Printf("Error verifying IPv6 address: %v", err)
-			s.pendingIP = ""
-			s.mu.Unlock()
-			return
+	s.mu.Lock()
+	if s.pendingIP == "" || s.standingByLocked() || s.paused || s.retiring {
+		// Pending update was cancelled while we were checking, another
+		// instance took over, or a reload replaced the service
+		s.mu.Unlock()
+		return
+	}
+	s.publishing.Add(1)
+	defer s.publishing.Done()
+
+	if err != nil {
+		// Keep the address pending: detection failing for a moment says
+		// nothing about whether it is still the one to publish
+		s.errorf("Error verifying %s address: %v", s.family(), err)
+		s.scheduleRetryLocked()
+		s.mu.Unlock()
+		return
+	}
+
+	if currentIP != s.pendingIP {
+		s.churnLocked(currentIP)
+		if !s.unstable {
+			s.logf("Address changed during stability window, restarting timer")
 		}
+		s.pendingIP = currentIP
+		s.startStabilityTimerLocked()
+		s.mu.Unlock()
+		return
+	}
 
-		if currentIP != s.pendingIP {
-			log.Printf("Address changed during stability window, restarting timer")
-			s.pendingIP = currentIP
-			s.startStabilityTimerLocked()
-			s.mu.Unlock()
+	stable := int(s.stabilityDelay / time.Second)
+	if stable == 0 {
+		stable = s.config.StabilityDelay
+	}
+	s.settleLocked()
+	s.prefixChangedLocked(currentIP)
+	if s.config.Observe {
+		s.logf("Address stable for %d seconds, comparing records", stable)
+		s.lastKnownIP = currentIP
+		s.pendingIP = ""
+		s.stabilityTimer = nil
+		s.mu.Unlock()
+		s.observe(currentIP)
+		return
+	}
+
+	// Address is stable, update DNS
+	if s.retryDelay > 0 {
+		s.logf("Retrying DNS update to %s", currentIP)
+	} else if s.forced {
+		s.logf("Forcing DNS update to %s", currentIP)
+	} else {
+		s.logf("Address stable for %d seconds, updating DNS", stable)
+	}
+	previous := s.lastKnownIP
+	staleSince := s.staleSince
+	s.mu.Unlock()
+	start := s.clock().Now()
+	err = s.publishAll(currentIP)
+	took := s.clock().Now().Sub(start)
+	// Runs after the unlock below: the state file keeps when the records
+	// went stale and when they are retried, so a restart doesn't reset
+	// their age or the backoff
+	var save bool
+	defer func() {
+		if save {
+			s.saveState()
+		}
+	}()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pendingIP != currentIP {
+		// Superseded or cancelled while the update was in flight
+		return
+	}
+	if err != nil {
+		s.updateErrors.print(s.errorf, fmt.Sprintf("Failed to update DNS: %v", err), s.clock().Now())
+		s.healthFailedLocked()
+		if s.staleSince.IsZero() {
+			s.staleSince = s.clock().Now()
+		}
+		if s.retryDelay == 0 {
+			// Only the first failure for an address; retries stay quiet
+			s.notify(webhookEvent{Event: "update_failed", Severity: "error", Address: currentIP, Reason: s.pendingReason, Error: err.Error()})
+		}
+		if !retryable(err) {
+			// Keep the address pending so polls don't restart the stability
+			// window; a new address will try again.
+			s.warnf("Not retrying until the address changes")
+			s.stabilityTimer = nil
+			s.retryDelay = 0
+			save = true
 			return
 		}
+		s.scheduleRetryLocked()
+		save = true
+		return
+	}
+	save = s.retryDelay > 0
+	s.updateErrors.reset(s.errorf, s.clock().Now())
+	s.logFields(slog.LevelInfo, updateFields(s.config.CloudFlare.RecordName, previous, currentIP, took),
+		"Successfully updated DNS record to %s", currentIP)
+	if !staleSince.IsZero() {
+		s.logf("Records are up to date again after being stale for %s", s.clock().Now().Sub(staleSince).Round(time.Second))
+	}
+	s.healthSucceededLocked()
+	s.lastKnownIP = currentIP
+	s.pendingIP = ""
+	s.pendingReason = ""
+	s.addressLost = false
+	s.forced = false
+	s.stabilityTimer = nil
+	s.retryDelay = 0
+}
 
-		// Address is stable, update DNS
-		log.Printf("Address stable for %d seconds, updating DNS", s.config.StabilityDelay)
-		s.mu.Unlock()
-		err = s.updateDNS(currentIP)
-		s.mu.Lock()
-		if err != nil {
-			log.Printf("Failed to update DNS: %v", err)
-		} else {
-			log.Printf("Successfully updated DNS record to %s", currentIP)
-			s.lastKnownIP = currentIP
+// announce reports a newly published address to NetBox and the webhooks
+// and probes the service behind it. These are informational, so they run in
+// the background rather than hold up the job, and their failures are only
+// logged.
+func (s *DDNSService) announce(previous, ip, reason string) {
+	if s.config.DryRun {
+		// Nothing was published
+		return
+	}
+	if s.config.NetBox.URL != "" {
+		s.goBackground(func() { s.recordInNetBox(ip) })
+	}
+	if s.config.Probe.Port != 0 {
+		s.goBackground(func() { s.probe(ip) })
+	}
+	s.notify(webhookEvent{Event: "address_changed", Severity: "info", Address: ip, Previous: previous, Reason: reason})
+}
+
+// goBackground runs fn in the background for shutdown to wait for. Once
+// shutdown has begun waiting, fn is dropped instead: the job is exiting, and
+// adding to the WaitGroup then would race with its Wait.
+func (s *DDNSService) goBackground(fn func()) {
+	s.backgroundMu.Lock()
+	defer s.backgroundMu.Unlock()
+	if s.stopping {
+		return
+	}
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		fn()
+	}()
+}
+
+// recordInNetBox logs rather than returns a NetBox failure; the DNS record
+// is already correct and the next change will try again.
+func (s *DDNSService) recordInNetBox(ip string) {
+	if err := s.protect("NetBox sync", func() error { return s.syncNetBox(ip) }); err != nil {
+		s.errorf("Failed to record %s in NetBox: %v", ip, err)
+		return
+	}
+	s.logf("Recorded %s in NetBox", ip)
+}
+
+// scheduleRetryLocked keeps the pending address after a failed update and
+// fires the stability callback again with exponential backoff, so the
+// address is re-verified before every attempt and a newer address still
+// restarts the stability window.
+func (s *DDNSService) scheduleRetryLocked() {
+	initial, max := s.retryDelays()
+	if s.retryDelay == 0 {
+		s.retryDelay = initial
+	} else {
+		s.retryDelay *= 2
+	}
+	if s.retryDelay > max {
+		s.retryDelay = max
+	}
+	if s.staleSince.IsZero() {
+		s.logf("Retrying in %s", s.retryDelay)
+	} else {
+		s.logf("Retrying in %s; the records have been stale for %s", s.retryDelay,
+			s.clock().Now().Sub(s.staleSince).Round(time.Second))
+	}
+	s.retryAt = s.clock().Now().Add(s.retryDelay)
+	s.updateAt = s.retryAt
+	s.stabilityTimer = s.clock().AfterFunc(s.retryDelay, s.stabilityTimerFired)
+}
+
+// recoverPanic logs a panic in component along with its stack trace and
+// calls reset, if given, so the component starts over from a clean state
+// instead of taking down the whole daemon. It must be deferred directly.
+func (s *DDNSService) recoverPanic(component string, reset func()) {
+	if r := recover(); r != nil {
+		s.errorf("Recovered from panic in %s: %v\n%s", component, r, debug.Stack())
+		if reset != nil {
+			reset()
 		}
-		s.pendingIP = ""
-		s.mu.Unlock()
+	}
+}
+
+// protect runs a CloudFlare API call, turning a panic into an error.
+func (s *DDNSService) protect(component string, fn func() error) (err error) {
+	defer s.recoverPanic(component, func() {
+		err = fmt.Errorf("panic in %s", component)
 	})
+	return fn()
 }
 
 func (s *DDNSService) cancelPendingUpdate() {
@@ -303,139 +1749,355 @@ func (s *DDNSService) cancelPendingUpdateLocked() {
 		s.stabilityTimer = nil
 	}
 	s.pendingIP = ""
+	s.retryDelay = 0
+	s.forced = false
 }
 
-func (s *DDNSService) fetchRecordID() error {
-	cfConfig := s.config.CloudFlare
-	url := fmt.Sprintf("%s/zones/%s/dns_records?type=AAAA&name=%s",
-		s.apiBaseURL, cfConfig.ZoneID, cfConfig.RecordName)
+// reconciliation compares the remote record with the detected address at
+// startup and describes what the service is going to do about it.
+type reconciliation struct {
+	Record   string
+	Remote   string
+	Detected string
+	Action   string
+}
+
+func (s *DDNSService) reconcile() reconciliation {
+	s.mu.Lock()
+	r := reconciliation{
+		Record: s.config.CloudFlare.RecordName,
+		Remote: s.lastKnownIP,
+	}
+	exists := s.recordID != ""
+	s.mu.Unlock()
+
+	detected, err := s.detectAddress()
+	switch {
+	case err != nil:
+		r.Action = fmt.Sprintf("none until an address is detected (%v)", err)
+	case !exists:
+		r.Detected = detected
+		r.Action = "create"
+	case detected == r.Remote:
+		r.Detected = detected
+		r.Action = "none"
+	default:
+		r.Detected = detected
+		r.Action = "update"
+	}
+	if s.config.Observe && r.Action != "none" && err == nil {
+		r.Action = "report, observing instead of " + r.Action
+	}
+	return r
+}
+
+func (s *DDNSService) logReconciliation(r reconciliation) {
+	remote, detected := r.Remote, r.Detected
+	if remote == "" {
+		remote = "(no record)"
+	}
+	if detected == "" {
+		detected = "(none)"
+	}
+	s.logf("Startup state for %s: remote=%s detected=%s action=%s", r.Record, remote, detected, r.Action)
+}
+
+// publish points the record at ip. With guard_remote_changes the record is
+// re-read first and left alone if another writer changed it.
+func (s *DDNSService) publish(ip string) error {
+	if s.config.CloudFlare.GuardRemoteChanges {
+		upToDate, err := s.guardRemote(ip)
+		if err != nil || upToDate {
+			return err
+		}
+	}
+	return s.updateDNS(ip)
+}
+
+// guardRemote compares the live record with the content we last saw. It
+// reports whether the record already holds ip, and fails if it holds
+// anything other than ip or the last known address.
+func (s *DDNSService) guardRemote(ip string) (bool, error) {
+	s.mu.Lock()
+	recordID := s.recordID
+	lastKnownIP := s.lastKnownIP
+	s.mu.Unlock()
+
+	if recordID == "" {
+		return false, nil
+	}
 
-	req, err := http.NewRequest("GET", url, nil)
+	record, err := s.provider.FetchRecord(s.typ(), s.config.CloudFlare.RecordName)
 	if err != nil {
+		return false, fmt.Errorf("checking current record: %w", err)
+	}
+	if record == nil {
+		return false, fmt.Errorf("record was deleted by another writer, not recreating")
+	}
+
+	// A newer stamp from another instance means someone else wrote last,
+	// even if they happened to write the content we expect
+	if st, ok := parseStamp(record.Comment); ok {
+		s.mu.Lock()
+		seen := s.stamp
+		if st.Seq > seen.Seq {
+			s.stamp = st
+		}
+		s.mu.Unlock()
+		if st.Instance != s.config.CloudFlare.InstanceID && st.Seq > seen.Seq {
+			return false, fmt.Errorf("record was changed by instance %s to %s at %s (seq %d), not overwriting",
+				st.Instance, record.Content, st.Time.Format(time.RFC3339), st.Seq)
+		}
+	}
+
+	switch recordValue(s.typ(), record.Content) {
+	case ip:
+		s.logf("Record already points to %s, not updating", ip)
+		return true, nil
+	case lastKnownIP:
+		return false, nil
+	}
+	return false, fmt.Errorf("record was changed by another writer to %s at %s (expected %s), not overwriting",
+		record.Content, record.ModifiedOn.Format(time.RFC3339), lastKnownIP)
+}
+
+// fetchRecordIDs looks up the record and all of its aliases.
+func (s *DDNSService) fetchRecordIDs() error {
+	if err := s.fetchRecordID(); err != nil {
 		return err
 	}
+	for _, alias := range s.aliases {
+		if err := alias.fetchRecordID(); err != nil {
+			return fmt.Errorf("%s: %w", alias.config.CloudFlare.RecordName, err)
+		}
+	}
+	return nil
+}
 
-	req.Header.Set("Authorization", "Bearer "+cfConfig.APIToken)
-	req.Header.Set("Content-Type", "application/json")
+// publishAll points the record and its aliases at ip. Records that already
+// hold ip, e.g. from an earlier attempt that failed only for some of them,
+// are skipped, so a retry repeats just the failed updates.
+func (s *DDNSService) publishAll(ip string) error {
+	var errs publishErrors
+	var updated []string
 
-	resp, err := s.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("API request failed: %w", err)
+	s.mu.Lock()
+	previous := s.lastKnownIP
+	reason := s.pendingReason
+	force := s.forced
+	s.mu.Unlock()
+	if previous != ip || force {
+		write := s.publish
+		var err error
+		if force {
+			write = s.updateDNS
+		} else {
+			err = s.checkFrozen(s)
+		}
+		if err == nil {
+			err = s.protect("DNS update", func() error { return write(ip) })
+		}
+		if err != nil {
+			errs = append(errs, err)
+			if s.config.CloudFlare.AliasesDependOnRecord && len(s.aliases) > 0 {
+				s.logf("Not updating aliases until %s points to %s", s.config.CloudFlare.RecordName, ip)
+				return errs[0]
+			}
+		} else {
+			s.mu.Lock()
+			s.lastKnownIP = ip
+			s.lastChanged = s.clock().Now()
+			s.mu.Unlock()
+			s.countChange(s, ip)
+			s.announce(previous, ip, reason)
+			updated = append(updated, s.config.CloudFlare.RecordName)
+		}
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("reading response: %w", err)
+	for _, alias := range s.aliases {
+		name := alias.config.CloudFlare.RecordName
+		value, err := alias.value(ip)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		alias.mu.Lock()
+		old := alias.lastKnownIP
+		alias.mu.Unlock()
+		if old == value && !force {
+			s.debugf("%s already points to %s", name, value)
+			continue
+		}
+		write := alias.publish
+		if force {
+			write = alias.updateDNS
+		} else if err := s.checkFrozen(alias); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		start := s.clock().Now()
+		if err := alias.protect("DNS update", func() error { return write(value) }); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		took := s.clock().Now().Sub(start)
+		alias.mu.Lock()
+		alias.lastKnownIP = value
+		alias.lastChanged = s.clock().Now()
+		alias.mu.Unlock()
+		s.countChange(alias, value)
+		s.logFields(slog.LevelInfo, updateFields(name, old, value, took), "Successfully updated %s to %s", name, value)
+		if !s.config.DryRun {
+			s.notify(webhookEvent{Event: "address_changed", Severity: "info", Record: name, Type: alias.typ(),
+				Address: value, Previous: old, Reason: reason})
+		}
+		updated = append(updated, name)
 	}
 
-	var cfResp struct {
-		Success bool        `json:"success"`
-		Errors  []CFError   `json:"errors"`
-		Result  []DNSRecord `json:"result"`
+	if len(errs) == 0 {
+		s.mu.Lock()
+		s.staleSince = time.Time{}
+		s.mu.Unlock()
+	}
+	s.notifyUpdated(previous, ip, reason, len(updated), errs)
+	if len(updated) > 0 {
+		s.saveState()
+	}
+	if len(updated) > 0 && s.config.FlushResolver.enabled() && !s.config.DryRun {
+		s.goBackground(func() {
+			defer s.recoverPanic("resolver flush", nil)
+			s.flushResolvers(updated)
+		})
 	}
 
-	if err := json.Unmarshal(body, &cfResp); err != nil {
-		return fmt.Errorf("parsing response: %w", err)
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	if len(errs) > 0 {
+		return errs
 	}
+	return nil
+}
 
-	if !cfResp.Success {
-		return fmt.Errorf("CloudFlare API error: %v", cfResp.Errors)
+func (s *DDNSService) fetchRecordID() error {
+	name := s.config.CloudFlare.RecordName
+	record, records, err := s.lookupRecord()
+	if err != nil {
+		return err
+	}
+	if err := s.checkManager(record); err != nil {
+		return err
 	}
+	s.checkDuplicates(record, records)
 
-	if len(cfResp.Result) == 0 {
+	if record == nil {
 		// Record doesn't exist, we'll create it on first update
-		log.Printf("DNS record %s does not exist, will create on first update", cfConfig.RecordName)
+		s.logf("DNS record %s does not exist, will create on first update", name)
 		return nil
 	}
 
+	st, stamped := parseStamp(record.Comment)
+
 	s.mu.Lock()
-	s.recordID = cfResp.Result[0].ID
-	s.lastKnownIP = cfResp.Result[0].Content
+	s.recordID = record.ID
+	s.lastKnownIP = recordValue(s.typ(), record.Content)
+	s.lastChanged = record.ModifiedOn
+	if stamped {
+		s.stamp = st
+	}
 	s.mu.Unlock()
 
-	log.Printf("Found existing record %s with IP %s", cfConfig.RecordName, cfResp.Result[0].Content)
+	s.logf("Found existing record %s with IP %s", name, record.Content)
+	if stamped {
+		s.logf("Record was last written by instance %s at %s (seq %d)", st.Instance, st.Time.Format(time.RFC3339), st.Seq)
+	}
 
 	return nil
 }
 
 func (s *DDNSService) updateDNS(ip string) error {
+	// Detected addresses are canonical already; this keeps anything else,
+	// such as a zone identifier, from reaching the provider
+	if addr, err := canonicalAddress(ip); s.typ() != "TXT" && (err != nil || addr != ip) {
+		return fmt.Errorf("refusing to publish %q: not a canonical unscoped address", ip)
+	}
+
 	s.mu.Lock()
 	recordID := s.recordID
+	manager := s.manager
 	cfConfig := s.config.CloudFlare
+	stamp := recordStamp{Instance: cfConfig.InstanceID, Seq: s.stamp.Seq + 1, Time: s.clock().Now().UTC().Truncate(time.Second)}
 	s.mu.Unlock()
 
-	record := map[string]interface{}{
-		"type":    "AAAA",
-		"name":    cfConfig.RecordName,
-		"content": ip,
-		"ttl":     cfConfig.TTL,
-		"proxied": cfConfig.Proxied,
+	if manager != "" && !cfConfig.Adopt {
+		return &foreignRecordError{name: cfConfig.RecordName, manager: manager}
 	}
 
-	body, err := json.Marshal(record)
-	if err != nil {
-		return err
+	record := DNSRecord{
+		ID:      recordID,
+		Type:    s.typ(),
+		Name:    cfConfig.RecordName,
+		Content: ip,
+		TTL:     cfConfig.TTL,
+		Proxied: cfConfig.Proxied,
+	}
+	if cfConfig.CommentStamp {
+		record.Comment = stamp.String()
 	}
 
-	var url string
-	var method string
-
+	var err error
+	replaced := false
 	if recordID == "" {
-		// Create new record
-		url = fmt.Sprintf("%s/zones/%s/dns_records",
-			s.apiBaseURL, cfConfig.ZoneID)
-		method = "POST"
+		record, err = s.provider.CreateRecord(record)
 	} else {
-		// Update existing record
-		url = fmt.Sprintf("%s/zones/%s/dns_records/%s",
-			s.apiBaseURL, cfConfig.ZoneID, recordID)
-		method = "PUT"
+		written := record
+		record, err = s.provider.UpdateRecord(record)
+		if errors.Is(err, errRecordNotFound) {
+			s.warnf("%s was deleted at the provider, looking it up again", cfConfig.RecordName)
+			record, err = s.recreateRecord(written)
+			replaced = true
+		}
 	}
-
-	req, err := http.NewRequest(method, url, bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+cfConfig.APIToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := s.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("API request failed: %w", err)
+	// Store the record ID if this was a create, or the record was deleted
+	// and written anew
+	s.mu.Lock()
+	if s.recordID == "" || replaced && s.recordID == recordID {
+		s.recordID = record.ID
 	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("reading response: %w", err)
+	if cfConfig.CommentStamp {
+		s.stamp = stamp
 	}
+	s.mu.Unlock()
 
-	var cfResp struct {
-		Success bool      `json:"success"`
-		Errors  []CFError `json:"errors"`
-		Result  DNSRecord `json:"result"`
-	}
+	return nil
+}
 
-	if err := json.Unmarshal(respBody, &cfResp); err != nil {
-		return fmt.Errorf("parsing response: %w", err)
+// recreateRecord writes record, whose ID no longer exists, to the record of
+// the same name that was created since, if there is one, or creates it.
+func (s *DDNSService) recreateRecord(record DNSRecord) (DNSRecord, error) {
+	found, err := s.provider.FetchRecord(record.Type, record.Name)
+	if err != nil {
+		return DNSRecord{}, err
 	}
-
-	if !cfResp.Success {
-		var errMsgs []string
-		for _, e := range cfResp.Errors {
-			errMsgs = append(errMsgs, e.Message)
-		}
-		return fmt.Errorf("CloudFlare API error: %s", strings.Join(errMsgs, ", "))
+	if found == nil {
+		s.logf("Creating %s again", record.Name)
+		record.ID = ""
+		return s.provider.CreateRecord(record)
 	}
-
-	// Store the record ID if this was a create
-	s.mu.Lock()
-	if s.recordID == "" {
-		s.recordID = cfResp.Result.ID
+	if err := s.checkManager(found); err != nil {
+		return DNSRecord{}, err
 	}
+	s.mu.Lock()
+	manager := s.manager
 	s.mu.Unlock()
-
-	return nil
+	if manager != "" && !s.config.CloudFlare.Adopt {
+		return DNSRecord{}, &foreignRecordError{name: record.Name, manager: manager}
+	}
+	s.logf("%s was created again as %s, updating that", record.Name, found.ID)
+	record.ID = found.ID
+	return s.provider.UpdateRecord(record)
 }
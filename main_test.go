@@ -2,17 +2,29 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
+// cloudflareAt points s at a fake CloudFlare API served at url.
+func cloudflareAt(s *DDNSService, client *http.Client, url string) *DDNSService {
+	cf := newCloudFlareProvider(s.config.CloudFlare, client)
+	cf.baseURL = url
+	s.provider = cf
+	return s
+}
+
 func TestLoadConfig(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -70,6 +82,116 @@ cloudflare:
 				},
 			},
 		},
+		{
+			name: "jobs with defaults",
+			content: `
+jobs:
+  - name: fiber
+    interface: eth0
+    poll_interval: 300
+    cloudflare:
+      api_token: test-token
+      zone_id: test-zone
+      record_name: fiber.example.com
+  - name: lte
+    interface: wwan0
+    cloudflare:
+      api_token: test-token
+      zone_id: test-zone
+      record_name: lte.example.com
+      ttl: 60
+`,
+			want: Config{
+				PollInterval:   30,
+				StabilityDelay: 5,
+				CloudFlare:     CloudFlareConfig{TTL: 1},
+				Jobs: []JobConfig{
+					{
+						Name:           "fiber",
+						Interface:      "eth0",
+						PollInterval:   300,
+						StabilityDelay: 5,
+						CloudFlare: CloudFlareConfig{
+							APIToken:   "test-token",
+							ZoneID:     "test-zone",
+							RecordName: "fiber.example.com",
+							TTL:        1,
+						},
+					},
+					{
+						Name:           "lte",
+						Interface:      "wwan0",
+						PollInterval:   30,
+						StabilityDelay: 5,
+						CloudFlare: CloudFlareConfig{
+							APIToken:   "test-token",
+							ZoneID:     "test-zone",
+							RecordName: "lte.example.com",
+							TTL:        60,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "jobs inherit global scheduling",
+			content: `
+poll_interval: 120
+stability_delay: 15
+retry:
+  max_delay: 600
+jobs:
+  - name: fiber
+    interface: eth0
+    cloudflare:
+      api_token: test-token
+      zone_id: test-zone
+      record_name: fiber.example.com
+  - name: lte
+    interface: wwan0
+    poll_interval: 5
+    retry:
+      initial_delay: 2
+    cloudflare:
+      api_token: test-token
+      zone_id: test-zone
+      record_name: lte.example.com
+`,
+			want: Config{
+				PollInterval:   120,
+				StabilityDelay: 15,
+				CloudFlare:     CloudFlareConfig{TTL: 1},
+				Retry:          RetryConfig{MaxDelay: 600},
+				Jobs: []JobConfig{
+					{
+						Name:           "fiber",
+						Interface:      "eth0",
+						PollInterval:   120,
+						StabilityDelay: 15,
+						Retry:          RetryConfig{MaxDelay: 600},
+						CloudFlare: CloudFlareConfig{
+							APIToken:   "test-token",
+							ZoneID:     "test-zone",
+							RecordName: "fiber.example.com",
+							TTL:        1,
+						},
+					},
+					{
+						Name:           "lte",
+						Interface:      "wwan0",
+						PollInterval:   5,
+						StabilityDelay: 15,
+						Retry:          RetryConfig{InitialDelay: 2, MaxDelay: 600},
+						CloudFlare: CloudFlareConfig{
+							APIToken:   "test-token",
+							ZoneID:     "test-zone",
+							RecordName: "lte.example.com",
+							TTL:        1,
+						},
+					},
+				},
+			},
+		},
 		{
 			name:      "missing file",
 			content:   "",
@@ -110,7 +232,7 @@ cloudflare:
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
-			if got != tt.want {
+			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("loadConfig() = %+v, want %+v", got, tt.want)
 			}
 		})
@@ -147,6 +269,20 @@ func TestValidateConfig(t *testing.T) {
 			wantErr: true,
 			errMsg:  "interface is required",
 		},
+		{
+			name: "retry delays out of order",
+			config: Config{
+				Interface: "eth0",
+				CloudFlare: CloudFlareConfig{
+					APIToken:   "token",
+					ZoneID:     "zone",
+					RecordName: "example.com",
+				},
+				Retry: RetryConfig{InitialDelay: 60, MaxDelay: 30},
+			},
+			wantErr: true,
+			errMsg:  "retry.initial_delay must not be longer than retry.max_delay",
+		},
 		{
 			name: "missing api token",
 			config: Config{
@@ -160,7 +296,7 @@ func TestValidateConfig(t *testing.T) {
 			errMsg:  "cloudflare.api_token is required",
 		},
 		{
-			name: "missing zone id",
+			name: "zone id looked up",
 			config: Config{
 				Interface: "eth0",
 				CloudFlare: CloudFlareConfig{
@@ -168,8 +304,7 @@ func TestValidateConfig(t *testing.T) {
 					RecordName: "example.com",
 				},
 			},
-			wantErr: true,
-			errMsg:  "cloudflare.zone_id is required",
+			wantErr: false,
 		},
 		{
 			name: "missing record name",
@@ -183,6 +318,238 @@ func TestValidateConfig(t *testing.T) {
 			wantErr: true,
 			errMsg:  "cloudflare.record_name is required",
 		},
+		{
+			name: "proxied service name",
+			config: Config{
+				Interface: "eth0",
+				CloudFlare: CloudFlareConfig{
+					APIToken:   "token",
+					ZoneID:     "zone",
+					RecordName: "_acme-challenge.example.com",
+					Proxied:    true,
+				},
+			},
+			wantErr: true,
+			errMsg:  `cloudflare.record_name "_acme-challenge.example.com" cannot be proxied: only host names (letters, digits and hyphens) can`,
+		},
+		{
+			name: "duplicate alias",
+			config: Config{
+				Interface: "eth0",
+				CloudFlare: CloudFlareConfig{
+					APIToken:   "token",
+					ZoneID:     "zone",
+					RecordName: "home.example.com",
+					Aliases:    []string{"www.example.com", "Home.example.com"},
+				},
+			},
+			wantErr: true,
+			errMsg:  "cloudflare.aliases: Home.example.com is listed more than once",
+		},
+		{
+			name: "record duplicates alias",
+			config: Config{
+				Interface: "eth0",
+				CloudFlare: CloudFlareConfig{
+					APIToken:   "token",
+					ZoneID:     "zone",
+					RecordName: "home.example.com",
+					Aliases:    []string{"www.example.com"},
+					Records:    []RecordConfig{{Name: "www.example.com", TTL: 60}},
+				},
+			},
+			wantErr: true,
+			errMsg:  "cloudflare.records: www.example.com is listed more than once",
+		},
+		{
+			name: "prefer_dhcpv6 with snmp",
+			config: Config{
+				Interface:    "wan",
+				PreferDHCPv6: true,
+				SNMP:         SNMPConfig{Target: "192.0.2.1", Version: "2c"},
+				CloudFlare: CloudFlareConfig{
+					APIToken:   "token",
+					ZoneID:     "zone",
+					RecordName: "home.example.com",
+				},
+			},
+			wantErr: true,
+			errMsg:  "prefer_dhcpv6 only applies to local interfaces, not snmp",
+		},
+		{
+			name: "ipv4 with snmp but no url",
+			config: Config{
+				Interface: "wan",
+				IPv4:      IPv4Config{Enabled: true},
+				SNMP:      SNMPConfig{Target: "192.0.2.1", Version: "2c"},
+				CloudFlare: CloudFlareConfig{
+					APIToken:   "token",
+					ZoneID:     "zone",
+					RecordName: "home.example.com",
+				},
+			},
+			wantErr: true,
+			errMsg:  "ipv4.url is required when snmp is used, as the router's IPv4 address is not read over SNMP",
+		},
+		{
+			name: "proxied wildcard",
+			config: Config{
+				Interface: "eth0",
+				CloudFlare: CloudFlareConfig{
+					APIToken:   "token",
+					ZoneID:     "zone",
+					RecordName: "*.example.com",
+					Proxied:    true,
+				},
+			},
+		},
+		{
+			name: "http listener without token",
+			config: Config{
+				Interface: "eth0",
+				CloudFlare: CloudFlareConfig{
+					APIToken:   "token",
+					ZoneID:     "zone",
+					RecordName: "example.com",
+				},
+				HTTP: HTTPConfig{Listen: "[::1]:8080"},
+			},
+			wantErr: true,
+			errMsg:  "http.trigger_token is required when http.listen is set",
+		},
+		{
+			name: "netbox without token",
+			config: Config{
+				Interface: "eth0",
+				CloudFlare: CloudFlareConfig{
+					APIToken:   "token",
+					ZoneID:     "zone",
+					RecordName: "example.com",
+				},
+				NetBox: NetBoxConfig{URL: "https://netbox.example.com"},
+			},
+			wantErr: true,
+			errMsg:  "netbox.token is required when netbox.url is set",
+		},
+		{
+			name: "webhook without secret",
+			config: Config{
+				Interface: "eth0",
+				CloudFlare: CloudFlareConfig{
+					APIToken:   "token",
+					ZoneID:     "zone",
+					RecordName: "example.com",
+				},
+				Webhook: WebhookConfig{URL: "https://hooks.example.com/ddns"},
+			},
+			wantErr: true,
+			errMsg:  "webhook.secret is required when webhook.url is set",
+		},
+		{
+			name: "unknown provider",
+			config: Config{
+				Interface: "eth0",
+				Provider:  "bind",
+				CloudFlare: CloudFlareConfig{
+					APIToken:   "token",
+					ZoneID:     "zone",
+					RecordName: "example.com",
+				},
+			},
+			wantErr: true,
+			errMsg:  `unknown provider "bind"`,
+		},
+		{
+			name: "webhooks entry with unknown severity",
+			config: Config{
+				Interface: "eth0",
+				CloudFlare: CloudFlareConfig{
+					APIToken:   "token",
+					ZoneID:     "zone",
+					RecordName: "example.com",
+				},
+				Webhooks: []WebhookConfig{
+					{URL: "https://hooks.example.com/ops", Secret: "s3cret"},
+					{URL: "https://hooks.example.com/family", Secret: "s3cret", Severity: "warning"},
+				},
+			},
+			wantErr: true,
+			errMsg:  "webhooks[1].severity must be info or error",
+		},
+		{
+			name: "negative http client timeout",
+			config: Config{
+				Interface: "eth0",
+				CloudFlare: CloudFlareConfig{
+					APIToken:   "token",
+					ZoneID:     "zone",
+					RecordName: "example.com",
+				},
+				HTTPClient: HTTPClientConfig{Timeout: -1},
+			},
+			wantErr: true,
+			errMsg:  "http_client settings must not be negative",
+		},
+		{
+			name: "valid jobs",
+			config: Config{
+				Jobs: []JobConfig{
+					{Name: "a", Interface: "eth0", CloudFlare: CloudFlareConfig{APIToken: "token", ZoneID: "zone", RecordName: "a.example.com"}},
+					{Name: "b", Interface: "eth1", CloudFlare: CloudFlareConfig{APIToken: "token", ZoneID: "zone", RecordName: "b.example.com"}},
+				},
+			},
+		},
+		{
+			name: "disabled job is not validated",
+			config: Config{
+				Jobs: []JobConfig{
+					{Name: "a", Interface: "eth0", CloudFlare: CloudFlareConfig{APIToken: "token", ZoneID: "zone", RecordName: "a.example.com"}},
+					{Name: "b", Enabled: new(bool)},
+				},
+			},
+		},
+		{
+			name: "job missing name",
+			config: Config{
+				Jobs: []JobConfig{
+					{Interface: "eth0", CloudFlare: CloudFlareConfig{APIToken: "token", ZoneID: "zone", RecordName: "a.example.com"}},
+				},
+			},
+			wantErr: true,
+			errMsg:  "jobs[0]: name is required",
+		},
+		{
+			name: "duplicate job name",
+			config: Config{
+				Jobs: []JobConfig{
+					{Name: "a", Interface: "eth0", CloudFlare: CloudFlareConfig{APIToken: "token", ZoneID: "zone", RecordName: "a.example.com"}},
+					{Name: "a", Interface: "eth1", CloudFlare: CloudFlareConfig{APIToken: "token", ZoneID: "zone", RecordName: "b.example.com"}},
+				},
+			},
+			wantErr: true,
+			errMsg:  `duplicate job name "a"`,
+		},
+		{
+			name: "invalid job",
+			config: Config{
+				Jobs: []JobConfig{
+					{Name: "a", Interface: "eth0", CloudFlare: CloudFlareConfig{ZoneID: "zone", RecordName: "a.example.com"}},
+				},
+			},
+			wantErr: true,
+			errMsg:  `job "a": cloudflare.api_token is required`,
+		},
+		{
+			name: "top-level settings mixed with jobs",
+			config: Config{
+				Interface: "eth0",
+				Jobs: []JobConfig{
+					{Name: "a", Interface: "eth0", CloudFlare: CloudFlareConfig{APIToken: "token", ZoneID: "zone", RecordName: "a.example.com"}},
+				},
+			},
+			wantErr: true,
+			errMsg:  "interface, cloudflare, route53, rfc2136, desec, custom, snmp, prefer_dhcpv6 and ipv4 must be set per job when jobs are used",
+		},
 	}
 
 	for _, tt := range tests {
@@ -248,6 +615,86 @@ func TestGetPublicIPv6(t *testing.T) {
 	})
 }
 
+func TestRankAddresses(t *testing.T) {
+	mustCIDR := func(cidr string) net.Addr {
+		ip, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ipNet.IP = ip
+		return ipNet
+	}
+	addrs := []net.Addr{
+		mustCIDR("fe80::1/64"),
+		mustCIDR("2001:db8::aaaa/64"),
+		mustCIDR("2001:db8::5/128"),
+		mustCIDR("2001:db8::bb/64"),
+	}
+
+	tests := []struct {
+		name         string
+		addrs        []net.Addr
+		preferDHCPv6 bool
+		want         []string
+	}{
+		{"sorted by address", addrs, false, []string{"2001:db8::5", "2001:db8::bb", "2001:db8::aaaa"}},
+		{"DHCPv6 preferred over lower address", []net.Addr{addrs[3], mustCIDR("2001:db8::ff/128")}, true, []string{"2001:db8::ff", "2001:db8::bb"}},
+		{"no DHCPv6 address", addrs[:2], true, []string{"2001:db8::aaaa"}},
+		{"no public address", addrs[:1], true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rankAddresses(tt.addrs, tt.preferDHCPv6); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rankAddresses() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("independent of kernel order", func(t *testing.T) {
+		reversed := []net.Addr{addrs[3], addrs[2], addrs[1], addrs[0]}
+		if a, b := rankAddresses(addrs, false), rankAddresses(reversed, false); !reflect.DeepEqual(a, b) {
+			t.Errorf("order changed the ranking: %v vs %v", a, b)
+		}
+	})
+}
+
+func TestMinAddressAge(t *testing.T) {
+	var logs []string
+	l := &localSource{
+		minAge: 30 * time.Second,
+		logf:   func(format string, args ...interface{}) { logs = append(logs, fmt.Sprintf(format, args...)) },
+	}
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Everything is new at first
+	if _, err := l.choose("eth0", []string{"2001:db8::1"}, start); err == nil ||
+		err.Error() != "no IPv6 address on eth0 has existed for 30s yet" {
+		t.Errorf("expected too-young error, got %v", err)
+	}
+	if got, err := l.choose("eth0", []string{"2001:db8::1"}, start.Add(30*time.Second)); err != nil || got != "2001:db8::1" {
+		t.Errorf("choose() = %q, %v, want 2001:db8::1", got, err)
+	}
+
+	// A transient address sorting first is passed over while it is young
+	candidates := []string{"2001:db8::", "2001:db8::1"}
+	if got, err := l.choose("eth0", candidates, start.Add(40*time.Second)); err != nil || got != "2001:db8::1" {
+		t.Errorf("choose() = %q, %v, want the established address", got, err)
+	}
+	if got, err := l.choose("eth0", candidates, start.Add(70*time.Second)); err != nil || got != "2001:db8::" {
+		t.Errorf("choose() = %q, %v, want 2001:db8:: once it is old enough", got, err)
+	}
+
+	// An address that disappears starts over when it returns
+	l.choose("eth0", []string{"2001:db8::1"}, start.Add(80*time.Second))
+	if got, _ := l.choose("eth0", candidates, start.Add(90*time.Second)); got != "2001:db8::1" {
+		t.Errorf("choose() = %q, want the returning address to be young again", got)
+	}
+
+	if len(logs) == 0 || logs[0] != "Ignoring 2001:db8::1 on eth0 until it has existed for 30s" {
+		t.Errorf("logs = %q", logs)
+	}
+}
+
 func TestFetchRecordID(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -296,7 +743,7 @@ func TestFetchRecordID(t *testing.T) {
 			}))
 			defer server.Close()
 
-			service := &DDNSService{
+			service := cloudflareAt(&DDNSService{
 				config: Config{
 					CloudFlare: CloudFlareConfig{
 						APIToken:   "test-token",
@@ -305,8 +752,7 @@ func TestFetchRecordID(t *testing.T) {
 					},
 				},
 				httpClient: server.Client(),
-				apiBaseURL: server.URL,
-			}
+			}, server.Client(), server.URL)
 
 			err := service.fetchRecordID()
 			if tt.wantErr {
@@ -397,7 +843,7 @@ func TestUpdateDNS(t *testing.T) {
 			}))
 			defer server.Close()
 
-			service := &DDNSService{
+			service := cloudflareAt(&DDNSService{
 				config: Config{
 					CloudFlare: CloudFlareConfig{
 						APIToken:   "test-token",
@@ -409,8 +855,7 @@ func TestUpdateDNS(t *testing.T) {
 				},
 				httpClient: server.Client(),
 				recordID:   tt.recordID,
-				apiBaseURL: server.URL,
-			}
+			}, server.Client(), server.URL)
 
 			err := service.updateDNS("2001:db8::1")
 			if tt.wantErr {
@@ -519,7 +964,7 @@ func TestStartStabilityTimer(t *testing.T) {
 		}))
 		defer server.Close()
 
-		service := &DDNSService{
+		service := cloudflareAt(&DDNSService{
 			config: Config{
 				Interface:      "eth0",
 				StabilityDelay: 1,
@@ -534,8 +979,7 @@ func TestStartStabilityTimer(t *testing.T) {
 			getIPv6: func(string) (string, error) {
 				return "2001:db8::5", nil
 			},
-			apiBaseURL: server.URL,
-		}
+		}, server.Client(), server.URL)
 
 		service.checkAndUpdate()
 
@@ -593,3 +1037,863 @@ func TestCancelPendingUpdate(t *testing.T) {
 		t.Errorf("pendingIP should be empty, got %q", service.pendingIP)
 	}
 }
+
+func TestUpdateRetry(t *testing.T) {
+	origInitial, origMax := retryInitialDelay, retryMaxDelay
+	retryInitialDelay, retryMaxDelay = 50*time.Millisecond, 100*time.Millisecond
+	defer func() { retryInitialDelay, retryMaxDelay = origInitial, origMax }()
+
+	newService := func(url string, client *http.Client, address *string, mu *sync.Mutex) *DDNSService {
+		return cloudflareAt(&DDNSService{
+			config: Config{
+				Interface:      "eth0",
+				StabilityDelay: 60,
+				CloudFlare: CloudFlareConfig{
+					APIToken:   "token",
+					ZoneID:     "zone",
+					RecordName: "test.example.com",
+				},
+			},
+			httpClient: client,
+			recordID:   "rec-1",
+			getIPv6: func(string) (string, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				return *address, nil
+			},
+		}, client, url)
+	}
+
+	t.Run("retries until the update succeeds", func(t *testing.T) {
+		var mu sync.Mutex
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			attempts++
+			n := attempts
+			mu.Unlock()
+			if n < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(`{"success": false, "errors": [{"code": 10000, "message": "unavailable"}]}`))
+				return
+			}
+			w.Write([]byte(`{"success": true, "result": {"id": "rec-1"}}`))
+		}))
+		defer server.Close()
+
+		address := "2001:db8::5"
+		service := newService(server.URL, server.Client(), &address, &mu)
+		service.pendingIP = address
+		service.stabilityTimerFired()
+
+		service.mu.Lock()
+		if service.pendingIP != address {
+			t.Errorf("pendingIP should be kept after a failed update, got %q", service.pendingIP)
+		}
+		if service.retryDelay != retryInitialDelay {
+			t.Errorf("retryDelay = %s, want %s", service.retryDelay, retryInitialDelay)
+		}
+		service.mu.Unlock()
+
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			service.mu.Lock()
+			lastKnown, pending := service.lastKnownIP, service.pendingIP
+			service.mu.Unlock()
+			if lastKnown == address {
+				if pending != "" {
+					t.Errorf("pendingIP should be cleared, got %q", pending)
+				}
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("update was not retried in time (lastKnownIP %q)", lastKnown)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if attempts != 3 {
+			t.Errorf("attempts = %d, want 3", attempts)
+		}
+	})
+
+	t.Run("newer address supersedes the retry", func(t *testing.T) {
+		var mu sync.Mutex
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"success": false, "errors": [{"code": 10000, "message": "unavailable"}]}`))
+		}))
+		defer server.Close()
+
+		address := "2001:db8::5"
+		service := newService(server.URL, server.Client(), &address, &mu)
+		service.pendingIP = address
+		service.stabilityTimerFired()
+
+		mu.Lock()
+		address = "2001:db8::6"
+		mu.Unlock()
+		service.checkAndUpdate()
+
+		service.mu.Lock()
+		defer service.mu.Unlock()
+		defer service.cancelPendingUpdateLocked()
+		if service.pendingIP != "2001:db8::6" {
+			t.Errorf("pendingIP = %q, want %q", service.pendingIP, "2001:db8::6")
+		}
+		if service.retryDelay != 0 {
+			t.Errorf("retryDelay should be reset by the new stability window, got %s", service.retryDelay)
+		}
+	})
+}
+
+func TestNewDDNSServiceProxiedTTL(t *testing.T) {
+	tests := []struct {
+		proxied bool
+		ttl     int
+		want    int
+	}{
+		{proxied: true, ttl: 300, want: 1},
+		{proxied: true, ttl: 1, want: 1},
+		{proxied: false, ttl: 300, want: 300},
+	}
+	for _, tt := range tests {
+		service := newDDNSService(Config{}, JobConfig{CloudFlare: CloudFlareConfig{Proxied: tt.proxied, TTL: tt.ttl}})
+		if got := service.config.CloudFlare.TTL; got != tt.want {
+			t.Errorf("proxied=%v ttl=%d: TTL = %d, want %d", tt.proxied, tt.ttl, got, tt.want)
+		}
+	}
+}
+
+func TestPublishAliases(t *testing.T) {
+	var mu sync.Mutex
+	var updated []string
+	failVPN := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rec DNSRecord
+		json.NewDecoder(r.Body).Decode(&rec)
+		mu.Lock()
+		defer mu.Unlock()
+		if rec.Name == "vpn.example.com" && failVPN {
+			failVPN = false
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`{"success": false, "errors": [{"code": 10000, "message": "bad gateway"}]}`))
+			return
+		}
+		updated = append(updated, rec.Name)
+		w.Write([]byte(`{"success": true, "result": {"id": "rec-` + rec.Name + `"}}`))
+	}))
+	defer server.Close()
+
+	cf := CloudFlareConfig{APIToken: "token", ZoneID: "zone", RecordName: "home.example.com"}
+	newRecord := func(name string) *DDNSService {
+		config := Config{CloudFlare: cf}
+		config.CloudFlare.RecordName = name
+		return cloudflareAt(&DDNSService{config: config, httpClient: server.Client()}, server.Client(), server.URL)
+	}
+	service := newRecord("home.example.com")
+	service.aliases = []*DDNSService{newRecord("www.example.com"), newRecord("vpn.example.com")}
+
+	err := service.publishAll("2001:db8::5")
+	if err == nil || !strings.Contains(err.Error(), "vpn.example.com: CloudFlare API error: bad gateway") {
+		t.Fatalf("expected vpn alias error, got %v", err)
+	}
+	if want := []string{"home.example.com", "www.example.com"}; !reflect.DeepEqual(updated, want) {
+		t.Errorf("first attempt updated %v, want %v", updated, want)
+	}
+
+	updated = nil
+	if err := service.publishAll("2001:db8::5"); err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+	if want := []string{"vpn.example.com"}; !reflect.DeepEqual(updated, want) {
+		t.Errorf("retry updated %v, want %v", updated, want)
+	}
+	for _, s := range append([]*DDNSService{service}, service.aliases...) {
+		if s.lastKnownIP != "2001:db8::5" {
+			t.Errorf("%s: lastKnownIP = %q", s.config.CloudFlare.RecordName, s.lastKnownIP)
+		}
+	}
+}
+
+func TestRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+interface: eth0
+cloudflare:
+  api_token: token
+  zone_id: zone
+  ttl: 300
+  aliases: [www.example.com]
+  records:
+    - name: home.example.com
+    - name: nas.example.com
+      ttl: 60
+    - name: web.example.com
+      proxied: true
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateConfig(config); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	if config.CloudFlare.RecordName != "home.example.com" || len(config.CloudFlare.Records) != 2 {
+		t.Fatalf("first record should become record_name, got %q and %d more", config.CloudFlare.RecordName, len(config.CloudFlare.Records))
+	}
+
+	service := newDDNSService(config, config.jobs()[0])
+	type settings struct {
+		name    string
+		ttl     int
+		proxied bool
+	}
+	var got []settings
+	for _, s := range append([]*DDNSService{service}, service.aliases...) {
+		got = append(got, settings{s.config.CloudFlare.RecordName, s.config.CloudFlare.TTL, s.config.CloudFlare.Proxied})
+	}
+	want := []settings{
+		{"home.example.com", 300, false},
+		{"www.example.com", 300, false},
+		{"nas.example.com", 60, false},
+		{"web.example.com", 1, true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("records = %+v, want %+v", got, want)
+	}
+}
+
+func TestZones(t *testing.T) {
+	var mu sync.Mutex
+	updates := make(map[string]string) // path -> token
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		updates[r.Method+" "+r.URL.Path] = r.Header.Get("Authorization")
+		mu.Unlock()
+		w.Write([]byte(`{"success": true, "result": {"id": "new"}}`))
+	}))
+	defer server.Close()
+
+	job := JobConfig{
+		Interface: "eth0",
+		CloudFlare: CloudFlareConfig{
+			APIToken:   "token-a",
+			ZoneID:     "zone-a",
+			RecordName: "home.example.com",
+			TTL:        1,
+			Zones: []ZoneConfig{
+				{ZoneID: "zone-b", Records: []RecordConfig{{Name: "home.example.net"}}},
+				{ZoneID: "zone-c", APIToken: "token-c", Records: []RecordConfig{{Name: "home.example.org"}}},
+			},
+		},
+	}
+	if err := validateJob(job); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	service := newDDNSService(Config{}, job)
+	service.httpClient = server.Client()
+	cloudflareAt(service, server.Client(), server.URL)
+	for _, alias := range service.aliases {
+		alias.httpClient = server.Client()
+		cloudflareAt(alias, server.Client(), server.URL)
+	}
+
+	if err := service.publishAll("2001:db8::5"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{
+		"POST /zones/zone-a/dns_records": "Bearer token-a",
+		"POST /zones/zone-b/dns_records": "Bearer token-a",
+		"POST /zones/zone-c/dns_records": "Bearer token-c",
+	}
+	if !reflect.DeepEqual(updates, want) {
+		t.Errorf("updates = %v, want %v", updates, want)
+	}
+
+	// Without a zone_id the zone is looked up from the record name, not
+	// taken from the job's own zone
+	job.CloudFlare.Zones = []ZoneConfig{{Records: []RecordConfig{{Name: "home.example.net"}}}}
+	if err := validateJob(job); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	alias := newDDNSService(Config{}, job).aliases[0]
+	if cf := alias.config.CloudFlare; cf.ZoneID != "" || cf.APIToken != "token-a" {
+		t.Errorf("zone without zone_id: zone %q, token %q; want no zone and the job's token", cf.ZoneID, cf.APIToken)
+	}
+}
+
+func TestPublishAliasesDependOnRecord(t *testing.T) {
+	var updated []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rec DNSRecord
+		json.NewDecoder(r.Body).Decode(&rec)
+		updated = append(updated, rec.Name)
+		if rec.Name == "bastion.example.com" {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`{"success": false, "errors": [{"code": 10000, "message": "bad gateway"}]}`))
+			return
+		}
+		w.Write([]byte(`{"success": true, "result": {"id": "rec-1"}}`))
+	}))
+	defer server.Close()
+
+	newRecord := func(name string) *DDNSService {
+		cf := CloudFlareConfig{APIToken: "token", ZoneID: "zone", RecordName: name, AliasesDependOnRecord: true}
+		return cloudflareAt(&DDNSService{config: Config{CloudFlare: cf}, httpClient: server.Client()}, server.Client(), server.URL)
+	}
+	service := newRecord("bastion.example.com")
+	service.aliases = []*DDNSService{newRecord("www.example.com")}
+
+	err := service.publishAll("2001:db8::5")
+	if err == nil || !strings.Contains(err.Error(), "bad gateway") {
+		t.Fatalf("expected bastion error, got %v", err)
+	}
+	if want := []string{"bastion.example.com"}; !reflect.DeepEqual(updated, want) {
+		t.Errorf("updated %v, want %v", updated, want)
+	}
+	if !retryable(err) {
+		t.Error("a skipped alias update should be retried")
+	}
+}
+
+func TestPlanLimitErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		errs          []CFError
+		wantLimit     bool
+		wantRetryable bool
+	}{
+		{"record quota", []CFError{{Code: 81045, Message: "Record quota exceeded."}}, true, false},
+		{"quota message", []CFError{{Code: 1234, Message: "Monthly request quota reached"}}, true, false},
+		{"quotas message", []CFError{{Code: 1234, Message: "Zone quotas exceeded"}}, true, false},
+		{"plan message", []CFError{{Code: 1234, Message: "Not available on your plan"}}, true, false},
+		{"planned maintenance", []CFError{{Code: 1234, Message: "Unavailable during planned maintenance"}}, false, true},
+		{"transient", []CFError{{Code: 10000, Message: "Internal error"}}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := planLimit(tt.errs)
+			if (err != nil) != tt.wantLimit {
+				t.Fatalf("planLimit() = %v, want limit %v", err, tt.wantLimit)
+			}
+			if err == nil {
+				err = fmt.Errorf("CloudFlare API error: %s", tt.errs[0].Message)
+			}
+			if got := retryable(fmt.Errorf("wrapped: %w", err)); got != tt.wantRetryable {
+				t.Errorf("retryable() = %v, want %v", got, tt.wantRetryable)
+			}
+		})
+	}
+
+	limit := planLimit([]CFError{{Code: 81045, Message: "Record quota exceeded."}})
+	if got := limit.Error(); got != "CloudFlare plan limit: Record quota exceeded. (code 81045); delete unused records in the zone or upgrade its plan" {
+		t.Errorf("message = %q", got)
+	}
+	var mixed *planLimitError
+	if err := planLimit([]CFError{{Code: 1234, Message: "Plan check failed"}, {Code: 81045, Message: "Record quota exceeded."}}); !errors.As(err, &mixed) || mixed.Code != 81045 {
+		t.Errorf("planLimit() = %v, want the error with a known code", err)
+	}
+	if retryable(publishErrors{limit, fmt.Errorf("a.example.com: %w", limit)}) {
+		t.Error("only plan limit failures should not be retryable")
+	}
+	if !retryable(publishErrors{limit, fmt.Errorf("connection refused")}) {
+		t.Error("a transient failure among several should be retryable")
+	}
+}
+
+func TestPlanLimitNotRetried(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"success": false, "errors": [{"code": 81045, "message": "Record quota exceeded."}]}`))
+	}))
+	defer server.Close()
+
+	service := cloudflareAt(&DDNSService{
+		config: Config{
+			Interface: "eth0",
+			CloudFlare: CloudFlareConfig{
+				APIToken:   "token",
+				ZoneID:     "zone",
+				RecordName: "test.example.com",
+			},
+		},
+		httpClient: server.Client(),
+		getIPv6:    func(string) (string, error) { return "2001:db8::5", nil },
+		pendingIP:  "2001:db8::5",
+	}, server.Client(), server.URL)
+	service.stabilityTimerFired()
+
+	if service.stabilityTimer != nil {
+		t.Error("no retry should be scheduled for a plan limit")
+	}
+	if service.pendingIP != "2001:db8::5" {
+		t.Errorf("pendingIP = %q, want it kept until the address changes", service.pendingIP)
+	}
+
+	// Polls with the same address must not restart the stability window
+	service.checkAndUpdate()
+	if service.stabilityTimer != nil {
+		t.Error("poll restarted the stability timer")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	tests := []struct {
+		name            string
+		flushOnShutdown bool
+		wantUpdate      bool
+	}{
+		{"pending update dropped", false, false},
+		{"pending update flushed", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if r.Method != "PUT" {
+					t.Errorf("expected PUT, got %s", r.Method)
+				}
+				w.Write([]byte(`{"success": true, "result": {"id": "rec-1"}}`))
+			}))
+			defer server.Close()
+
+			service := cloudflareAt(&DDNSService{
+				config: Config{
+					StabilityDelay:  60,
+					FlushOnShutdown: tt.flushOnShutdown,
+					CloudFlare: CloudFlareConfig{
+						APIToken:   "token",
+						ZoneID:     "zone",
+						RecordName: "test.example.com",
+					},
+				},
+				httpClient:  server.Client(),
+				recordID:    "rec-1",
+				lastKnownIP: "2001:db8::1",
+				pendingIP:   "2001:db8::2",
+			}, server.Client(), server.URL)
+			service.startStabilityTimer()
+
+			service.shutdown()
+
+			if service.stabilityTimer != nil {
+				t.Error("stabilityTimer should be stopped")
+			}
+			if service.pendingIP != "" {
+				t.Errorf("pendingIP should be empty, got %q", service.pendingIP)
+			}
+			if got := requests == 1; got != tt.wantUpdate {
+				t.Errorf("update sent = %v, want %v (requests: %d)", got, tt.wantUpdate, requests)
+			}
+			wantLastKnown := "2001:db8::1"
+			if tt.wantUpdate {
+				wantLastKnown = "2001:db8::2"
+			}
+			if service.lastKnownIP != wantLastKnown {
+				t.Errorf("lastKnownIP = %q, want %q", service.lastKnownIP, wantLastKnown)
+			}
+		})
+	}
+}
+
+type panicTransport struct{}
+
+func (panicTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	panic("transport exploded")
+}
+
+func TestPanicRecovery(t *testing.T) {
+	t.Run("address check", func(t *testing.T) {
+		service := &DDNSService{
+			config: Config{Interface: "eth0"},
+			getIPv6: func(string) (string, error) {
+				panic("source exploded")
+			},
+		}
+
+		service.safeCheckAndUpdate()
+
+		if service.pendingIP != "" {
+			t.Errorf("pendingIP should be empty, got %q", service.pendingIP)
+		}
+	})
+
+	t.Run("stability timer resets pending state", func(t *testing.T) {
+		service := &DDNSService{
+			config:    Config{Interface: "eth0", StabilityDelay: 60},
+			pendingIP: "2001:db8::2",
+			getIPv6: func(string) (string, error) {
+				panic("source exploded")
+			},
+		}
+		service.startStabilityTimer()
+
+		service.stabilityTimerFired()
+
+		if service.pendingIP != "" {
+			t.Errorf("pendingIP should be cleared, got %q", service.pendingIP)
+		}
+		if service.stabilityTimer != nil {
+			t.Error("stabilityTimer should be cleared")
+		}
+	})
+
+	t.Run("provider call", func(t *testing.T) {
+		service := cloudflareAt(&DDNSService{
+			config: Config{
+				CloudFlare: CloudFlareConfig{
+					APIToken:   "token",
+					ZoneID:     "zone",
+					RecordName: "test.example.com",
+				},
+			},
+			httpClient: &http.Client{Transport: panicTransport{}},
+		}, &http.Client{Transport: panicTransport{}}, "http://cloudflare.invalid")
+
+		err := service.protect("DNS update", func() error { return service.updateDNS("2001:db8::1") })
+		if err == nil || !strings.Contains(err.Error(), "panic in DNS update") {
+			t.Errorf("expected panic error, got %v", err)
+		}
+	})
+}
+
+func TestSelectProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+interface: eth0
+poll_interval: 60
+cloudflare:
+  api_token: test-token
+  zone_id: test-zone
+  record_name: home.example.com
+profiles:
+  remote:
+    jobs:
+      - name: laptop
+        interface: wlan0
+        cloudflare:
+          api_token: test-token
+          zone_id: test-zone
+          record_name: laptop.example.com
+  empty: {}
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+
+	t.Run("no profile keeps top-level job", func(t *testing.T) {
+		got, err := selectProfile(config, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		jobs := got.jobs()
+		if len(jobs) != 1 || jobs[0].Interface != "eth0" {
+			t.Errorf("jobs = %+v, want the top-level eth0 job", jobs)
+		}
+	})
+
+	t.Run("profile replaces jobs", func(t *testing.T) {
+		got, err := selectProfile(config, "remote")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := validateConfig(got); err != nil {
+			t.Fatalf("profile config should be valid: %v", err)
+		}
+		jobs := got.jobs()
+		if len(jobs) != 1 || jobs[0].Name != "laptop" || jobs[0].Interface != "wlan0" {
+			t.Fatalf("jobs = %+v, want the laptop job", jobs)
+		}
+		if jobs[0].PollInterval != 60 || jobs[0].StabilityDelay != 5 || jobs[0].CloudFlare.TTL != 1 {
+			t.Errorf("profile job defaults not applied: %+v", jobs[0])
+		}
+	})
+
+	for name, wantErr := range map[string]string{
+		"missing": `unknown profile "missing"`,
+		"empty":   `profile "empty" has no jobs`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := selectProfile(config, name)
+			if err == nil || err.Error() != wantErr {
+				t.Errorf("expected error %q, got %v", wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPublishGuardRemoteChanges(t *testing.T) {
+	tests := []struct {
+		name          string
+		guard         bool
+		remoteContent string
+		wantGets      int
+		wantPuts      int
+		wantErr       string
+	}{
+		{"guard disabled", false, "2001:db8::9", 0, 1, ""},
+		{"record unchanged", true, "2001:db8::1", 1, 1, ""},
+		{"record already updated", true, "2001:db8::2", 1, 0, ""},
+		{"record changed by other writer", true, "2001:db8::9", 1, 0, "record was changed by another writer to 2001:db8::9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gets, puts int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case "GET":
+					if r.URL.Path != "/zones/zone/dns_records" || r.URL.Query().Get("name") != "test.example.com" {
+						t.Errorf("unexpected lookup %s", r.URL)
+					}
+					gets++
+					fmt.Fprintf(w, `{"success": true, "result": [{"id": "rec-1", "content": %q, "modified_on": "2025-01-02T03:04:05Z"}]}`, tt.remoteContent)
+				case "PUT":
+					if r.URL.Path != "/zones/zone/dns_records/rec-1" {
+						t.Errorf("unexpected path %s", r.URL.Path)
+					}
+					puts++
+					w.Write([]byte(`{"success": true, "result": {"id": "rec-1"}}`))
+				}
+			}))
+			defer server.Close()
+
+			service := cloudflareAt(&DDNSService{
+				config: Config{
+					CloudFlare: CloudFlareConfig{
+						APIToken:           "token",
+						ZoneID:             "zone",
+						RecordName:         "test.example.com",
+						GuardRemoteChanges: tt.guard,
+					},
+				},
+				httpClient:  server.Client(),
+				recordID:    "rec-1",
+				lastKnownIP: "2001:db8::1",
+			}, server.Client(), server.URL)
+
+			err := service.publish("2001:db8::2")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if gets != tt.wantGets || puts != tt.wantPuts {
+				t.Errorf("GETs = %d, PUTs = %d, want %d and %d", gets, puts, tt.wantGets, tt.wantPuts)
+			}
+		})
+	}
+}
+
+func TestCommentStamp(t *testing.T) {
+	t.Run("update writes next stamp", func(t *testing.T) {
+		var comment string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			comment, _ = body["comment"].(string)
+			w.Write([]byte(`{"success": true, "result": {"id": "rec-1"}}`))
+		}))
+		defer server.Close()
+
+		service := cloudflareAt(&DDNSService{
+			config: Config{
+				CloudFlare: CloudFlareConfig{
+					APIToken:     "token",
+					ZoneID:       "zone",
+					RecordName:   "test.example.com",
+					CommentStamp: true,
+					InstanceID:   "site-a",
+				},
+			},
+			httpClient: server.Client(),
+			recordID:   "rec-1",
+			stamp:      recordStamp{Instance: "site-b", Seq: 7},
+		}, server.Client(), server.URL)
+
+		if err := service.updateDNS("2001:db8::2"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		st, ok := parseStamp(comment)
+		if !ok {
+			t.Fatalf("comment %q is not a stamp", comment)
+		}
+		if st.Instance != "site-a" || st.Seq != 8 {
+			t.Errorf("stamp = %+v, want instance site-a seq 8", st)
+		}
+		if service.stamp != st {
+			t.Errorf("service stamp = %+v, want %+v", service.stamp, st)
+		}
+	})
+
+	t.Run("guard detects newer stamp from other instance", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "GET" {
+				t.Errorf("record should not be written, got %s", r.Method)
+			}
+			w.Write([]byte(`{"success": true, "result": [{"id": "rec-1", "content": "2001:db8::1",
+				"comment": "ipv6-ddns-cloudflare instance=site-b seq=9 ts=2025-01-02T03:04:05Z"}]}`))
+		}))
+		defer server.Close()
+
+		service := cloudflareAt(&DDNSService{
+			config: Config{
+				CloudFlare: CloudFlareConfig{
+					APIToken:           "token",
+					ZoneID:             "zone",
+					RecordName:         "test.example.com",
+					GuardRemoteChanges: true,
+					CommentStamp:       true,
+					InstanceID:         "site-a",
+				},
+			},
+			httpClient:  server.Client(),
+			recordID:    "rec-1",
+			lastKnownIP: "2001:db8::1",
+			stamp:       recordStamp{Instance: "site-a", Seq: 8},
+		}, server.Client(), server.URL)
+
+		err := service.publish("2001:db8::2")
+		if err == nil || !strings.Contains(err.Error(), "changed by instance site-b") {
+			t.Errorf("expected conflict error, got %v", err)
+		}
+	})
+}
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		name       string
+		recordID   string
+		remote     string
+		detected   string
+		detectErr  error
+		wantAction string
+	}{
+		{"in sync", "rec-1", "2001:db8::1", "2001:db8::1", nil, "none"},
+		{"address changed", "rec-1", "2001:db8::1", "2001:db8::2", nil, "update"},
+		{"no record", "", "", "2001:db8::2", nil, "create"},
+		{"detection failed", "rec-1", "2001:db8::1", "", fmt.Errorf("interface eth0 not found"),
+			"none until an address is detected (interface eth0 not found)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &DDNSService{
+				config:      Config{Interface: "eth0", CloudFlare: CloudFlareConfig{RecordName: "test.example.com"}},
+				recordID:    tt.recordID,
+				lastKnownIP: tt.remote,
+				getIPv6: func(string) (string, error) {
+					return tt.detected, tt.detectErr
+				},
+			}
+
+			got := service.reconcile()
+			want := reconciliation{Record: "test.example.com", Remote: tt.remote, Detected: tt.detected, Action: tt.wantAction}
+			if got != want {
+				t.Errorf("reconcile() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestUpdateDeletedRecord(t *testing.T) {
+	tests := []struct {
+		name         string
+		listed       string
+		wantLast     string
+		wantRecordID string
+	}{
+		{
+			name:         "created anew",
+			listed:       `[]`,
+			wantLast:     "POST /dns_records",
+			wantRecordID: "new",
+		},
+		{
+			name:         "created again by hand",
+			listed:       `[{"id": "by-hand", "type": "AAAA", "name": "test.example.com", "content": "2001:db8::9"}]`,
+			wantLast:     "PUT /dns_records/by-hand",
+			wantRecordID: "by-hand",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path := strings.TrimPrefix(r.URL.Path, "/zones/test-zone")
+				requests = append(requests, r.Method+" "+path)
+				switch {
+				case r.Method == "PUT" && path == "/dns_records/old":
+					w.WriteHeader(http.StatusNotFound)
+					w.Write([]byte(`{"success": false, "errors": [{"code": 81044, "message": "Record does not exist."}]}`))
+				case r.Method == "GET":
+					w.Write([]byte(`{"success": true, "result": ` + tt.listed + `}`))
+				case r.Method == "POST":
+					w.Write([]byte(`{"success": true, "result": {"id": "new"}}`))
+				default:
+					w.Write([]byte(`{"success": true, "result": {"id": "by-hand"}}`))
+				}
+			}))
+			defer server.Close()
+
+			service := cloudflareAt(&DDNSService{
+				config:   Config{CloudFlare: CloudFlareConfig{APIToken: "test-token", ZoneID: "test-zone", RecordName: "test.example.com", TTL: 1}},
+				recordID: "old",
+			}, server.Client(), server.URL)
+			if err := service.updateDNS("2001:db8::1"); err != nil {
+				t.Fatalf("updateDNS() of a deleted record: %v", err)
+			}
+			// The record is looked up again before it is written
+			if len(requests) < 3 || requests[1] != "GET /dns_records" || requests[len(requests)-1] != tt.wantLast {
+				t.Errorf("requests = %s, want a lookup and then %s", strings.Join(requests, ", "), tt.wantLast)
+			}
+			if service.recordID != tt.wantRecordID {
+				t.Errorf("recordID = %q, want %q", service.recordID, tt.wantRecordID)
+			}
+		})
+	}
+}
+
+func TestOutputFlag(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{args: nil, want: "text"},
+		{args: []string{"-output", "json"}, want: "json"},
+		{args: []string{"-output", "yaml"}, wantErr: `unknown output format "yaml" (use text or json)`},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		output := outputFlag(fs, "text", "json")
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		got, err := output()
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%v: error = %v, want %q", tt.args, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%v: output = %q, %v, want %q", tt.args, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// commentMarkers are record comment fragments, matched case-insensitively,
+// that tell which other tool manages a record.
+var commentMarkers = []struct {
+	fragment string
+	manager  string
+}{
+	{"external-dns", "external-dns"},
+	{"terraform", "Terraform"},
+	{"pulumi", "Pulumi"},
+	{"octodns", "octoDNS"},
+	{"managed by", "another tool"},
+}
+
+// commentManager returns the tool named in a record comment, or "".
+func commentManager(comment string) string {
+	lower := strings.ToLower(comment)
+	for _, m := range commentMarkers {
+		if strings.Contains(lower, m.fragment) {
+			return m.manager
+		}
+	}
+	return ""
+}
+
+// txtManager returns the tool that owns a name according to an ownership
+// TXT record, as written by external-dns's TXT registry
+// ("heritage=external-dns,external-dns/owner=..."), or "".
+func txtManager(content string) string {
+	for _, field := range strings.Split(strings.Trim(content, `"`), ",") {
+		if key, value, ok := strings.Cut(field, "="); ok && key == "heritage" {
+			return value
+		}
+	}
+	return ""
+}
+
+// foreignRecordError refuses an update of a record another tool manages.
+// Repeating it does not help, so it is not retried.
+type foreignRecordError struct {
+	name    string
+	manager string
+}
+
+func (e *foreignRecordError) Error() string {
+	return fmt.Sprintf("%s is managed by %s; set adopt: true to take it over", e.name, e.manager)
+}
+
+// detectManager looks for signs that another tool manages the record: a
+// comment naming it, or an external-dns ownership TXT record next to the
+// record, either at the same name or at the newer "<type>-<name>" form.
+// It returns the tool and where it was found, or "" if there are none.
+func (s *DDNSService) detectManager(record *DNSRecord) (manager, evidence string, err error) {
+	name := s.config.CloudFlare.RecordName
+	if record != nil {
+		if manager := commentManager(record.Comment); manager != "" {
+			return manager, fmt.Sprintf("comment %q", record.Comment), nil
+		}
+	}
+
+	for _, txtName := range []string{name, strings.ToLower(s.typ()) + "-" + name} {
+		txt, err := s.provider.FetchRecord("TXT", txtName)
+		if err != nil {
+			return "", "", fmt.Errorf("checking TXT %s for an owner: %w", txtName, err)
+		}
+		if txt == nil {
+			continue
+		}
+		if manager := txtManager(txt.Content); manager != "" {
+			return manager, fmt.Sprintf("TXT %s %s", txtName, txt.Content), nil
+		}
+	}
+	return "", "", nil
+}
+
+// checkManager records which other tool, if any, manages the record and
+// warns about it. Without adopt, updates of such a record are refused.
+func (s *DDNSService) checkManager(record *DNSRecord) error {
+	manager, evidence, err := s.detectManager(record)
+	if err != nil || manager == "" {
+		return err
+	}
+
+	name := s.config.CloudFlare.RecordName
+	if s.config.CloudFlare.Adopt {
+		s.warnf("WARNING: %s appears to be managed by %s (%s); adopting it as configured. Make sure %s no longer manages it, or the two will keep overwriting each other",
+			name, manager, evidence, manager)
+	} else {
+		s.warnf("WARNING: %s appears to be managed by %s (%s); not modifying it. Set adopt: true to take it over",
+			name, manager, evidence)
+	}
+
+	s.mu.Lock()
+	s.manager = manager
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCommentManager(t *testing.T) {
+	tests := map[string]string{
+		"":                            "",
+		"Managed by Terraform":        "Terraform",
+		"external-dns owned":          "external-dns",
+		"managed by the network team": "another tool",
+		"home router, do not touch":   "",
+		stampPrefix + " instance=a":   "",
+		"pulumi:stack=prod":           "Pulumi",
+	}
+	for comment, want := range tests {
+		if got := commentManager(comment); got != want {
+			t.Errorf("commentManager(%q) = %q, want %q", comment, got, want)
+		}
+	}
+}
+
+func TestTXTManager(t *testing.T) {
+	tests := map[string]string{
+		`"heritage=external-dns,external-dns/owner=default,external-dns/resource=service/default/web"`: "external-dns",
+		`"v=spf1 -all"`: "",
+		`"heritage"`:    "",
+	}
+	for content, want := range tests {
+		if got := txtManager(content); got != want {
+			t.Errorf("txtManager(%q) = %q, want %q", content, got, want)
+		}
+	}
+}
+
+func TestForeignRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		records memProvider
+		adopt   bool
+		wantErr bool
+	}{
+		{
+			name:    "unmarked",
+			records: memProvider{"AAAA home.example.com": {ID: "home", Content: "2001:db8::1"}},
+		},
+		{
+			name:    "terraform comment",
+			records: memProvider{"AAAA home.example.com": {ID: "home", Content: "2001:db8::1", Comment: "Managed by Terraform"}},
+			wantErr: true,
+		},
+		{
+			name: "external-dns TXT",
+			records: memProvider{
+				"AAAA home.example.com":     {ID: "home", Content: "2001:db8::1"},
+				"TXT aaaa-home.example.com": {Content: `"heritage=external-dns,external-dns/owner=k8s"`},
+			},
+			wantErr: true,
+		},
+		{
+			name: "external-dns TXT without record",
+			records: memProvider{
+				"TXT home.example.com": {Content: `"heritage=external-dns,external-dns/owner=k8s"`},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "adopted",
+			records: memProvider{"AAAA home.example.com": {ID: "home", Content: "2001:db8::1", Comment: "Managed by Terraform"}},
+			adopt:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &DDNSService{
+				config:   Config{CloudFlare: CloudFlareConfig{RecordName: "home.example.com", Adopt: tt.adopt}},
+				provider: tt.records,
+			}
+			if err := service.fetchRecordID(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			err := service.updateDNS("2001:db8::2")
+			var foreign *foreignRecordError
+			if got := errors.As(err, &foreign); got != tt.wantErr {
+				t.Fatalf("updateDNS() error = %v, want foreign record error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if retryable(err) {
+					t.Error("foreign record error should not be retried")
+				}
+				if got := tt.records["AAAA home.example.com"].Content; got == "2001:db8::2" {
+					t.Error("record was modified")
+				}
+			} else if got := tt.records["AAAA home.example.com"].Content; got != "2001:db8::2" {
+				t.Errorf("record content = %q, want 2001:db8::2", got)
+			}
+		})
+	}
+}
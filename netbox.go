@@ -0,0 +1,123 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NetBoxConfig mirrors every published address into NetBox, so the site's
+// IPAM documentation follows prefix changes without manual edits.
+type NetBoxConfig struct {
+	URL    string `yaml:"url"`
+	Token  string `yaml:"token"`
+	Status string `yaml:"status"`
+}
+
+type netboxIPAddress struct {
+	ID          int    `json:"id,omitempty"`
+	Address     string `json:"address"`
+	DNSName     string `json:"dns_name"`
+	Status      string `json:"status,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// syncNetBox records ip as the address of the IP address object whose
+// dns_name is the managed record, creating the object on first use.
+func (s *DDNSService) syncNetBox(ip string) error {
+	nb := s.config.NetBox
+	base := strings.TrimSuffix(nb.URL, "/") + "/api/ipam/ip-addresses/"
+	name := s.config.CloudFlare.RecordName
+
+	var list struct {
+		Results []netboxIPAddress `json:"results"`
+	}
+	if err := s.netboxRequest("GET", base+"?dns_name="+url.QueryEscape(name), nil, &list); err != nil {
+		return fmt.Errorf("looking up %s: %w", name, err)
+	}
+
+	prefixLen := "/128"
+	if s.recordType == "A" {
+		prefixLen = "/32"
+	}
+	addr := netboxIPAddress{
+		Address:     ip + prefixLen,
+		DNSName:     name,
+		Status:      nb.Status,
+		Description: "Managed by ipv6-ddns-cloudflare",
+	}
+	if len(list.Results) == 0 {
+		if err := s.netboxRequest("POST", base, addr, nil); err != nil {
+			return fmt.Errorf("creating %s: %w", name, err)
+		}
+		return nil
+	}
+	if len(list.Results) > 1 {
+		return fmt.Errorf("%d IP addresses have dns_name %s, not updating", len(list.Results), name)
+	}
+	if err := s.netboxRequest("PATCH", fmt.Sprintf("%s%d/", base, list.Results[0].ID), addr, nil); err != nil {
+		return fmt.Errorf("updating %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *DDNSService) netboxRequest(method, url string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+s.config.NetBox.Token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("NetBox API returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	if result != nil {
+		if err := json.Unmarshal(data, result); err != nil {
+			return fmt.Errorf("parsing NetBox response: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSyncNetBox(t *testing.T) {
+	tests := []struct {
+		name       string
+		existing   []netboxIPAddress
+		wantMethod string
+		wantPath   string
+		wantErr    string
+	}{
+		{
+			name:       "creates address",
+			wantMethod: "POST",
+			wantPath:   "/api/ipam/ip-addresses/",
+		},
+		{
+			name:       "updates existing address",
+			existing:   []netboxIPAddress{{ID: 7, Address: "2001:db8::1/128", DNSName: "home.example.com"}},
+			wantMethod: "PATCH",
+			wantPath:   "/api/ipam/ip-addresses/7/",
+		},
+		{
+			name: "ambiguous dns_name",
+			existing: []netboxIPAddress{
+				{ID: 7, Address: "2001:db8::1/128", DNSName: "home.example.com"},
+				{ID: 8, Address: "2001:db8::2/128", DNSName: "home.example.com"},
+			},
+			wantErr: "2 IP addresses have dns_name home.example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var method, path string
+			var sent netboxIPAddress
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Authorization"); got != "Token nb-token" {
+					t.Errorf("Authorization = %q", got)
+				}
+				if r.Method == "GET" {
+					if got := r.URL.Query().Get("dns_name"); got != "home.example.com" {
+						t.Errorf("dns_name filter = %q", got)
+					}
+					json.NewEncoder(w).Encode(map[string]interface{}{"results": tt.existing})
+					return
+				}
+				method, path = r.Method, r.URL.Path
+				json.NewDecoder(r.Body).Decode(&sent)
+				w.Write([]byte(`{}`))
+			}))
+			defer server.Close()
+
+			service := &DDNSService{
+				config: Config{
+					CloudFlare: CloudFlareConfig{RecordName: "home.example.com"},
+					NetBox:     NetBoxConfig{URL: server.URL + "/", Token: "nb-token", Status: "active"},
+				},
+				httpClient: server.Client(),
+			}
+
+			err := service.syncNetBox("2001:db8::5")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				if method != "" {
+					t.Errorf("unexpected %s %s", method, path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if method != tt.wantMethod || path != tt.wantPath {
+				t.Errorf("request = %s %s, want %s %s", method, path, tt.wantMethod, tt.wantPath)
+			}
+			want := netboxIPAddress{
+				Address:     "2001:db8::5/128",
+				DNSName:     "home.example.com",
+				Status:      "active",
+				Description: "Managed by ipv6-ddns-cloudflare",
+			}
+			if sent != want {
+				t.Errorf("sent %+v, want %+v", sent, want)
+			}
+		})
+	}
+
+	t.Run("API error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"detail": "Invalid token"}`))
+		}))
+		defer server.Close()
+
+		service := &DDNSService{
+			config: Config{
+				CloudFlare: CloudFlareConfig{RecordName: "home.example.com"},
+				NetBox:     NetBoxConfig{URL: server.URL, Token: "bad"},
+			},
+			httpClient: server.Client(),
+		}
+		err := service.syncNetBox("2001:db8::5")
+		if err == nil || !strings.Contains(err.Error(), "403 Forbidden") {
+			t.Errorf("expected 403 error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,147 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// notifier sends sd_notify(3) messages to systemd: readiness, a status line
+// and watchdog keep-alives. It is nil when systemd didn't ask for them, and
+// a nil notifier drops all messages.
+type notifier struct {
+	conn   *net.UnixConn
+	errors errorLog
+}
+
+// newNotifier connects to $NOTIFY_SOCKET, or returns nil if it is unset.
+// Like the socket activation variables, it is removed from the environment
+// so resolver flush commands don't report to systemd in our place.
+func newNotifier() (*notifier, error) {
+	path := os.Getenv("NOTIFY_SOCKET")
+	os.Unsetenv("NOTIFY_SOCKET")
+	if path == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(path, "@") {
+		// Abstract namespace socket
+		path = "\x00" + path[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("connecting to NOTIFY_SOCKET: %w", err)
+	}
+	return &notifier{conn: conn}, nil
+}
+
+// send reports state, one or more VARIABLE=value lines, to systemd.
+func (n *notifier) send(state string) {
+	if n == nil {
+		return
+	}
+	if _, err := n.conn.Write([]byte(state)); err != nil {
+		n.errors.print(logError, fmt.Sprintf("Failed to notify systemd: %v", err), time.Now())
+		return
+	}
+	n.errors.reset(logError, time.Now())
+}
+
+// watchdogInterval returns how often systemd expects a WATCHDOG=1 keep-alive
+// ($WATCHDOG_USEC), or 0 if the watchdog is not enabled for this process.
+func watchdogInterval() time.Duration {
+	pid, usec := os.Getenv("WATCHDOG_PID"), os.Getenv("WATCHDOG_USEC")
+	os.Unsetenv("WATCHDOG_PID")
+	os.Unsetenv("WATCHDOG_USEC")
+	if pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	n, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || n <= 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Microsecond
+}
+
+// notifyStatus describes the published address of every job for systemctl
+// status, e.g. "AAAA 2001:db8::1 (home.example.com)".
+func notifyStatus(services []*DDNSService) string {
+	var parts []string
+	for _, s := range services {
+		st := s.recordStatuses()[0]
+		address := st.Address
+		if address == "" {
+			address = "no address yet"
+		}
+		part := fmt.Sprintf("%s %s (%s)", st.Type, address, st.Record)
+		if st.Pending != "" && st.Pending != st.Address {
+			part += ", changing to " + st.Pending
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// runNotifier keeps the systemd status line current and, when the watchdog
+// is enabled, sends keep-alives for as long as every service's poll loop
+// keeps beating. A loop stuck for longer than the watchdog interval stops
+// the keep-alives, and systemd restarts the service.
+func runNotifier(n *notifier, services *serviceSet, watchdog time.Duration, stop <-chan struct{}) {
+	interval := 30 * time.Second
+	if watchdog > 0 {
+		interval = watchdog / 2
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last string
+	for {
+		current := services.list()
+		if status := notifyStatus(current); status != last {
+			n.send("STATUS=" + status)
+			last = status
+		}
+		if watchdog > 0 {
+			if stuck := stuckService(current, time.Now(), watchdog); stuck != nil {
+				stuck.errorf("Poll loop has not run for %s, withholding the watchdog keep-alive", watchdog)
+			} else {
+				n.send("WATCHDOG=1")
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// stuckService returns a service whose poll loop hasn't beaten within
+// watchdog of now, or nil if all are alive.
+func stuckService(services []*DDNSService, now time.Time, watchdog time.Duration) *DDNSService {
+	for _, s := range services {
+		if beat := s.lastBeat.Load(); beat != 0 && now.Sub(time.Unix(0, beat)) > watchdog {
+			return s
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNotifier(t *testing.T) {
+	// Unix socket paths are limited to about 100 bytes, shorter than some
+	// t.TempDir paths
+	dir, err := os.MkdirTemp("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", path)
+	n, err := newNotifier()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if os.Getenv("NOTIFY_SOCKET") != "" {
+		t.Error("NOTIFY_SOCKET should be removed from the environment")
+	}
+
+	n.send("READY=1\nSTATUS=AAAA 2001:db8::1 (home.example.com)")
+	buf := make([]byte, 256)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	nr, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("reading notification: %v", err)
+	}
+	if got, want := string(buf[:nr]), "READY=1\nSTATUS=AAAA 2001:db8::1 (home.example.com)"; got != want {
+		t.Errorf("notification = %q, want %q", got, want)
+	}
+
+	t.Setenv("NOTIFY_SOCKET", "")
+	if n, err := newNotifier(); n != nil || err != nil {
+		t.Errorf("newNotifier() without NOTIFY_SOCKET = %v, %v", n, err)
+	}
+	// A nil notifier drops messages
+	var none *notifier
+	none.send("READY=1")
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		pid  string
+		usec string
+		want time.Duration
+	}{
+		{strconv.Itoa(os.Getpid()), "300000000", 5 * time.Minute},
+		{"", "60000000", time.Minute},
+		{"1", "300000000", 0},
+		{"", "", 0},
+		{"", "soon", 0},
+	}
+	for _, tt := range tests {
+		t.Setenv("WATCHDOG_PID", tt.pid)
+		t.Setenv("WATCHDOG_USEC", tt.usec)
+		if got := watchdogInterval(); got != tt.want {
+			t.Errorf("watchdogInterval() with pid %q, usec %q = %s, want %s", tt.pid, tt.usec, got, tt.want)
+		}
+	}
+}
+
+func TestNotifyStatus(t *testing.T) {
+	services := []*DDNSService{
+		{config: Config{CloudFlare: CloudFlareConfig{RecordName: "home.example.com"}}, lastKnownIP: "2001:db8::1", pendingIP: "2001:db8::2"},
+		{config: Config{CloudFlare: CloudFlareConfig{RecordName: "home.example.com"}}, recordType: "A"},
+	}
+	want := "AAAA 2001:db8::1 (home.example.com), changing to 2001:db8::2; A no address yet (home.example.com)"
+	if got := notifyStatus(services); got != want {
+		t.Errorf("notifyStatus() = %q, want %q", got, want)
+	}
+}
+
+func TestStuckService(t *testing.T) {
+	now := time.Now()
+	alive, stuck, starting := &DDNSService{}, &DDNSService{}, &DDNSService{}
+	alive.lastBeat.Store(now.Add(-time.Minute).UnixNano())
+	stuck.lastBeat.Store(now.Add(-10 * time.Minute).UnixNano())
+
+	if got := stuckService([]*DDNSService{alive, starting}, now, 5*time.Minute); got != nil {
+		t.Error("reported a live poll loop as stuck")
+	}
+	if got := stuckService([]*DDNSService{alive, stuck}, now, 5*time.Minute); got != stuck {
+		t.Error("did not report the stuck poll loop")
+	}
+}
@@ -0,0 +1,54 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+// observe compares the records with ip instead of updating them, in
+// observe mode. Records that differ are logged and reported to the
+// webhooks as dns_diverged; nothing is written.
+func (s *DDNSService) observe(ip string) {
+	for _, r := range append([]*DDNSService{s}, s.aliases...) {
+		name := r.config.CloudFlare.RecordName
+		want, err := r.value(ip)
+		if err != nil {
+			s.errorf("Failed to render %s: %v", name, err)
+			continue
+		}
+		var remote string
+		err = r.protect("DNS record lookup", func() error {
+			record, err := r.provider.FetchRecord(r.typ(), name)
+			if record != nil {
+				remote = recordValue(r.typ(), record.Content)
+			}
+			return err
+		})
+		if err != nil {
+			s.errorf("Failed to read %s: %v", name, err)
+			continue
+		}
+		if remote == want {
+			s.logf("%s points to %s", name, want)
+			continue
+		}
+
+		shown := remote
+		if shown == "" {
+			shown = "(no record)"
+		}
+		s.warnf("DIVERGED: %s is %s but should be %s; not updating in observe mode", name, shown, want)
+		s.notify(webhookEvent{Event: "dns_diverged", Severity: "error", Record: name, Address: want, Previous: remote})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestObserveMode(t *testing.T) {
+	var mu sync.Mutex
+	var events []webhookEvent
+	hooks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	defer hooks.Close()
+
+	records := memProvider{
+		"AAAA home.example.com": {ID: "home.example.com", Type: "AAAA", Name: "home.example.com", Content: "2001:db8::1"},
+		"AAAA www.example.com":  {ID: "www.example.com", Type: "AAAA", Name: "www.example.com", Content: "2001:db8::2"},
+	}
+	config := Config{
+		Observe:         true,
+		FlushOnShutdown: true,
+		Webhook:         WebhookConfig{URL: hooks.URL, Secret: "s3cret"},
+		Leader:          LeaderConfig{Record: "_leader.example.com", Lease: 60},
+	}
+	service := newDDNSService(config, JobConfig{Interface: "eth0",
+		CloudFlare: CloudFlareConfig{RecordName: "home.example.com", Aliases: []string{"www.example.com"}}})
+	if service.leader != nil {
+		t.Error("observer takes part in leader election")
+	}
+	service.provider = records
+	for _, alias := range service.aliases {
+		alias.provider = records
+	}
+	service.getIPv6 = func(string) (string, error) { return "2001:db8::2", nil }
+
+	if err := service.fetchRecordIDs(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r := service.reconcile(); r.Action != "report, observing instead of update" {
+		t.Errorf("reconciliation action = %q", r.Action)
+	}
+
+	service.pendingIP = "2001:db8::2"
+	service.stabilityTimerFired()
+	service.shutdown()
+
+	if got := records["AAAA home.example.com"].Content; got != "2001:db8::1" {
+		t.Errorf("observer wrote the record: %s", got)
+	}
+	if service.lastKnownIP != "2001:db8::2" || service.pendingIP != "" {
+		t.Errorf("lastKnownIP = %q, pendingIP = %q", service.lastKnownIP, service.pendingIP)
+	}
+	if len(events) != 1 || events[0].Event != "dns_diverged" || events[0].Record != "home.example.com" ||
+		events[0].Address != "2001:db8::2" || events[0].Previous != "2001:db8::1" {
+		t.Errorf("events = %+v", events)
+	}
+}
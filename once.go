@@ -0,0 +1,114 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"log/slog"
+)
+
+// Exit codes of -once, for cron jobs and DHCP client hooks. An invalid
+// config exits with 1, like the daemon. With several jobs, the most severe
+// outcome wins: jobs left out by soft_fail, then API failures, then
+// detection failures, then updates.
+const (
+	exitNoChange        = 0
+	exitInvalidConfig   = 1
+	exitUpdated         = 10
+	exitDetectionFailed = 11
+	exitAPIFailed       = 12
+)
+
+// onceSeverity orders the exit codes by how much attention they need.
+var onceSeverity = map[int]int{exitNoChange: 0, exitUpdated: 1, exitDetectionFailed: 2, exitAPIFailed: 3, exitInvalidConfig: 4}
+
+// runOnce checks every job a single time, publishing a changed address
+// right away instead of waiting for the stability delay, and returns the
+// exit code.
+func runOnce(config Config) int {
+	for _, job := range config.jobs() {
+		// Address ages are counted from when the process first saw them
+		if job.enabled() && job.MinAddressAge > 0 {
+			logError("Failed to start: min_address_age can't be used with -once")
+			return exitInvalidConfig
+		}
+	}
+
+	services, broken, err := prepareServices(config, nil)
+	if err != nil {
+		logError("Failed to start: %v", err)
+		return exitAPIFailed
+	}
+
+	code := exitNoChange
+	if len(broken) > 0 {
+		code = exitInvalidConfig
+	}
+	for _, service := range services {
+		result := service.checkOnce()
+		service.shutdown()
+		if onceSeverity[result] > onceSeverity[code] {
+			code = result
+		}
+	}
+	return code
+}
+
+// checkOnce detects the address and points any record that doesn't hold
+// it yet at it.
+func (s *DDNSService) checkOnce() int {
+	ip, err := s.detectAddress()
+	if err != nil {
+		s.errorf("Error getting %s address: %v", s.family(), err)
+		return exitDetectionFailed
+	}
+	if s.leader != nil && !s.campaign(s.clock().Now()) {
+		return exitNoChange
+	}
+	if s.config.Observe {
+		s.observe(ip)
+		return exitNoChange
+	}
+
+	s.mu.Lock()
+	s.detectedIP = ip
+	previous := s.lastKnownIP
+	s.prefixChangedLocked(ip)
+	s.mu.Unlock()
+	current := true
+	for _, r := range s.records() {
+		value, err := r.value(ip)
+		r.mu.Lock()
+		current = current && err == nil && r.lastKnownIP == value
+		r.mu.Unlock()
+	}
+	if current {
+		s.logf("%s address %s is already published", s.family(), ip)
+		return exitNoChange
+	}
+
+	s.mu.Lock()
+	s.pendingReason = s.changeReason(previous, ip, false)
+	s.mu.Unlock()
+	start := s.clock().Now()
+	if err := s.publishAll(ip); err != nil {
+		s.errorf("Failed to update DNS: %v", err)
+		return exitAPIFailed
+	}
+	s.logFields(slog.LevelInfo, updateFields(s.config.CloudFlare.RecordName, previous, ip, s.clock().Now().Sub(start)),
+		"Successfully updated DNS record to %s", ip)
+	return exitUpdated
+}
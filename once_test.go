@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckOnce(t *testing.T) {
+	tests := []struct {
+		name     string
+		detected string
+		detect   error
+		remote   string
+		alias    string
+		failures int
+		want     int
+	}{
+		{"no change", "2001:db8::1", nil, "2001:db8::1", "2001:db8::1", 0, exitNoChange},
+		{"updated", "2001:db8::2", nil, "2001:db8::1", "2001:db8::1", 0, exitUpdated},
+		{"stale alias", "2001:db8::1", nil, "2001:db8::1", "2001:db8::9", 0, exitUpdated},
+		{"detection failed", "", errors.New("no address"), "2001:db8::1", "2001:db8::1", 0, exitDetectionFailed},
+		{"API failed", "2001:db8::2", nil, "2001:db8::1", "2001:db8::1", 1, exitAPIFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			provider := &flakyProvider{memProvider: memProvider{}, failures: tt.failures, clock: clock}
+			newRecord := func(name, content string) *DDNSService {
+				provider.memProvider["AAAA "+name] = DNSRecord{ID: name, Name: name, Type: "AAAA", Content: content}
+				return &DDNSService{
+					config:     Config{CloudFlare: CloudFlareConfig{RecordName: name}},
+					getIPv6:    func(string) (string, error) { return tt.detected, tt.detect },
+					provider:   provider,
+					timeSource: clock,
+				}
+			}
+			service := newRecord("home.example.com", tt.remote)
+			service.aliases = []*DDNSService{newRecord("www.example.com", tt.alias)}
+			if err := service.fetchRecordIDs(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := service.checkOnce(); got != tt.want {
+				t.Errorf("checkOnce() = %d, want %d", got, tt.want)
+			}
+			if tt.want == exitUpdated {
+				for _, name := range []string{"home.example.com", "www.example.com"} {
+					if got := provider.memProvider["AAAA "+name].Content; got != tt.detected {
+						t.Errorf("%s = %q, want %s", name, got, tt.detected)
+					}
+				}
+			}
+			if clock.Pending() != 0 {
+				t.Errorf("%d timers left pending", clock.Pending())
+			}
+		})
+	}
+}
+
+func TestRunOnceRejectsMinAddressAge(t *testing.T) {
+	config := Config{Interface: "eth0", MinAddressAge: 60}
+	if got := runOnce(config); got != exitInvalidConfig {
+		t.Errorf("runOnce() = %d, want %d", got, exitInvalidConfig)
+	}
+}
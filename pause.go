@@ -0,0 +1,54 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+// pause stops the job from checking its address and writing its records
+// until resume, dropping an update still waiting for the stability delay.
+// It reports whether the job was running.
+func (s *DDNSService) pause() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.paused {
+		return false
+	}
+	s.paused = true
+	s.cancelPendingUpdateLocked()
+	s.logf("Paused, not checking the address until resumed")
+	return true
+}
+
+// resume undoes pause and checks the address right away. It reports
+// whether the job was paused.
+func (s *DDNSService) resume() bool {
+	s.mu.Lock()
+	if !s.paused {
+		s.mu.Unlock()
+		return false
+	}
+	s.paused = false
+	s.mu.Unlock()
+
+	s.logf("Resumed")
+	go s.safeCheckAndUpdate()
+	return true
+}
+
+func (s *DDNSService) isPaused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
@@ -0,0 +1,193 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+)
+
+// Prefix is the IPv6 prefix a job's address is in, tracked apart from the
+// address itself: a new address in the same prefix, e.g. a privacy
+// rotation, is no prefix change, while a new prefix from the ISP is one
+// change however many records follow it. The prefix hook, the
+// prefix_changed webhook event and the status take it from here instead of
+// re-deriving it from address strings.
+type Prefix struct {
+	// Network is the prefix, of prefix_hook.prefix_length bits (default 64).
+	Network netip.Prefix `json:"network"`
+
+	// Source is where the address was read: "interface" or "snmp".
+	Source string `json:"source"`
+
+	// PreferredLifetime and ValidLifetime are the seconds the kernel still
+	// keeps the address the prefix was taken from, -1 for ever. They are
+	// only known for local interfaces on Linux.
+	PreferredLifetime *int `json:"preferred_lifetime,omitempty"`
+	ValidLifetime     *int `json:"valid_lifetime,omitempty"`
+
+	// address is the address the lifetimes are read from
+	address net.IP
+}
+
+// defaultPrefixLength is the length of a job's prefix unless
+// prefix_hook.prefix_length sets it: the on-link prefix of SLAAC addresses.
+const defaultPrefixLength = 64
+
+// infiniteLifetime is the kernel's lifetime of a static address.
+const infiniteLifetime = 0xffffffff
+
+// newPrefix returns the prefix of ip, an address of the job, without its
+// lifetimes. It reports false if ip is not an IPv6 address.
+func (s *DDNSService) newPrefix(ip string) (Prefix, bool) {
+	length := s.config.PrefixHook.PrefixLength
+	if length == 0 {
+		length = defaultPrefixLength
+	}
+	network, err := netip.ParsePrefix(addressPrefix(ip, length))
+	if err != nil {
+		return Prefix{}, false
+	}
+	source := "interface"
+	if s.config.SNMP.Target != "" {
+		source = "snmp"
+	}
+	return Prefix{Network: network, Source: source, address: net.ParseIP(ip)}, true
+}
+
+// withLifetimes returns p with the current lifetimes of its address, if
+// the kernel has them.
+func (p Prefix) withLifetimes() Prefix {
+	if p.Source != "interface" || p.address == nil {
+		return p
+	}
+	preferred, valid, ok := addressLifetimes(p.address)
+	if !ok {
+		return p
+	}
+	p.PreferredLifetime, p.ValidLifetime = lifetimeSeconds(preferred), lifetimeSeconds(valid)
+	return p
+}
+
+func lifetimeSeconds(lifetime uint32) *int {
+	n := -1
+	if lifetime != infiniteLifetime {
+		n = int(lifetime)
+	}
+	return &n
+}
+
+// String returns the prefix in CIDR notation, or "" for no prefix.
+func (p Prefix) String() string {
+	if !p.Network.IsValid() {
+		return ""
+	}
+	return p.Network.String()
+}
+
+// describeLifetimes returns the lifetimes for the status command, e.g.
+// " (preferred 3h0m0s, valid 24h0m0s)", or "" when they are unknown.
+func (p Prefix) describeLifetimes() string {
+	if p.PreferredLifetime == nil {
+		return ""
+	}
+	lifetime := func(n *int) string {
+		if *n < 0 {
+			return "forever"
+		}
+		return (time.Duration(*n) * time.Second).String()
+	}
+	return fmt.Sprintf(" (preferred %s, valid %s)", lifetime(p.PreferredLifetime), lifetime(p.ValidLifetime))
+}
+
+// env returns the environment variables the prefix hook gets about p.
+func (p Prefix) env() []string {
+	env := []string{"PREFIX_SOURCE=" + p.Source}
+	lifetime := func(n *int) string {
+		if *n < 0 {
+			return "infinite"
+		}
+		return strconv.Itoa(*n)
+	}
+	if p.PreferredLifetime != nil {
+		env = append(env, "PREFERRED_LIFETIME="+lifetime(p.PreferredLifetime), "VALID_LIFETIME="+lifetime(p.ValidLifetime))
+	}
+	return env
+}
+
+// maxPrefixHistory is how many prefixes a job remembers; the one seen
+// longest ago is forgotten first.
+const maxPrefixHistory = 16
+
+// prefixSeen is a prefix a job's address was in. The history of them is
+// kept in the state store, so a prefix an ISP hands out again after a
+// change back and forth is known across restarts.
+type prefixSeen struct {
+	Network   netip.Prefix `json:"network"`
+	FirstSeen time.Time    `json:"first_seen"`
+	LastSeen  time.Time    `json:"last_seen"`
+}
+
+// seenPrefixLocked returns when the prefix of ip was last seen, if it is
+// in the history and isn't the current prefix.
+func (s *DDNSService) seenPrefixLocked(ip string) (prefixSeen, bool) {
+	prefix, ok := s.newPrefix(ip)
+	if !ok || prefix.Network == s.prefix.Network {
+		return prefixSeen{}, false
+	}
+	for _, p := range s.prefixes {
+		if p.Network == prefix.Network {
+			return p, true
+		}
+	}
+	return prefixSeen{}, false
+}
+
+// knownPrefixLocked reports whether the pending address gets the shorter
+// known_prefix_stability_delay, being in a prefix seen before while the link
+// is stable, and returns that prefix.
+func (s *DDNSService) knownPrefixLocked() (prefixSeen, bool) {
+	known := s.config.KnownPrefixStabilityDelay
+	if known == 0 || known >= s.config.StabilityDelay || s.churn >= churnThreshold || s.pendingIP == "" {
+		return prefixSeen{}, false
+	}
+	return s.seenPrefixLocked(s.pendingIP)
+}
+
+// seePrefixLocked records in the history that network is in use now.
+func (s *DDNSService) seePrefixLocked(network netip.Prefix) {
+	now := s.clock().Now()
+	for i := range s.prefixes {
+		if s.prefixes[i].Network == network {
+			s.prefixes[i].LastSeen = now
+			return
+		}
+	}
+	s.prefixes = append(s.prefixes, prefixSeen{Network: network, FirstSeen: now, LastSeen: now})
+	if len(s.prefixes) > maxPrefixHistory {
+		oldest := 0
+		for i, p := range s.prefixes {
+			if p.LastSeen.Before(s.prefixes[oldest].LastSeen) {
+				oldest = i
+			}
+		}
+		s.prefixes = append(s.prefixes[:oldest], s.prefixes[oldest+1:]...)
+	}
+}
@@ -0,0 +1,60 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+)
+
+// addressLifetimes returns the preferred and valid lifetimes, in seconds,
+// of a local IPv6 address from the kernel's address list.
+func addressLifetimes(ip net.IP) (preferred, valid uint32, ok bool) {
+	data, err := syscall.NetlinkRIB(syscall.RTM_GETADDR, syscall.AF_INET6)
+	if err != nil {
+		return 0, 0, false
+	}
+	msgs, err := syscall.ParseNetlinkMessage(data)
+	if err != nil {
+		return 0, 0, false
+	}
+	for i := range msgs {
+		if msgs[i].Header.Type != syscall.RTM_NEWADDR {
+			continue
+		}
+		attrs, err := syscall.ParseNetlinkRouteAttr(&msgs[i])
+		if err != nil {
+			continue
+		}
+		var addr net.IP
+		var cacheInfo []byte
+		for _, attr := range attrs {
+			switch attr.Attr.Type {
+			case syscall.IFA_ADDRESS:
+				addr = net.IP(attr.Value)
+			case syscall.IFA_CACHEINFO:
+				cacheInfo = attr.Value
+			}
+		}
+		// struct ifa_cacheinfo starts with ifa_prefered and ifa_valid
+		if addr.Equal(ip) && len(cacheInfo) >= 8 {
+			return binary.NativeEndian.Uint32(cacheInfo[0:4]), binary.NativeEndian.Uint32(cacheInfo[4:8]), true
+		}
+	}
+	return 0, 0, false
+}
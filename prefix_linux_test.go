@@ -0,0 +1,20 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestAddressLifetimes(t *testing.T) {
+	// The loopback address is static, so it lives for ever
+	preferred, valid, ok := addressLifetimes(net.IPv6loopback)
+	if !ok {
+		t.Skip("no IPv6 loopback address")
+	}
+	if preferred != infiniteLifetime || valid != infiniteLifetime {
+		t.Errorf("lifetimes of ::1 = %d, %d, want infinite", preferred, valid)
+	}
+	if _, _, ok := addressLifetimes(net.ParseIP("2001:db8::dead")); ok {
+		t.Error("found lifetimes of an address that isn't configured")
+	}
+}
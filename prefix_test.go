@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewPrefix(t *testing.T) {
+	tests := []struct {
+		ip     string
+		length int
+		snmp   bool
+		want   string
+		source string
+	}{
+		{"2001:db8:1:2::10", 0, false, "2001:db8:1:2::/64", "interface"},
+		{"2001:db8:1:2::10", 56, false, "2001:db8:1::/56", "interface"},
+		{"2001:db8:1:2::10", 0, true, "2001:db8:1:2::/64", "snmp"},
+		{"203.0.113.5", 0, false, "", ""},
+		{"", 0, false, "", ""},
+	}
+	for _, tt := range tests {
+		s := &DDNSService{config: Config{PrefixHook: PrefixHookConfig{PrefixLength: tt.length}}}
+		if tt.snmp {
+			s.config.SNMP.Target = "192.0.2.1"
+		}
+		got, ok := s.newPrefix(tt.ip)
+		if got.String() != tt.want || got.Source != tt.source || ok != (tt.want != "") {
+			t.Errorf("newPrefix(%q) with length %d = %s from %q, %v, want %s from %q", tt.ip, tt.length, got, got.Source, ok, tt.want, tt.source)
+		}
+	}
+}
+
+func TestPrefixLifetimes(t *testing.T) {
+	preferred, valid := 3600, -1
+	p := Prefix{Source: "interface", PreferredLifetime: &preferred, ValidLifetime: &valid}
+	if got, want := strings.Join(p.env(), " "), "PREFIX_SOURCE=interface PREFERRED_LIFETIME=3600 VALID_LIFETIME=infinite"; got != want {
+		t.Errorf("env() = %q, want %q", got, want)
+	}
+	if got, want := p.describeLifetimes(), " (preferred 1h0m0s, valid forever)"; got != want {
+		t.Errorf("describeLifetimes() = %q, want %q", got, want)
+	}
+	if got := (Prefix{Source: "snmp"}).env(); len(got) != 1 {
+		t.Errorf("env() without lifetimes = %q", got)
+	}
+	if n := lifetimeSeconds(infiniteLifetime); *n != -1 {
+		t.Errorf("lifetimeSeconds(infinite) = %d, want -1", *n)
+	}
+}
+
+func TestPrefixChangedEvent(t *testing.T) {
+	var mu sync.Mutex
+	var events []webhookEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	service := &DDNSService{
+		config: Config{
+			CloudFlare: CloudFlareConfig{RecordName: "home.example.com"},
+			Webhook:    WebhookConfig{URL: server.URL, Secret: "s3cret"},
+		},
+		httpClient:  server.Client(),
+		lastKnownIP: "2001:db8:1::10",
+	}
+	// A new interface identifier is no prefix change, a new prefix is
+	for _, ip := range []string{"2001:db8:1::20", "2001:db8:2::20"} {
+		service.mu.Lock()
+		service.prefixChangedLocked(ip)
+		service.lastKnownIP = ip
+		service.mu.Unlock()
+	}
+	service.background.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 1 || events[0].Address != "2001:db8:2::/64" || events[0].Previous != "2001:db8:1::/64" {
+		t.Errorf("events = %+v, want one prefix_changed from 2001:db8:1::/64 to 2001:db8:2::/64", events)
+	}
+	if st := service.status(); st.Prefix == nil || st.Prefix.String() != "2001:db8:2::/64" {
+		t.Errorf("status prefix = %v", st.Prefix)
+	}
+}
+
+func TestPrefixHistory(t *testing.T) {
+	var mu sync.Mutex
+	var events []webhookEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	clock := newFakeClock()
+	st, _ := loadState(filepath.Join(t.TempDir(), "state.json"))
+	service := &DDNSService{
+		config: Config{
+			StabilityDelay:            60,
+			KnownPrefixStabilityDelay: 5,
+			CloudFlare:                CloudFlareConfig{ZoneID: "zone", RecordName: "home.example.com"},
+			Webhook:                   WebhookConfig{URL: server.URL},
+		},
+		httpClient:  server.Client(),
+		lastKnownIP: "2001:db8:1::10",
+		timeSource:  clock,
+	}
+	service.useState(st)
+	left := clock.Now()
+	// The ISP flips to another prefix and back
+	for _, ip := range []string{"2001:db8:2::20", "2001:db8:1::20"} {
+		service.mu.Lock()
+		service.prefixChangedLocked(ip)
+		service.lastKnownIP = ip
+		service.mu.Unlock()
+		clock.Advance(time.Hour)
+	}
+	service.background.Wait()
+
+	mu.Lock()
+	if len(events) != 2 {
+		t.Fatalf("events = %+v, want two prefix_changed", events)
+	}
+	for _, event := range events {
+		back := event.Address == "2001:db8:1::/64"
+		if back && (event.SeenBefore == nil || !event.SeenBefore.Equal(left)) || !back && event.SeenBefore != nil {
+			t.Errorf("event for %s seen before %v, want it only back in 2001:db8:1::/64, seen at %s", event.Address, event.SeenBefore, left)
+		}
+	}
+	mu.Unlock()
+	if prefixes := service.status().Prefixes; len(prefixes) != 2 {
+		t.Errorf("status prefixes = %+v, want both", prefixes)
+	}
+
+	tests := []struct {
+		pending string
+		churn   int
+		want    time.Duration
+	}{
+		{"2001:db8:2::30", 0, 5 * time.Second},
+		{"2001:db8:1::30", 0, 60 * time.Second},  // the current prefix
+		{"2001:db8:3::30", 0, 60 * time.Second},  // never seen
+		{"2001:db8:2::30", 3, 120 * time.Second}, // unstable link
+	}
+	for _, tt := range tests {
+		service.mu.Lock()
+		service.pendingIP, service.churn = tt.pending, tt.churn
+		got := service.stabilityDelayLocked()
+		service.mu.Unlock()
+		if got != tt.want {
+			t.Errorf("stability delay for %s with %d changes = %s, want %s", tt.pending, tt.churn, got, tt.want)
+		}
+	}
+
+	// The history survives a restart
+	service.saveState()
+	restarted := &DDNSService{config: service.config, timeSource: clock}
+	restarted.useState(st)
+	restarted.restoreJobState()
+	if !reflect.DeepEqual(restarted.prefixes, service.prefixes) {
+		t.Errorf("prefixes after a restart = %+v, want %+v", restarted.prefixes, service.prefixes)
+	}
+}
@@ -0,0 +1,149 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// PrefixHookConfig runs a command once whenever a job's IPv6 prefix
+// changes, e.g. to regenerate firewall, NAT66 or router advertisement
+// configuration, however many records the job updates.
+type PrefixHookConfig struct {
+	Command      string `yaml:"command"`
+	PrefixLength int    `yaml:"prefix_length"`
+	Timeout      int    `yaml:"timeout"`
+}
+
+func validatePrefixHook(h PrefixHookConfig) error {
+	if h.PrefixLength < 1 || h.PrefixLength > 128 {
+		return fmt.Errorf("prefix_hook.prefix_length must be between 1 and 128")
+	}
+	if h.Timeout < 0 {
+		return fmt.Errorf("prefix_hook.timeout must not be negative")
+	}
+	return nil
+}
+
+// addressPrefix returns the prefix of the given length that ip is in, in
+// CIDR notation, or "" if ip is not an IPv6 address.
+func addressPrefix(ip string, length int) string {
+	addr := net.ParseIP(ip)
+	if addr == nil || addr.To4() != nil {
+		return ""
+	}
+	prefix := net.IPNet{IP: addr.Mask(net.CIDRMask(length, 128)), Mask: net.CIDRMask(length, 128)}
+	return prefix.String()
+}
+
+// runHookCommand runs the prefix hook through the shell with env added to
+// the daemon's environment. Replaced in tests.
+var runHookCommand = func(command string, env []string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// prefixChangedLocked tracks the prefix of ip, an address that has just
+// proven stable, and reports a change from the prefix it was in before (or,
+// at first, that of the published address) with prefixChanged.
+func (s *DDNSService) prefixChangedLocked(ip string) {
+	if s.recordType == "A" || s.config.Observe {
+		return
+	}
+	old := s.prefix
+	if !old.Network.IsValid() {
+		old, _ = s.newPrefix(s.lastKnownIP)
+	}
+	prefix, ok := s.newPrefix(ip)
+	if !ok {
+		return
+	}
+	seen, known := s.seenPrefixLocked(ip)
+	s.prefix = prefix
+	if prefix.Network != old.Network {
+		if old.Network.IsValid() {
+			// The old prefix was in use until now
+			s.seePrefixLocked(old.Network)
+		}
+		var lastSeen *time.Time
+		if known {
+			lastSeen = &seen.LastSeen
+		}
+		s.prefixChanged(old, prefix.withLifetimes(), s.lastKnownIP, ip, lastSeen)
+	}
+	s.seePrefixLocked(prefix.Network)
+}
+
+// prefixChanged is the prefix change event: it is logged, sent to the
+// webhooks as prefix_changed and runs the prefix hook in the background.
+// old is the zero Prefix when the job had no address before. lastSeen is
+// when the job's address was last in prefix, if it was before.
+func (s *DDNSService) prefixChanged(old, prefix Prefix, oldIP, ip string, lastSeen *time.Time) {
+	if s.config.DryRun {
+		if s.config.PrefixHook.Command != "" {
+			s.logf("Dry run: would run the prefix hook for %s (was: %s)", prefix, old)
+		}
+		return
+	}
+	// The first prefix is no change, but the hook still sets it up
+	if old.Network.IsValid() {
+		if lastSeen != nil {
+			s.logf("Prefix changed back to %s (was: %s), last seen %s", prefix, old, lastSeen.Format(time.RFC3339))
+		} else {
+			s.logf("Prefix changed to %s (was: %s)", prefix, old)
+		}
+		s.notify(webhookEvent{Event: "prefix_changed", Severity: "info", Address: prefix.String(), Previous: old.String(), SeenBefore: lastSeen})
+	}
+
+	hook := s.config.PrefixHook
+	if hook.Command == "" {
+		return
+	}
+	env := []string{
+		"OLD_PREFIX=" + old.String(),
+		"NEW_PREFIX=" + prefix.String(),
+		"OLD_ADDRESS=" + oldIP,
+		"NEW_ADDRESS=" + ip,
+		"JOB=" + s.name,
+		"INTERFACE=" + s.config.Interface,
+	}
+	env = append(env, prefix.env()...)
+	s.goBackground(func() {
+		defer s.recoverPanic("prefix hook", nil)
+		if err := runHookCommand(hook.Command, env, time.Duration(hook.Timeout)*time.Second); err != nil {
+			s.errorf("Prefix hook for %s failed: %v", prefix, err)
+			return
+		}
+		s.logf("Ran prefix hook for %s (was: %s)", prefix, old)
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAddressPrefix(t *testing.T) {
+	tests := []struct {
+		ip     string
+		length int
+		want   string
+	}{
+		{"2001:db8:1:2::10", 64, "2001:db8:1:2::/64"},
+		{"2001:db8:1:2::10", 56, "2001:db8:1::/56"},
+		{"", 64, ""},
+		{"203.0.113.5", 64, ""},
+	}
+	for _, tt := range tests {
+		if got := addressPrefix(tt.ip, tt.length); got != tt.want {
+			t.Errorf("addressPrefix(%q, %d) = %q, want %q", tt.ip, tt.length, got, tt.want)
+		}
+	}
+}
+
+func TestPrefixHook(t *testing.T) {
+	var mu sync.Mutex
+	var runs [][]string
+	defer func(f func(string, []string, time.Duration) error) { runHookCommand = f }(runHookCommand)
+	runHookCommand = func(command string, env []string, timeout time.Duration) error {
+		mu.Lock()
+		defer mu.Unlock()
+		runs = append(runs, env)
+		return nil
+	}
+
+	clock := newFakeClock()
+	address := "2001:db8:1::10"
+	newRecord := func(name string) *DDNSService {
+		return &DDNSService{
+			name: "home",
+			config: Config{
+				Interface:      "eth0",
+				StabilityDelay: 60,
+				PrefixHook:     PrefixHookConfig{Command: "renumber", PrefixLength: 64, Timeout: 60},
+				CloudFlare:     CloudFlareConfig{RecordName: name},
+			},
+			getIPv6:     func(string) (string, error) { return address, nil },
+			provider:    memProvider{},
+			timeSource:  clock,
+			lastKnownIP: "2001:db8:1::10",
+		}
+	}
+	service := newRecord("home.example.com")
+	service.aliases = []*DDNSService{newRecord("www.example.com"), newRecord("vpn.example.com")}
+
+	steps := []struct {
+		address string
+		want    string
+	}{
+		// A new interface identifier in the same prefix
+		{"2001:db8:1::20", ""},
+		// A new prefix runs the hook once for all three records
+		{"2001:db8:2::20", "OLD_PREFIX=2001:db8:1::/64 NEW_PREFIX=2001:db8:2::/64 OLD_ADDRESS=2001:db8:1::20 NEW_ADDRESS=2001:db8:2::20 JOB=home INTERFACE=eth0 PREFIX_SOURCE=interface"},
+		{"2001:db8:2::30", ""},
+	}
+	for _, step := range steps {
+		runs = nil
+		address = step.address
+		service.checkAndUpdate()
+		clock.Advance(time.Minute)
+		service.background.Wait()
+
+		var got []string
+		for _, env := range runs {
+			got = append(got, strings.Join(env, " "))
+		}
+		var want []string
+		if step.want != "" {
+			want = append(want, step.want)
+		}
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%s: hook ran with %q, want %q", step.address, got, want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ProbeConfig checks after every update that the service behind the record
+// answers on the new address, to catch firewall rules or listeners still
+// bound to the old prefix. Without url the daemon connects to the port
+// itself; with url, an external checker is asked to.
+type ProbeConfig struct {
+	Port    int    `yaml:"port"`
+	URL     string `yaml:"url"`
+	Timeout int    `yaml:"timeout"`
+}
+
+// probeTarget is the data the probe URL template is executed with.
+type probeTarget struct {
+	IP   string
+	Port int
+	Name string
+}
+
+func parseProbeURL(text string) (*template.Template, error) {
+	tmpl, err := template.New("probe.url").Funcs(customFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("probe.url: %w", err)
+	}
+	return tmpl, nil
+}
+
+func validateProbe(p ProbeConfig) error {
+	if p.Port < 1 || p.Port > 65535 {
+		return fmt.Errorf("probe.port must be between 1 and 65535")
+	}
+	if p.Timeout < 0 {
+		return fmt.Errorf("probe.timeout must not be negative")
+	}
+	if p.URL != "" {
+		if _, err := parseProbeURL(p.URL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// probe reports whether the service behind the record is reachable on ip,
+// logging an ALERT and sending a probe_failed event if it isn't.
+func (s *DDNSService) probe(ip string) {
+	defer s.recoverPanic("probe", nil)
+	p := s.config.Probe
+	target := net.JoinHostPort(ip, strconv.Itoa(p.Port))
+	var err error
+	if p.URL != "" {
+		err = s.probeURL(probeTarget{IP: ip, Port: p.Port, Name: s.config.CloudFlare.RecordName})
+	} else {
+		var conn net.Conn
+		conn, err = net.DialTimeout("tcp", target, time.Duration(p.Timeout)*time.Second)
+		if err == nil {
+			conn.Close()
+		}
+	}
+	if err != nil {
+		s.errorf("ALERT: %s is not reachable over the new address: %v", target, err)
+		s.notify(webhookEvent{Event: "probe_failed", Severity: "error", Address: ip, Error: err.Error()})
+		return
+	}
+	s.logf("Probe: %s is reachable", target)
+}
+
+// probeURL asks an external checker to connect to the target; any 2xx
+// answer means the service is reachable.
+func (s *DDNSService) probeURL(target probeTarget) error {
+	tmpl, err := parseProbeURL(s.config.Probe.URL)
+	if err != nil {
+		return err
+	}
+	var url strings.Builder
+	if err := tmpl.Execute(&url, target); err != nil {
+		return fmt.Errorf("probe.url: %w", err)
+	}
+
+	client := *s.httpClient
+	client.Timeout = time.Duration(s.config.Probe.Timeout) * time.Second
+	resp, err := client.Get(url.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("probe URL returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestValidateProbe(t *testing.T) {
+	tests := []struct {
+		name    string
+		probe   ProbeConfig
+		wantErr bool
+	}{
+		{"port", ProbeConfig{Port: 443}, false},
+		{"url", ProbeConfig{Port: 443, URL: "https://probe.example.com/?host={{.IP}}&port={{.Port}}"}, false},
+		{"url without port", ProbeConfig{URL: "https://probe.example.com/"}, true},
+		{"port out of range", ProbeConfig{Port: 70000}, true},
+		{"bad template", ProbeConfig{Port: 443, URL: "https://probe.example.com/{{.IP"}, true},
+		{"negative timeout", ProbeConfig{Port: 443, Timeout: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateProbe(tt.probe); (err != nil) != tt.wantErr {
+				t.Errorf("validateProbe() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProbe(t *testing.T) {
+	var mu sync.Mutex
+	var events []webhookEvent
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	defer hook.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	open := listener.Addr().(*net.TCPAddr).Port
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+	defer listener.Close()
+
+	var probed string
+	checker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probed = r.URL.Query().Get("host") + " " + r.URL.Query().Get("port")
+		if r.URL.Query().Get("port") != strconv.Itoa(open) {
+			http.Error(w, "connection refused", http.StatusBadGateway)
+		}
+	}))
+	defer checker.Close()
+
+	tests := []struct {
+		name       string
+		probe      ProbeConfig
+		wantFailed bool
+	}{
+		{"open port", ProbeConfig{Port: open, Timeout: 5}, false},
+		{"closed port", ProbeConfig{Port: closedPort, Timeout: 5}, true},
+		{"checker reachable", ProbeConfig{Port: open, Timeout: 5, URL: checker.URL + "/?host={{.IP}}&port={{.Port}}"}, false},
+		{"checker unreachable", ProbeConfig{Port: closedPort, Timeout: 5, URL: checker.URL + "/?host={{.IP}}&port={{.Port}}"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events = nil
+			service := &DDNSService{
+				config: Config{
+					CloudFlare: CloudFlareConfig{RecordName: "home.example.com"},
+					Probe:      tt.probe,
+					Webhook:    WebhookConfig{URL: hook.URL, Secret: "s3cret"},
+				},
+				httpClient: checker.Client(),
+			}
+			service.probe("127.0.0.1")
+			service.background.Wait()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if failed := len(events) == 1 && events[0].Event == "probe_failed"; failed != tt.wantFailed || len(events) > 1 {
+				t.Errorf("events = %+v, want probe_failed %v", events, tt.wantFailed)
+			}
+			if tt.probe.URL != "" && probed != "127.0.0.1 "+strconv.Itoa(tt.probe.Port) {
+				t.Errorf("checker was asked about %q", probed)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Provider is a DNS backend. A provider is bound to one zone and its
+// credentials; the detection and stability logic only ever talks to it
+// through these calls.
+type Provider interface {
+	// FetchRecord returns the record of the given type and name, or nil if
+	// the zone has none.
+	FetchRecord(recordType, name string) (*DNSRecord, error)
+	// CreateRecord creates record and returns it as stored, with its ID.
+	CreateRecord(record DNSRecord) (DNSRecord, error)
+	// UpdateRecord replaces the record with record.ID. If there is no
+	// such record any more, the error wraps errRecordNotFound.
+	UpdateRecord(record DNSRecord) (DNSRecord, error)
+	// Capabilities tells which record features the provider has.
+	Capabilities() Capabilities
+}
+
+// Capabilities are the record features a provider supports beyond an
+// address and a TTL. The engine fits a job's settings to them instead of
+// assuming CloudFlare's.
+type Capabilities struct {
+	// Comments: records carry a free-text comment, which comment stamps
+	// are written to.
+	Comments bool
+	// Proxied: records can be served through the provider's proxy, which
+	// always uses the automatic TTL for them.
+	Proxied bool
+	// MinTTL is the lowest TTL, in seconds, every zone of the provider
+	// accepts; 0 leaves the check to the provider. AutoTTL is the TTL that
+	// lets the provider choose, exempt from MinTTL, or 0 if there is none.
+	MinTTL  int
+	AutoTTL int
+}
+
+// fitToProvider adjusts the record settings in cf to what p supports,
+// warning about every setting it has to change.
+func (s *DDNSService) fitToProvider(cf *CloudFlareConfig, p Provider) {
+	caps := p.Capabilities()
+	if cf.Proxied && !caps.Proxied {
+		s.warnf("Warning: the provider can't proxy %s, publishing it unproxied", cf.RecordName)
+		cf.Proxied = false
+	}
+	if cf.CommentStamp && !caps.Comments {
+		s.warnf("Warning: the provider keeps no comment for %s, leaving out the comment stamp", cf.RecordName)
+		cf.CommentStamp = false
+	}
+	if cf.Proxied && cf.TTL != caps.AutoTTL {
+		s.warnf("Warning: ttl %d of %s has no effect on proxied records, using %d (automatic)", cf.TTL, cf.RecordName, caps.AutoTTL)
+		cf.TTL = caps.AutoTTL
+	}
+	if cf.TTL < caps.MinTTL && (caps.AutoTTL == 0 || cf.TTL != caps.AutoTTL) {
+		s.warnf("Warning: ttl %d of %s is below the provider's minimum, using %d", cf.TTL, cf.RecordName, caps.MinTTL)
+		cf.TTL = caps.MinTTL
+	}
+}
+
+// errRecordNotFound reports an update of a record that no longer exists,
+// e.g. because it was deleted in the provider's dashboard.
+var errRecordNotFound = errors.New("record not found")
+
+// DNSRecord is a record as seen by a provider. Providers that have no
+// record IDs, comments or proxying leave those fields empty.
+type DNSRecord struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Name       string    `json:"name"`
+	Content    string    `json:"content"`
+	TTL        int       `json:"ttl"`
+	Proxied    bool      `json:"proxied"`
+	Comment    string    `json:"comment"`
+	ModifiedOn time.Time `json:"modified_on"`
+}
+
+// providers creates the provider selected with a job's provider setting.
+// config is the job's configuration with the record's zone and credentials
+// filled in.
+var providers = map[string]func(config Config, client *http.Client) Provider{
+	"cloudflare": func(config Config, client *http.Client) Provider {
+		return newCloudFlareProvider(config.CloudFlare, client)
+	},
+	"route53": func(config Config, client *http.Client) Provider {
+		return newRoute53Provider(config.Route53, client)
+	},
+	"rfc2136": func(config Config, client *http.Client) Provider {
+		return newRFC2136Provider(config.RFC2136, seconds(config.HTTPClient.Timeout, 30))
+	},
+	"desec": func(config Config, client *http.Client) Provider {
+		return newDeSECProvider(config.DeSEC, client)
+	},
+	"custom": func(config Config, client *http.Client) Provider {
+		return newCustomProvider(config.Custom, client)
+	},
+}
+
+// newProvider creates the provider for a record; in a dry run it only logs
+// its writes with logf.
+func newProvider(config Config, client *http.Client, logf func(string, ...interface{})) Provider {
+	p := providers[config.provider()](config, client)
+	if config.DryRun {
+		return newDryRunProvider(p, logf)
+	}
+	return p
+}
+
+// defaultProvider is used by jobs that don't set provider.
+const defaultProvider = "cloudflare"
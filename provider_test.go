@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// capsProvider is a memProvider with the given capabilities.
+type capsProvider struct {
+	memProvider
+	caps Capabilities
+}
+
+func (p capsProvider) Capabilities() Capabilities { return p.caps }
+
+func TestFitToProvider(t *testing.T) {
+	cloudflare := (&cloudflareProvider{}).Capabilities()
+	tests := []struct {
+		name string
+		caps Capabilities
+		cf   CloudFlareConfig
+		want CloudFlareConfig
+	}{
+		{"supported", cloudflare,
+			CloudFlareConfig{RecordName: "a", TTL: 300, CommentStamp: true},
+			CloudFlareConfig{RecordName: "a", TTL: 300, CommentStamp: true}},
+		{"automatic ttl", cloudflare,
+			CloudFlareConfig{RecordName: "a", TTL: 1},
+			CloudFlareConfig{RecordName: "a", TTL: 1}},
+		{"proxied uses automatic ttl", cloudflare,
+			CloudFlareConfig{RecordName: "a", TTL: 300, Proxied: true},
+			CloudFlareConfig{RecordName: "a", TTL: 1, Proxied: true}},
+		{"ttl below minimum", cloudflare,
+			CloudFlareConfig{RecordName: "a", TTL: 10},
+			CloudFlareConfig{RecordName: "a", TTL: 30}},
+		{"no proxy", Capabilities{},
+			CloudFlareConfig{RecordName: "a", TTL: 300, Proxied: true},
+			CloudFlareConfig{RecordName: "a", TTL: 300}},
+		{"no comments", Capabilities{},
+			CloudFlareConfig{RecordName: "a", TTL: 300, CommentStamp: true},
+			CloudFlareConfig{RecordName: "a", TTL: 300}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &DDNSService{}
+			cf := tt.cf
+			s.fitToProvider(&cf, capsProvider{memProvider{}, tt.caps})
+			if !reflect.DeepEqual(cf, tt.want) {
+				t.Errorf("fitToProvider() = %+v, want %+v", cf, tt.want)
+			}
+		})
+	}
+}
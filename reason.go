@@ -0,0 +1,116 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ipv6AddrPath lists the kernel's IPv6 addresses with their flags.
+// Replaced in tests.
+var ipv6AddrPath = "/proc/net/if_inet6"
+
+// ifaFTemporary marks RFC 4941 privacy addresses in the kernel's address
+// flags.
+const ifaFTemporary = 0x01
+
+// Reasons for an address change, as reported in logs and webhook events.
+const (
+	reasonInitial         = "initial"
+	reasonNewPrefix       = "new_prefix"
+	reasonPrivacyRotation = "privacy_rotation"
+	reasonInterfaceFlap   = "interface_flap"
+	reasonManual          = "manual"
+	reasonChanged         = "changed"
+	reasonForced          = "forced"
+)
+
+var reasonDescriptions = map[string]string{
+	reasonInitial:         "first address",
+	reasonNewPrefix:       "new prefix from the ISP",
+	reasonPrivacyRotation: "privacy address rotation",
+	reasonInterfaceFlap:   "interface came back with a new address",
+	reasonManual:          "interface identifier changed, e.g. by hand",
+	reasonChanged:         "address changed",
+	reasonForced:          "update forced with SIGUSR1",
+}
+
+// classifyChange explains why the address changed from previous to
+// current. lost reports that no address could be detected in between, and
+// temporary that current is a privacy address. IPv4 addresses carry no
+// prefix information, so they are only told apart from flaps.
+func classifyChange(previous, current string, lost, temporary bool) string {
+	if previous == "" {
+		return reasonInitial
+	}
+	prev, cur := net.ParseIP(previous), net.ParseIP(current)
+	if prev == nil || cur == nil || prev.To4() != nil || cur.To4() != nil {
+		if lost {
+			return reasonInterfaceFlap
+		}
+		return reasonChanged
+	}
+	mask := net.CIDRMask(64, 128)
+	if !prev.Mask(mask).Equal(cur.Mask(mask)) {
+		return reasonNewPrefix
+	}
+	switch {
+	case temporary:
+		return reasonPrivacyRotation
+	case lost:
+		return reasonInterfaceFlap
+	}
+	return reasonManual
+}
+
+// parseAddressFlags returns the flags of ip from /proc/net/if_inet6.
+func parseAddressFlags(r io.Reader, ip net.IP) (uint64, bool) {
+	want := hex.EncodeToString(ip.To16())
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 6 || fields[0] != want {
+			continue
+		}
+		flags, err := strconv.ParseUint(fields[4], 16, 32)
+		if err != nil {
+			return 0, false
+		}
+		return flags, true
+	}
+	return 0, false
+}
+
+// changeReason classifies a newly detected address. Privacy addresses are
+// only recognised on local interfaces on Linux.
+func (s *DDNSService) changeReason(previous, current string, lost bool) string {
+	temporary := false
+	if s.config.SNMP.Target == "" && s.recordType != "A" {
+		if f, err := os.Open(ipv6AddrPath); err == nil {
+			flags, ok := parseAddressFlags(f, net.ParseIP(current))
+			f.Close()
+			temporary = ok && flags&ifaFTemporary != 0
+		}
+	}
+	return classifyChange(previous, current, lost, temporary)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClassifyChange(t *testing.T) {
+	tests := []struct {
+		name      string
+		previous  string
+		current   string
+		lost      bool
+		temporary bool
+		want      string
+	}{
+		{"first address", "", "2001:db8:1::1", false, false, reasonInitial},
+		{"new prefix", "2001:db8:1::1", "2001:db8:2::1", false, false, reasonNewPrefix},
+		{"new prefix after an outage", "2001:db8:1::1", "2001:db8:2::1", true, false, reasonNewPrefix},
+		{"privacy rotation", "2001:db8:1::1", "2001:db8:1::2", false, true, reasonPrivacyRotation},
+		{"flap", "2001:db8:1::1", "2001:db8:1::2", true, false, reasonInterfaceFlap},
+		{"manual", "2001:db8:1::1", "2001:db8:1::2", false, false, reasonManual},
+		{"IPv4", "203.0.113.5", "203.0.113.6", false, false, reasonChanged},
+		{"IPv4 flap", "203.0.113.5", "198.51.100.7", true, false, reasonInterfaceFlap},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyChange(tt.previous, tt.current, tt.lost, tt.temporary); got != tt.want {
+				t.Errorf("classifyChange() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+const testIfInet6 = `20010db8000100000000000000000002 02 40 00 01     eth0
+20010db8000100000000000000000001 02 40 00 00     eth0
+fe80000000000000021122fffe334455 02 40 20 80     eth0
+`
+
+func TestParseAddressFlags(t *testing.T) {
+	flags, ok := parseAddressFlags(strings.NewReader(testIfInet6), net.ParseIP("2001:db8:1::2"))
+	if !ok || flags&ifaFTemporary == 0 {
+		t.Errorf("flags of temporary address = %#x, %v", flags, ok)
+	}
+	flags, ok = parseAddressFlags(strings.NewReader(testIfInet6), net.ParseIP("2001:db8:1::1"))
+	if !ok || flags != 0 {
+		t.Errorf("flags of stable address = %#x, %v", flags, ok)
+	}
+	if _, ok := parseAddressFlags(strings.NewReader(testIfInet6), net.ParseIP("2001:db8:1::3")); ok {
+		t.Error("found flags of an unknown address")
+	}
+}
+
+func TestChangeReasonDetection(t *testing.T) {
+	oldPath := ipv6AddrPath
+	defer func() { ipv6AddrPath = oldPath }()
+	ipv6AddrPath = filepath.Join(t.TempDir(), "if_inet6")
+	os.WriteFile(ipv6AddrPath, []byte(testIfInet6), 0644)
+
+	service := &DDNSService{
+		config:      Config{Interface: "eth0", StabilityDelay: 3600},
+		lastKnownIP: "2001:db8:1::1",
+	}
+	defer service.cancelPendingUpdate()
+
+	service.getIPv6 = func(string) (string, error) { return "", errors.New("interface down") }
+	service.checkAndUpdate()
+	service.getIPv6 = func(string) (string, error) { return "2001:db8:1::2", nil }
+	service.checkAndUpdate()
+	// The address is a privacy address, which explains the change better
+	// than the outage does
+	if service.pendingReason != reasonPrivacyRotation {
+		t.Errorf("pendingReason = %q, want %q", service.pendingReason, reasonPrivacyRotation)
+	}
+
+	service.cancelPendingUpdate()
+	service.getIPv6 = func(string) (string, error) { return "2001:db8:1::3", nil }
+	service.checkAndUpdate()
+	if service.pendingReason != reasonInterfaceFlap {
+		t.Errorf("pendingReason = %q, want %q", service.pendingReason, reasonInterfaceFlap)
+	}
+}
@@ -0,0 +1,112 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+// safeReconcileRecords runs reconcileRecords, recovering from panics so the
+// poll loop goes on.
+func (s *DDNSService) safeReconcileRecords() {
+	defer s.recoverPanic("reconciliation", nil)
+	s.reconcileRecords()
+}
+
+// reconcileRecords re-reads every record of the job every
+// reconcile_interval and restores the published value in records that
+// someone or something changed or deleted since, instead of trusting what
+// the job last wrote for ever. Records guarded by guard_remote_changes are
+// only reported, as is everything in observe mode.
+func (s *DDNSService) reconcileRecords() {
+	s.mu.Lock()
+	ip := s.lastKnownIP
+	idle := s.pendingIP == "" && !s.paused && !s.standingByLocked()
+	s.mu.Unlock()
+	// A pending update writes the records anyway
+	if ip == "" || !idle {
+		return
+	}
+	if s.config.Observe {
+		s.observe(ip)
+		return
+	}
+
+	restored := false
+	for _, r := range s.records() {
+		name := r.config.CloudFlare.RecordName
+		want, err := r.value(ip)
+		if err != nil {
+			s.errorf("Failed to render %s: %v", name, err)
+			continue
+		}
+		var record *DNSRecord
+		err = r.protect("DNS record lookup", func() error {
+			record, err = r.provider.FetchRecord(r.typ(), name)
+			return err
+		})
+		if err != nil {
+			s.errorf("Failed to read %s for reconciliation: %v", name, err)
+			continue
+		}
+		var remote string
+		if record != nil {
+			remote = recordValue(r.typ(), record.Content)
+		}
+		if remote == want {
+			s.debugf("%s still points to %s", name, want)
+			continue
+		}
+
+		shown := remote
+		if shown == "" {
+			shown = "deleted"
+		}
+		if r.config.CloudFlare.GuardRemoteChanges {
+			s.warnf("%s was changed to %s but should be %s; not restoring it with guard_remote_changes", name, shown, want)
+			s.notify(webhookEvent{Event: "dns_diverged", Severity: "error", Record: name, Address: want, Previous: remote})
+			continue
+		}
+		if err := r.checkManager(record); err != nil {
+			s.errorf("Failed to check %s: %v", name, err)
+			continue
+		}
+		s.warnf("%s was changed behind our back to %s, restoring %s", name, shown, want)
+
+		r.mu.Lock()
+		r.lastKnownIP = remote
+		r.recordID = ""
+		if record != nil {
+			r.recordID = record.ID
+		}
+		r.mu.Unlock()
+		if err := s.checkFrozen(r); err != nil {
+			s.errorf("Failed to restore %s: %v", name, err)
+			continue
+		}
+		if err := r.protect("DNS update", func() error { return r.updateDNS(want) }); err != nil {
+			s.errorf("Failed to restore %s: %v", name, err)
+			continue
+		}
+		r.mu.Lock()
+		r.lastKnownIP = want
+		r.lastChanged = s.clock().Now()
+		r.mu.Unlock()
+		s.countChange(r, want)
+		s.logf("Restored %s to %s", name, want)
+		restored = true
+	}
+	if restored {
+		s.saveState()
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReconcileRecords(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	tests := []struct {
+		name    string
+		guard   bool
+		observe bool
+		pending string
+		want    string
+		wantLog string
+	}{
+		{name: "restores changed and deleted records", want: "2001:db8::1", wantLog: "home.example.com was changed behind our back to 2001:db8::99, restoring 2001:db8::1"},
+		{name: "guarded records are only reported", guard: true, want: "2001:db8::99", wantLog: "not restoring it with guard_remote_changes"},
+		{name: "observe mode only reports", observe: true, want: "2001:db8::99", wantLog: "DIVERGED: home.example.com is 2001:db8::99"},
+		{name: "pending update is left to finish", pending: "2001:db8::2", want: "2001:db8::99"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			provider := memProvider{}
+			provider.CreateRecord(DNSRecord{Type: "AAAA", Name: "home.example.com", Content: "2001:db8::99"})
+			config := Config{
+				Observe:    tt.observe,
+				CloudFlare: CloudFlareConfig{RecordName: "home.example.com", GuardRemoteChanges: tt.guard},
+			}
+			alias := &DDNSService{config: config, provider: provider, lastKnownIP: "2001:db8::1", recordID: "www.example.com"}
+			alias.config.CloudFlare.RecordName = "www.example.com"
+			service := &DDNSService{
+				config:      config,
+				provider:    provider,
+				timeSource:  newFakeClock(),
+				aliases:     []*DDNSService{alias},
+				recordID:    "home.example.com",
+				lastKnownIP: "2001:db8::1",
+				pendingIP:   tt.pending,
+			}
+
+			service.reconcileRecords()
+			if got := provider["AAAA home.example.com"].Content; got != tt.want {
+				t.Errorf("home.example.com = %s, want %s", got, tt.want)
+			}
+			if !strings.Contains(buf.String(), tt.wantLog) {
+				t.Errorf("log lacks %q:\n%s", tt.wantLog, buf.String())
+			}
+			_, recreated := provider["AAAA www.example.com"]
+			if restore := tt.want == "2001:db8::1"; recreated != restore {
+				t.Errorf("deleted www.example.com recreated = %v, want %v", recreated, restore)
+			}
+			if recreated && service.lastKnownIP != "2001:db8::1" {
+				t.Errorf("lastKnownIP = %s after restoring", service.lastKnownIP)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StateRedisConfig is a Redis server keeping the state of the records, so
+// a fleet of instances can share one place for it instead of a file each.
+type StateRedisConfig struct {
+	// Address is host:port of the server.
+	Address  string `yaml:"address"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+	TLS      bool   `yaml:"tls"`
+	// Key is the hash holding one field per record; it defaults to
+	// ipv6-ddns-cloudflare:state:v1.
+	Key string `yaml:"key"`
+}
+
+// defaultRedisKey is the default key of the state hash. The layout version
+// is part of it, so a new layout starts with a fresh hash.
+const defaultRedisKey = "ipv6-ddns-cloudflare:state"
+
+// redisTimeout bounds a whole exchange with the server.
+const redisTimeout = 10 * time.Second
+
+func (r StateRedisConfig) key() string {
+	if r.Key == "" {
+		return fmt.Sprintf("%s:v%d", defaultRedisKey, stateVersion)
+	}
+	return r.Key
+}
+
+func validateStateRedis(config Config) error {
+	r := config.StateRedis
+	if r.Address == "" {
+		return nil
+	}
+	if config.StateFile != "" {
+		return fmt.Errorf("state_file and state_redis can't be used together")
+	}
+	if _, _, err := net.SplitHostPort(r.Address); err != nil {
+		return fmt.Errorf("state_redis.address: %w", err)
+	}
+	if r.DB < 0 {
+		return fmt.Errorf("state_redis.db must not be negative")
+	}
+	if r.Username != "" && r.Password == "" {
+		return fmt.Errorf("state_redis.password is required with state_redis.username")
+	}
+	return nil
+}
+
+// redisStore is the state kept in a Redis hash. Every record is a field of
+// its own, so instances sharing the hash only ever write their own records.
+type redisStore struct {
+	config  StateRedisConfig
+	mu      sync.Mutex
+	records map[string]recordState
+}
+
+// loadRedisState reads the state hash. An unreachable server leaves the
+// state empty; updates keep trying to write to it.
+func loadRedisState(config StateRedisConfig) (*redisStore, error) {
+	st := &redisStore{config: config, records: make(map[string]recordState)}
+	reply, err := st.command("HGETALL", config.key())
+	if err != nil {
+		return st, fmt.Errorf("reading the state from Redis: %w", err)
+	}
+	fields, _ := reply.([]interface{})
+	for i := 0; i+1 < len(fields); i += 2 {
+		key, _ := fields[i].(string)
+		value, _ := fields[i+1].(string)
+		var rec recordState
+		if err := json.Unmarshal([]byte(value), &rec); err != nil {
+			return st, fmt.Errorf("parsing the state of %s from Redis: %w", key, err)
+		}
+		st.records[key] = rec
+	}
+	return st, nil
+}
+
+func (st *redisStore) get(key string) (recordState, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	rec, ok := st.records[key]
+	return rec, ok
+}
+
+// update writes the given records to their fields of the hash.
+func (st *redisStore) update(records map[string]recordState) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	args := []string{"HSET", st.config.key()}
+	for key, rec := range records {
+		st.records[key] = rec
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		args = append(args, key, string(data))
+	}
+	if len(args) == 2 {
+		return nil
+	}
+	if _, err := st.command(args...); err != nil {
+		return fmt.Errorf("writing the state to Redis: %w", err)
+	}
+	return nil
+}
+
+// command runs one command on a new connection, after authenticating and
+// selecting the database. State is written rarely enough that keeping a
+// connection open isn't worth handling its failures.
+func (st *redisStore) command(args ...string) (interface{}, error) {
+	c := st.config
+	conn, err := net.DialTimeout("tcp", c.Address, redisTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(redisTimeout))
+	if c.TLS {
+		host, _, _ := net.SplitHostPort(c.Address)
+		conn = tls.Client(conn, &tls.Config{ServerName: host})
+	}
+
+	var commands [][]string
+	if c.Password != "" {
+		auth := []string{"AUTH", c.Password}
+		if c.Username != "" {
+			auth = []string{"AUTH", c.Username, c.Password}
+		}
+		commands = append(commands, auth)
+	}
+	if c.DB != 0 {
+		commands = append(commands, []string{"SELECT", strconv.Itoa(c.DB)})
+	}
+	commands = append(commands, args)
+
+	// Pipelined: the replies come back in order
+	var b strings.Builder
+	for _, cmd := range commands {
+		fmt.Fprintf(&b, "*%d\r\n", len(cmd))
+		for _, arg := range cmd {
+			fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if _, err := conn.Write([]byte(b.String())); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	var reply interface{}
+	for _, cmd := range commands {
+		if reply, err = readRESP(r); err != nil {
+			return nil, fmt.Errorf("%s: %w", cmd[0], err)
+		}
+	}
+	return reply, nil
+}
+
+// redisError is an error reply of the server.
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+// Limits of the replies readRESP accepts, so a broken or hostile server
+// can't make the daemon allocate without bound: a string is at most the
+// state of a record many times over, an array holds far more records than
+// any fleet has, and a whole reply takes at most maxRESPReply bytes of
+// memory however its arrays nest.
+const (
+	maxRESPBulk  = 256 << 10
+	maxRESPArray = 1 << 16
+	maxRESPReply = 16 << 20
+)
+
+// respLength parses the length of a bulk string or array: -1 for nil, or
+// up to max.
+func respLength(line string, max int) (int, error) {
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return 0, fmt.Errorf("bad length in reply %q", line)
+	}
+	if n < -1 || n > max {
+		return 0, fmt.Errorf("length out of range in reply %q", line)
+	}
+	return n, nil
+}
+
+// readRESP reads one reply: a string, an integer, nil or a slice of those.
+func readRESP(r *bufio.Reader) (interface{}, error) {
+	budget := maxRESPReply
+	return readRESPWithin(r, &budget)
+}
+
+// readRESPWithin reads a reply taking at most *budget bytes, and takes what
+// it read and allocated off *budget.
+func readRESPWithin(r *bufio.Reader, budget *int) (interface{}, error) {
+	// A line longer than the reader's buffer is no valid reply
+	data, err := r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, errors.New("reply line too long")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if *budget -= len(data); *budget < 0 {
+		return nil, fmt.Errorf("reply longer than %d bytes", maxRESPReply)
+	}
+	line := strings.TrimSuffix(string(data), "\r\n")
+	if line == "" {
+		return nil, errors.New("empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := respLength(line, maxRESPBulk)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		if *budget -= n + 2; *budget < 0 {
+			return nil, fmt.Errorf("reply longer than %d bytes", maxRESPReply)
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := respLength(line, maxRESPArray)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		// Each element takes an interface value, two words
+		if *budget -= n * 16; *budget < 0 {
+			return nil, fmt.Errorf("reply longer than %d bytes", maxRESPReply)
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readRESPWithin(r, budget); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unexpected reply %q", line)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis serves the few commands the state store uses from a map of
+// hashes, and records the commands it got.
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+	mu       sync.Mutex
+	hashes   map[string]map[string]string
+	commands []string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{ln: ln, password: password, hashes: make(map[string]map[string]string)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := f.password == ""
+	for {
+		reply, err := readRESP(r)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]interface{})
+		var args []string
+		for _, item := range items {
+			args = append(args, item.(string))
+		}
+		f.mu.Lock()
+		f.commands = append(f.commands, args[0])
+		switch {
+		case args[0] == "AUTH":
+			authed = args[len(args)-1] == f.password
+			if authed {
+				fmt.Fprint(conn, "+OK\r\n")
+			} else {
+				fmt.Fprint(conn, "-WRONGPASS invalid password\r\n")
+			}
+		case !authed:
+			fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+		case args[0] == "SELECT":
+			fmt.Fprint(conn, "+OK\r\n")
+		case args[0] == "HGETALL":
+			hash := f.hashes[args[1]]
+			fmt.Fprintf(conn, "*%d\r\n", 2*len(hash))
+			for key, value := range hash {
+				fmt.Fprintf(conn, "$%d\r\n%s\r\n$%d\r\n%s\r\n", len(key), key, len(value), value)
+			}
+		case args[0] == "HSET":
+			if f.hashes[args[1]] == nil {
+				f.hashes[args[1]] = make(map[string]string)
+			}
+			for i := 2; i+1 < len(args); i += 2 {
+				f.hashes[args[1]][args[i]] = args[i+1]
+			}
+			fmt.Fprintf(conn, ":%d\r\n", (len(args)-2)/2)
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+		f.mu.Unlock()
+	}
+}
+
+func TestRedisState(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+	config := StateRedisConfig{Address: server.ln.Addr().String(), Password: "secret", DB: 2}
+
+	st, err := loadRedisState(config)
+	if err != nil {
+		t.Fatalf("loadRedisState() of an empty hash: %v", err)
+	}
+	changed := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	want := recordState{RecordID: "rec1", Address: "2001:db8::1", LastChanged: changed}
+	if err := st.update(map[string]recordState{"cloudflare zone AAAA home.example.com": want}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	// Another instance's record is kept when this one writes
+	other, _ := loadRedisState(config)
+	if err := other.update(map[string]recordState{"cloudflare zone AAAA office.example.com": want}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	st, err = loadRedisState(config)
+	if err != nil {
+		t.Fatalf("loadRedisState: %v", err)
+	}
+	for _, key := range []string{"cloudflare zone AAAA home.example.com", "cloudflare zone AAAA office.example.com"} {
+		if got, ok := st.get(key); !ok || !got.LastChanged.Equal(want.LastChanged) || got.Address != want.Address {
+			t.Errorf("get(%q) = %+v, %v, want %+v", key, got, ok, want)
+		}
+	}
+	if _, ok := server.hashes["ipv6-ddns-cloudflare:state:v1"]; !ok {
+		t.Errorf("state not written to the default key, hashes: %v", server.hashes)
+	}
+	if got := strings.Join(server.commands[:3], " "); got != "AUTH SELECT HGETALL" {
+		t.Errorf("commands = %s, want AUTH SELECT HGETALL first", got)
+	}
+
+	config.Password = "wrong"
+	if _, err := loadRedisState(config); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("loadRedisState() with a wrong password = %v", err)
+	}
+}
+
+func TestValidateStateRedis(t *testing.T) {
+	tests := []struct {
+		config  Config
+		wantErr string
+	}{
+		{config: Config{}},
+		{config: Config{StateRedis: StateRedisConfig{Address: "redis.example.net:6379"}}},
+		{config: Config{StateRedis: StateRedisConfig{Address: "redis.example.net"}}, wantErr: "state_redis.address"},
+		{config: Config{StateFile: "/var/lib/x/state.json", StateRedis: StateRedisConfig{Address: "redis:6379"}}, wantErr: "can't be used together"},
+		{config: Config{StateRedis: StateRedisConfig{Address: "redis:6379", DB: -1}}, wantErr: "db must not be negative"},
+		{config: Config{StateRedis: StateRedisConfig{Address: "redis:6379", Username: "ddns"}}, wantErr: "password is required"},
+	}
+	for _, tt := range tests {
+		err := validateStateRedis(tt.config)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("validateStateRedis(%+v) = %v", tt.config.StateRedis, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("validateStateRedis(%+v) = %v, want %q", tt.config.StateRedis, err, tt.wantErr)
+		}
+	}
+}
+
+func TestReadRESP(t *testing.T) {
+	tests := []struct {
+		reply   string
+		want    interface{}
+		wantErr string
+	}{
+		{"+OK\r\n", "OK", ""},
+		{":42\r\n", int64(42), ""},
+		{"$5\r\nhello\r\n", "hello", ""},
+		{"$-1\r\n", nil, ""},
+		{"*2\r\n$1\r\na\r\n:1\r\n", []interface{}{"a", int64(1)}, ""},
+		{"*-1\r\n", nil, ""},
+		{"-ERR wrong\r\n", nil, "ERR wrong"},
+		{"$-2\r\n", nil, "length out of range"},
+		{"*-5\r\n", nil, "length out of range"},
+		{"$262145\r\n", nil, "length out of range"},
+		{"*65537\r\n", nil, "length out of range"},
+		{"$" + strings.Repeat("1", 5000) + "\r\n", nil, "line too long"},
+		{"$x\r\n", nil, "bad length"},
+	}
+	for _, tt := range tests {
+		got, err := readRESP(bufio.NewReader(strings.NewReader(tt.reply)))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("readRESP(%q) error = %v, want %q", tt.reply, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("readRESP(%q) = %#v, %v, want %#v", tt.reply, got, err, tt.want)
+		}
+	}
+
+	// Elements within their limits can't add up to more than a whole reply,
+	// nor can nested arrays
+	var big strings.Builder
+	big.WriteString("*100\r\n")
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&big, "$%d\r\n%s\r\n", maxRESPBulk, strings.Repeat("x", maxRESPBulk))
+	}
+	for _, reply := range []string{big.String(), strings.Repeat("*65536\r\n", 100)} {
+		if _, err := readRESP(bufio.NewReader(strings.NewReader(reply))); err == nil || !strings.Contains(err.Error(), "reply longer than") {
+			t.Errorf("readRESP() of %.20q... error = %v, want reply longer than", reply, err)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// serviceSet is the list of running updaters. A reload replaces it as a
+// whole, so the HTTP endpoints, status page and systemd notifications
+// always see one consistent generation.
+type serviceSet struct {
+	mu       sync.Mutex
+	services []*DDNSService
+	broken   []brokenJob
+}
+
+func newServiceSet(services []*DDNSService) *serviceSet {
+	return &serviceSet{services: services}
+}
+
+func (set *serviceSet) list() []*DDNSService {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	return set.services
+}
+
+// selectJob returns the services of the named job, or all of them for "".
+// It reports false for a job that isn't running.
+func (set *serviceSet) selectJob(job string) ([]*DDNSService, bool) {
+	if job == "" {
+		return set.list(), true
+	}
+	var services []*DDNSService
+	for _, s := range set.list() {
+		if s.name == job {
+			services = append(services, s)
+		}
+	}
+	return services, len(services) > 0
+}
+
+// brokenJobs returns the jobs left out by soft_fail.
+func (set *serviceSet) brokenJobs() []brokenJob {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	return set.broken
+}
+
+func (set *serviceSet) setBroken(broken []brokenJob) {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	set.broken = broken
+}
+
+// supervisor runs the poll loop of every service in set and swaps them for
+// a new generation on reload.
+type supervisor struct {
+	set       *serviceSet
+	heartbeat time.Duration
+	stop      map[*DDNSService]chan struct{}
+	done      map[*DDNSService]chan struct{}
+	running   sync.WaitGroup
+}
+
+func newSupervisor(set *serviceSet) *supervisor {
+	return &supervisor{set: set, stop: map[*DDNSService]chan struct{}{}, done: map[*DDNSService]chan struct{}{}}
+}
+
+// start runs the poll loops of the current services.
+func (sv *supervisor) start() {
+	for _, s := range sv.set.list() {
+		stop, done := make(chan struct{}), make(chan struct{})
+		sv.stop[s], sv.done[s] = stop, done
+		s.heartbeat = sv.heartbeat
+		sv.running.Add(1)
+		go func(s *DDNSService) {
+			defer sv.running.Done()
+			defer close(done)
+			s.run(stop)
+		}(s)
+	}
+}
+
+// stopAll stops every poll loop and waits for them to finish.
+func (sv *supervisor) stopAll() {
+	for s, stop := range sv.stop {
+		close(stop)
+		delete(sv.stop, s)
+		delete(sv.done, s)
+	}
+	sv.running.Wait()
+}
+
+// replace stops the current poll loops without flushing their pending
+// updates, waits for updates already under way, takes over their final
+// state into services and starts those.
+func (sv *supervisor) replace(services []*DDNSService) {
+	previous := sv.set.list()
+	for _, s := range previous {
+		s.mu.Lock()
+		s.retiring = true
+		s.mu.Unlock()
+		close(sv.stop[s])
+		<-sv.done[s]
+		delete(sv.stop, s)
+		delete(sv.done, s)
+		// A stability timer that fired before the loop stopped may still be
+		// writing; a retry it schedules finds the service retiring
+		s.publishing.Wait()
+		s.cancelPendingUpdate()
+	}
+
+	// The old loops may have published since the new services copied their
+	// state during preparation
+	byKey := servicesByKey(previous)
+	for _, s := range services {
+		if old := byKey[s.key()]; old != nil {
+			s.inheritState(old)
+		}
+	}
+
+	sv.set.mu.Lock()
+	sv.set.services = services
+	sv.set.mu.Unlock()
+	for _, s := range services {
+		s.publishAddedRecords()
+	}
+	sv.start()
+}
+
+// key identifies a job's updater across reloads.
+func (s *DDNSService) key() string {
+	return s.name + " " + s.typ()
+}
+
+func servicesByKey(services []*DDNSService) map[string]*DDNSService {
+	byKey := make(map[string]*DDNSService, len(services))
+	for _, s := range services {
+		byKey[s.key()] = s
+	}
+	return byKey
+}
+
+// records returns the job's main record and its aliases.
+func (s *DDNSService) records() []*DDNSService {
+	return append([]*DDNSService{s}, s.aliases...)
+}
+
+// recordKey identifies a record at its provider.
+func (s *DDNSService) recordKey() string {
+	return s.config.provider() + " " + s.config.CloudFlare.ZoneID + " " + s.typ() + " " + s.config.CloudFlare.RecordName
+}
+
+// sameDetection reports whether a and b detect the address the same way, so
+// a reload can keep the detection state, such as address ages.
+func sameDetection(a, b Config) bool {
+	return a.Interface == b.Interface && a.SNMP == b.SNMP && a.PreferDHCPv6 == b.PreferDHCPv6 &&
+		a.MinAddressAge == b.MinAddressAge && a.IPv4 == b.IPv4
+}
+
+// inheritState takes over what previous knows about the records both
+// manage, so a reload neither looks them up again nor republishes them. It
+// returns the records of s that were taken over.
+func (s *DDNSService) inheritState(previous *DDNSService) map[*DDNSService]bool {
+	old := make(map[string]*DDNSService)
+	for _, r := range previous.records() {
+		old[r.recordKey()] = r
+	}
+
+	inherited := make(map[*DDNSService]bool)
+	for _, r := range s.records() {
+		// A record whose content template changed is looked up again
+		p := old[r.recordKey()]
+		if p == nil || p.content != r.content {
+			continue
+		}
+		p.mu.Lock()
+		recordID, lastKnownIP, lastChanged, stamp, manager := p.recordID, p.lastKnownIP, p.lastChanged, p.stamp, p.manager
+		changes, frozenUntil := p.changes, p.frozenUntil
+		p.mu.Unlock()
+
+		r.mu.Lock()
+		r.recordID, r.lastKnownIP, r.lastChanged, r.stamp, r.manager = recordID, lastKnownIP, lastChanged, stamp, manager
+		// A reload neither resets the change count nor lifts a freeze
+		r.changes, r.frozenUntil = changes, frozenUntil
+		r.mu.Unlock()
+		inherited[r] = true
+	}
+
+	previous.mu.Lock()
+	detectedIP, paused, staleSince := previous.detectedIP, previous.paused, previous.staleSince
+	prefixes := previous.prefixes
+	failures, lastSuccess, started, unhealthy := previous.failures, previous.lastSuccess, previous.started, previous.unhealthy
+	var leading bool
+	var holder string
+	var expires time.Time
+	if previous.leader != nil {
+		leading, holder, expires = previous.leader.leading, previous.leader.holder, previous.leader.expires
+	}
+	previous.mu.Unlock()
+
+	s.mu.Lock()
+	s.detectedIP, s.paused, s.staleSince = detectedIP, paused, staleSince
+	s.prefixes = prefixes
+	s.failures, s.lastSuccess, s.started, s.unhealthy = failures, lastSuccess, started, unhealthy
+	if s.leader != nil && previous.leader != nil &&
+		s.leader.record == previous.leader.record && s.leader.instance == previous.leader.instance {
+		s.leader.leading, s.leader.holder, s.leader.expires = leading, holder, expires
+	}
+	s.mu.Unlock()
+
+	if sameDetection(s.config, previous.config) {
+		s.getIPv6 = previous.getIPv6
+	}
+	return inherited
+}
+
+// prepare looks up the job's records before its poll loop starts. Records
+// previous already managed are taken over from it instead.
+func (s *DDNSService) prepare(previous *DDNSService) error {
+	if previous == nil {
+		s.restoreJobState()
+		if err := s.protect("DNS record lookup", s.fetchRecordIDs); err != nil {
+			if !retryable(err) || !s.restoreState() {
+				return err
+			}
+			s.logf("Records could not be looked up, going on from the state file: %v", err)
+			return nil
+		}
+		s.logDrift()
+		s.saveState()
+		s.logReconciliation(s.reconcile())
+		return nil
+	}
+
+	inherited := s.inheritState(previous)
+	for _, r := range s.records() {
+		if inherited[r] {
+			continue
+		}
+		if err := s.protect("DNS record lookup", r.fetchRecordID); err != nil {
+			return fmt.Errorf("%s: %w", r.config.CloudFlare.RecordName, err)
+		}
+		// A new main record is compared with the detected address by the
+		// first poll; only new aliases of a known record need a push
+		s.addedRecords = inherited[s]
+	}
+	return nil
+}
+
+// publishAddedRecords points records added by a reload at the address the
+// job has already published, after the usual stability delay. Records that
+// hold it already are skipped by publishAll.
+func (s *DDNSService) publishAddedRecords() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.addedRecords || s.lastKnownIP == "" || s.config.Observe {
+		return
+	}
+	s.logf("Records were added, publishing %s to them", s.lastKnownIP)
+	s.pendingIP = s.lastKnownIP
+	s.startStabilityTimerLocked()
+}
+
+// prepareServices creates the updaters for the enabled jobs of config and
+// looks up their records. On reload, previous are the running updaters,
+// whose state is taken over for the records that are still configured.
+func prepareServices(config Config, previous []*DDNSService) ([]*DDNSService, []brokenJob, error) {
+	byKey := servicesByKey(previous)
+
+	state, err := openState(config)
+	if err != nil {
+		logWarn("Warning: ignoring the stored state: %v", err)
+	}
+
+	var services []*DDNSService
+	var broken []brokenJob
+	for _, job := range config.jobs() {
+		if !job.enabled() {
+			logInfo("Job %s is disabled, leaving its record untouched", job.Name)
+			continue
+		}
+		if config.SoftFail && len(config.Jobs) > 0 {
+			// validateConfig let invalid jobs through
+			if err := validateJob(job); err != nil {
+				broken = softFail(broken, job, err)
+				continue
+			}
+		}
+
+		service := newDDNSService(config, job)
+		service.useState(state)
+		if err := service.prepare(byKey[service.key()]); err != nil {
+			if config.SoftFail && len(config.Jobs) > 0 {
+				broken = softFail(broken, job, fmt.Errorf("fetching DNS record: %w", err))
+				continue
+			}
+			if job.Name != "" {
+				return nil, nil, fmt.Errorf("fetching DNS record for job %s: %w", job.Name, err)
+			}
+			return nil, nil, fmt.Errorf("fetching DNS record: %w", err)
+		}
+		// A job left out by soft_fail runs none of its updaters
+		jobServices := []*DDNSService{service}
+
+		if job.IPv4.Enabled {
+			service := newIPv4Service(config, job)
+			service.useState(state)
+			if err := service.prepare(byKey[service.key()]); err != nil {
+				if config.SoftFail && len(config.Jobs) > 0 {
+					broken = softFail(broken, job, fmt.Errorf("fetching A record: %w", err))
+					continue
+				}
+				if job.Name != "" {
+					return nil, nil, fmt.Errorf("fetching A record for job %s: %w", job.Name, err)
+				}
+				return nil, nil, fmt.Errorf("fetching A record: %w", err)
+			}
+			jobServices = append(jobServices, service)
+		}
+		services = append(services, jobServices...)
+	}
+	if err := checkBroken(services, broken); err != nil {
+		return nil, nil, err
+	}
+	return services, broken, nil
+}
+
+// commandLine holds the flags that override settings of the config file,
+// so they keep applying after a reload.
+type commandLine struct {
+	observe bool
+	dryRun  bool
+}
+
+// readConfig loads, selects the profile of, reads the API tokens of and
+// validates the config file, the same way at startup and on reload.
+func readConfig(path, profile string, flags commandLine) (Config, error) {
+	config, err := loadConfig(path)
+	if err != nil {
+		return config, err
+	}
+	if flags.observe {
+		config.Observe = true
+	}
+	if flags.dryRun {
+		config.DryRun = true
+	}
+	if config, err = selectProfile(config, profile); err != nil {
+		return config, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := resolveAPITokens(&config); err != nil {
+		return config, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := validateConfig(config); err != nil {
+		return config, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return config, nil
+}
+
+// reloadConfig re-reads the config file and replaces the running services
+// with ones for the new config, keeping what they know about the records.
+// On any error the running services are left alone. Settings used only at
+// startup keep their old values until a restart; it returns the config now
+// in effect.
+func reloadConfig(path, profile string, flags commandLine, current Config, sv *supervisor) (Config, error) {
+	config, err := readConfig(path, profile, flags)
+	if err != nil {
+		return current, err
+	}
+
+	services, broken, err := prepareServices(config, sv.set.list())
+	if err != nil {
+		return current, err
+	}
+	sv.replace(services)
+	sv.set.setBroken(broken)
+	setupLogging(config.Log)
+
+	if config.HTTP != current.HTTP {
+		logWarn("http settings changed; restart to apply them")
+	}
+	if config.StatusPage != current.StatusPage {
+		logWarn("status_page settings changed; restart to apply them")
+	}
+	if config.ControlSocket != current.ControlSocket || config.ControlGroup != current.ControlGroup {
+		logWarn("control_socket settings changed; restart to apply them")
+	}
+	if !config.ACME.equal(current.ACME) {
+		logWarn("acme settings changed; restart to apply them")
+	}
+	config.HTTP, config.StatusPage = current.HTTP, current.StatusPage
+	config.ControlSocket, config.ControlGroup = current.ControlSocket, current.ControlGroup
+	config.ACME = current.ACME
+	return config, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrepareInheritsState(t *testing.T) {
+	records := memProvider{
+		"AAAA home.example.com": {ID: "home", Content: "2001:db8::1"},
+		"AAAA www.example.com":  {ID: "www", Content: "2001:db8::9"},
+	}
+	job := JobConfig{Name: "home", Interface: "eth0", PollInterval: 30, StabilityDelay: 60,
+		CloudFlare: CloudFlareConfig{RecordName: "home.example.com"}}
+	newService := func(job JobConfig) *DDNSService {
+		s := newDDNSService(Config{}, job)
+		for _, r := range s.records() {
+			r.provider = records
+		}
+		return s
+	}
+
+	old := newService(job)
+	if err := old.fetchRecordIDs(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Published since startup; the provider isn't asked again on reload
+	old.lastKnownIP = "2001:db8::2"
+	oldDetect := func(string) (string, error) { return "2001:db8::2", nil }
+	old.getIPv6 = oldDetect
+
+	job.StabilityDelay = 5
+	job.CloudFlare.Aliases = []string{"www.example.com"}
+	s := newService(job)
+	if err := s.prepare(old); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if s.recordID != "home" || s.lastKnownIP != "2001:db8::2" {
+		t.Errorf("main record: recordID = %q, lastKnownIP = %q; want home, 2001:db8::2", s.recordID, s.lastKnownIP)
+	}
+	if alias := s.aliases[0]; alias.recordID != "www" || alias.lastKnownIP != "2001:db8::9" {
+		t.Errorf("new alias: recordID = %q, lastKnownIP = %q; want www, 2001:db8::9", alias.recordID, alias.lastKnownIP)
+	}
+	if !s.addedRecords {
+		t.Error("the added alias should be published")
+	}
+	if got, _ := s.getIPv6("eth0"); got != "2001:db8::2" {
+		t.Error("detection state should be kept when the interface didn't change")
+	}
+
+	// Only the added alias is written, once the new stability delay passed
+	clock := newFakeClock()
+	s.timeSource = clock
+	s.publishAddedRecords()
+	clock.Advance(5 * time.Second)
+	if got := records["AAAA www.example.com"].Content; got != "2001:db8::2" {
+		t.Errorf("alias content = %q, want 2001:db8::2", got)
+	}
+	if got := records["AAAA home.example.com"].Content; got != "2001:db8::1" {
+		t.Errorf("main record was rewritten to %q", got)
+	}
+}
+
+func TestSupervisorReplace(t *testing.T) {
+	detect := func(string) (string, error) { return "2001:db8::1", nil }
+	newService := func(name string) *DDNSService {
+		return &DDNSService{
+			name:     name,
+			config:   Config{PollInterval: 3600, StabilityDelay: 3600, FlushOnShutdown: true, CloudFlare: CloudFlareConfig{RecordName: name + ".example.com"}},
+			getIPv6:  detect,
+			provider: memProvider{},
+		}
+	}
+
+	old := newService("home")
+	set := newServiceSet([]*DDNSService{old})
+	sv := newSupervisor(set)
+	sv.start()
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(time.Millisecond) {
+		old.mu.Lock()
+		pending := old.pendingIP
+		old.mu.Unlock()
+		if pending != "" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the first poll")
+		}
+	}
+
+	replacement := newService("home")
+	sv.replace([]*DDNSService{replacement})
+	defer sv.stopAll()
+
+	if got := set.list(); len(got) != 1 || got[0] != replacement {
+		t.Fatalf("service set = %v, want the replacement", got)
+	}
+	// The old loop found 2001:db8::1 pending but left it to the replacement
+	// instead of flushing it on the way out
+	if got := old.provider.(memProvider)["AAAA home.example.com"].Content; got != "" {
+		t.Errorf("retired service flushed %q", got)
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("interface: eth0\ncloudflare:\n  api_token: t\n  zone_id: z\n  record_name: home.example.com\n")
+	config, err := readConfig(path, "", commandLine{observe: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !config.Observe {
+		t.Error("-observe should carry over to the reloaded config")
+	}
+
+	write("interface: eth0\ncloudflare:\n  zone_id: z\n  record_name: home.example.com\n")
+	if _, err := readConfig(path, "", commandLine{}); err == nil || !strings.HasPrefix(err.Error(), "invalid configuration: ") {
+		t.Errorf("readConfig() error = %v, want an invalid configuration", err)
+	}
+}
+
+// blockingProvider holds every write until release is closed.
+type blockingProvider struct {
+	memProvider
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (p *blockingProvider) CreateRecord(record DNSRecord) (DNSRecord, error) {
+	p.writing <- struct{}{}
+	<-p.release
+	return p.memProvider.CreateRecord(record)
+}
+
+func (p *blockingProvider) UpdateRecord(record DNSRecord) (DNSRecord, error) {
+	return p.CreateRecord(record)
+}
+
+func TestSupervisorReplaceWaitsForUpdate(t *testing.T) {
+	provider := &blockingProvider{memProvider: memProvider{}, writing: make(chan struct{}), release: make(chan struct{})}
+	clock := newFakeClock()
+	newService := func() *DDNSService {
+		return &DDNSService{
+			name:       "home",
+			config:     Config{PollInterval: 3600, StabilityDelay: 5, CloudFlare: CloudFlareConfig{RecordName: "home.example.com"}},
+			getIPv6:    func(string) (string, error) { return "2001:db8::1", nil },
+			provider:   provider,
+			timeSource: clock,
+		}
+	}
+
+	old := newService()
+	set := newServiceSet([]*DDNSService{old})
+	sv := newSupervisor(set)
+	sv.start()
+	for deadline := time.Now().Add(2 * time.Second); clock.Pending() < 2; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the first poll")
+		}
+	}
+	// The stability timer fires and the update is under way
+	go clock.Advance(5 * time.Second)
+	<-provider.writing
+
+	replacement := newService()
+	replaced := make(chan struct{})
+	go func() {
+		sv.replace([]*DDNSService{replacement})
+		close(replaced)
+	}()
+	select {
+	case <-replaced:
+		t.Fatal("the reload didn't wait for the update under way")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(provider.release)
+	<-replaced
+	defer sv.stopAll()
+
+	replacement.mu.Lock()
+	defer replacement.mu.Unlock()
+	if replacement.lastKnownIP != "2001:db8::1" || replacement.recordID == "" {
+		t.Errorf("replacement took over %q (record %q), want what the old service published", replacement.lastKnownIP, replacement.recordID)
+	}
+}
@@ -0,0 +1,193 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// resolverServer is one entry of the resolvers setting: plain DNS
+// ("1.1.1.1", "[2606:4700:4700::1111]:53"), DNS over TLS
+// ("tls://1.1.1.1") or DNS over HTTPS ("https://1.1.1.1/dns-query").
+type resolverServer struct {
+	scheme string // "dns", "tls" or "https"
+	addr   string // host:port for dns and tls
+	host   string // TLS server name
+	url    string // for https
+}
+
+func parseResolverServer(s string) (resolverServer, error) {
+	switch {
+	case strings.HasPrefix(s, "https://"):
+		u, err := url.Parse(s)
+		if err != nil || u.Host == "" {
+			return resolverServer{}, fmt.Errorf("%q is not a valid DNS over HTTPS URL", s)
+		}
+		return resolverServer{scheme: "https", url: s}, nil
+	case strings.HasPrefix(s, "tls://"):
+		addr, host, err := withDefaultPort(strings.TrimPrefix(s, "tls://"), "853")
+		if err != nil {
+			return resolverServer{}, fmt.Errorf("%q: %w", s, err)
+		}
+		return resolverServer{scheme: "tls", addr: addr, host: host}, nil
+	case strings.Contains(s, "://"):
+		return resolverServer{}, fmt.Errorf("%q: only tls:// and https:// resolvers are supported", s)
+	}
+	addr, _, err := withDefaultPort(s, "53")
+	if err != nil {
+		return resolverServer{}, fmt.Errorf("%q: %w", s, err)
+	}
+	return resolverServer{scheme: "dns", addr: addr}, nil
+}
+
+// withDefaultPort adds port to hostport unless it has one, and returns the
+// host part as well.
+func withDefaultPort(hostport, port string) (addr, host string, err error) {
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		return hostport, h, nil
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(hostport, "["), "]")
+	if host == "" {
+		return "", "", fmt.Errorf("missing host")
+	}
+	return net.JoinHostPort(host, port), host, nil
+}
+
+// newResolver returns a resolver that sends every query to servers, taking
+// turns, or nil for the system resolver when servers is empty. Host names
+// in tls:// and https:// entries are resolved with the system resolver,
+// so give addresses to keep working while it is broken.
+func newResolver(servers []string) (*net.Resolver, error) {
+	if len(servers) == 0 {
+		return nil, nil
+	}
+	parsed := make([]resolverServer, len(servers))
+	for i, s := range servers {
+		var err error
+		if parsed[i], err = parseResolverServer(s); err != nil {
+			return nil, err
+		}
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	var next atomic.Uint32
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			server := parsed[int(next.Add(1)-1)%len(parsed)]
+			return server.dial(ctx, network, client)
+		},
+	}, nil
+}
+
+// dial connects to the server for one exchange of the Go resolver. TLS and
+// HTTPS connections are streams, so the resolver frames its messages with
+// a length prefix as for DNS over TCP.
+func (r resolverServer) dial(ctx context.Context, network string, client *http.Client) (net.Conn, error) {
+	var d net.Dialer
+	switch r.scheme {
+	case "tls":
+		conn, err := d.DialContext(ctx, "tcp", r.addr)
+		if err != nil {
+			return nil, err
+		}
+		return tls.Client(conn, &tls.Config{ServerName: r.host}), nil
+	case "https":
+		return &dohConn{ctx: ctx, url: r.url, client: client}, nil
+	}
+	return d.DialContext(ctx, network, r.addr)
+}
+
+// dohConn carries length-prefixed DNS messages written by the Go resolver
+// to a DNS over HTTPS server (RFC 8484), one POST per message.
+type dohConn struct {
+	ctx      context.Context
+	url      string
+	client   *http.Client
+	deadline time.Time
+
+	query    bytes.Buffer
+	response bytes.Reader
+}
+
+func (c *dohConn) Write(b []byte) (int, error) {
+	c.query.Write(b)
+	data := c.query.Bytes()
+	if len(data) < 2 || len(data) < 2+int(binary.BigEndian.Uint16(data)) {
+		return len(b), nil
+	}
+	answer, err := c.exchange(data[2 : 2+int(binary.BigEndian.Uint16(data))])
+	c.query.Reset()
+	if err != nil {
+		return 0, err
+	}
+	framed := binary.BigEndian.AppendUint16(nil, uint16(len(answer)))
+	c.response.Reset(append(framed, answer...))
+	return len(b), nil
+}
+
+func (c *dohConn) exchange(msg []byte) ([]byte, error) {
+	ctx := c.ctx
+	if !c.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS over HTTPS server returned %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 65535))
+}
+
+func (c *dohConn) Read(b []byte) (int, error) { return c.response.Read(b) }
+func (c *dohConn) Close() error               { return nil }
+func (c *dohConn) LocalAddr() net.Addr        { return dohAddr(c.url) }
+func (c *dohConn) RemoteAddr() net.Addr       { return dohAddr(c.url) }
+
+func (c *dohConn) SetDeadline(t time.Time) error {
+	c.deadline = t
+	return nil
+}
+func (c *dohConn) SetReadDeadline(t time.Time) error  { return c.SetDeadline(t) }
+func (c *dohConn) SetWriteDeadline(t time.Time) error { return c.SetDeadline(t) }
+
+type dohAddr string
+
+func (a dohAddr) Network() string { return "https" }
+func (a dohAddr) String() string  { return string(a) }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseResolverServer(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    resolverServer
+		wantErr bool
+	}{
+		{"1.1.1.1", resolverServer{scheme: "dns", addr: "1.1.1.1:53"}, false},
+		{"[2606:4700:4700::1111]:5353", resolverServer{scheme: "dns", addr: "[2606:4700:4700::1111]:5353"}, false},
+		{"2606:4700:4700::1111", resolverServer{scheme: "dns", addr: "[2606:4700:4700::1111]:53"}, false},
+		{"tls://1.1.1.1", resolverServer{scheme: "tls", addr: "1.1.1.1:853", host: "1.1.1.1"}, false},
+		{"tls://dns.quad9.net:8853", resolverServer{scheme: "tls", addr: "dns.quad9.net:8853", host: "dns.quad9.net"}, false},
+		{"https://1.1.1.1/dns-query", resolverServer{scheme: "https", url: "https://1.1.1.1/dns-query"}, false},
+		{"quic://1.1.1.1", resolverServer{}, true},
+		{"https:///dns-query", resolverServer{}, true},
+		{"tls://", resolverServer{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseResolverServer(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseResolverServer(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseResolverServer(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+// dnsAnswer answers query, a DNS message, with a single AAAA record.
+func dnsAnswer(query []byte, addr net.IP) []byte {
+	end := 12
+	for query[end] != 0 {
+		end += int(query[end]) + 1
+	}
+	end += 5 // root label, type and class
+
+	resp := append([]byte(nil), query[:end]...)
+	resp[2] |= 0x80 // QR
+	resp[3] = 0x80  // RA, NOERROR
+	binary.BigEndian.PutUint16(resp[6:], 1)
+	binary.BigEndian.PutUint16(resp[8:], 0)
+	binary.BigEndian.PutUint16(resp[10:], 0)
+	resp = append(resp, 0xc0, 12, 0, 28, 0, 1, 0, 0, 0, 60, 0, 16)
+	return append(resp, addr.To16()...)
+}
+
+func TestDNSOverHTTPS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		query, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(dnsAnswer(query, net.ParseIP("2001:db8::5")))
+	}))
+	defer server.Close()
+
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return &dohConn{ctx: ctx, url: server.URL, client: server.Client()}, nil
+		},
+	}
+	addrs, err := newLookupIP(resolver, "ip6")(context.Background(), "home.example.com")
+	if err != nil {
+		t.Fatalf("lookup failed: %v", err)
+	}
+	if len(addrs) != 1 || addrs[0].String() != "2001:db8::5" {
+		t.Errorf("lookup = %v, want [2001:db8::5]", addrs)
+	}
+}
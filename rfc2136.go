@@ -0,0 +1,666 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// RFC2136Config selects the server, zone and TSIG key of a job using the
+// rfc2136 provider, and the records kept up to date in the zone. Without a
+// key, updates are sent unsigned for servers that allow them by address.
+type RFC2136Config struct {
+	Server       string         `yaml:"server"`
+	Zone         string         `yaml:"zone"`
+	KeyName      string         `yaml:"key_name"`
+	KeyAlgorithm string         `yaml:"key_algorithm"`
+	KeySecret    string         `yaml:"key_secret"`
+	RecordName   string         `yaml:"record_name"`
+	TTL          int            `yaml:"ttl"`
+	Aliases      []string       `yaml:"aliases"`
+	Records      []RecordConfig `yaml:"records"`
+	Adopt        bool           `yaml:"adopt"`
+}
+
+// recordSettings returns the records in the form the updater works with.
+func (r RFC2136Config) recordSettings() CloudFlareConfig {
+	return CloudFlareConfig{
+		ZoneID:     r.Zone,
+		RecordName: r.RecordName,
+		TTL:        r.TTL,
+		Aliases:    r.Aliases,
+		Records:    r.Records,
+		Adopt:      r.Adopt,
+	}
+}
+
+func setRFC2136Defaults(r *RFC2136Config) {
+	if r.Server == "" {
+		return
+	}
+	if r.TTL == 0 {
+		r.TTL = 300
+	}
+	if r.KeyName != "" && r.KeyAlgorithm == "" {
+		r.KeyAlgorithm = "hmac-sha256"
+	}
+	if r.RecordName == "" && len(r.Records) > 0 && r.Records[0].plain() {
+		r.RecordName = r.Records[0].Name
+		if r.Records[0].TTL != 0 {
+			r.TTL = r.Records[0].TTL
+		}
+		r.Records = r.Records[1:]
+	}
+}
+
+func validateRFC2136(r RFC2136Config) error {
+	if r.Server == "" {
+		return fmt.Errorf("rfc2136.server is required")
+	}
+	if r.Zone == "" {
+		return fmt.Errorf("rfc2136.zone is required")
+	}
+	if r.RecordName == "" {
+		return fmt.Errorf("rfc2136.record_name is required")
+	}
+	if (r.KeyName == "") != (r.KeySecret == "") {
+		return fmt.Errorf("rfc2136.key_name and rfc2136.key_secret must be set together")
+	}
+	if r.KeyName != "" {
+		if _, ok := tsigAlgorithms[strings.ToLower(r.KeyAlgorithm)]; !ok {
+			return fmt.Errorf("rfc2136.key_algorithm must be hmac-sha1, hmac-sha256 or hmac-sha512")
+		}
+		if _, err := base64.StdEncoding.DecodeString(r.KeySecret); err != nil {
+			return fmt.Errorf("rfc2136.key_secret is not valid base64")
+		}
+	}
+	seen := map[string]bool{strings.ToLower(r.RecordName): true}
+	for _, alias := range r.Aliases {
+		if alias == "" {
+			return fmt.Errorf("rfc2136.aliases must not contain empty names")
+		}
+		if seen[strings.ToLower(alias)] {
+			return fmt.Errorf("rfc2136.aliases: %s is listed more than once", alias)
+		}
+		seen[strings.ToLower(alias)] = true
+	}
+	for _, record := range r.Records {
+		if record.Proxied != nil {
+			return fmt.Errorf("rfc2136.records: %s: proxied is not supported by RFC 2136", record.Name)
+		}
+	}
+	return validateRecords("rfc2136.records", r.Records, false, seen)
+}
+
+// DNS wire format constants used by the provider.
+const (
+	dnsTypeA     = 1
+	dnsTypeSOA   = 6
+	dnsTypeTXT   = 16
+	dnsTypeAAAA  = 28
+	dnsTypeTSIG  = 250
+	dnsClassIN   = 1
+	dnsClassNONE = 254
+	dnsClassANY  = 255
+
+	dnsOpcodeUpdate = 5
+
+	// tsigFudge is the clock skew in seconds a TSIG signature allows.
+	tsigFudge = 300
+)
+
+var tsigAlgorithms = map[string]func() hash.Hash{
+	"hmac-sha1":   sha1.New,
+	"hmac-sha256": sha256.New,
+	"hmac-sha512": sha512.New,
+}
+
+var dnsRcodes = map[int]string{
+	1: "FORMERR", 2: "SERVFAIL", 3: "NXDOMAIN", 4: "NOTIMP", 5: "REFUSED",
+	6: "YXDOMAIN", 7: "YXRRSET", 8: "NXRRSET", 9: "NOTAUTH", 10: "NOTZONE",
+	16: "BADSIG", 17: "BADKEY", 18: "BADTIME",
+}
+
+func rcodeName(rcode int) string {
+	if name, ok := dnsRcodes[rcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE%d", rcode)
+}
+
+func dnsType(recordType string) (uint16, error) {
+	switch recordType {
+	case "AAAA":
+		return dnsTypeAAAA, nil
+	case "A":
+		return dnsTypeA, nil
+	case "TXT":
+		return dnsTypeTXT, nil
+	}
+	return 0, fmt.Errorf("unsupported record type %s", recordType)
+}
+
+// txtContent joins the character strings of TXT rdata and quotes them the
+// way CloudFlare returns TXT content.
+func txtContent(rdata []byte) string {
+	var b strings.Builder
+	for len(rdata) > 0 {
+		n := int(rdata[0])
+		if n+1 > len(rdata) {
+			break
+		}
+		b.Write(rdata[1 : n+1])
+		rdata = rdata[n+1:]
+	}
+	return `"` + b.String() + `"`
+}
+
+// txtRdata encodes a TXT value as character strings of up to 255 bytes.
+func txtRdata(value string) []byte {
+	var b []byte
+	for {
+		n := min(len(value), 255)
+		b = append(b, byte(n))
+		b = append(b, value[:n]...)
+		value = value[n:]
+		if value == "" {
+			return b
+		}
+	}
+}
+
+// appendName appends name in uncompressed wire format.
+func appendName(b []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if len(name) > 253 {
+		return nil, fmt.Errorf("name %q is too long", name)
+	}
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if label == "" || len(label) > 63 {
+				return nil, fmt.Errorf("invalid name %q", name)
+			}
+			b = append(b, byte(len(label)))
+			b = append(b, label...)
+		}
+	}
+	return append(b, 0), nil
+}
+
+// readName reads a possibly compressed name at off and returns it along
+// with the offset just past it.
+func readName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, fmt.Errorf("truncated name")
+		}
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.Join(labels, "."), end, nil
+		case n&0xC0 == 0xC0:
+			if off+1 >= len(msg) || jumps > 16 {
+				return "", 0, fmt.Errorf("invalid name compression")
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3FFF)
+			jumps++
+		default:
+			if off+1+n > len(msg) {
+				return "", 0, fmt.Errorf("truncated name")
+			}
+			labels = append(labels, string(msg[off+1:off+1+n]))
+			off += 1 + n
+		}
+	}
+}
+
+type dnsRR struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+	Data  []byte
+
+	// offset of the record in the message it was read from
+	offset int
+}
+
+func appendRR(b []byte, rr dnsRR) ([]byte, error) {
+	b, err := appendName(b, rr.Name)
+	if err != nil {
+		return nil, err
+	}
+	b = binary.BigEndian.AppendUint16(b, rr.Type)
+	b = binary.BigEndian.AppendUint16(b, rr.Class)
+	b = binary.BigEndian.AppendUint32(b, rr.TTL)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(rr.Data)))
+	return append(b, rr.Data...), nil
+}
+
+// dnsMessage is a parsed response. The first section (question or zone)
+// is skipped; the records of the other three are kept in order.
+type dnsMessage struct {
+	ID      uint16
+	Rcode   int
+	Answers []dnsRR
+	Extra   []dnsRR
+}
+
+func parseDNSMessage(msg []byte) (dnsMessage, error) {
+	if len(msg) < 12 {
+		return dnsMessage{}, fmt.Errorf("short DNS message")
+	}
+	m := dnsMessage{
+		ID:    binary.BigEndian.Uint16(msg),
+		Rcode: int(msg[3] & 0x0F),
+	}
+	counts := [4]int{}
+	for i := range counts {
+		counts[i] = int(binary.BigEndian.Uint16(msg[4+2*i:]))
+	}
+
+	off := 12
+	for i := 0; i < counts[0]; i++ {
+		_, next, err := readName(msg, off)
+		if err != nil {
+			return dnsMessage{}, err
+		}
+		off = next + 4
+	}
+	for section := 1; section < 4; section++ {
+		for i := 0; i < counts[section]; i++ {
+			start := off
+			name, next, err := readName(msg, off)
+			if err != nil {
+				return dnsMessage{}, err
+			}
+			if next+10 > len(msg) {
+				return dnsMessage{}, fmt.Errorf("truncated record")
+			}
+			rr := dnsRR{
+				Name:   name,
+				Type:   binary.BigEndian.Uint16(msg[next:]),
+				Class:  binary.BigEndian.Uint16(msg[next+2:]),
+				TTL:    binary.BigEndian.Uint32(msg[next+4:]),
+				offset: start,
+			}
+			length := int(binary.BigEndian.Uint16(msg[next+8:]))
+			off = next + 10 + length
+			if off > len(msg) {
+				return dnsMessage{}, fmt.Errorf("truncated record")
+			}
+			rr.Data = msg[next+10 : off]
+			switch section {
+			case 1:
+				m.Answers = append(m.Answers, rr)
+			case 3:
+				m.Extra = append(m.Extra, rr)
+			}
+		}
+	}
+	return m, nil
+}
+
+// tsigKey is a TSIG key with its algorithm, in canonical (lower case) form.
+type tsigKey struct {
+	Name      string
+	Algorithm string
+	Secret    []byte
+}
+
+// tsigRecord holds the fields of a TSIG record's data.
+type tsigRecord struct {
+	Algorithm  string
+	TimeSigned uint64
+	Fudge      uint16
+	MAC        []byte
+	OriginalID uint16
+	Error      uint16
+	Other      []byte
+}
+
+// tsigVariables are the TSIG fields covered by the MAC (RFC 8945, 4.3.3).
+func tsigVariables(keyName string, t tsigRecord) ([]byte, error) {
+	b, err := appendName(nil, keyName)
+	if err != nil {
+		return nil, err
+	}
+	b = binary.BigEndian.AppendUint16(b, dnsClassANY)
+	b = binary.BigEndian.AppendUint32(b, 0)
+	if b, err = appendName(b, t.Algorithm); err != nil {
+		return nil, err
+	}
+	b = appendUint48(b, t.TimeSigned)
+	b = binary.BigEndian.AppendUint16(b, t.Fudge)
+	b = binary.BigEndian.AppendUint16(b, t.Error)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(t.Other)))
+	return append(b, t.Other...), nil
+}
+
+func appendUint48(b []byte, v uint64) []byte {
+	return append(b, byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (k tsigKey) mac(parts ...[]byte) []byte {
+	mac := hmac.New(tsigAlgorithms[k.Algorithm], k.Secret)
+	for _, p := range parts {
+		mac.Write(p)
+	}
+	return mac.Sum(nil)
+}
+
+// signTSIG appends a TSIG record to msg and returns the signed message and
+// its MAC, which is needed to verify the response.
+func signTSIG(msg []byte, key tsigKey, now time.Time) ([]byte, []byte, error) {
+	t := tsigRecord{
+		Algorithm:  key.Algorithm,
+		TimeSigned: uint64(now.Unix()),
+		Fudge:      tsigFudge,
+		OriginalID: binary.BigEndian.Uint16(msg),
+	}
+	vars, err := tsigVariables(key.Name, t)
+	if err != nil {
+		return nil, nil, err
+	}
+	t.MAC = key.mac(msg, vars)
+
+	data, err := appendName(nil, t.Algorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+	data = appendUint48(data, t.TimeSigned)
+	data = binary.BigEndian.AppendUint16(data, t.Fudge)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(t.MAC)))
+	data = append(data, t.MAC...)
+	data = binary.BigEndian.AppendUint16(data, t.OriginalID)
+	data = binary.BigEndian.AppendUint16(data, t.Error)
+	data = binary.BigEndian.AppendUint16(data, 0)
+
+	signed := append([]byte(nil), msg...)
+	binary.BigEndian.PutUint16(signed[10:], binary.BigEndian.Uint16(signed[10:])+1)
+	signed, err = appendRR(signed, dnsRR{Name: key.Name, Type: dnsTypeTSIG, Class: dnsClassANY, Data: data})
+	if err != nil {
+		return nil, nil, err
+	}
+	return signed, t.MAC, nil
+}
+
+func parseTSIG(data []byte) (tsigRecord, error) {
+	var t tsigRecord
+	alg, off, err := readName(data, 0)
+	if err != nil {
+		return t, err
+	}
+	t.Algorithm = strings.ToLower(alg)
+	if off+10 > len(data) {
+		return t, fmt.Errorf("truncated TSIG record")
+	}
+	t.TimeSigned = uint64(binary.BigEndian.Uint16(data[off:]))<<32 | uint64(binary.BigEndian.Uint32(data[off+2:]))
+	t.Fudge = binary.BigEndian.Uint16(data[off+6:])
+	macSize := int(binary.BigEndian.Uint16(data[off+8:]))
+	off += 10
+	if off+macSize+6 > len(data) {
+		return t, fmt.Errorf("truncated TSIG record")
+	}
+	t.MAC = data[off : off+macSize]
+	off += macSize
+	t.OriginalID = binary.BigEndian.Uint16(data[off:])
+	t.Error = binary.BigEndian.Uint16(data[off+2:])
+	otherLen := int(binary.BigEndian.Uint16(data[off+4:]))
+	off += 6
+	if off+otherLen > len(data) {
+		return t, fmt.Errorf("truncated TSIG record")
+	}
+	t.Other = data[off : off+otherLen]
+	return t, nil
+}
+
+// verifyTSIG checks the TSIG record that ends a response to a request
+// signed with requestMAC (RFC 8945, 5.3).
+func verifyTSIG(resp []byte, m dnsMessage, key tsigKey, requestMAC []byte, now time.Time) error {
+	if len(m.Extra) == 0 || m.Extra[len(m.Extra)-1].Type != dnsTypeTSIG {
+		return fmt.Errorf("response is not signed")
+	}
+	rr := m.Extra[len(m.Extra)-1]
+	t, err := parseTSIG(rr.Data)
+	if err != nil {
+		return err
+	}
+	if t.Error != 0 {
+		return fmt.Errorf("server rejected the signature: %s", rcodeName(int(t.Error)))
+	}
+	if !strings.EqualFold(rr.Name, key.Name) || t.Algorithm != key.Algorithm {
+		return fmt.Errorf("response is signed with a different key")
+	}
+
+	unsigned := append([]byte(nil), resp[:rr.offset]...)
+	binary.BigEndian.PutUint16(unsigned, t.OriginalID)
+	binary.BigEndian.PutUint16(unsigned[10:], binary.BigEndian.Uint16(unsigned[10:])-1)
+	vars, err := tsigVariables(key.Name, t)
+	if err != nil {
+		return err
+	}
+	prefix := binary.BigEndian.AppendUint16(nil, uint16(len(requestMAC)))
+	if !hmac.Equal(t.MAC, key.mac(prefix, requestMAC, unsigned, vars)) {
+		return fmt.Errorf("response signature does not match")
+	}
+	if skew := now.Unix() - int64(t.TimeSigned); skew > int64(t.Fudge) || -skew > int64(t.Fudge) {
+		return fmt.Errorf("response signature time is off by %ds", skew)
+	}
+	return nil
+}
+
+// rfc2136Provider updates records on an authoritative server with RFC 2136
+// dynamic updates over TCP. There are no record IDs; the record name
+// stands in for one.
+type rfc2136Provider struct {
+	config  RFC2136Config
+	key     *tsigKey
+	timeout time.Duration
+}
+
+func newRFC2136Provider(config RFC2136Config, timeout time.Duration) *rfc2136Provider {
+	p := &rfc2136Provider{config: config, timeout: timeout}
+	if config.KeyName != "" {
+		secret, _ := base64.StdEncoding.DecodeString(config.KeySecret)
+		p.key = &tsigKey{
+			Name:      strings.ToLower(strings.TrimSuffix(config.KeyName, ".")),
+			Algorithm: strings.ToLower(config.KeyAlgorithm),
+			Secret:    secret,
+		}
+	}
+	return p
+}
+
+func (p *rfc2136Provider) Capabilities() Capabilities {
+	return Capabilities{}
+}
+
+func (p *rfc2136Provider) FetchRecord(recordType, name string) (*DNSRecord, error) {
+	qtype, err := dnsType(recordType)
+	if err != nil {
+		return nil, err
+	}
+	msg := dnsHeader(newDNSID(), 0, 1, 0, 0, 0)
+	if msg, err = appendName(msg, name); err != nil {
+		return nil, err
+	}
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, dnsClassIN)
+
+	resp, err := p.exchange(msg)
+	if err != nil {
+		return nil, err
+	}
+	m, err := parseDNSMessage(resp)
+	if err != nil {
+		return nil, fmt.Errorf("parsing response: %w", err)
+	}
+	if m.Rcode == 3 {
+		return nil, nil
+	}
+	if m.Rcode != 0 {
+		return nil, fmt.Errorf("DNS query for %s failed: %s", name, rcodeName(m.Rcode))
+	}
+	for _, rr := range m.Answers {
+		if rr.Type == qtype && strings.EqualFold(rr.Name, strings.TrimSuffix(name, ".")) {
+			content := net.IP(rr.Data).String()
+			if qtype == dnsTypeTXT {
+				content = txtContent(rr.Data)
+			}
+			return &DNSRecord{ID: name, Type: recordType, Name: name, Content: content, TTL: int(rr.TTL)}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (p *rfc2136Provider) CreateRecord(record DNSRecord) (DNSRecord, error) {
+	return p.replace(record)
+}
+
+func (p *rfc2136Provider) UpdateRecord(record DNSRecord) (DNSRecord, error) {
+	return p.replace(record)
+}
+
+// replace deletes the record's RRset and adds the new address in one
+// update, so the name never holds more than one address.
+func (p *rfc2136Provider) replace(record DNSRecord) (DNSRecord, error) {
+	rtype, err := dnsType(record.Type)
+	if err != nil {
+		return DNSRecord{}, err
+	}
+	var rdata []byte
+	if rtype == dnsTypeTXT {
+		rdata = txtRdata(record.Content)
+	} else {
+		ip := net.ParseIP(record.Content)
+		rdata = ip.To16()
+		if rtype == dnsTypeA {
+			rdata = ip.To4()
+		}
+		if ip == nil || rdata == nil {
+			return DNSRecord{}, fmt.Errorf("invalid address %q", record.Content)
+		}
+	}
+
+	id := newDNSID()
+	msg := dnsHeader(id, dnsOpcodeUpdate<<11, 1, 0, 2, 0)
+	if msg, err = appendName(msg, p.config.Zone); err != nil {
+		return DNSRecord{}, err
+	}
+	msg = binary.BigEndian.AppendUint16(msg, dnsTypeSOA)
+	msg = binary.BigEndian.AppendUint16(msg, dnsClassIN)
+	if msg, err = appendRR(msg, dnsRR{Name: record.Name, Type: rtype, Class: dnsClassANY}); err != nil {
+		return DNSRecord{}, err
+	}
+	if msg, err = appendRR(msg, dnsRR{Name: record.Name, Type: rtype, Class: dnsClassIN, TTL: uint32(record.TTL), Data: rdata}); err != nil {
+		return DNSRecord{}, err
+	}
+
+	var requestMAC []byte
+	if p.key != nil {
+		if msg, requestMAC, err = signTSIG(msg, *p.key, time.Now()); err != nil {
+			return DNSRecord{}, err
+		}
+	}
+
+	resp, err := p.exchange(msg)
+	if err != nil {
+		return DNSRecord{}, err
+	}
+	m, err := parseDNSMessage(resp)
+	if err != nil {
+		return DNSRecord{}, fmt.Errorf("parsing response: %w", err)
+	}
+	if m.ID != id {
+		return DNSRecord{}, fmt.Errorf("response ID does not match the update")
+	}
+	if m.Rcode != 0 {
+		return DNSRecord{}, fmt.Errorf("RFC 2136 update refused: %s", rcodeName(m.Rcode))
+	}
+	if p.key != nil {
+		if err := verifyTSIG(resp, m, *p.key, requestMAC, time.Now()); err != nil {
+			return DNSRecord{}, fmt.Errorf("RFC 2136 update: %w", err)
+		}
+	}
+
+	record.ID = record.Name
+	return record, nil
+}
+
+func dnsHeader(id, flags uint16, counts ...uint16) []byte {
+	b := binary.BigEndian.AppendUint16(nil, id)
+	b = binary.BigEndian.AppendUint16(b, flags)
+	for _, c := range counts {
+		b = binary.BigEndian.AppendUint16(b, c)
+	}
+	return b
+}
+
+func newDNSID() uint16 {
+	var b [2]byte
+	rand.Read(b[:])
+	return binary.BigEndian.Uint16(b[:])
+}
+
+// exchange sends msg to the server over TCP and returns the response.
+func (p *rfc2136Provider) exchange(msg []byte) ([]byte, error) {
+	server := p.config.Server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	conn, err := net.DialTimeout("tcp", server, p.timeout)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", server, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(p.timeout))
+
+	framed := binary.BigEndian.AppendUint16(nil, uint16(len(msg)))
+	if _, err := conn.Write(append(framed, msg...)); err != nil {
+		return nil, fmt.Errorf("sending to %s: %w", server, err)
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, fmt.Errorf("reading from %s: %w", server, err)
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, fmt.Errorf("reading from %s: %w", server, err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testTSIGKey = tsigKey{Name: "ddns-key", Algorithm: "hmac-sha256", Secret: []byte("secret-key-for-tests")}
+
+func TestSignTSIG(t *testing.T) {
+	msg := dnsHeader(0x1234, dnsOpcodeUpdate<<11, 1, 0, 2, 0)
+	msg, _ = appendName(msg, "example.com")
+	msg = binary.BigEndian.AppendUint16(msg, dnsTypeSOA)
+	msg = binary.BigEndian.AppendUint16(msg, dnsClassIN)
+	msg, _ = appendRR(msg, dnsRR{Name: "home.example.com", Type: dnsTypeAAAA, Class: dnsClassANY})
+	msg, _ = appendRR(msg, dnsRR{Name: "home.example.com", Type: dnsTypeAAAA, Class: dnsClassIN, TTL: 300,
+		Data: net.ParseIP("2001:db8::1")})
+
+	wantMsg := "123428000001000000020000076578616d706c6503636f6d000006000104686f6d65076578616d706c6503636f6d00001c00ff" +
+		"00000000000004686f6d65076578616d706c6503636f6d00001c00010000012c001020010db8000000000000000000000001"
+	if got := hex.EncodeToString(msg); got != wantMsg {
+		t.Fatalf("update message = %s, want %s", got, wantMsg)
+	}
+
+	signed, mac, err := signTSIG(msg, testTSIGKey, time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// HMAC-SHA256 over the message and the TSIG variables, computed separately
+	if got := hex.EncodeToString(mac); got != "ba2c75d860158531381f75f96211267d0da43a22051d44514f1747b4838bc0f8" {
+		t.Errorf("MAC = %s", got)
+	}
+
+	m, err := parseDNSMessage(signed)
+	if err != nil {
+		t.Fatalf("parsing signed message: %v", err)
+	}
+	if len(m.Extra) != 1 || m.Extra[0].Type != dnsTypeTSIG || m.Extra[0].Name != "ddns-key" {
+		t.Fatalf("additional section = %+v", m.Extra)
+	}
+	tsig, err := parseTSIG(m.Extra[0].Data)
+	if err != nil {
+		t.Fatalf("parsing TSIG: %v", err)
+	}
+	if tsig.Algorithm != "hmac-sha256" || tsig.TimeSigned != 1700000000 || tsig.Fudge != 300 ||
+		tsig.OriginalID != 0x1234 || string(tsig.MAC) != string(mac) {
+		t.Errorf("TSIG = %+v", tsig)
+	}
+}
+
+// fakeDNSServer answers one query or update per connection with respond.
+func fakeDNSServer(t *testing.T, respond func(req []byte) []byte) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			var length [2]byte
+			io.ReadFull(conn, length[:])
+			req := make([]byte, binary.BigEndian.Uint16(length[:]))
+			io.ReadFull(conn, req)
+			resp := respond(req)
+			conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...))
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestRFC2136Provider(t *testing.T) {
+	var updates []string
+	var badSignature bool
+	addr := fakeDNSServer(t, func(req []byte) []byte {
+		resp := append([]byte(nil), req[:12]...)
+		resp[2] |= 0x80
+		m, err := parseDNSMessage(req)
+		if err != nil {
+			t.Errorf("parsing request: %v", err)
+			return resp
+		}
+
+		if req[2]>>3&0x0F != dnsOpcodeUpdate {
+			// Answer queries for home.example.com only, with a compressed owner name.
+			name, end, _ := readName(req, 12)
+			resp = append(resp, req[12:end+4]...)
+			if name != "home.example.com" {
+				resp[3] |= 3
+				return resp
+			}
+			binary.BigEndian.PutUint16(resp[6:], 1)
+			resp = append(resp, 0xC0, 12)
+			resp = binary.BigEndian.AppendUint16(resp, dnsTypeAAAA)
+			resp = binary.BigEndian.AppendUint16(resp, dnsClassIN)
+			resp = binary.BigEndian.AppendUint32(resp, 300)
+			resp = binary.BigEndian.AppendUint16(resp, 16)
+			return append(resp, net.ParseIP("2001:db8::1")...)
+		}
+
+		tsigRR := m.Extra[len(m.Extra)-1]
+		tsig, _ := parseTSIG(tsigRR.Data)
+		unsigned := append([]byte(nil), req[:tsigRR.offset]...)
+		binary.BigEndian.PutUint16(unsigned[10:], 0)
+		vars, _ := tsigVariables("ddns-key", tsig)
+		if string(testTSIGKey.mac(unsigned, vars)) != string(tsig.MAC) {
+			t.Errorf("request signature does not match")
+		}
+		// parseDNSMessage skips the zone section and keeps no update
+		// section, so read the update records by hand.
+		_, off, _ := readName(req, 12)
+		off += 4
+		for i := 0; i < 2; i++ {
+			name, next, _ := readName(req, off)
+			class := binary.BigEndian.Uint16(req[next+2:])
+			length := int(binary.BigEndian.Uint16(req[next+8:]))
+			data := req[next+10 : next+10+length]
+			switch class {
+			case dnsClassANY:
+				updates = append(updates, "delete "+name)
+			case dnsClassIN:
+				updates = append(updates, "add "+name+" "+net.IP(data).String())
+			}
+			off = next + 10 + length
+		}
+
+		resp = dnsHeader(tsig.OriginalID, binary.BigEndian.Uint16(resp[2:]), 0, 0, 0, 0)
+		reply := tsigRecord{Algorithm: "hmac-sha256", TimeSigned: uint64(time.Now().Unix()), Fudge: 300, OriginalID: tsig.OriginalID}
+		vars, _ = tsigVariables("ddns-key", reply)
+		prefix := binary.BigEndian.AppendUint16(nil, uint16(len(tsig.MAC)))
+		reply.MAC = testTSIGKey.mac(prefix, tsig.MAC, resp, vars)
+		if badSignature {
+			reply.MAC[0] ^= 0xFF
+		}
+		data, _ := appendName(nil, "hmac-sha256")
+		data = appendUint48(data, reply.TimeSigned)
+		data = binary.BigEndian.AppendUint16(data, reply.Fudge)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(reply.MAC)))
+		data = append(data, reply.MAC...)
+		data = binary.BigEndian.AppendUint16(data, reply.OriginalID)
+		data = binary.BigEndian.AppendUint32(data, 0)
+		binary.BigEndian.PutUint16(resp[10:], 1)
+		resp, _ = appendRR(resp, dnsRR{Name: "ddns-key", Type: dnsTypeTSIG, Class: dnsClassANY, Data: data})
+		return resp
+	})
+
+	p := newRFC2136Provider(RFC2136Config{
+		Server:       addr,
+		Zone:         "example.com",
+		KeyName:      "DDNS-Key.",
+		KeyAlgorithm: "hmac-sha256",
+		KeySecret:    "c2VjcmV0LWtleS1mb3ItdGVzdHM=",
+	}, 5*time.Second)
+
+	rec, err := p.FetchRecord("AAAA", "home.example.com")
+	if err != nil {
+		t.Fatalf("FetchRecord: %v", err)
+	}
+	if rec == nil || rec.ID != "home.example.com" || rec.Content != "2001:db8::1" || rec.TTL != 300 {
+		t.Errorf("record = %+v", rec)
+	}
+	if rec, err := p.FetchRecord("AAAA", "missing.example.com"); err != nil || rec != nil {
+		t.Errorf("missing record = %+v, %v", rec, err)
+	}
+
+	updated, err := p.UpdateRecord(DNSRecord{Type: "AAAA", Name: "home.example.com", Content: "2001:db8::2", TTL: 300})
+	if err != nil {
+		t.Fatalf("UpdateRecord: %v", err)
+	}
+	if updated.ID != "home.example.com" {
+		t.Errorf("ID = %q", updated.ID)
+	}
+	if got, want := strings.Join(updates, "\n"), "delete home.example.com\nadd home.example.com 2001:db8::2"; got != want {
+		t.Errorf("updates:\n%s\nwant:\n%s", got, want)
+	}
+
+	badSignature = true
+	_, err = p.UpdateRecord(DNSRecord{Type: "AAAA", Name: "home.example.com", Content: "2001:db8::3", TTL: 300})
+	if err == nil || !strings.Contains(err.Error(), "response signature does not match") {
+		t.Errorf("expected signature error, got %v", err)
+	}
+}
+
+func TestRFC2136Refused(t *testing.T) {
+	addr := fakeDNSServer(t, func(req []byte) []byte {
+		resp := append([]byte(nil), req[:12]...)
+		resp[2] |= 0x80
+		resp[3] = 9 // NOTAUTH, as sent unsigned for an unknown key
+		binary.BigEndian.PutUint16(resp[4:], 0)
+		binary.BigEndian.PutUint16(resp[8:], 0)
+		binary.BigEndian.PutUint16(resp[10:], 0)
+		return resp
+	})
+	p := newRFC2136Provider(RFC2136Config{Server: addr, Zone: "example.com", KeyName: "ddns-key",
+		KeyAlgorithm: "hmac-sha256", KeySecret: "c2VjcmV0"}, 5*time.Second)
+
+	_, err := p.CreateRecord(DNSRecord{Type: "A", Name: "home.example.com", Content: "203.0.113.5", TTL: 300})
+	if err == nil || err.Error() != "RFC 2136 update refused: NOTAUTH" {
+		t.Errorf("expected NOTAUTH, got %v", err)
+	}
+}
+
+func TestTXTContent(t *testing.T) {
+	rdata := append([]byte{8}, "heritage"...)
+	rdata = append(rdata, 14)
+	rdata = append(rdata, "=external-dns,"...)
+	if got, want := txtContent(rdata), `"heritage=external-dns,"`; got != want {
+		t.Errorf("txtContent() = %s, want %s", got, want)
+	}
+}
+
+func TestValidateRFC2136(t *testing.T) {
+	valid := RFC2136Config{Server: "ns1.example.com", Zone: "example.com", RecordName: "home.example.com",
+		KeyName: "ddns-key", KeyAlgorithm: "hmac-sha256", KeySecret: "c2VjcmV0"}
+	tests := []struct {
+		name    string
+		modify  func(*RFC2136Config)
+		wantErr string
+	}{
+		{"valid", func(*RFC2136Config) {}, ""},
+		{"unsigned", func(r *RFC2136Config) { r.KeyName, r.KeySecret = "", "" }, ""},
+		{"missing server", func(r *RFC2136Config) { r.Server = "" }, "rfc2136.server is required"},
+		{"missing zone", func(r *RFC2136Config) { r.Zone = "" }, "rfc2136.zone is required"},
+		{"missing record", func(r *RFC2136Config) { r.RecordName = "" }, "rfc2136.record_name is required"},
+		{"half a key", func(r *RFC2136Config) { r.KeySecret = "" },
+			"rfc2136.key_name and rfc2136.key_secret must be set together"},
+		{"unknown algorithm", func(r *RFC2136Config) { r.KeyAlgorithm = "hmac-md5" },
+			"rfc2136.key_algorithm must be hmac-sha1, hmac-sha256 or hmac-sha512"},
+		{"bad secret", func(r *RFC2136Config) { r.KeySecret = "not base64!" }, "rfc2136.key_secret is not valid base64"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid
+			tt.modify(&config)
+			err := validateRFC2136(config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRFC2136Job(t *testing.T) {
+	job := JobConfig{
+		Name:      "home",
+		Interface: "eth0",
+		Provider:  "rfc2136",
+		RFC2136: RFC2136Config{
+			Server:     "ns1.example.com",
+			Zone:       "example.com",
+			KeyName:    "ddns-key",
+			KeySecret:  "c2VjcmV0",
+			RecordName: "home.example.com",
+			Aliases:    []string{"www.example.com"},
+		},
+	}
+	setRFC2136Defaults(&job.RFC2136)
+	if err := validateJob(job); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	service := newDDNSService(Config{}, job)
+	p, ok := service.provider.(*rfc2136Provider)
+	if !ok {
+		t.Fatalf("provider = %T, want *rfc2136Provider", service.provider)
+	}
+	if p.key == nil || p.key.Algorithm != "hmac-sha256" {
+		t.Errorf("key = %+v", p.key)
+	}
+	if cf := service.config.CloudFlare; cf.RecordName != "home.example.com" || cf.TTL != 300 {
+		t.Errorf("record settings = %+v", cf)
+	}
+	if len(service.aliases) != 1 {
+		t.Fatalf("aliases = %+v", service.aliases)
+	}
+	if _, ok := service.aliases[0].provider.(*rfc2136Provider); !ok {
+		t.Errorf("alias provider = %T, want *rfc2136Provider", service.aliases[0].provider)
+	}
+}
@@ -0,0 +1,97 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ipv6RoutePath is the kernel's IPv6 routing table. Replaced in tests.
+var ipv6RoutePath = "/proc/net/ipv6_route"
+
+const (
+	rtfUp     = 0x0001
+	rtfReject = 0x0200
+)
+
+// parseDefaultRoutes returns the interfaces of usable IPv6 default routes in
+// /proc/net/ipv6_route format, without duplicates. Unreachable defaults the
+// kernel installs on lo are skipped.
+func parseDefaultRoutes(r io.Reader) []string {
+	var ifaces []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 10 {
+			continue
+		}
+		if fields[0] != strings.Repeat("0", 32) || fields[1] != "00" {
+			continue
+		}
+		flags, err := strconv.ParseUint(fields[8], 16, 32)
+		if err != nil || flags&rtfUp == 0 || flags&rtfReject != 0 {
+			continue
+		}
+		if iface := fields[9]; !seen[iface] {
+			seen[iface] = true
+			ifaces = append(ifaces, iface)
+		}
+	}
+	return ifaces
+}
+
+// checkDefaultRoute warns when ip is published from an interface that does
+// not carry the IPv6 default route, a common multi-homing mistake: replies
+// leave through the other interface with a different source prefix, so the
+// published address does not answer. Only local interfaces on Linux are
+// checked.
+func (s *DDNSService) checkDefaultRoute(ip string) {
+	if s.config.SNMP.Target != "" || s.recordType == "A" {
+		return
+	}
+	f, err := os.Open(ipv6RoutePath)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	ifaces := parseDefaultRoutes(f)
+	switch {
+	case len(ifaces) == 0:
+		s.warnf("Warning: there is no IPv6 default route; %s may not be reachable from outside", ip)
+	case !contains(ifaces, s.config.Interface):
+		s.warnf("Warning: %s is on %s, but the IPv6 default route is via %s; the host may not answer on this address",
+			ip, s.config.Interface, strings.Join(ifaces, ", "))
+	case len(ifaces) > 1:
+		s.warnf("Warning: there are IPv6 default routes via %s; replies may leave with a source address other than %s",
+			strings.Join(ifaces, ", "), ip)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,418 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// route53API is the base URL of the Route53 API. Route53 is a global
+// service; requests are signed for us-east-1.
+const route53API = "https://route53.amazonaws.com"
+
+// Route53Config selects the hosted zone and credentials of a job using the
+// route53 provider, and the records kept up to date in it. Without keys in
+// the config, credentials are taken from the environment or the shared
+// credentials file, like the AWS CLI does.
+type Route53Config struct {
+	HostedZoneID    string         `yaml:"hosted_zone_id"`
+	AccessKeyID     string         `yaml:"access_key_id"`
+	SecretAccessKey string         `yaml:"secret_access_key"`
+	Profile         string         `yaml:"profile"`
+	RecordName      string         `yaml:"record_name"`
+	TTL             int            `yaml:"ttl"`
+	Aliases         []string       `yaml:"aliases"`
+	Records         []RecordConfig `yaml:"records"`
+	Adopt           bool           `yaml:"adopt"`
+}
+
+// recordSettings returns the records in the form the updater works with.
+func (r Route53Config) recordSettings() CloudFlareConfig {
+	return CloudFlareConfig{
+		ZoneID:     r.HostedZoneID,
+		RecordName: r.RecordName,
+		TTL:        r.TTL,
+		Aliases:    r.Aliases,
+		Records:    r.Records,
+		Adopt:      r.Adopt,
+	}
+}
+
+func setRoute53Defaults(r *Route53Config) {
+	if r.HostedZoneID == "" {
+		return
+	}
+	if r.TTL == 0 {
+		r.TTL = 300
+	}
+	if r.RecordName == "" && len(r.Records) > 0 && r.Records[0].plain() {
+		r.RecordName = r.Records[0].Name
+		if r.Records[0].TTL != 0 {
+			r.TTL = r.Records[0].TTL
+		}
+		r.Records = r.Records[1:]
+	}
+}
+
+func validateRoute53(r Route53Config) error {
+	if r.HostedZoneID == "" {
+		return fmt.Errorf("route53.hosted_zone_id is required")
+	}
+	if r.RecordName == "" {
+		return fmt.Errorf("route53.record_name is required")
+	}
+	if (r.AccessKeyID == "") != (r.SecretAccessKey == "") {
+		return fmt.Errorf("route53.access_key_id and route53.secret_access_key must be set together")
+	}
+	seen := map[string]bool{strings.ToLower(r.RecordName): true}
+	for _, alias := range r.Aliases {
+		if alias == "" {
+			return fmt.Errorf("route53.aliases must not contain empty names")
+		}
+		if seen[strings.ToLower(alias)] {
+			return fmt.Errorf("route53.aliases: %s is listed more than once", alias)
+		}
+		seen[strings.ToLower(alias)] = true
+	}
+	for _, record := range r.Records {
+		if record.Proxied != nil {
+			return fmt.Errorf("route53.records: %s: proxied is not supported by Route53", record.Name)
+		}
+	}
+	return validateRecords("route53.records", r.Records, false, seen)
+}
+
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// resolveAWSCredentials looks for credentials in the config, then in the
+// AWS_* environment variables and then in the shared credentials file.
+func resolveAWSCredentials(r Route53Config) (awsCredentials, error) {
+	if r.AccessKeyID != "" {
+		return awsCredentials{AccessKeyID: r.AccessKeyID, SecretAccessKey: r.SecretAccessKey}, nil
+	}
+	if id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); id != "" && secret != "" {
+		return awsCredentials{AccessKeyID: id, SecretAccessKey: secret, SessionToken: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return awsCredentials{}, fmt.Errorf("no AWS credentials in the config or environment")
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := r.Profile
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+	creds, err := readSharedCredentials(path, profile)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("no AWS credentials in the config or environment, and %w", err)
+	}
+	return creds, nil
+}
+
+// readSharedCredentials reads a profile from an AWS credentials file.
+func readSharedCredentials(path, profile string) (awsCredentials, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("reading shared credentials: %w", err)
+	}
+	defer f.Close()
+
+	var creds awsCredentials
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = strings.TrimSpace(value)
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = strings.TrimSpace(value)
+		case "aws_session_token":
+			creds.SessionToken = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return awsCredentials{}, fmt.Errorf("reading shared credentials: %w", err)
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return awsCredentials{}, fmt.Errorf("profile %q not found in %s", profile, path)
+	}
+	return creds, nil
+}
+
+// signAWS signs req with AWS Signature Version 4.
+func signAWS(req *http.Request, body []byte, creds awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "x-amz-date" || lower == "x-amz-security-token" || lower == "content-type" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQuery sorts and encodes the query as SigV4 requires: spaces as
+// %20 rather than +.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, awsEscape(key)+"="+awsEscape(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// route53Provider manages records in one Route53 hosted zone. Route53 has no
+// record IDs; the record name stands in for one.
+type route53Provider struct {
+	client  *http.Client
+	baseURL string
+	config  Route53Config
+}
+
+func newRoute53Provider(config Route53Config, client *http.Client) *route53Provider {
+	return &route53Provider{client: client, baseURL: route53API, config: config}
+}
+
+type route53ResourceRecordSet struct {
+	Name            string   `xml:"Name"`
+	Type            string   `xml:"Type"`
+	TTL             int      `xml:"TTL"`
+	ResourceRecords []string `xml:"ResourceRecords>ResourceRecord>Value"`
+}
+
+func (p *route53Provider) zonePath() string {
+	return "/2013-04-01/hostedzone/" + strings.TrimPrefix(p.config.HostedZoneID, "/hostedzone/")
+}
+
+func (p *route53Provider) Capabilities() Capabilities {
+	return Capabilities{}
+}
+
+func (p *route53Provider) FetchRecord(recordType, name string) (*DNSRecord, error) {
+	query := url.Values{"name": {name}, "type": {recordType}, "maxitems": {"1"}}
+	var resp struct {
+		ResourceRecordSets []route53ResourceRecordSet `xml:"ResourceRecordSets>ResourceRecordSet"`
+	}
+	if err := p.call("GET", p.zonePath()+"/rrset?"+query.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+	// The listing starts at name, so the first set may belong to another name
+	for _, set := range resp.ResourceRecordSets {
+		if !strings.EqualFold(strings.TrimSuffix(set.Name, "."), strings.TrimSuffix(name, ".")) || set.Type != recordType {
+			break
+		}
+		record := &DNSRecord{ID: name, Type: set.Type, Name: name, TTL: set.TTL}
+		if len(set.ResourceRecords) > 0 {
+			record.Content = set.ResourceRecords[0]
+		}
+		return record, nil
+	}
+	return nil, nil
+}
+
+func (p *route53Provider) CreateRecord(record DNSRecord) (DNSRecord, error) {
+	return p.upsert(record)
+}
+
+func (p *route53Provider) UpdateRecord(record DNSRecord) (DNSRecord, error) {
+	return p.upsert(record)
+}
+
+func (p *route53Provider) upsert(record DNSRecord) (DNSRecord, error) {
+	content := record.Content
+	if record.Type == "TXT" {
+		content = quoteTXT(content)
+	}
+	type change struct {
+		Action            string                   `xml:"Action"`
+		ResourceRecordSet route53ResourceRecordSet `xml:"ResourceRecordSet"`
+	}
+	req := struct {
+		XMLName xml.Name `xml:"https://route53.amazonaws.com/doc/2013-04-01/ ChangeResourceRecordSetsRequest"`
+		Changes []change `xml:"ChangeBatch>Changes>Change"`
+	}{
+		Changes: []change{{
+			Action: "UPSERT",
+			ResourceRecordSet: route53ResourceRecordSet{
+				Name:            record.Name,
+				Type:            record.Type,
+				TTL:             record.TTL,
+				ResourceRecords: []string{content},
+			},
+		}},
+	}
+	body, err := xml.Marshal(req)
+	if err != nil {
+		return DNSRecord{}, err
+	}
+	if err := p.call("POST", p.zonePath()+"/rrset/", append([]byte(xml.Header), body...), nil); err != nil {
+		return DNSRecord{}, err
+	}
+	record.ID = record.Name
+	return record, nil
+}
+
+// call sends a signed request and decodes a successful XML response into
+// result, if given.
+func (p *route53Provider) call(method, path string, body []byte, result interface{}) error {
+	creds, err := resolveAWSCredentials(p.config)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, p.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/xml")
+	}
+	signAWS(req, body, creds, "us-east-1", "route53", time.Now())
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var errResp struct {
+			Code    string `xml:"Error>Code"`
+			Message string `xml:"Error>Message"`
+		}
+		if xml.Unmarshal(respBody, &errResp) == nil && errResp.Code != "" {
+			return fmt.Errorf("Route53 API error: %s: %s", errResp.Code, errResp.Message)
+		}
+		return fmt.Errorf("Route53 API error: %s", resp.Status)
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err := xml.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("parsing response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAWS(t *testing.T) {
+	// get-vanilla from the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	creds := awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signAWS(req, nil, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %q, want %q", got, want)
+	}
+	if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+		t.Errorf("X-Amz-Date = %q", got)
+	}
+}
+
+func TestResolveAWSCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	os.WriteFile(path, []byte(`[default]
+aws_access_key_id = AKIDDEFAULT
+aws_secret_access_key = default-secret
+
+# DDNS only
+[ddns]
+aws_access_key_id=AKIDDDNS
+aws_secret_access_key=ddns-secret
+aws_session_token=ddns-token
+`), 0600)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", path)
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_PROFILE", "")
+
+	tests := []struct {
+		name    string
+		config  Route53Config
+		env     map[string]string
+		want    awsCredentials
+		wantErr string
+	}{
+		{
+			name:   "config keys",
+			config: Route53Config{AccessKeyID: "AKIDCONFIG", SecretAccessKey: "config-secret"},
+			env:    map[string]string{"AWS_ACCESS_KEY_ID": "AKIDENV", "AWS_SECRET_ACCESS_KEY": "env-secret"},
+			want:   awsCredentials{AccessKeyID: "AKIDCONFIG", SecretAccessKey: "config-secret"},
+		},
+		{
+			name: "environment",
+			env:  map[string]string{"AWS_ACCESS_KEY_ID": "AKIDENV", "AWS_SECRET_ACCESS_KEY": "env-secret", "AWS_SESSION_TOKEN": "env-token"},
+			want: awsCredentials{AccessKeyID: "AKIDENV", SecretAccessKey: "env-secret", SessionToken: "env-token"},
+		},
+		{
+			name: "default profile",
+			want: awsCredentials{AccessKeyID: "AKIDDEFAULT", SecretAccessKey: "default-secret"},
+		},
+		{
+			name: "AWS_PROFILE",
+			env:  map[string]string{"AWS_PROFILE": "ddns"},
+			want: awsCredentials{AccessKeyID: "AKIDDDNS", SecretAccessKey: "ddns-secret", SessionToken: "ddns-token"},
+		},
+		{
+			name:    "missing profile",
+			config:  Route53Config{Profile: "other"},
+			wantErr: `profile "other" not found`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			got, err := resolveAWSCredentials(tt.config)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("credentials = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoute53Provider(t *testing.T) {
+	var changes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			t.Errorf("unsigned request: %q", r.Header.Get("Authorization"))
+		}
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/2013-04-01/hostedzone/Z123/rrset":
+			if r.URL.Query().Get("name") == "missing.example.com" {
+				// The listing continues with the next name
+				w.Write([]byte(`<ListResourceRecordSetsResponse><ResourceRecordSets><ResourceRecordSet>
+					<Name>nas.example.com.</Name><Type>AAAA</Type><TTL>60</TTL>
+					<ResourceRecords><ResourceRecord><Value>2001:db8::9</Value></ResourceRecord></ResourceRecords>
+				</ResourceRecordSet></ResourceRecordSets></ListResourceRecordSetsResponse>`))
+				return
+			}
+			w.Write([]byte(`<ListResourceRecordSetsResponse><ResourceRecordSets><ResourceRecordSet>
+				<Name>home.example.com.</Name><Type>AAAA</Type><TTL>300</TTL>
+				<ResourceRecords><ResourceRecord><Value>2001:db8::1</Value></ResourceRecord></ResourceRecords>
+			</ResourceRecordSet></ResourceRecordSets></ListResourceRecordSetsResponse>`))
+		case r.Method == "POST" && r.URL.Path == "/2013-04-01/hostedzone/Z123/rrset/":
+			body, _ := io.ReadAll(r.Body)
+			changes = append(changes, string(body))
+			if strings.Contains(string(body), "denied.example.com") {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`<ErrorResponse><Error><Code>AccessDenied</Code><Message>not allowed</Message></Error></ErrorResponse>`))
+				return
+			}
+			w.Write([]byte(`<ChangeResourceRecordSetsResponse><ChangeInfo><Status>PENDING</Status></ChangeInfo></ChangeResourceRecordSetsResponse>`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	}))
+	defer server.Close()
+
+	p := newRoute53Provider(Route53Config{HostedZoneID: "/hostedzone/Z123", AccessKeyID: "AKID", SecretAccessKey: "secret"}, server.Client())
+	p.baseURL = server.URL
+
+	record, err := p.FetchRecord("AAAA", "home.example.com")
+	if err != nil || record == nil || record.Content != "2001:db8::1" || record.ID != "home.example.com" {
+		t.Errorf("FetchRecord() = %+v, %v", record, err)
+	}
+	record, err = p.FetchRecord("AAAA", "missing.example.com")
+	if err != nil || record != nil {
+		t.Errorf("FetchRecord() of missing record = %+v, %v, want nil", record, err)
+	}
+
+	updated, err := p.UpdateRecord(DNSRecord{ID: "home.example.com", Type: "AAAA", Name: "home.example.com", Content: "2001:db8::2", TTL: 300})
+	if err != nil || updated.ID != "home.example.com" {
+		t.Errorf("UpdateRecord() = %+v, %v", updated, err)
+	}
+	if len(changes) != 1 || !strings.Contains(changes[0], "<Action>UPSERT</Action>") ||
+		!strings.Contains(changes[0], "<Value>2001:db8::2</Value>") || !strings.Contains(changes[0], "<TTL>300</TTL>") {
+		t.Errorf("change batch = %v", changes)
+	}
+
+	_, err = p.CreateRecord(DNSRecord{Type: "AAAA", Name: "denied.example.com", Content: "2001:db8::2", TTL: 300})
+	if err == nil || err.Error() != "Route53 API error: AccessDenied: not allowed" {
+		t.Errorf("expected AccessDenied error, got %v", err)
+	}
+}
+
+func TestValidateRoute53(t *testing.T) {
+	proxied := true
+	tests := []struct {
+		name    string
+		config  Route53Config
+		wantErr string
+	}{
+		{"valid", Route53Config{HostedZoneID: "Z123", RecordName: "home.example.com"}, ""},
+		{"missing zone", Route53Config{RecordName: "home.example.com"}, "route53.hosted_zone_id is required"},
+		{"missing record", Route53Config{HostedZoneID: "Z123"}, "route53.record_name is required"},
+		{"half a key", Route53Config{HostedZoneID: "Z123", RecordName: "home.example.com", AccessKeyID: "AKID"},
+			"route53.access_key_id and route53.secret_access_key must be set together"},
+		{"proxied record", Route53Config{HostedZoneID: "Z123", RecordName: "home.example.com",
+			Records: []RecordConfig{{Name: "www.example.com", Proxied: &proxied}}},
+			"route53.records: www.example.com: proxied is not supported by Route53"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRoute53(tt.config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRoute53Job(t *testing.T) {
+	job := JobConfig{
+		Name:      "home",
+		Interface: "eth0",
+		Provider:  "route53",
+		Route53: Route53Config{
+			HostedZoneID: "Z123",
+			Records:      []RecordConfig{{Name: "home.example.com", TTL: 60}, {Name: "www.example.com"}},
+		},
+	}
+	setRoute53Defaults(&job.Route53)
+	if err := validateJob(job); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	service := newDDNSService(Config{}, job)
+	if _, ok := service.provider.(*route53Provider); !ok {
+		t.Errorf("provider = %T, want *route53Provider", service.provider)
+	}
+	if cf := service.config.CloudFlare; cf.RecordName != "home.example.com" || cf.TTL != 60 {
+		t.Errorf("record settings = %+v", cf)
+	}
+	if len(service.aliases) != 1 || service.aliases[0].config.CloudFlare.RecordName != "www.example.com" ||
+		service.aliases[0].config.CloudFlare.TTL != 60 {
+		t.Fatalf("aliases = %+v", service.aliases)
+	}
+	if _, ok := service.aliases[0].provider.(*route53Provider); !ok {
+		t.Errorf("alias provider = %T, want *route53Provider", service.aliases[0].provider)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testIPv6Routes = `20010db8000100000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001     eth0
+fe800000000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001     eth0
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe80000000000000022233fffe445566 00000400 00000001 00000000 00000003     eth0
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe80000000000000022233fffe445577 00000400 00000001 00000000 00000003     eth0
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 00000000000000000000000000000000 ffffffff 00000001 00000000 00200200       lo
+`
+
+func TestParseDefaultRoutes(t *testing.T) {
+	got := parseDefaultRoutes(strings.NewReader(testIPv6Routes))
+	if want := []string{"eth0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDefaultRoutes() = %v, want %v", got, want)
+	}
+}
+
+func TestCheckDefaultRoute(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes string
+		iface  string
+		want   string
+	}{
+		{"routed interface", testIPv6Routes, "eth0", ""},
+		{"other interface", testIPv6Routes, "eth1", "2001:db8::5 is on eth1, but the IPv6 default route is via eth0"},
+		{"no default route", "", "eth0", "there is no IPv6 default route"},
+		{
+			"several default routes",
+			testIPv6Routes + strings.Replace(strings.SplitAfter(testIPv6Routes, "\n")[2], "eth0", "wwan0", 1),
+			"eth0",
+			"there are IPv6 default routes via eth0, wwan0",
+		},
+	}
+
+	origPath := ipv6RoutePath
+	defer func() { ipv6RoutePath = origPath }()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipv6RoutePath = filepath.Join(t.TempDir(), "ipv6_route")
+			if err := os.WriteFile(ipv6RoutePath, []byte(tt.routes), 0644); err != nil {
+				t.Fatal(err)
+			}
+			buf.Reset()
+
+			service := &DDNSService{config: Config{Interface: tt.iface}}
+			service.checkDefaultRoute("2001:db8::5")
+
+			if tt.want == "" {
+				if buf.Len() != 0 {
+					t.Errorf("unexpected warning: %s", buf.String())
+				}
+			} else if !strings.Contains(buf.String(), tt.want) {
+				t.Errorf("log = %q, want it to contain %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// canonicalAddress returns addr in the unscoped canonical form used for
+// comparing, logging and publishing. A zone identifier ("%eth0") only means
+// something on this host, so it is dropped from global addresses, and
+// addresses that need one to be reachable are rejected.
+func canonicalAddress(addr string) (string, error) {
+	host, zone, scoped := strings.Cut(addr, "%")
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "", fmt.Errorf("invalid address %q", addr)
+	}
+	if scoped && (ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()) {
+		return "", fmt.Errorf("%s is scoped to %s and can't be published", ip, zone)
+	}
+	return ip.String(), nil
+}
+
+// remoteAddress canonicalizes a record's content for comparisons, keeping
+// content that isn't an address as it is.
+func remoteAddress(content string) string {
+	if addr, err := canonicalAddress(content); err == nil {
+		return addr
+	}
+	return content
+}
+
+// detectAddress reads the job's current address in canonical form.
+func (s *DDNSService) detectAddress() (string, error) {
+	addr, err := s.getIPv6(s.config.Interface)
+	if err != nil {
+		return "", err
+	}
+	return canonicalAddress(addr)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestCanonicalAddress(t *testing.T) {
+	tests := []struct {
+		addr    string
+		want    string
+		wantErr bool
+	}{
+		{"2001:db8::1", "2001:db8::1", false},
+		{"2001:0DB8:0000::0001", "2001:db8::1", false},
+		{"2001:db8::1%eth0", "2001:db8::1", false},
+		{"fe80::1%eth0", "", true},
+		{"203.0.113.5", "203.0.113.5", false},
+		{"::ffff:203.0.113.5", "203.0.113.5", false},
+		{"eth0", "", true},
+	}
+	for _, tt := range tests {
+		got, err := canonicalAddress(tt.addr)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("canonicalAddress(%q) = %q, %v, want %q (error %v)", tt.addr, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestRankScopedAddresses(t *testing.T) {
+	addrs := []net.Addr{
+		&net.IPAddr{IP: net.ParseIP("2001:db8::2"), Zone: "eth0"},
+		&net.IPNet{IP: net.ParseIP("2001:db8::2"), Mask: net.CIDRMask(64, 128)},
+		&net.IPAddr{IP: net.ParseIP("fe80::1"), Zone: "eth0"},
+		&net.IPAddr{IP: net.ParseIP("2001:db8::1"), Zone: "eth0"},
+	}
+	got := rankAddresses(addrs, false)
+	if len(got) != 2 || got[0] != "2001:db8::1" || got[1] != "2001:db8::2" {
+		t.Errorf("rankAddresses() = %v, want [2001:db8::1 2001:db8::2]", got)
+	}
+}
+
+func TestScopedAddressNotPublished(t *testing.T) {
+	records := memProvider{}
+	service := &DDNSService{
+		config:   Config{Interface: "eth0", CloudFlare: CloudFlareConfig{RecordName: "home.example.com"}},
+		provider: records,
+	}
+
+	service.getIPv6 = func(string) (string, error) { return "2001:db8::1%eth0", nil }
+	if got, err := service.detectAddress(); err != nil || got != "2001:db8::1" {
+		t.Errorf("detectAddress() = %q, %v, want 2001:db8::1", got, err)
+	}
+
+	if err := service.updateDNS("2001:db8::1%eth0"); err == nil {
+		t.Error("expected scoped address to be refused")
+	}
+	if len(records) != 0 {
+		t.Errorf("scoped address reached the provider: %+v", records)
+	}
+}
@@ -0,0 +1,335 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const defaultServiceName = "ipv6-ddns-cloudflare"
+
+var unitTemplate = template.Must(template.New("unit").Funcs(template.FuncMap{
+	"join":       strings.Join,
+	"arg":        unitArg,
+	"specifiers": escapeSpecifiers,
+}).Parse(`[Unit]
+Description=IPv6 Dynamic DNS updater for CloudFlare
+Documentation=https://github.com/cloudflare/cloudflare-go
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=notify
+NotifyAccess=main
+WatchdogSec=300
+{{- if .Sandbox.DynamicUser}}
+ExecStart={{arg .Binary}} -config ${CREDENTIALS_DIRECTORY}/config.yaml
+{{- else}}
+ExecStart={{arg .Binary}} -config {{arg .Config}}
+ExecReload=/bin/kill -HUP $MAINPID
+{{- end}}
+Restart=always
+RestartSec=10
+
+# Security hardening, derived from the features the config uses
+{{- if .Sandbox.DynamicUser}}
+DynamicUser=true
+LoadCredential=config.yaml:{{specifiers .Config}}
+{{- end}}
+NoNewPrivileges=true
+ProtectSystem=strict
+ProtectHome={{.Sandbox.ProtectHome}}
+RuntimeDirectory=ipv6-ddns-cloudflare
+{{- if .Sandbox.StateDirectory}}
+StateDirectory={{.Sandbox.StateDirectory}}
+{{- end}}
+{{- range .Sandbox.ReadWritePaths}}
+ReadWritePaths={{specifiers .}}
+{{- end}}
+PrivateTmp=true
+PrivateDevices=true
+ProtectKernelTunables=true
+ProtectKernelModules=true
+ProtectKernelLogs=true
+ProtectControlGroups=true
+ProtectClock=true
+ProtectHostname=true
+RestrictAddressFamilies={{join .Sandbox.AddressFamilies " "}}
+RestrictNamespaces=true
+RestrictRealtime=true
+RestrictSUIDSGID=true
+LockPersonality=true
+MemoryDenyWriteExecute=true
+SystemCallArchitectures=native
+
+CapabilityBoundingSet={{join .Sandbox.Capabilities " "}}
+AmbientCapabilities={{if .Sandbox.DynamicUser}}{{join .Sandbox.Capabilities " "}}{{end}}
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+// escapeSpecifiers keeps systemd from expanding the % specifiers in s.
+func escapeSpecifiers(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
+
+// unitArg makes s one argument of an ExecStart command line: specifiers
+// and $ variables are escaped, and s is quoted when it has characters the
+// command line would split or unescape.
+func unitArg(s string) string {
+	s = strings.ReplaceAll(escapeSpecifiers(s), "$", "$$")
+	if !strings.ContainsAny(s, " \t\n\"'\\;") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`).Replace(s) + `"`
+}
+
+type unitParams struct {
+	Binary  string
+	Config  string
+	Sandbox *unitSandbox
+}
+
+// unitSandbox holds the hardening settings that depend on the features in
+// use, so the unit allows no more than the config needs.
+type unitSandbox struct {
+	// DynamicUser runs the daemon as a throwaway user that reads the config
+	// through a systemd credential, for configs that need nothing of root.
+	DynamicUser     bool
+	ProtectHome     string
+	StateDirectory  string
+	ReadWritePaths  []string
+	AddressFamilies []string
+	Capabilities    []string
+}
+
+// defaultSandbox is used when the config can't be read: root without
+// capabilities, reading local interfaces, as the shipped unit file does.
+func defaultSandbox() *unitSandbox {
+	return &unitSandbox{
+		ProtectHome:     "true",
+		AddressFamilies: []string{"AF_UNIX", "AF_INET", "AF_INET6", "AF_NETLINK"},
+	}
+}
+
+// sandboxFor derives the hardening settings from the features config uses.
+func sandboxFor(config Config) *unitSandbox {
+	// AF_UNIX for sd_notify
+	sb := &unitSandbox{ProtectHome: "true", AddressFamilies: []string{"AF_UNIX", "AF_INET", "AF_INET6"}}
+	needsRoot := false
+
+	jobs := config.jobs()
+	for _, profile := range config.Profiles {
+		jobs = append(jobs, profile.Jobs...)
+	}
+	netlink := false
+	for _, job := range jobs {
+		// Interface addresses are read over netlink; SNMP jobs ask a router
+		if job.SNMP.Target == "" {
+			netlink = true
+		}
+		if job.Provider == "route53" && job.Route53.AccessKeyID == "" {
+			// The shared credentials file is in root's home directory
+			sb.ProtectHome = "read-only"
+			needsRoot = true
+		}
+		if cf := job.CloudFlare; cf.APITokenCommand != "" {
+			// Password managers keep their stores in the home directory
+			sb.ProtectHome = "read-only"
+			needsRoot = true
+		} else if cf.APITokenFile != "" || cf.APITokenSecret != "" {
+			// Token files are usually readable by root only
+			if strings.HasPrefix(cf.APITokenFile, "/home/") || strings.HasPrefix(cf.APITokenFile, "/root/") {
+				sb.ProtectHome = "read-only"
+			}
+			needsRoot = true
+		}
+	}
+	if config.PrefixHook.Command != "" {
+		// Hooks typically reload the firewall or routing daemons
+		sb.Capabilities = append(sb.Capabilities, "CAP_NET_ADMIN")
+		netlink = true
+		needsRoot = true
+	}
+	if netlink {
+		sb.AddressFamilies = append(sb.AddressFamilies, "AF_NETLINK")
+	}
+
+	flush := config.FlushResolver
+	if flush.Unbound || flush.SystemdResolved {
+		// unbound-control's keys and resolved's D-Bus policy are for root
+		needsRoot = true
+	}
+	if flush.Dnsmasq {
+		sb.Capabilities = append(sb.Capabilities, "CAP_KILL")
+		needsRoot = true
+	}
+	if config.StatusPage.Dir != "" {
+		sb.ReadWritePaths = append(sb.ReadWritePaths, config.StatusPage.Dir)
+		needsRoot = true
+	}
+	if socket := config.ControlSocket; socket != "" && filepath.Dir(socket) != filepath.Dir(runtimeControlSocket) {
+		// The default socket is in the unit's RuntimeDirectory
+		sb.ReadWritePaths = append(sb.ReadWritePaths, filepath.Dir(socket))
+		needsRoot = true
+	}
+	if config.StateFile != "" {
+		if filepath.Dir(config.StateFile) == defaultStateDirectory {
+			// Created by systemd, also for a DynamicUser
+			sb.StateDirectory = filepath.Base(defaultStateDirectory)
+		} else {
+			sb.ReadWritePaths = append(sb.ReadWritePaths, filepath.Dir(config.StateFile))
+			needsRoot = true
+		}
+	}
+	if config.ControlGroup != "" {
+		// Handing the socket to a group the dynamic user isn't in
+		needsRoot = true
+	}
+	if _, port, err := net.SplitHostPort(config.HTTP.Listen); err == nil {
+		if n, err := strconv.Atoi(port); err == nil && n > 0 && n < 1024 {
+			sb.Capabilities = append(sb.Capabilities, "CAP_NET_BIND_SERVICE")
+		}
+	}
+
+	sb.DynamicUser = !needsRoot
+	return sb
+}
+
+// systemctl runs systemctl with the given arguments. Replaced in tests.
+var systemctl = func(args ...string) error {
+	cmd := exec.Command("systemctl", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func renderUnit(params unitParams) ([]byte, error) {
+	if params.Sandbox == nil {
+		params.Sandbox = defaultSandbox()
+	}
+	var buf bytes.Buffer
+	if err := unitTemplate.Execute(&buf, params); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func checkSystemd() error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("service installation is only supported with systemd on Linux (running on %s)", runtime.GOOS)
+	}
+	return nil
+}
+
+func runInstallService(args []string) error {
+	fs := flag.NewFlagSet("install-service", flag.ExitOnError)
+	configPath := fs.String("config", "/etc/ipv6-ddns-cloudflare/config.yaml", "Path to configuration file used by the service")
+	unitDir := fs.String("unit-dir", "/etc/systemd/system", "Directory to install the systemd unit into")
+	name := fs.String("name", defaultServiceName, "Name of the systemd service")
+	printOnly := fs.Bool("print", false, "Print the unit to stdout instead of installing it")
+	fs.Parse(args)
+
+	binary, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locating executable: %w", err)
+	}
+	if binary, err = filepath.EvalSymlinks(binary); err != nil {
+		return fmt.Errorf("resolving executable path: %w", err)
+	}
+	config, err := filepath.Abs(*configPath)
+	if err != nil {
+		return fmt.Errorf("resolving config path: %w", err)
+	}
+
+	sandbox := defaultSandbox()
+	if cfg, err := loadConfig(config); err == nil {
+		sandbox = sandboxFor(cfg)
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: %v; generating a unit without config-specific hardening\n", err)
+	}
+
+	unit, err := renderUnit(unitParams{Binary: binary, Config: config, Sandbox: sandbox})
+	if err != nil {
+		return fmt.Errorf("rendering unit: %w", err)
+	}
+
+	if *printOnly {
+		_, err := os.Stdout.Write(unit)
+		return err
+	}
+
+	if err := checkSystemd(); err != nil {
+		return err
+	}
+	unitPath := filepath.Join(*unitDir, *name+".service")
+	if err := os.WriteFile(unitPath, unit, 0644); err != nil {
+		return fmt.Errorf("writing unit file: %w", err)
+	}
+	fmt.Printf("Installed %s\n", unitPath)
+
+	if err := systemctl("daemon-reload"); err != nil {
+		return fmt.Errorf("reloading systemd: %w", err)
+	}
+	if err := systemctl("enable", *name); err != nil {
+		return fmt.Errorf("enabling service: %w", err)
+	}
+
+	fmt.Printf("Service enabled. Start it with: systemctl start %s\n", *name)
+	return nil
+}
+
+func runUninstallService(args []string) error {
+	fs := flag.NewFlagSet("uninstall-service", flag.ExitOnError)
+	unitDir := fs.String("unit-dir", "/etc/systemd/system", "Directory the systemd unit was installed into")
+	name := fs.String("name", defaultServiceName, "Name of the systemd service")
+	fs.Parse(args)
+
+	if err := checkSystemd(); err != nil {
+		return err
+	}
+
+	unitPath := filepath.Join(*unitDir, *name+".service")
+	if _, err := os.Stat(unitPath); err != nil {
+		return fmt.Errorf("unit file %s not found: %w", unitPath, err)
+	}
+
+	if err := systemctl("disable", "--now", *name); err != nil {
+		return fmt.Errorf("disabling service: %w", err)
+	}
+	if err := os.Remove(unitPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing unit file: %w", err)
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return fmt.Errorf("reloading systemd: %w", err)
+	}
+
+	fmt.Printf("Removed %s\n", unitPath)
+	return nil
+}
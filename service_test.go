@@ -0,0 +1,212 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRenderUnit(t *testing.T) {
+	unit, err := renderUnit(unitParams{
+		Binary: "/opt/bin/ipv6-ddns-cloudflare",
+		Config: "/srv/ddns/config.yaml",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "ExecStart=/opt/bin/ipv6-ddns-cloudflare -config /srv/ddns/config.yaml\n"
+	if !strings.Contains(string(unit), want) {
+		t.Errorf("unit missing %q:\n%s", want, unit)
+	}
+	for _, directive := range []string{"NoNewPrivileges=true", "ProtectSystem=strict", "WantedBy=multi-user.target"} {
+		if !strings.Contains(string(unit), directive) {
+			t.Errorf("unit missing %q", directive)
+		}
+	}
+}
+
+func TestRenderUnitEscaping(t *testing.T) {
+	tests := []struct {
+		name   string
+		params unitParams
+		want   []string
+	}{
+		{"path with spaces and specifiers",
+			unitParams{Binary: "/opt/my tools/ipv6-ddns-cloudflare", Config: "/srv/ddns 100%/config.yaml"},
+			[]string{`ExecStart="/opt/my tools/ipv6-ddns-cloudflare" -config "/srv/ddns 100%%/config.yaml"` + "\n"}},
+		{"quotes and variables",
+			unitParams{Binary: "/opt/bin/ipv6-ddns-cloudflare", Config: `/srv/"ddns"/$HOME.yaml`},
+			[]string{`ExecStart=/opt/bin/ipv6-ddns-cloudflare -config "/srv/\"ddns\"/$$HOME.yaml"` + "\n"}},
+		{"credential",
+			unitParams{Binary: "/opt/bin/ipv6-ddns-cloudflare", Config: "/srv/%i/config.yaml", Sandbox: &unitSandbox{DynamicUser: true}},
+			[]string{"ExecStart=/opt/bin/ipv6-ddns-cloudflare -config ${CREDENTIALS_DIRECTORY}/config.yaml\n",
+				"LoadCredential=config.yaml:/srv/%%i/config.yaml\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unit, err := renderUnit(tt.params)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(unit), want) {
+					t.Errorf("unit missing %q:\n%s", want, unit)
+				}
+			}
+		})
+	}
+}
+
+func TestSandboxFor(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   unitSandbox
+	}{
+		{
+			name:   "interface only",
+			config: Config{Interface: "eth0"},
+			want: unitSandbox{DynamicUser: true, ProtectHome: "true",
+				AddressFamilies: []string{"AF_UNIX", "AF_INET", "AF_INET6", "AF_NETLINK"}},
+		},
+		{
+			name:   "snmp and privileged port",
+			config: Config{Interface: "pppoe0", SNMP: SNMPConfig{Target: "192.168.1.1"}, HTTP: HTTPConfig{Listen: "[::1]:80"}},
+			want: unitSandbox{DynamicUser: true, ProtectHome: "true",
+				AddressFamilies: []string{"AF_UNIX", "AF_INET", "AF_INET6"}, Capabilities: []string{"CAP_NET_BIND_SERVICE"}},
+		},
+		{
+			name: "resolver flush and status page",
+			config: Config{Interface: "eth0", StatusPage: StatusPageConfig{Dir: "/var/www/ddns"},
+				FlushResolver: ResolverFlushConfig{Unbound: true, Dnsmasq: true}},
+			want: unitSandbox{ProtectHome: "true", ReadWritePaths: []string{"/var/www/ddns"},
+				AddressFamilies: []string{"AF_UNIX", "AF_INET", "AF_INET6", "AF_NETLINK"}, Capabilities: []string{"CAP_KILL"}},
+		},
+		{
+			name:   "prefix hook",
+			config: Config{Interface: "pppoe0", SNMP: SNMPConfig{Target: "192.168.1.1"}, PrefixHook: PrefixHookConfig{Command: "/usr/local/sbin/renumber"}},
+			want: unitSandbox{ProtectHome: "true",
+				AddressFamilies: []string{"AF_UNIX", "AF_INET", "AF_INET6", "AF_NETLINK"}, Capabilities: []string{"CAP_NET_ADMIN"}},
+		},
+		{
+			name:   "control socket outside the runtime directory",
+			config: Config{Interface: "eth0", ControlSocket: "/var/lib/ddns/control.sock"},
+			want: unitSandbox{ProtectHome: "true", ReadWritePaths: []string{"/var/lib/ddns"},
+				AddressFamilies: []string{"AF_UNIX", "AF_INET", "AF_INET6", "AF_NETLINK"}},
+		},
+		{
+			name:   "control group",
+			config: Config{Interface: "eth0", ControlGroup: "ddns"},
+			want: unitSandbox{ProtectHome: "true",
+				AddressFamilies: []string{"AF_UNIX", "AF_INET", "AF_INET6", "AF_NETLINK"}},
+		},
+		{
+			name:   "state file",
+			config: Config{Interface: "eth0", StateFile: "/var/lib/ipv6-ddns-cloudflare/state.json"},
+			want: unitSandbox{DynamicUser: true, ProtectHome: "true", StateDirectory: "ipv6-ddns-cloudflare",
+				AddressFamilies: []string{"AF_UNIX", "AF_INET", "AF_INET6", "AF_NETLINK"}},
+		},
+		{
+			name:   "route53 shared credentials",
+			config: Config{Jobs: []JobConfig{{Interface: "eth0", Provider: "route53"}}},
+			want: unitSandbox{ProtectHome: "read-only",
+				AddressFamilies: []string{"AF_UNIX", "AF_INET", "AF_INET6", "AF_NETLINK"}},
+		},
+		{
+			name:   "token file",
+			config: Config{Interface: "eth0", CloudFlare: CloudFlareConfig{APITokenFile: "/etc/ipv6-ddns-cloudflare/token"}},
+			want: unitSandbox{ProtectHome: "true",
+				AddressFamilies: []string{"AF_UNIX", "AF_INET", "AF_INET6", "AF_NETLINK"}},
+		},
+		{
+			name:   "token command",
+			config: Config{Interface: "eth0", CloudFlare: CloudFlareConfig{APITokenCommand: "pass show cloudflare"}},
+			want: unitSandbox{ProtectHome: "read-only",
+				AddressFamilies: []string{"AF_UNIX", "AF_INET", "AF_INET6", "AF_NETLINK"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sandboxFor(tt.config); !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("sandboxFor() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderDynamicUserUnit(t *testing.T) {
+	unit, err := renderUnit(unitParams{
+		Binary:  "/opt/bin/ipv6-ddns-cloudflare",
+		Config:  "/srv/ddns/config.yaml",
+		Sandbox: &unitSandbox{DynamicUser: true, ProtectHome: "true", AddressFamilies: []string{"AF_UNIX", "AF_INET", "AF_INET6"}, Capabilities: []string{"CAP_NET_BIND_SERVICE"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, line := range []string{
+		"ExecStart=/opt/bin/ipv6-ddns-cloudflare -config ${CREDENTIALS_DIRECTORY}/config.yaml\n",
+		"DynamicUser=true\n",
+		"LoadCredential=config.yaml:/srv/ddns/config.yaml\n",
+		"RestrictAddressFamilies=AF_UNIX AF_INET AF_INET6\n",
+		"CapabilityBoundingSet=CAP_NET_BIND_SERVICE\n",
+		"AmbientCapabilities=CAP_NET_BIND_SERVICE\n",
+	} {
+		if !strings.Contains(string(unit), line) {
+			t.Errorf("unit missing %q:\n%s", line, unit)
+		}
+	}
+}
+
+func TestInstallService(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("systemd service installation is Linux-only")
+	}
+
+	var calls [][]string
+	orig := systemctl
+	systemctl = func(args ...string) error {
+		calls = append(calls, args)
+		return nil
+	}
+	defer func() { systemctl = orig }()
+
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.yaml")
+
+	if err := runInstallService([]string{"-unit-dir", dir, "-config", config, "-name", "ddns-test"}); err != nil {
+		t.Fatalf("install: %v", err)
+	}
+
+	unitPath := filepath.Join(dir, "ddns-test.service")
+	unit, err := os.ReadFile(unitPath)
+	if err != nil {
+		t.Fatalf("reading unit: %v", err)
+	}
+	if !strings.Contains(string(unit), "-config "+config) {
+		t.Errorf("unit does not reference config %s:\n%s", config, unit)
+	}
+
+	wantCalls := [][]string{{"daemon-reload"}, {"enable", "ddns-test"}}
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("systemctl calls = %v, want %v", calls, wantCalls)
+	}
+
+	calls = nil
+	if err := runUninstallService([]string{"-unit-dir", dir, "-name", "ddns-test"}); err != nil {
+		t.Fatalf("uninstall: %v", err)
+	}
+	if _, err := os.Stat(unitPath); !os.IsNotExist(err) {
+		t.Errorf("unit file should be removed, stat err = %v", err)
+	}
+
+	wantCalls = [][]string{{"disable", "--now", "ddns-test"}, {"daemon-reload"}}
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("systemctl calls = %v, want %v", calls, wantCalls)
+	}
+}
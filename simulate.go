@@ -0,0 +1,300 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// scenario is a scripted sequence of address events fed through the real
+// stability/update engine by the simulate command.
+type scenario struct {
+	PollInterval   int             `yaml:"poll_interval"`
+	StabilityDelay int             `yaml:"stability_delay"`
+	Record         string          `yaml:"record"`
+	Duration       float64         `yaml:"duration"`
+	Speed          float64         `yaml:"speed"`
+	Events         []scenarioEvent `yaml:"events"`
+}
+
+// scenarioEvent changes the simulated world at a given number of seconds
+// after the start: the address on the interface, a detection error, or
+// whether the fake CloudFlare API accepts updates.
+type scenarioEvent struct {
+	At      float64 `yaml:"at"`
+	Address string  `yaml:"address"`
+	Error   string  `yaml:"error"`
+	API     string  `yaml:"api"`
+}
+
+func loadScenario(path string) (scenario, error) {
+	var sc scenario
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return sc, fmt.Errorf("reading scenario file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &sc); err != nil {
+		return sc, fmt.Errorf("parsing scenario file: %w", err)
+	}
+
+	if sc.PollInterval == 0 {
+		sc.PollInterval = 1
+	}
+	if sc.StabilityDelay == 0 {
+		sc.StabilityDelay = 5
+	}
+	if sc.Speed < 0 {
+		return sc, fmt.Errorf("speed must be positive")
+	}
+	if sc.Speed == 0 {
+		sc.Speed = 1
+	}
+	sort.SliceStable(sc.Events, func(i, j int) bool { return sc.Events[i].At < sc.Events[j].At })
+	if sc.Duration == 0 {
+		if n := len(sc.Events); n > 0 {
+			sc.Duration = sc.Events[n-1].At
+		}
+		sc.Duration += float64(sc.StabilityDelay + sc.PollInterval + 1)
+	}
+
+	for i, ev := range sc.Events {
+		if ev.API != "" && ev.API != "up" && ev.API != "down" {
+			return sc, fmt.Errorf("events[%d]: api must be \"up\" or \"down\"", i)
+		}
+		if ev.Address == "" && ev.Error == "" && ev.API == "" {
+			return sc, fmt.Errorf("events[%d]: one of address, error or api is required", i)
+		}
+	}
+
+	return sc, nil
+}
+
+// elapsedWriter prefixes every line with the time since start on clock.
+type elapsedWriter struct {
+	mu    sync.Mutex
+	out   io.Writer
+	clock Clock
+	start time.Time
+}
+
+func (w *elapsedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := fmt.Fprintf(w.out, "[%6.1fs] ", w.clock.Now().Sub(w.start).Seconds()); err != nil {
+		return 0, err
+	}
+	return w.out.Write(p)
+}
+
+// simWorld is the simulated interface address and fake CloudFlare zone.
+type simWorld struct {
+	mu        sync.Mutex
+	address   string
+	detectErr string
+	apiDown   bool
+	record    string
+	updates   []string
+}
+
+func (w *simWorld) getIPv6(string) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.detectErr != "" {
+		return "", fmt.Errorf("%s", w.detectErr)
+	}
+	if w.address == "" {
+		return "", fmt.Errorf("no public IPv6 address found on interface sim0")
+	}
+	return w.address, nil
+}
+
+func (w *simWorld) apply(ev scenarioEvent) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch {
+	case ev.Error != "":
+		w.detectErr = ev.Error
+		return fmt.Sprintf("event: detection fails (%s)", ev.Error)
+	case ev.Address != "":
+		w.detectErr = ""
+		w.address = ev.Address
+		return fmt.Sprintf("event: interface address is now %s", ev.Address)
+	default:
+		w.apiDown = ev.API == "down"
+		return fmt.Sprintf("event: CloudFlare API is %s", ev.API)
+	}
+}
+
+func (w *simWorld) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.apiDown {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		rw.Write([]byte(`{"success": false, "errors": [{"code": 10000, "message": "simulated outage"}]}`))
+		log.Printf("provider: rejected %s (API down)", r.Method)
+		return
+	}
+
+	if r.Method == "GET" {
+		var result []DNSRecord
+		if w.record != "" {
+			result = append(result, DNSRecord{ID: "sim-record", Type: "AAAA", Name: "sim.example.com", Content: w.record})
+		}
+		json.NewEncoder(rw).Encode(map[string]interface{}{"success": true, "result": result})
+		return
+	}
+
+	var rec DNSRecord
+	if err := json.NewDecoder(r.Body).Decode(&rec); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte(`{"success": false, "errors": [{"code": 9207, "message": "invalid request"}]}`))
+		return
+	}
+	w.record = rec.Content
+	w.updates = append(w.updates, rec.Content)
+	log.Printf("provider: %s %s AAAA %s", r.Method, rec.Name, rec.Content)
+
+	rec.ID = "sim-record"
+	json.NewEncoder(rw).Encode(map[string]interface{}{"success": true, "result": rec})
+}
+
+// simulate runs sc at sc.Speed times real time and returns the record contents pushed to
+// the fake provider, in order.
+func simulate(sc scenario, out io.Writer) ([]string, error) {
+	origWriter, origFlags := log.Writer(), log.Flags()
+	clock := newScaledClock(sc.Speed)
+	log.SetOutput(&elapsedWriter{out: out, clock: clock, start: clock.Now()})
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(origWriter)
+		log.SetFlags(origFlags)
+	}()
+
+	world := &simWorld{record: sc.Record}
+	server := httptest.NewServer(world)
+	defer server.Close()
+
+	service := &DDNSService{
+		config: Config{
+			Interface:      "sim0",
+			PollInterval:   sc.PollInterval,
+			StabilityDelay: sc.StabilityDelay,
+			CloudFlare: CloudFlareConfig{
+				APIToken:   "simulated",
+				ZoneID:     "simulated",
+				RecordName: "sim.example.com",
+				TTL:        1,
+			},
+		},
+		httpClient: server.Client(),
+		getIPv6:    world.getIPv6,
+		timeSource: clock,
+	}
+	cf := newCloudFlareProvider(service.config.CloudFlare, server.Client())
+	cf.baseURL = server.URL
+	service.provider = cf
+
+	if err := service.fetchRecordID(); err != nil {
+		return nil, err
+	}
+
+	var timers []Timer
+	for _, ev := range sc.Events {
+		ev := ev
+		if ev.At <= 0 {
+			log.Print(world.apply(ev))
+			continue
+		}
+		timers = append(timers, clock.AfterFunc(time.Duration(ev.At*float64(time.Second)), func() {
+			log.Print(world.apply(ev))
+		}))
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		service.run(stop)
+		close(done)
+	}()
+
+	time.Sleep(clock.scale(time.Duration(sc.Duration * float64(time.Second))))
+	for _, t := range timers {
+		t.Stop()
+	}
+	close(stop)
+	<-done
+
+	world.mu.Lock()
+	defer world.mu.Unlock()
+	log.Printf("done: %d update(s), record content is %q", len(world.updates), world.record)
+	return world.updates, nil
+}
+
+func runSimulate(args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s simulate [-output text|json] SCENARIO\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Replays a YAML or JSON scenario of address events through the update engine")
+		fmt.Fprintln(fs.Output(), "against a fake CloudFlare API. The scenario runs in real time unless it sets speed.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	outputFormat := outputFlag(fs, "text", "json")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one scenario file")
+	}
+	output, err := outputFormat()
+	if err != nil {
+		return err
+	}
+
+	sc, err := loadScenario(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if output == "text" {
+		_, err = simulate(sc, os.Stdout)
+		return err
+	}
+	updates, err := simulate(sc, io.Discard)
+	if err != nil {
+		return err
+	}
+	if updates == nil {
+		updates = []string{}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]interface{}{"updates": updates})
+}
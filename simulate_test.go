@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadScenario(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		wantErr      string
+		wantDuration float64
+	}{
+		{
+			name: "defaults",
+			content: `
+events:
+  - at: 10
+    address: 2001:db8::2
+  - at: 0
+    address: 2001:db8::1
+`,
+			wantDuration: 17,
+		},
+		{
+			name:    "invalid api state",
+			content: "events: [{at: 1, api: sideways}]",
+			wantErr: `events[0]: api must be "up" or "down"`,
+		},
+		{
+			name:    "negative speed",
+			content: "speed: -2\nevents: [{at: 1, address: 2001:db8::1}]",
+			wantErr: "speed must be positive",
+		},
+		{
+			name:    "empty event",
+			content: "events: [{at: 1}]",
+			wantErr: "events[0]: one of address, error or api is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "scenario.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			sc, err := loadScenario(path)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if sc.Duration != tt.wantDuration {
+				t.Errorf("Duration = %v, want %v", sc.Duration, tt.wantDuration)
+			}
+			if sc.Events[0].At != 0 {
+				t.Errorf("events should be sorted by time, got %+v", sc.Events)
+			}
+		})
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	sc := scenario{
+		PollInterval:   1,
+		StabilityDelay: 1,
+		Record:         "2001:db8::1",
+		Duration:       3.5,
+		Events: []scenarioEvent{
+			{At: 0, Address: "2001:db8::1"},
+			{At: 0.5, Address: "2001:db8::2"},
+		},
+	}
+
+	var out bytes.Buffer
+	updates, err := simulate(sc, &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := []string{"2001:db8::2"}; !reflect.DeepEqual(updates, want) {
+		t.Errorf("updates = %v, want %v\noutput:\n%s", updates, want, out.String())
+	}
+	if !strings.Contains(out.String(), "provider: PUT sim.example.com AAAA 2001:db8::2") {
+		t.Errorf("output does not show the update:\n%s", out.String())
+	}
+}
@@ -0,0 +1,254 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// SNMPConfig selects SNMP as the address source: the IPv6 addresses of the
+// job's interface are read from a router's IP-MIB instead of the local host.
+type SNMPConfig struct {
+	Target    string `yaml:"target"`
+	Community string `yaml:"community"`
+	Version   string `yaml:"version"`
+	Timeout   int    `yaml:"timeout"`
+	Retries   int    `yaml:"retries"`
+}
+
+var (
+	oidIfDescr         = asn1.ObjectIdentifier{1, 3, 6, 1, 2, 1, 2, 2, 1, 2}
+	oidIfName          = asn1.ObjectIdentifier{1, 3, 6, 1, 2, 1, 31, 1, 1, 1, 1}
+	oidIPv6AddrIfIndex = asn1.ObjectIdentifier{1, 3, 6, 1, 2, 1, 4, 34, 1, 3, 2, 16} // ipAddressIfIndex.ipv6.16
+)
+
+const (
+	snmpPDUGetNext      = 1
+	snmpPDUResponse     = 2
+	snmpTagEndOfMibView = 2
+)
+
+type snmpMessage struct {
+	Version   int
+	Community []byte
+	PDU       asn1.RawValue
+}
+
+type snmpPDU struct {
+	RequestID   int32
+	ErrorStatus int
+	ErrorIndex  int
+	VarBinds    []snmpVarBind
+}
+
+type snmpVarBind struct {
+	Name  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type snmpSource struct {
+	config SNMPConfig
+}
+
+func newSNMPSource(config SNMPConfig) *snmpSource {
+	if _, _, err := net.SplitHostPort(config.Target); err != nil {
+		config.Target = net.JoinHostPort(config.Target, "161")
+	}
+	return &snmpSource{config: config}
+}
+
+// getPublicIPv6 returns the first public IPv6 address the router reports on
+// the interface with the given name (matched against ifName and ifDescr).
+func (s *snmpSource) getPublicIPv6(ifaceName string) (string, error) {
+	ifIndex, err := s.interfaceIndex(ifaceName)
+	if err != nil {
+		return "", err
+	}
+
+	var found string
+	err = s.walk(oidIPv6AddrIfIndex, func(oid asn1.ObjectIdentifier, value asn1.RawValue) bool {
+		var index int
+		if _, err := asn1.Unmarshal(value.FullBytes, &index); err != nil || index != ifIndex {
+			return true
+		}
+		suffix := oid[len(oidIPv6AddrIfIndex):]
+		if len(suffix) != net.IPv6len {
+			return true
+		}
+		ip := make(net.IP, net.IPv6len)
+		for i, b := range suffix {
+			ip[i] = byte(b)
+		}
+		if isValidPublicIPv6(ip) {
+			found = ip.String()
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return "", fmt.Errorf("reading addresses from %s: %w", s.config.Target, err)
+	}
+	if found == "" {
+		return "", fmt.Errorf("no public IPv6 address found on interface %s of %s", ifaceName, s.config.Target)
+	}
+	return found, nil
+}
+
+func (s *snmpSource) interfaceIndex(ifaceName string) (int, error) {
+	for _, table := range []asn1.ObjectIdentifier{oidIfName, oidIfDescr} {
+		index := 0
+		err := s.walk(table, func(oid asn1.ObjectIdentifier, value asn1.RawValue) bool {
+			var name []byte
+			if _, err := asn1.Unmarshal(value.FullBytes, &name); err != nil || string(name) != ifaceName {
+				return true
+			}
+			index = oid[len(oid)-1]
+			return false
+		})
+		if err != nil {
+			return 0, fmt.Errorf("reading interfaces from %s: %w", s.config.Target, err)
+		}
+		if index != 0 {
+			return index, nil
+		}
+	}
+	return 0, fmt.Errorf("interface %s not found on %s", ifaceName, s.config.Target)
+}
+
+// snmpMaxWalk bounds the objects read in one walk; interface and address
+// tables of routers are far smaller.
+const snmpMaxWalk = 100000
+
+// oidLess reports whether a comes before b in the order GetNext walks.
+func oidLess(a, b asn1.ObjectIdentifier) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// walk calls fn for every object below base until fn returns false.
+func (s *snmpSource) walk(base asn1.ObjectIdentifier, fn func(asn1.ObjectIdentifier, asn1.RawValue) bool) error {
+	conn, err := net.Dial("udp", s.config.Target)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	oid := base
+	for i := 0; ; i++ {
+		if i == snmpMaxWalk {
+			return fmt.Errorf("gave up walking %s after %d objects", base, snmpMaxWalk)
+		}
+		vb, err := s.getNext(conn, oid)
+		if err != nil {
+			return err
+		}
+		if vb.Value.Class == asn1.ClassContextSpecific && vb.Value.Tag == snmpTagEndOfMibView {
+			return nil
+		}
+		if len(vb.Name) <= len(base) || !vb.Name[:len(base)].Equal(base) {
+			return nil
+		}
+		// A broken agent answering with the same or an earlier object would
+		// keep the walk going forever
+		if !oidLess(oid, vb.Name) {
+			return fmt.Errorf("the agent answered GetNext of %s with %s, which doesn't follow it", oid, vb.Name)
+		}
+		if !fn(vb.Name, vb.Value) {
+			return nil
+		}
+		oid = vb.Name
+	}
+}
+
+func (s *snmpSource) getNext(conn net.Conn, oid asn1.ObjectIdentifier) (snmpVarBind, error) {
+	requestID := rand.Int31()
+	pdu, err := asn1.MarshalWithParams(snmpPDU{
+		RequestID: requestID,
+		VarBinds:  []snmpVarBind{{Name: oid, Value: asn1.NullRawValue}},
+	}, fmt.Sprintf("tag:%d", snmpPDUGetNext))
+	if err != nil {
+		return snmpVarBind{}, err
+	}
+	version := 1 // v2c
+	if s.config.Version == "1" {
+		version = 0
+	}
+	packet, err := asn1.Marshal(snmpMessage{
+		Version:   version,
+		Community: []byte(s.config.Community),
+		PDU:       asn1.RawValue{FullBytes: pdu},
+	})
+	if err != nil {
+		return snmpVarBind{}, err
+	}
+
+	timeout := time.Duration(s.config.Timeout) * time.Second
+	buf := make([]byte, 65535)
+	for attempt := 0; attempt <= s.config.Retries; attempt++ {
+		if _, err := conn.Write(packet); err != nil {
+			return snmpVarBind{}, err
+		}
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					break
+				}
+				return snmpVarBind{}, err
+			}
+			resp, err := parseSNMPResponse(buf[:n])
+			if err != nil {
+				return snmpVarBind{}, err
+			}
+			if resp.RequestID != requestID {
+				continue // stale reply to an earlier attempt
+			}
+			if resp.ErrorStatus != 0 {
+				return snmpVarBind{}, fmt.Errorf("SNMP error status %d", resp.ErrorStatus)
+			}
+			if len(resp.VarBinds) != 1 {
+				return snmpVarBind{}, fmt.Errorf("expected 1 varbind, got %d", len(resp.VarBinds))
+			}
+			return resp.VarBinds[0], nil
+		}
+	}
+	return snmpVarBind{}, fmt.Errorf("no response after %d attempts", s.config.Retries+1)
+}
+
+func parseSNMPResponse(packet []byte) (snmpPDU, error) {
+	var msg snmpMessage
+	if _, err := asn1.Unmarshal(packet, &msg); err != nil {
+		return snmpPDU{}, fmt.Errorf("parsing SNMP message: %w", err)
+	}
+	if msg.PDU.Class != asn1.ClassContextSpecific || msg.PDU.Tag != snmpPDUResponse {
+		return snmpPDU{}, fmt.Errorf("unexpected SNMP PDU type %d", msg.PDU.Tag)
+	}
+	var pdu snmpPDU
+	if _, err := asn1.UnmarshalWithParams(msg.PDU.FullBytes, &pdu, fmt.Sprintf("tag:%d", snmpPDUResponse)); err != nil {
+		return snmpPDU{}, fmt.Errorf("parsing SNMP PDU: %w", err)
+	}
+	return pdu, nil
+}
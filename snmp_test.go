@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/asn1"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeAgentEntry struct {
+	oid   asn1.ObjectIdentifier
+	value asn1.RawValue
+}
+
+func mustRaw(t *testing.T, v interface{}) asn1.RawValue {
+	t.Helper()
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return asn1.RawValue{FullBytes: b}
+}
+
+func ipv6AddrOID(t *testing.T, addr string) asn1.ObjectIdentifier {
+	oid := append(asn1.ObjectIdentifier{}, oidIPv6AddrIfIndex...)
+	for _, b := range net.ParseIP(addr).To16() {
+		oid = append(oid, int(b))
+	}
+	return oid
+}
+
+// startFakeAgent answers GetNext requests from a static MIB table.
+func startFakeAgent(t *testing.T, community string, entries []fakeAgentEntry) string {
+	t.Helper()
+	sort.Slice(entries, func(i, j int) bool { return oidLess(entries[i].oid, entries[j].oid) })
+	return startAgent(t, community, func(oid asn1.ObjectIdentifier) snmpVarBind {
+		for _, e := range entries {
+			if oidLess(oid, e.oid) {
+				return snmpVarBind{Name: e.oid, Value: e.value}
+			}
+		}
+		return snmpVarBind{
+			Name:  oid,
+			Value: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: snmpTagEndOfMibView, FullBytes: []byte{0x82, 0x00}},
+		}
+	})
+}
+
+// startAgent answers GetNext requests with next.
+func startAgent(t *testing.T, community string, next func(asn1.ObjectIdentifier) snmpVarBind) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var msg snmpMessage
+			if _, err := asn1.Unmarshal(buf[:n], &msg); err != nil {
+				t.Errorf("agent: bad message: %v", err)
+				return
+			}
+			if msg.Version != 1 || string(msg.Community) != community {
+				continue // agents silently drop bad communities
+			}
+			if msg.PDU.FullBytes[0] != 0xa1 {
+				t.Errorf("agent: expected GetNext PDU, got tag %#x", msg.PDU.FullBytes[0])
+				return
+			}
+			var req snmpPDU
+			if _, err := asn1.UnmarshalWithParams(msg.PDU.FullBytes, &req, "tag:1"); err != nil {
+				t.Errorf("agent: bad PDU: %v", err)
+				return
+			}
+
+			pdu, _ := asn1.MarshalWithParams(snmpPDU{RequestID: req.RequestID, VarBinds: []snmpVarBind{next(req.VarBinds[0].Name)}}, "tag:2")
+			resp, _ := asn1.Marshal(snmpMessage{Version: 1, Community: msg.Community, PDU: asn1.RawValue{FullBytes: pdu}})
+			conn.WriteTo(resp, addr)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestSNMPSource(t *testing.T) {
+	entries := []fakeAgentEntry{
+		{append(asn1.ObjectIdentifier{}, append(oidIfName, 1)...), mustRaw(t, []byte("lo"))},
+		{append(asn1.ObjectIdentifier{}, append(oidIfName, 2)...), mustRaw(t, []byte("pppoe0"))},
+		{append(asn1.ObjectIdentifier{}, append(oidIfDescr, 3)...), mustRaw(t, []byte("WAN Port"))},
+		{ipv6AddrOID(t, "2001:db8::5"), mustRaw(t, 1)},
+		{ipv6AddrOID(t, "fe80::1"), mustRaw(t, 2)},
+		{ipv6AddrOID(t, "fd00::1"), mustRaw(t, 2)},
+		{ipv6AddrOID(t, "2001:db8:1::42"), mustRaw(t, 2)},
+		{ipv6AddrOID(t, "2001:db8:2::1"), mustRaw(t, 3)},
+	}
+	target := startFakeAgent(t, "secret", entries)
+
+	tests := []struct {
+		iface   string
+		want    string
+		wantErr string
+	}{
+		{iface: "pppoe0", want: "2001:db8:1::42"},
+		{iface: "WAN Port", want: "2001:db8:2::1"},
+		{iface: "eth9", wantErr: "interface eth9 not found"},
+	}
+
+	source := newSNMPSource(SNMPConfig{Target: target, Community: "secret", Version: "2c", Timeout: 1, Retries: 0})
+	for _, tt := range tests {
+		t.Run(tt.iface, func(t *testing.T) {
+			got, err := source.getPublicIPv6(tt.iface)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("getPublicIPv6(%q) = %q, want %q", tt.iface, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("wrong community times out", func(t *testing.T) {
+		source := newSNMPSource(SNMPConfig{Target: target, Community: "public", Version: "2c", Timeout: 1, Retries: 0})
+		_, err := source.getPublicIPv6("pppoe0")
+		if err == nil || !strings.Contains(err.Error(), "no response after 1 attempts") {
+			t.Errorf("expected timeout error, got %v", err)
+		}
+	})
+}
+
+func TestSNMPWalkNotAdvancing(t *testing.T) {
+	stuck := append(asn1.ObjectIdentifier{}, append(oidIfName, 1)...)
+	target := startAgent(t, "public", func(asn1.ObjectIdentifier) snmpVarBind {
+		return snmpVarBind{Name: stuck, Value: mustRaw(t, []byte("lo"))}
+	})
+	source := newSNMPSource(SNMPConfig{Target: target, Community: "public", Version: "2c", Timeout: 1, Retries: 0})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := source.getPublicIPv6("pppoe0")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "doesn't follow it") {
+			t.Errorf("expected an error about the walk not advancing, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("walk of an agent repeating the same object didn't stop")
+	}
+}
+
+func TestNewSNMPSourceDefaultPort(t *testing.T) {
+	tests := map[string]string{
+		"192.0.2.1":        "192.0.2.1:161",
+		"192.0.2.1:1161":   "192.0.2.1:1161",
+		"2001:db8::1":      "[2001:db8::1]:161",
+		"router.lan":       "router.lan:161",
+		"[2001:db8::1]:16": "[2001:db8::1]:16",
+	}
+	for in, want := range tests {
+		if got := newSNMPSource(SNMPConfig{Target: in}).config.Target; got != want {
+			t.Errorf("target %q = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+)
+
+// brokenJob is a job left out with soft_fail because its settings are
+// invalid or its records couldn't be looked up at startup. It is reported
+// by the status endpoints until a reload or restart fixes it.
+type brokenJob struct {
+	Name      string
+	Interface string
+	Optional  bool // health.optional of the job
+	Err       error
+}
+
+// status reports the job in GET /status like a running one, without
+// addresses or records.
+func (b brokenJob) status() jobStatus {
+	return jobStatus{
+		Job:       b.Name,
+		Interface: b.Interface,
+		Invalid:   true,
+		LastError: b.Err.Error(),
+		Records:   []recordStatus{},
+	}
+}
+
+// softFail records job as broken instead of failing the whole config.
+func softFail(broken []brokenJob, job JobConfig, err error) []brokenJob {
+	logError("Job %s is broken, starting the other jobs without it: %v", job.Name, err)
+	return append(broken, brokenJob{Name: job.Name, Interface: job.Interface, Optional: job.Health.Optional, Err: err})
+}
+
+// checkBroken fails a soft_fail config where no job could be started, as
+// there would be nothing left to run.
+func checkBroken(services []*DDNSService, broken []brokenJob) error {
+	if len(services) == 0 && len(broken) > 0 {
+		return fmt.Errorf("no job could be started: job %s: %w", broken[0].Name, broken[0].Err)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSoftFail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	jobs := `jobs:
+  - name: home
+    interface: eth0
+    provider: custom
+    custom:
+      url: "https://dyn.example.net/update?host={{.Name}}&ip={{.IP}}"
+      record_name: home.example.com
+  - name: office
+    interface: eth1
+    cloudflare:
+      zone_id: z
+      record_name: office.example.com
+`
+
+	write(jobs)
+	if _, err := readConfig(path, "", commandLine{}); err == nil || !strings.Contains(err.Error(), `job "office"`) {
+		t.Fatalf("readConfig() error = %v, want office rejected without soft_fail", err)
+	}
+
+	write("soft_fail: true\n" + jobs)
+	config, err := readConfig(path, "", commandLine{})
+	if err != nil {
+		t.Fatalf("readConfig() with soft_fail: %v", err)
+	}
+	services, broken, err := prepareServices(config, nil)
+	if err != nil {
+		t.Fatalf("prepareServices: %v", err)
+	}
+	if len(services) != 1 || services[0].name != "home" {
+		t.Errorf("services = %v, want only home", services)
+	}
+	if len(broken) != 1 || broken[0].Name != "office" || !strings.Contains(broken[0].Err.Error(), "api_token") {
+		t.Fatalf("broken = %+v, want office missing its api_token", broken)
+	}
+
+	set := newServiceSet(services)
+	set.setBroken(broken)
+	var listed *jobStatus
+	for _, st := range jobStatuses(set) {
+		if st.Job == "office" {
+			st := st
+			listed = &st
+		}
+	}
+	if listed == nil || !listed.Invalid || listed.LastError == "" {
+		t.Errorf("status of office = %+v, want it reported as invalid", listed)
+	}
+
+	rec := httptest.NewRecorder()
+	newHTTPHandler(HTTPConfig{}, ACMEConfig{}, set).ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"office"`) {
+		t.Errorf("healthz = %d %s, want 503 naming office", rec.Code, rec.Body.String())
+	}
+
+	// With every job broken there is nothing left to run
+	write("soft_fail: true\njobs:\n" + jobs[strings.Index(jobs, "  - name: office"):])
+	if config, err = readConfig(path, "", commandLine{}); err != nil {
+		t.Fatalf("readConfig(): %v", err)
+	}
+	if _, _, err := prepareServices(config, nil); err == nil || !strings.Contains(err.Error(), "no job could be started") {
+		t.Errorf("prepareServices() error = %v, want no job could be started", err)
+	}
+}
+
+func TestSoftFailIPv4(t *testing.T) {
+	// The server has no AAAA record for the job and fails the A lookup
+	addr := fakeDNSServer(t, func(req []byte) []byte {
+		i := 12
+		for req[i] != 0 {
+			i += int(req[i]) + 1
+		}
+		resp := append([]byte(nil), req...)
+		resp[2] |= 0x80
+		resp[3] = 3 // NXDOMAIN
+		if binary.BigEndian.Uint16(req[i+1:]) == 1 {
+			resp[3] = 2 // SERVFAIL
+		}
+		return resp
+	})
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config := `soft_fail: true
+jobs:
+  - name: home
+    interface: eth0
+    provider: custom
+    custom:
+      url: "https://dyn.example.net/update?host={{.Name}}&ip={{.IP}}"
+      record_name: home.example.com
+  - name: dual
+    interface: eth1
+    provider: rfc2136
+    ipv4:
+      enabled: true
+    rfc2136:
+      server: "` + addr + `"
+      zone: example.com
+      key_name: ddns-key
+      key_secret: c2VjcmV0
+      record_name: dual.example.com
+`
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := readConfig(path, "", commandLine{})
+	if err != nil {
+		t.Fatalf("readConfig(): %v", err)
+	}
+	services, broken, err := prepareServices(cfg, nil)
+	if err != nil {
+		t.Fatalf("prepareServices: %v", err)
+	}
+	// The job is reported broken, not left running with only its AAAA record
+	for _, s := range services {
+		if s.name == "dual" {
+			t.Errorf("%s updater of the broken job is running", s.typ())
+		}
+	}
+	if len(broken) != 1 || broken[0].Name != "dual" || !strings.Contains(broken[0].Err.Error(), "fetching A record") {
+		t.Errorf("broken = %+v, want dual failing its A record", broken)
+	}
+}
@@ -0,0 +1,74 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const stampPrefix = "ipv6-ddns-cloudflare"
+
+// recordStamp is the freshness marker written to the record comment when
+// cloudflare.comment_stamp is enabled. Seq increases with every write, by
+// whichever instance makes it.
+type recordStamp struct {
+	Instance string
+	Seq      uint64
+	Time     time.Time
+}
+
+func (st recordStamp) String() string {
+	return fmt.Sprintf("%s instance=%s seq=%d ts=%s",
+		stampPrefix, st.Instance, st.Seq, st.Time.UTC().Format(time.RFC3339))
+}
+
+// parseStamp extracts a stamp from a record comment. Comments not written
+// by this tool are reported as not ok.
+func parseStamp(comment string) (recordStamp, bool) {
+	fields := strings.Fields(comment)
+	if len(fields) == 0 || fields[0] != stampPrefix {
+		return recordStamp{}, false
+	}
+
+	var st recordStamp
+	for _, field := range fields[1:] {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "instance":
+			st.Instance = value
+		case "seq":
+			seq, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return recordStamp{}, false
+			}
+			st.Seq = seq
+		case "ts":
+			ts, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return recordStamp{}, false
+			}
+			st.Time = ts
+		}
+	}
+	if st.Instance == "" || st.Seq == 0 {
+		return recordStamp{}, false
+	}
+	return st, true
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordStamp(t *testing.T) {
+	st := recordStamp{Instance: "router-a", Seq: 42, Time: time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)}
+	comment := st.String()
+	if want := "ipv6-ddns-cloudflare instance=router-a seq=42 ts=2025-03-04T05:06:07Z"; comment != want {
+		t.Errorf("String() = %q, want %q", comment, want)
+	}
+
+	got, ok := parseStamp(comment)
+	if !ok || got != st {
+		t.Errorf("parseStamp(%q) = %+v, %v; want %+v", comment, got, ok, st)
+	}
+
+	for _, comment := range []string{
+		"",
+		"managed by hand",
+		"ipv6-ddns-cloudflare",
+		"ipv6-ddns-cloudflare instance=a seq=x ts=2025-03-04T05:06:07Z",
+		"ipv6-ddns-cloudflare seq=1 ts=2025-03-04T05:06:07Z",
+		"ipv6-ddns-cloudflare instance=a seq=1 ts=yesterday",
+	} {
+		if _, ok := parseStamp(comment); ok {
+			t.Errorf("parseStamp(%q) should fail", comment)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultStateDirectory is the directory of state_file that the generated
+// unit creates with StateDirectory.
+const defaultStateDirectory = "/var/lib/ipv6-ddns-cloudflare"
+
+// stateVersion is the layout of the state file. A file of another version
+// is ignored, and replaced on the next write.
+const stateVersion = 1
+
+func validateStateFile(path string) error {
+	if path != "" && !filepath.IsAbs(path) {
+		return fmt.Errorf("state_file must be an absolute path")
+	}
+	return nil
+}
+
+// recordState is what the state file keeps about one record.
+type recordState struct {
+	RecordID    string    `json:"record_id,omitempty"`
+	Address     string    `json:"address,omitempty"`
+	LastChanged time.Time `json:"last_changed,omitempty"`
+
+	// StaleSince is kept for a job's main record while an update of the
+	// job keeps failing
+	StaleSince *time.Time `json:"stale_since,omitempty"`
+
+	// Backoff is kept for a job's main record while a failed update waits
+	// to be retried, so a restart doesn't retry any sooner
+	Backoff *backoffState `json:"backoff,omitempty"`
+
+	// Prefixes is the prefix history of the job, kept with its main record
+	Prefixes []prefixSeen `json:"prefixes,omitempty"`
+}
+
+// backoffState is a scheduled retry of an update to Address.
+type backoffState struct {
+	Address string    `json:"address"`
+	Delay   int       `json:"delay"`
+	RetryAt time.Time `json:"retry_at"`
+}
+
+type stateFile struct {
+	Version int                    `json:"version"`
+	Records map[string]recordState `json:"records"`
+}
+
+// stateStore keeps the state of every job's records, keyed by recordKey.
+// It lets a restart go on from what was last published when the provider
+// can't be reached, and tells which records changed while the daemon was
+// stopped. The state lives in a local file or, for fleets of instances, in
+// Redis.
+type stateStore interface {
+	// get returns the state of a record as loaded or last updated.
+	get(key string) (recordState, bool)
+	// update merges records into the state and stores them.
+	update(records map[string]recordState) error
+}
+
+// openState opens the store selected in config, or returns nil if there
+// is none. The store is returned even when loading it failed, empty, so
+// the next update replaces what couldn't be read.
+func openState(config Config) (stateStore, error) {
+	switch {
+	case config.StateFile != "":
+		return loadState(config.StateFile)
+	case config.StateRedis.Address != "":
+		return loadRedisState(config.StateRedis)
+	}
+	return nil, nil
+}
+
+// fileStore is the state kept in state_file.
+type fileStore struct {
+	path    string
+	mu      sync.Mutex
+	records map[string]recordState
+}
+
+// loadState reads the state file at path. A missing file is an empty
+// state; an unreadable one is reported and replaced by the next write.
+func loadState(path string) (*fileStore, error) {
+	st := &fileStore{path: path, records: make(map[string]recordState)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	var file stateFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return st, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if file.Version != stateVersion {
+		return st, fmt.Errorf("%s has version %d, not %d", path, file.Version, stateVersion)
+	}
+	for key, rec := range file.Records {
+		st.records[key] = rec
+	}
+	return st, nil
+}
+
+func (st *fileStore) get(key string) (recordState, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	rec, ok := st.records[key]
+	return rec, ok
+}
+
+// update merges records into the state and writes the file, through a
+// temporary file so a crash never leaves half of it behind.
+func (st *fileStore) update(records map[string]recordState) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for key, rec := range records {
+		st.records[key] = rec
+	}
+
+	data, err := json.MarshalIndent(stateFile{Version: stateVersion, Records: st.records}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(st.path), ".state-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), st.path)
+}
+
+// useState makes the job and its aliases keep their records in state.
+func (s *DDNSService) useState(state stateStore) {
+	for _, r := range s.records() {
+		r.state = state
+	}
+}
+
+// saveState writes what the job knows about its records to the state file.
+func (s *DDNSService) saveState() {
+	if s.state == nil || s.config.DryRun {
+		return
+	}
+	records := make(map[string]recordState)
+	for _, r := range s.records() {
+		r.mu.Lock()
+		rec := recordState{RecordID: r.recordID, Address: r.lastKnownIP, LastChanged: r.lastChanged}
+		if since := r.staleSince; !since.IsZero() {
+			rec.StaleSince = &since
+		}
+		if r == s && r.retryDelay > 0 && r.pendingIP != "" {
+			rec.Backoff = &backoffState{Address: r.pendingIP, Delay: int(r.retryDelay / time.Second), RetryAt: r.retryAt}
+		}
+		if r == s {
+			rec.Prefixes = append([]prefixSeen(nil), r.prefixes...)
+		}
+		records[r.recordKey()] = rec
+		r.mu.Unlock()
+	}
+	if err := s.state.update(records); err != nil {
+		s.errorf("Failed to write the state file: %v", err)
+	}
+}
+
+// restoreState takes over the records from the state file when they can't
+// be looked up at startup. It reports false unless every record of the job
+// is in the file.
+func (s *DDNSService) restoreState() bool {
+	if s.state == nil {
+		return false
+	}
+	saved := make(map[*DDNSService]recordState)
+	for _, r := range s.records() {
+		rec, ok := s.state.get(r.recordKey())
+		if !ok {
+			return false
+		}
+		saved[r] = rec
+	}
+	for r, rec := range saved {
+		r.mu.Lock()
+		r.recordID, r.lastKnownIP, r.lastChanged = rec.RecordID, rec.Address, rec.LastChanged
+		r.mu.Unlock()
+	}
+	return true
+}
+
+// restoreJobState takes over when the job's records went stale from the
+// state file, so their age goes on counting across restarts, along with the
+// backoff of the retry that was scheduled and the prefix history.
+func (s *DDNSService) restoreJobState() {
+	if s.state == nil {
+		return
+	}
+	rec, ok := s.state.get(s.recordKey())
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec.StaleSince != nil {
+		s.staleSince = *rec.StaleSince
+	}
+	if rec.Backoff != nil && rec.Backoff.RetryAt.After(s.clock().Now()) {
+		s.savedBackoff = rec.Backoff
+	}
+	s.prefixes = rec.Prefixes
+}
+
+// logDrift reports records that were changed by something else while the
+// daemon was stopped, comparing the looked up records with the state file.
+func (s *DDNSService) logDrift() {
+	if s.state == nil {
+		return
+	}
+	for _, r := range s.records() {
+		rec, ok := s.state.get(r.recordKey())
+		r.mu.Lock()
+		current := r.lastKnownIP
+		r.mu.Unlock()
+		if ok && rec.Address != "" && current != rec.Address {
+			remote := current
+			if remote == "" {
+				remote = "deleted"
+			}
+			s.warnf("Record %s changed while the daemon was stopped: %s, last published %s", r.config.CloudFlare.RecordName, remote, rec.Address)
+		}
+	}
+}
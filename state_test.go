@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// downProvider fails every lookup, like a provider API that can't be
+// reached.
+type downProvider struct {
+	memProvider
+}
+
+func (downProvider) FetchRecord(typ, name string) (*DNSRecord, error) {
+	return nil, errors.New("dial tcp: connection refused")
+}
+
+func TestStateStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	st, err := loadState(path)
+	if err != nil {
+		t.Fatalf("loadState() of a missing file: %v", err)
+	}
+	changed := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	want := recordState{RecordID: "rec1", Address: "2001:db8::1", LastChanged: changed}
+	if err := st.update(map[string]recordState{"cloudflare zone AAAA home.example.com": want}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	st, err = loadState(path)
+	if err != nil {
+		t.Fatalf("loadState: %v", err)
+	}
+	if got, ok := st.get("cloudflare zone AAAA home.example.com"); !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("get() = %+v, %v, want %+v", got, ok, want)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+
+	os.WriteFile(path, []byte(`{"version": 99, "records": {}}`), 0600)
+	if _, err := loadState(path); err == nil {
+		t.Errorf("loadState() accepted an unknown version")
+	}
+}
+
+func TestPrepareFromState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	newService := func(provider Provider) *DDNSService {
+		s := &DDNSService{
+			config:     Config{CloudFlare: CloudFlareConfig{ZoneID: "zone", RecordName: "home.example.com"}},
+			getIPv6:    func(string) (string, error) { return "2001:db8::1", nil },
+			provider:   provider,
+			timeSource: newFakeClock(),
+		}
+		state, err := loadState(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.useState(state)
+		return s
+	}
+
+	// Without a state file, a failed lookup stops the job from starting
+	if err := newService(downProvider{}).prepare(nil); err == nil {
+		t.Fatalf("prepare() without a state file succeeded")
+	}
+
+	// A successful lookup is written to the state file
+	remote := memProvider{"AAAA home.example.com": {ID: "rec1", Name: "home.example.com", Type: "AAAA", Content: "2001:db8::1"}}
+	if err := newService(remote).prepare(nil); err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+
+	// The next start goes on from it when the provider is down
+	s := newService(downProvider{})
+	if err := s.prepare(nil); err != nil {
+		t.Fatalf("prepare() with a state file: %v", err)
+	}
+	if s.recordID != "rec1" || s.lastKnownIP != "2001:db8::1" {
+		t.Errorf("restored record %q with %q, want rec1 with 2001:db8::1", s.recordID, s.lastKnownIP)
+	}
+
+	// A record changed while stopped is reported
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	remote["AAAA home.example.com"] = DNSRecord{ID: "rec1", Name: "home.example.com", Type: "AAAA", Content: "2001:db8::9"}
+	if err := newService(remote).prepare(nil); err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	if want := "Record home.example.com changed while the daemon was stopped: 2001:db8::9, last published 2001:db8::1"; !strings.Contains(buf.String(), want) {
+		t.Errorf("log does not report the drift:\n%s", buf.String())
+	}
+}
+
+func TestStaleRecords(t *testing.T) {
+	origInitial, origMax := retryInitialDelay, retryMaxDelay
+	retryInitialDelay, retryMaxDelay = 10*time.Second, 30*time.Second
+	defer func() { retryInitialDelay, retryMaxDelay = origInitial, origMax }()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	st, _ := loadState(path)
+	clock := newFakeClock()
+	provider := &flakyProvider{memProvider: memProvider{}, failures: 2, clock: clock}
+	service := &DDNSService{
+		config:     Config{StabilityDelay: 5, CloudFlare: CloudFlareConfig{ZoneID: "zone", RecordName: "home.example.com"}},
+		getIPv6:    func(string) (string, error) { return "2001:db8::1", nil },
+		provider:   provider,
+		timeSource: clock,
+	}
+	service.useState(st)
+
+	service.checkAndUpdate()
+	clock.Advance(5 * time.Second)
+	failed := clock.Now()
+	since := service.status().StaleSince
+	if since == nil || !since.Equal(failed) {
+		t.Fatalf("stale since %v after a failed update, want %s", since, failed)
+	}
+
+	// A restart goes on counting from the state file
+	restarted := &DDNSService{config: service.config, timeSource: clock}
+	st, _ = loadState(path)
+	restarted.useState(st)
+	restarted.restoreJobState()
+	if !restarted.staleSince.Equal(failed) {
+		t.Errorf("stale since %s after a restart, want %s", restarted.staleSince, failed)
+	}
+
+	clock.Advance(10 * time.Second)
+	if !strings.Contains(buf.String(), "Retrying in 20s; the records have been stale for 10s") {
+		t.Errorf("retry doesn't log the age of the records, log:\n%s", buf.String())
+	}
+	clock.Advance(20 * time.Second)
+	if len(provider.writes) != 3 {
+		t.Fatalf("%d writes, want 3", len(provider.writes))
+	}
+	if since := service.status().StaleSince; since != nil {
+		t.Errorf("still stale since %s after the update succeeded", since)
+	}
+	if !strings.Contains(buf.String(), "Records are up to date again after being stale for 30s") {
+		t.Errorf("success doesn't log how long the records were stale, log:\n%s", buf.String())
+	}
+	st, _ = loadState(path)
+	if rec, _ := st.get(service.recordKey()); rec.StaleSince != nil {
+		t.Errorf("state file still has stale_since %s", rec.StaleSince)
+	}
+}
+
+func TestBackoffAcrossRestart(t *testing.T) {
+	origInitial, origMax := retryInitialDelay, retryMaxDelay
+	retryInitialDelay, retryMaxDelay = 10*time.Second, time.Minute
+	defer func() { retryInitialDelay, retryMaxDelay = origInitial, origMax }()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	st, _ := loadState(path)
+	clock := newFakeClock()
+	provider := &flakyProvider{memProvider: memProvider{}, failures: 3, clock: clock}
+	config := Config{StabilityDelay: 5, CloudFlare: CloudFlareConfig{ZoneID: "zone", RecordName: "home.example.com"}}
+	service := &DDNSService{
+		config:     config,
+		getIPv6:    func(string) (string, error) { return "2001:db8::1", nil },
+		provider:   provider,
+		timeSource: clock,
+	}
+	service.useState(st)
+
+	// Two failures: the next retry is 20s after the second one
+	service.checkAndUpdate()
+	clock.Advance(5 * time.Second)
+	clock.Advance(10 * time.Second)
+	retryAt := clock.Now().Add(20 * time.Second)
+	st, _ = loadState(path)
+	rec, _ := st.get(service.recordKey())
+	if b := rec.Backoff; b == nil || b.Address != "2001:db8::1" || b.Delay != 20 || !b.RetryAt.Equal(retryAt) {
+		t.Fatalf("state file has backoff %+v, want a retry of 2001:db8::1 in 20s at %s", b, retryAt)
+	}
+	service.cancelPendingUpdate()
+
+	// The restarted daemon waits for that retry rather than the stability
+	// delay, and backs off further from there
+	restarted := &DDNSService{
+		config:     config,
+		getIPv6:    service.getIPv6,
+		provider:   provider,
+		timeSource: clock,
+	}
+	restarted.useState(st)
+	restarted.restoreJobState()
+	restarted.checkAndUpdate()
+	clock.Advance(5 * time.Second)
+	if len(provider.writes) != 2 {
+		t.Fatalf("%d writes after the stability delay, want 2: the retry was scheduled for %s", len(provider.writes), retryAt)
+	}
+	clock.Advance(15 * time.Second)
+	if len(provider.writes) != 3 || !provider.writes[2].Equal(retryAt) {
+		t.Fatalf("writes at %v, want the third at %s", provider.writes, retryAt)
+	}
+	if !strings.Contains(buf.String(), "Retrying in 40s") {
+		t.Errorf("backoff started over after the restart, log:\n%s", buf.String())
+	}
+
+	clock.Advance(40 * time.Second)
+	if len(provider.writes) != 4 {
+		t.Fatalf("%d writes, want 4", len(provider.writes))
+	}
+	st, _ = loadState(path)
+	if rec, _ := st.get(service.recordKey()); rec.Backoff != nil {
+		t.Errorf("state file still has backoff %+v after the update succeeded", rec.Backoff)
+	}
+}
@@ -0,0 +1,170 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StatusPageConfig writes a static status page (index.html and
+// status.json) into Dir, for sharing the current addresses with people who
+// should not get access to the trigger endpoint.
+type StatusPageConfig struct {
+	Dir      string `yaml:"dir"`
+	Interval int    `yaml:"interval"`
+}
+
+// recordStatus is the public view of one managed record.
+type recordStatus struct {
+	Job         string    `json:"job,omitempty"`
+	Record      string    `json:"record"`
+	Type        string    `json:"type"`
+	Address     string    `json:"address,omitempty"`
+	LastChanged time.Time `json:"last_changed"`
+	Pending     string    `json:"pending,omitempty"`
+}
+
+// recordStatuses returns the status of the job's record and its aliases.
+func (s *DDNSService) recordStatuses() []recordStatus {
+	s.mu.Lock()
+	pending := s.pendingIP
+	statuses := []recordStatus{{
+		Job:         s.name,
+		Record:      s.config.CloudFlare.RecordName,
+		Type:        s.typ(),
+		Address:     s.lastKnownIP,
+		LastChanged: s.lastChanged,
+		Pending:     pending,
+	}}
+	s.mu.Unlock()
+
+	for _, alias := range s.aliases {
+		alias.mu.Lock()
+		st := recordStatus{
+			Job:         s.name,
+			Record:      alias.config.CloudFlare.RecordName,
+			Type:        alias.typ(),
+			Address:     alias.lastKnownIP,
+			LastChanged: alias.lastChanged,
+		}
+		if value, err := alias.value(pending); pending != "" && err == nil && value != alias.lastKnownIP {
+			st.Pending = value
+		}
+		alias.mu.Unlock()
+		statuses = append(statuses, st)
+	}
+	return statuses
+}
+
+var statusPageTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>IPv6 DDNS status</title>
+</head>
+<body>
+<h1>IPv6 DDNS status</h1>
+<table>
+<tr><th>Record</th><th>Type</th><th>Address</th><th>Last changed</th></tr>
+{{- range .Records}}
+<tr><td>{{.Record}}</td><td>{{.Type}}</td><td>{{.Address}}{{if .Pending}} (changing to {{.Pending}}){{end}}</td><td>{{if not .LastChanged.IsZero}}{{.LastChanged.UTC.Format "2006-01-02 15:04:05 MST"}}{{end}}</td></tr>
+{{- end}}
+</table>
+<p>Generated {{.Generated.UTC.Format "2006-01-02 15:04:05 MST"}}</p>
+</body>
+</html>
+`))
+
+type statusPage struct {
+	Schema    int            `json:"schema"`
+	Records   []recordStatus `json:"records"`
+	Generated time.Time      `json:"generated"`
+}
+
+// writeStatusPage renders page into dir. Files are replaced atomically so
+// a web server never serves a half-written page.
+func writeStatusPage(dir string, page statusPage) error {
+	data, err := json.MarshalIndent(page, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, "status.json"), append(data, '\n')); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := statusPageTemplate.Execute(&buf, page); err != nil {
+		return fmt.Errorf("rendering status page: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(dir, "index.html"), buf.Bytes())
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// runStatusPage rewrites the status page every interval until stop is
+// closed, skipping the write when no record changed since the last one.
+func runStatusPage(config StatusPageConfig, services *serviceSet, stop <-chan struct{}) {
+	interval := time.Duration(config.Interval) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last []byte
+	for {
+		var records []recordStatus
+		for _, s := range services.list() {
+			records = append(records, s.recordStatuses()...)
+		}
+		current, _ := json.Marshal(records)
+		if !bytes.Equal(current, last) {
+			if err := writeStatusPage(config.Dir, statusPage{Schema: statusSchema, Records: records, Generated: time.Now()}); err != nil {
+				logError("Failed to write status page: %v", err)
+			} else {
+				last = current
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
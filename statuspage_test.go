@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordStatuses(t *testing.T) {
+	changed := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	service := &DDNSService{
+		name:        "home",
+		config:      Config{CloudFlare: CloudFlareConfig{RecordName: "home.example.com"}},
+		lastKnownIP: "2001:db8::1",
+		lastChanged: changed,
+		pendingIP:   "2001:db8::2",
+		aliases: []*DDNSService{
+			{config: Config{CloudFlare: CloudFlareConfig{RecordName: "www.example.com"}}, lastKnownIP: "2001:db8::2", lastChanged: changed},
+			{config: Config{CloudFlare: CloudFlareConfig{RecordName: "vpn.example.com"}}, lastKnownIP: "2001:db8::1", lastChanged: changed},
+		},
+	}
+
+	want := []recordStatus{
+		{Job: "home", Record: "home.example.com", Type: "AAAA", Address: "2001:db8::1", LastChanged: changed, Pending: "2001:db8::2"},
+		{Job: "home", Record: "www.example.com", Type: "AAAA", Address: "2001:db8::2", LastChanged: changed},
+		{Job: "home", Record: "vpn.example.com", Type: "AAAA", Address: "2001:db8::1", LastChanged: changed, Pending: "2001:db8::2"},
+	}
+	if got := service.recordStatuses(); !reflect.DeepEqual(got, want) {
+		t.Errorf("recordStatuses() = %+v, want %+v", got, want)
+	}
+}
+
+func TestRunStatusPage(t *testing.T) {
+	dir := t.TempDir()
+	service := &DDNSService{
+		config:      Config{CloudFlare: CloudFlareConfig{RecordName: "home.example.com"}},
+		lastKnownIP: "2001:db8::1",
+		lastChanged: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	// A closed stop channel writes the page once and returns
+	stop := make(chan struct{})
+	close(stop)
+	runStatusPage(StatusPageConfig{Dir: dir, Interval: 60}, newServiceSet([]*DDNSService{service}), stop)
+
+	data, err := os.ReadFile(filepath.Join(dir, "status.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var page statusPage
+	if err := json.Unmarshal(data, &page); err != nil {
+		t.Fatalf("invalid status.json: %v", err)
+	}
+	if len(page.Records) != 1 || page.Records[0].Address != "2001:db8::1" || page.Generated.IsZero() {
+		t.Errorf("status.json = %s", data)
+	}
+
+	html, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<tr><td>home.example.com</td><td>AAAA</td><td>2001:db8::1</td><td>2025-01-02 03:04:05 UTC</td></tr>"
+	if !strings.Contains(string(html), want) {
+		t.Errorf("index.html does not contain %q:\n%s", want, html)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("expected only status.json and index.html, got %d files", len(entries))
+	}
+}
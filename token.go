@@ -0,0 +1,138 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// tokenCommandTimeout bounds api_token_command, which may wait for a
+// password manager to be unlocked.
+const tokenCommandTimeout = time.Minute
+
+// tokenSources returns the settings that supply the API token of cf.
+func (cf CloudFlareConfig) tokenSources() []string {
+	var sources []string
+	if cf.APIToken != "" {
+		sources = append(sources, "api_token")
+	}
+	if cf.APITokenFile != "" {
+		sources = append(sources, "api_token_file")
+	}
+	if cf.APITokenEnv != "" {
+		sources = append(sources, "api_token_env")
+	}
+	if cf.APITokenCommand != "" {
+		sources = append(sources, "api_token_command")
+	}
+	if cf.APITokenSecret != "" {
+		sources = append(sources, "api_token_secret")
+	}
+	return sources
+}
+
+// secretsDir is where Docker and Podman mount the secrets of a container.
+// Replaced in tests.
+var secretsDir = "/run/secrets"
+
+// resolveAPIToken fills in cf.APIToken from api_token_file, api_token_env,
+// api_token_command or api_token_secret.
+func resolveAPIToken(cf *CloudFlareConfig) error {
+	sources := cf.tokenSources()
+	if len(sources) > 1 {
+		return fmt.Errorf("cloudflare: only one of %s may be set", strings.Join(sources, ", "))
+	}
+	var token string
+	switch {
+	case cf.APITokenFile != "":
+		data, err := os.ReadFile(cf.APITokenFile)
+		if err != nil {
+			return fmt.Errorf("cloudflare.api_token_file: %w", err)
+		}
+		token = string(data)
+	case cf.APITokenEnv != "":
+		token = os.Getenv(cf.APITokenEnv)
+		if token == "" {
+			return fmt.Errorf("cloudflare.api_token_env: %s is not set", cf.APITokenEnv)
+		}
+	case cf.APITokenCommand != "":
+		out, err := runTokenCommand(cf.APITokenCommand, tokenCommandTimeout)
+		if err != nil {
+			return fmt.Errorf("cloudflare.api_token_command: %w", err)
+		}
+		token = string(out)
+	case cf.APITokenSecret != "":
+		if strings.ContainsRune(cf.APITokenSecret, '/') {
+			return fmt.Errorf("cloudflare.api_token_secret: %q is not a secret name; use api_token_file for a path", cf.APITokenSecret)
+		}
+		data, err := os.ReadFile(filepath.Join(secretsDir, cf.APITokenSecret))
+		if err != nil {
+			return fmt.Errorf("cloudflare.api_token_secret: %w", err)
+		}
+		token = string(data)
+	default:
+		return nil
+	}
+	// Only the first line counts, like pass show prints the password
+	// before any further fields
+	token, _, _ = strings.Cut(strings.TrimSpace(token), "\n")
+	if token = strings.TrimSpace(token); token == "" {
+		return fmt.Errorf("cloudflare: the token read from %s is empty", sources[0])
+	}
+	cf.APIToken = token
+	return nil
+}
+
+// resolveAPITokens reads the API tokens of the jobs to run that keep them
+// outside the config. It is run once the profile has been selected, so
+// only the tokens that are needed are read. With soft_fail, a job whose
+// token can't be read is logged and then left out for missing its token.
+func resolveAPITokens(config *Config) error {
+	if len(config.Jobs) == 0 {
+		return resolveAPIToken(&config.CloudFlare)
+	}
+	for i := range config.Jobs {
+		job := &config.Jobs[i]
+		if !job.enabled() {
+			continue
+		}
+		if err := resolveAPIToken(&job.CloudFlare); err != nil {
+			if !config.SoftFail {
+				return fmt.Errorf("job %q: %w", job.Name, err)
+			}
+			logWarn("Warning: job %q: %v", job.Name, err)
+		}
+	}
+	return nil
+}
+
+// runTokenCommand runs command through the shell and returns its output.
+// Its stderr is passed through, so a password manager can prompt or
+// explain a failure. Replaced in tests.
+var runTokenCommand = func(command string, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Stderr = os.Stderr
+	return cmd.Output()
+}
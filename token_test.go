@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveAPIToken(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "token")
+	if err := os.WriteFile(file, []byte("file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DDNS_TEST_TOKEN", "env-token")
+	defer func(orig string) { secretsDir = orig }(secretsDir)
+	secretsDir = dir
+	if err := os.WriteFile(filepath.Join(dir, "cf_token"), []byte("secret-token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(orig func(string, time.Duration) ([]byte, error)) { runTokenCommand = orig }(runTokenCommand)
+	runTokenCommand = func(command string, timeout time.Duration) ([]byte, error) {
+		if command != "pass show cloudflare" {
+			t.Errorf("ran %q", command)
+		}
+		return []byte("command-token\nlogin: ddns\n"), nil
+	}
+
+	tests := []struct {
+		name    string
+		cf      CloudFlareConfig
+		want    string
+		wantErr string
+	}{
+		{name: "inline", cf: CloudFlareConfig{APIToken: "inline"}, want: "inline"},
+		{name: "none", cf: CloudFlareConfig{}, want: ""},
+		{name: "file", cf: CloudFlareConfig{APITokenFile: file}, want: "file-token"},
+		{name: "env", cf: CloudFlareConfig{APITokenEnv: "DDNS_TEST_TOKEN"}, want: "env-token"},
+		{name: "command", cf: CloudFlareConfig{APITokenCommand: "pass show cloudflare"}, want: "command-token"},
+		{name: "secret", cf: CloudFlareConfig{APITokenSecret: "cf_token"}, want: "secret-token"},
+		{name: "secret path", cf: CloudFlareConfig{APITokenSecret: "../token"}, wantErr: "not a secret name"},
+		{name: "missing secret", cf: CloudFlareConfig{APITokenSecret: "other"}, wantErr: "cloudflare.api_token_secret"},
+		{name: "two sources", cf: CloudFlareConfig{APIToken: "inline", APITokenEnv: "DDNS_TEST_TOKEN"},
+			wantErr: "only one of api_token, api_token_env may be set"},
+		{name: "missing file", cf: CloudFlareConfig{APITokenFile: filepath.Join(dir, "missing")}, wantErr: "cloudflare.api_token_file"},
+		{name: "empty file", cf: CloudFlareConfig{APITokenFile: empty}, wantErr: "the token read from api_token_file is empty"},
+		{name: "unset env", cf: CloudFlareConfig{APITokenEnv: "DDNS_TEST_UNSET"}, wantErr: "DDNS_TEST_UNSET is not set"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cf := tt.cf
+			err := resolveAPIToken(&cf)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("resolveAPIToken() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveAPIToken() failed: %v", err)
+			}
+			if cf.APIToken != tt.want {
+				t.Errorf("token = %q, want %q", cf.APIToken, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveAPITokens(t *testing.T) {
+	t.Setenv("DDNS_TEST_TOKEN", "env-token")
+	disabled := false
+	config := Config{Jobs: []JobConfig{
+		{Name: "home", CloudFlare: CloudFlareConfig{APITokenEnv: "DDNS_TEST_TOKEN"}},
+		{Name: "office", CloudFlare: CloudFlareConfig{APITokenEnv: "DDNS_TEST_UNSET"}},
+		{Name: "lab", Enabled: &disabled, CloudFlare: CloudFlareConfig{APITokenEnv: "DDNS_TEST_UNSET"}},
+	}}
+	if err := resolveAPITokens(&config); err == nil || !strings.Contains(err.Error(), `job "office"`) {
+		t.Fatalf("resolveAPITokens() error = %v, want office failing", err)
+	}
+
+	// With soft_fail, office is left without a token and fails validation
+	config.SoftFail = true
+	if err := resolveAPITokens(&config); err != nil {
+		t.Fatalf("resolveAPITokens() with soft_fail: %v", err)
+	}
+	if config.Jobs[0].CloudFlare.APIToken != "env-token" || config.Jobs[1].CloudFlare.APIToken != "" {
+		t.Errorf("tokens = %q, %q", config.Jobs[0].CloudFlare.APIToken, config.Jobs[1].CloudFlare.APIToken)
+	}
+}
+
+func TestReadConfigTokenFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "token"), []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	content := "interface: eth0\ncloudflare:\n  api_token_file: " + filepath.Join(dir, "token") + "\n  record_name: home.example.com\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := readConfig(path, "", commandLine{})
+	if err != nil {
+		t.Fatalf("readConfig() failed: %v", err)
+	}
+	if config.CloudFlare.APIToken != "secret" {
+		t.Errorf("api_token = %q, want the file's content", config.CloudFlare.APIToken)
+	}
+}
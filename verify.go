@@ -0,0 +1,117 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// VerifyConfig enables periodic resolution of the managed record to catch
+// answers that diverge from the desired address (propagation problems, a
+// record proxied by mistake, or a record changed behind our back).
+type VerifyConfig struct {
+	Interval  int    `yaml:"interval"`
+	Threshold int    `yaml:"threshold"`
+	Resolver  string `yaml:"resolver"`
+}
+
+// verifyResolver returns the resolver for verification lookups:
+// verify.resolver if set, otherwise the one for all of the daemon's own
+// lookups. nil is the system resolver.
+func verifyResolver(config Config) *net.Resolver {
+	servers := config.Resolvers
+	if config.Verify.Resolver != "" {
+		servers = []string{config.Verify.Resolver}
+	}
+	// Validated with the config
+	resolver, _ := newResolver(servers)
+	return resolver
+}
+
+// newLookupIP returns a lookup function for addresses of the given network
+// ("ip6" for AAAA, "ip4" for A records) using resolver, or the system
+// resolver when nil.
+func newLookupIP(resolver *net.Resolver, network string) func(context.Context, string) ([]net.IP, error) {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return func(ctx context.Context, host string) ([]net.IP, error) {
+		return resolver.LookupIP(ctx, network, host)
+	}
+}
+
+// verifyDNS resolves the record and raises an alert once the answer has
+// differed from the desired address for longer than verify.threshold.
+func (s *DDNSService) verifyDNS(now time.Time) {
+	s.mu.Lock()
+	desired := s.detectedIP
+	if desired == "" {
+		desired = s.lastKnownIP
+	}
+	standingBy := s.standingByLocked()
+	s.mu.Unlock()
+	// A standby's address is not expected in the record
+	if desired == "" || standingBy {
+		return
+	}
+
+	name := s.config.CloudFlare.RecordName
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	addrs, err := s.lookupIP(ctx, name)
+	if err != nil {
+		s.verifyErrors.print(s.logf, fmt.Sprintf("Error resolving %s for verification: %v", name, err), now)
+		addrs = nil
+	} else {
+		s.verifyErrors.reset(s.logf, now)
+	}
+
+	matches := false
+	for _, addr := range addrs {
+		if addr.String() == desired {
+			matches = true
+			break
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if matches {
+		if s.divergenceAlerted {
+			s.logf("DNS answer for %s matches %s again", name, desired)
+		}
+		s.divergedSince = time.Time{}
+		s.divergenceAlerted = false
+		return
+	}
+
+	if s.divergedSince.IsZero() {
+		s.divergedSince = now
+	}
+	threshold := time.Duration(s.config.Verify.Threshold) * time.Second
+	if !s.divergenceAlerted && now.Sub(s.divergedSince) >= threshold {
+		s.errorf("ALERT: DNS answer for %s is %v but should be %s (diverged for %s)",
+			name, addrs, desired, now.Sub(s.divergedSince).Round(time.Second))
+		s.divergenceAlerted = true
+		s.notify(webhookEvent{Event: "dns_diverged", Severity: "error", Address: desired,
+			Error: fmt.Sprintf("DNS answer is %v", addrs)})
+	}
+}
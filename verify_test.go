@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestVerifyDNS(t *testing.T) {
+	var answer []net.IP
+	var lookupErr error
+
+	service := &DDNSService{
+		config: Config{
+			CloudFlare: CloudFlareConfig{RecordName: "home.example.com"},
+			Verify:     VerifyConfig{Interval: 60, Threshold: 300},
+		},
+		detectedIP: "2001:db8::2",
+		lookupIP: func(_ context.Context, host string) ([]net.IP, error) {
+			if host != "home.example.com" {
+				t.Errorf("looked up %q", host)
+			}
+			return answer, lookupErr
+		},
+	}
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	verify := func(offset time.Duration) {
+		service.verifyDNS(start.Add(offset))
+	}
+
+	// Diverging answer below the threshold does not alert
+	answer = []net.IP{net.ParseIP("2001:db8::1")}
+	verify(0)
+	verify(4 * time.Minute)
+	if service.divergenceAlerted {
+		t.Fatal("should not alert before the threshold")
+	}
+
+	// Lookup failures count as divergence too
+	answer, lookupErr = nil, fmt.Errorf("SERVFAIL")
+	verify(5 * time.Minute)
+	if !service.divergenceAlerted {
+		t.Fatal("should alert after the threshold")
+	}
+
+	// Matching answer clears the alert
+	answer, lookupErr = []net.IP{net.ParseIP("2001:db8::2")}, nil
+	verify(6 * time.Minute)
+	if service.divergenceAlerted || !service.divergedSince.IsZero() {
+		t.Error("matching answer should clear divergence state")
+	}
+
+	// Divergence starts counting from scratch
+	answer = []net.IP{net.ParseIP("2001:db8::1")}
+	verify(7 * time.Minute)
+	verify(11 * time.Minute)
+	if service.divergenceAlerted {
+		t.Error("divergence should be timed from when it started again")
+	}
+}
@@ -0,0 +1,93 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// clearScreen moves the cursor home and clears the terminal, so every
+// frame of watch replaces the one before.
+const clearScreen = "\033[H\033[2J"
+
+func runWatch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	socketPath := controlFlags(fs)
+	interval := fs.Float64("interval", 1, "Seconds between refreshes")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s watch [flags]\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Shows the state of every job of the running daemon, as status does, and")
+		fmt.Fprintln(fs.Output(), "keeps it up to date until interrupted: the detected and pending address,")
+		fmt.Fprintln(fs.Output(), "the time left until the pending update and the last error of every job.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *interval <= 0 {
+		return fmt.Errorf("-interval must be positive")
+	}
+
+	path, err := socketPath()
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(time.Duration(*interval * float64(time.Second)))
+	defer ticker.Stop()
+	for {
+		jobs, err := fetchStatus(path)
+		// Render into a buffer first, so the terminal never shows half a frame
+		var frame bytes.Buffer
+		renderWatch(&frame, path, jobs, err, time.Now())
+		os.Stdout.Write(frame.Bytes())
+		<-ticker.C
+	}
+}
+
+// fetchStatus asks the daemon listening on path for the state of its jobs.
+func fetchStatus(path string) ([]jobStatus, error) {
+	body, err := controlRequest(path, http.MethodGet, fmt.Sprintf("/status?schema=%d", statusSchema))
+	if err != nil {
+		return nil, err
+	}
+	var status struct {
+		Jobs []jobStatus `json:"jobs"`
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return nil, fmt.Errorf("decoding status: %w", err)
+	}
+	return status.Jobs, nil
+}
+
+// renderWatch writes one frame of watch: a header with the time, then the
+// jobs, or err while the daemon can't be reached. The frame starts by
+// clearing the screen.
+func renderWatch(w io.Writer, path string, jobs []jobStatus, err error, now time.Time) {
+	fmt.Fprint(w, clearScreen)
+	fmt.Fprintf(w, "%s  %s\n\n", now.Format("15:04:05"), path)
+	if err != nil {
+		fmt.Fprintf(w, "daemon not reachable: %v\n", err)
+		return
+	}
+	printStatus(w, jobs, now)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderWatch(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.Local)
+	updateAt := now.Add(42 * time.Second)
+	jobs := []jobStatus{{
+		Job:       "lte",
+		Interface: "wwan0",
+		Detected:  "2001:db8::2",
+		Pending:   "2001:db8::2",
+		UpdateAt:  &updateAt,
+		LastError: "CloudFlare API error: unavailable",
+		Records:   []recordStatus{{Type: "AAAA", Record: "lte.example.com", Address: "2001:db8::1"}},
+	}}
+
+	var out bytes.Buffer
+	renderWatch(&out, "/run/control.sock", jobs, nil, now)
+	frame := out.String()
+	if !strings.HasPrefix(frame, clearScreen+"12:00:00  /run/control.sock\n") {
+		t.Errorf("frame doesn't start with a cleared screen and the header:\n%q", frame)
+	}
+	for _, want := range []string{
+		"lte (wwan0)",
+		"pending:   2001:db8::2, update in 42s",
+		"failing:   CloudFlare API error: unavailable",
+		"AAAA lte.example.com 2001:db8::1",
+	} {
+		if !strings.Contains(frame, want) {
+			t.Errorf("frame lacks %q:\n%s", want, frame)
+		}
+	}
+
+	out.Reset()
+	renderWatch(&out, "/run/control.sock", nil, errors.New("connection refused"), now)
+	if !strings.Contains(out.String(), "daemon not reachable: connection refused") {
+		t.Errorf("frame without daemon:\n%s", out.String())
+	}
+}
+
+func TestStatusUpdateAt(t *testing.T) {
+	clock := newFakeClock()
+	service := &DDNSService{
+		config: Config{
+			Interface:      "eth0",
+			StabilityDelay: 60,
+			CloudFlare:     CloudFlareConfig{RecordName: "home.example.com"},
+		},
+		getIPv6:    func(string) (string, error) { return "2001:db8::1", nil },
+		provider:   memProvider{},
+		timeSource: clock,
+	}
+	if st := service.status(); st.UpdateAt != nil {
+		t.Errorf("update_at = %v before any change", st.UpdateAt)
+	}
+
+	service.checkAndUpdate()
+	clock.Advance(10 * time.Second)
+	st := service.status()
+	if want := clock.Now().Add(50 * time.Second); st.UpdateAt == nil || !st.UpdateAt.Equal(want) {
+		t.Errorf("update_at = %v, want %v", st.UpdateAt, want)
+	}
+
+	clock.Advance(time.Minute)
+	if st := service.status(); st.UpdateAt != nil {
+		t.Errorf("update_at = %v after the update", st.UpdateAt)
+	}
+}
@@ -0,0 +1,230 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WebhookConfig sends a signed JSON notification to URL whenever a record
+// is updated. Jobs, Records and Severity, when set, restrict the events the
+// webhook receives.
+type WebhookConfig struct {
+	URL      string   `yaml:"url"`
+	Secret   string   `yaml:"secret"`
+	Jobs     []string `yaml:"jobs"`
+	Records  []string `yaml:"records"`
+	Severity string   `yaml:"severity"`
+
+	// Batch replaces the address_changed event of every record with one
+	// records_updated event for each update of a job, e.g. for a chat
+	// that shouldn't get dozens of messages when a prefix rotates.
+	Batch bool `yaml:"batch"`
+}
+
+type webhookEvent struct {
+	Event    string    `json:"event"`
+	Severity string    `json:"severity"`
+	Job      string    `json:"job,omitempty"`
+	Record   string    `json:"record"`
+	Type     string    `json:"type"`
+	Address  string    `json:"address"`
+	Previous string    `json:"previous,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+
+	// SeenBefore is when a prefix_changed event's prefix was last in use
+	SeenBefore *time.Time `json:"seen_before,omitempty"`
+
+	// Updated and Failed count the records a records_updated event is
+	// about, and Summary describes the update in one line
+	Updated int    `json:"updated,omitempty"`
+	Failed  int    `json:"failed,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+// webhookSeverities orders the event severities; a webhook with a severity
+// receives events of that severity and above.
+var webhookSeverities = map[string]int{"info": 0, "error": 1}
+
+// wants reports whether event passes the webhook's filters.
+func (w WebhookConfig) wants(event webhookEvent) bool {
+	if len(w.Jobs) > 0 && !containsFold(w.Jobs, event.Job) {
+		return false
+	}
+	if len(w.Records) > 0 && !containsFold(w.Records, event.Record) {
+		return false
+	}
+	switch event.Event {
+	case "address_changed":
+		if w.Batch {
+			return false
+		}
+	case "records_updated":
+		if !w.Batch {
+			return false
+		}
+	}
+	return w.Severity == "" || webhookSeverities[event.Severity] >= webhookSeverities[w.Severity]
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateWebhook checks one webhook entry; field is its name in messages.
+func validateWebhook(field string, w WebhookConfig) error {
+	if w.URL == "" {
+		return fmt.Errorf("%s.url is required", field)
+	}
+	if w.Secret == "" {
+		return fmt.Errorf("%s.secret is required when %s.url is set", field, field)
+	}
+	if _, ok := webhookSeverities[w.Severity]; w.Severity != "" && !ok {
+		return fmt.Errorf("%s.severity must be info or error", field)
+	}
+	return nil
+}
+
+// Signature headers. The signature is an HMAC-SHA256 over
+// "<timestamp>.<nonce>.<body>" with the shared secret, so receivers can
+// authenticate the sender and reject replays by checking the timestamp and
+// remembering recent nonces.
+const (
+	webhookTimestampHeader = "X-DDNS-Timestamp"
+	webhookNonceHeader     = "X-DDNS-Nonce"
+	webhookSignatureHeader = "X-DDNS-Signature"
+)
+
+func signWebhook(secret, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + nonce + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// notify sends event to every webhook whose filters match, in the
+// background; delivery failures are only logged. The record and its type
+// are the job's main record unless the event names another one.
+func (s *DDNSService) notify(event webhookEvent) {
+	event.Job = s.name
+	if event.Record == "" {
+		event.Record = s.config.CloudFlare.RecordName
+	}
+	if event.Type == "" {
+		event.Type = s.typ()
+	}
+	event.Time = s.clock().Now().UTC().Truncate(time.Second)
+	for _, hook := range s.config.webhooks() {
+		if !hook.wants(event) {
+			continue
+		}
+		hook := hook
+		s.goBackground(func() {
+			if err := s.protect("webhook", func() error { return s.sendWebhook(hook, event) }); err != nil {
+				s.errorf("Failed to send webhook to %s: %v", hook.URL, err)
+			}
+		})
+	}
+}
+
+// notifyUpdated sends the records_updated event of an update of the job's
+// records from previous to ip, in which updated records were written and
+// errs are the failures. Updates that wrote nothing send none; their
+// failures are reported by update_failed.
+func (s *DDNSService) notifyUpdated(previous, ip, reason string, updated int, errs publishErrors) {
+	if s.config.DryRun || updated == 0 {
+		return
+	}
+	change := fmt.Sprintf("address set to %s", ip)
+	if previous != "" && previous != ip {
+		change = fmt.Sprintf("address changed from %s to %s", previous, ip)
+	}
+	old, ok := s.newPrefix(previous)
+	if prefix, ok2 := s.newPrefix(ip); ok && ok2 && old.Network != prefix.Network {
+		change = fmt.Sprintf("prefix changed from %s to %s", old.Network, prefix.Network)
+	}
+	event := webhookEvent{Event: "records_updated", Severity: "info", Address: ip, Previous: previous, Reason: reason,
+		Updated: updated, Failed: len(errs), Summary: fmt.Sprintf("%s; %d record(s) updated", change, updated)}
+	if len(errs) > 0 {
+		event.Severity = "error"
+		event.Error = errs.Error()
+		event.Summary += fmt.Sprintf(", %d failed", len(errs))
+	}
+	s.notify(event)
+}
+
+func (s *DDNSService) sendWebhook(hook WebhookConfig, event webhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("generating nonce: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonceHex := hex.EncodeToString(nonce)
+
+	req, err := http.NewRequest("POST", hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookNonceHeader, nonceHex)
+	req.Header.Set(webhookSignatureHeader, signWebhook(hook.Secret, timestamp, nonceHex, body))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+// webhooks returns the single webhook, if set, followed by the webhooks list.
+func (c Config) webhooks() []WebhookConfig {
+	var hooks []WebhookConfig
+	if c.Webhook.URL != "" {
+		hooks = append(hooks, c.Webhook)
+	}
+	return append(hooks, c.Webhooks...)
+}
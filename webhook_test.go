@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSignWebhook(t *testing.T) {
+	got := signWebhook("secret", "1700000000", "abc", []byte(`{"event":"address_changed"}`))
+	want := "sha256=381ec34a080a53aac74105e8db3c43b83d98c2f2e197898b3b40d476f14d62cd"
+	if got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+}
+
+func TestSendWebhook(t *testing.T) {
+	var received webhookEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts, nonce := r.Header.Get(webhookTimestampHeader), r.Header.Get(webhookNonceHeader)
+		if ts == "" || len(nonce) != 32 {
+			t.Errorf("timestamp %q nonce %q", ts, nonce)
+		}
+		if got, want := r.Header.Get(webhookSignatureHeader), signWebhook("s3cret", ts, nonce, body); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+		json.Unmarshal(body, &received)
+	}))
+	defer server.Close()
+
+	// The webhook is sent when the record is published
+	cloudflare := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success": true, "result": {"id": "rec-1"}}`))
+	}))
+	defer cloudflare.Close()
+
+	service := cloudflareAt(&DDNSService{
+		name: "home",
+		config: Config{
+			CloudFlare: CloudFlareConfig{APIToken: "token", ZoneID: "zone", RecordName: "home.example.com"},
+			Webhook:    WebhookConfig{URL: server.URL, Secret: "s3cret"},
+		},
+		httpClient:  cloudflare.Client(),
+		recordID:    "rec-1",
+		lastKnownIP: "2001:db8::1",
+	}, cloudflare.Client(), cloudflare.URL)
+	if err := service.publishAll("2001:db8::2"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	service.shutdown()
+
+	if received.Event != "address_changed" || received.Severity != "info" || received.Job != "home" || received.Record != "home.example.com" ||
+		received.Address != "2001:db8::2" || received.Previous != "2001:db8::1" || received.Time.IsZero() {
+		t.Errorf("received %+v", received)
+	}
+
+	t.Run("receiver error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+		}))
+		defer server.Close()
+
+		service := &DDNSService{httpClient: server.Client()}
+		err := service.sendWebhook(WebhookConfig{URL: server.URL, Secret: "s3cret"}, webhookEvent{Event: "address_changed"})
+		if err == nil || !strings.Contains(err.Error(), "401 Unauthorized: bad signature") {
+			t.Errorf("expected 401 error, got %v", err)
+		}
+	})
+}
+
+func TestWebhookWants(t *testing.T) {
+	nas := webhookEvent{Event: "address_changed", Severity: "info", Job: "home", Record: "nas.example.com"}
+	failed := webhookEvent{Event: "update_failed", Severity: "error", Job: "home", Record: "web.example.com"}
+
+	tests := []struct {
+		name  string
+		hook  WebhookConfig
+		event webhookEvent
+		want  bool
+	}{
+		{"no filters", WebhookConfig{}, nas, true},
+		{"record matches", WebhookConfig{Records: []string{"NAS.example.com"}}, nas, true},
+		{"record differs", WebhookConfig{Records: []string{"nas.example.com"}}, failed, false},
+		{"job matches", WebhookConfig{Jobs: []string{"home"}}, nas, true},
+		{"job differs", WebhookConfig{Jobs: []string{"office"}}, nas, false},
+		{"severity below", WebhookConfig{Severity: "error"}, nas, false},
+		{"severity reached", WebhookConfig{Severity: "error"}, failed, true},
+		{"info gets errors", WebhookConfig{Severity: "info"}, failed, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hook.wants(tt.event); got != tt.want {
+				t.Errorf("wants() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookRouting(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string][]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		mu.Lock()
+		received[r.URL.Path] = append(received[r.URL.Path], event.Event)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	cloudflare := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success": false, "errors": [{"code": 1000, "message": "boom"}]}`))
+	}))
+	defer cloudflare.Close()
+
+	defer func(d time.Duration) { retryInitialDelay = d }(retryInitialDelay)
+	retryInitialDelay = time.Hour
+
+	service := cloudflareAt(&DDNSService{
+		name: "home",
+		config: Config{
+			CloudFlare: CloudFlareConfig{APIToken: "token", ZoneID: "zone", RecordName: "home.example.com"},
+			Webhook:    WebhookConfig{URL: server.URL + "/ops", Secret: "s3cret"},
+			Webhooks: []WebhookConfig{
+				{URL: server.URL + "/family", Secret: "s3cret", Records: []string{"nas.example.com"}},
+				{URL: server.URL + "/alerts", Secret: "s3cret", Severity: "error"},
+			},
+		},
+		httpClient: cloudflare.Client(),
+		recordID:   "rec-1",
+		pendingIP:  "2001:db8::2",
+		getIPv6:    func(string) (string, error) { return "2001:db8::2", nil },
+	}, cloudflare.Client(), cloudflare.URL)
+	service.stabilityTimerFired()
+	// A retry failing again does not notify a second time
+	service.stabilityTimerFired()
+	service.cancelPendingUpdate()
+	service.shutdown()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := received["/ops"]; len(got) != 1 || got[0] != "update_failed" {
+		t.Errorf("ops received %v", got)
+	}
+	if got := received["/alerts"]; len(got) != 1 || got[0] != "update_failed" {
+		t.Errorf("alerts received %v", got)
+	}
+	if got := received["/family"]; len(got) != 0 {
+		t.Errorf("family received %v", got)
+	}
+}
+
+func TestWebhookPerRecord(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string][]webhookEvent{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		mu.Lock()
+		received[r.URL.Path] = append(received[r.URL.Path], event)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	remote := memProvider{}
+	s := newDDNSService(Config{
+		Webhooks: []WebhookConfig{
+			{URL: server.URL + "/all"},
+			{URL: server.URL + "/nas", Records: []string{"nas.example.com"}},
+		},
+	}, JobConfig{Name: "home", Interface: "eth0", PollInterval: 30,
+		CloudFlare: CloudFlareConfig{RecordName: "home.example.com", Aliases: []string{"www.example.com"},
+			Records: []RecordConfig{{Name: "nas.example.com", Content: `{{ .IP | host 64 "::20" }}`}},
+			Zones:   []ZoneConfig{{ZoneID: "other", Records: []RecordConfig{{Name: "home.example.org"}}}},
+		}})
+	for _, r := range s.records() {
+		r.provider = remote
+	}
+	s.httpClient = server.Client()
+	s.timeSource = newFakeClock()
+
+	if err := s.publishAll("2001:db8:1:2::1"); err != nil {
+		t.Fatalf("publishAll: %v", err)
+	}
+	s.background.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	records := map[string]string{}
+	for _, event := range received["/all"] {
+		if event.Event != "address_changed" || event.Job != "home" {
+			t.Errorf("received %+v", event)
+		}
+		records[event.Record] = event.Address
+	}
+	want := map[string]string{
+		"home.example.com": "2001:db8:1:2::1",
+		"www.example.com":  "2001:db8:1:2::1",
+		"nas.example.com":  "2001:db8:1:2::20",
+		"home.example.org": "2001:db8:1:2::1",
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("events for %v, want one for every record: %v", records, want)
+	}
+	if got := received["/nas"]; len(got) != 1 || got[0].Record != "nas.example.com" || got[0].Address != "2001:db8:1:2::20" {
+		t.Errorf("webhook filtered on nas.example.com received %+v", got)
+	}
+}
+
+func TestWebhookDuringShutdown(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		mu.Lock()
+		received = append(received, event.Event)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	s := newDDNSService(Config{Webhooks: []WebhookConfig{{URL: server.URL}}},
+		JobConfig{Interface: "eth0", PollInterval: 30, CloudFlare: CloudFlareConfig{RecordName: "home.example.com"}})
+	s.httpClient = server.Client()
+	s.timeSource = newFakeClock()
+
+	// Events raised while shutdown waits must not race with its Wait
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.notify(webhookEvent{Event: "job_unhealthy", Severity: "error"})
+		}()
+	}
+	s.shutdown()
+	wg.Wait()
+
+	mu.Lock()
+	before := len(received)
+	mu.Unlock()
+	s.notify(webhookEvent{Event: "job_recovered", Severity: "info"})
+	s.background.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != before {
+		t.Errorf("webhook sent after shutdown: %v", received)
+	}
+}
+
+func TestWebhookBatch(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string][]webhookEvent{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		mu.Lock()
+		received[r.URL.Path] = append(received[r.URL.Path], event)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	clock := newFakeClock()
+	s := newDDNSService(Config{
+		Webhooks: []WebhookConfig{
+			{URL: server.URL + "/each"},
+			{URL: server.URL + "/batch", Batch: true},
+		},
+	}, JobConfig{Name: "router", Interface: "eth0", PollInterval: 30,
+		CloudFlare: CloudFlareConfig{RecordName: "router.example.com",
+			Aliases: []string{"nas.example.com", "printer.example.com", "broken.example.com"}}})
+	for _, r := range s.records() {
+		r.provider = memProvider{}
+		r.lastKnownIP = "2001:db8:1::1"
+	}
+	s.aliases[2].provider = &flakyProvider{memProvider: memProvider{}, failures: 1, clock: clock}
+	s.httpClient = server.Client()
+	s.timeSource = clock
+
+	err := s.publishAll("2001:db8:2::1")
+	if err == nil {
+		t.Fatal("expected the broken record to fail")
+	}
+	s.background.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := received["/each"]; len(got) != 3 {
+		t.Errorf("webhook without batch received %+v, want an event per updated record", got)
+	}
+	got := received["/batch"]
+	if len(got) != 1 {
+		t.Fatalf("batch webhook received %+v, want one event", got)
+	}
+	event := got[0]
+	if event.Event != "records_updated" || event.Severity != "error" || event.Updated != 3 || event.Failed != 1 ||
+		event.Summary != "prefix changed from 2001:db8:1::/64 to 2001:db8:2::/64; 3 record(s) updated, 1 failed" ||
+		!strings.Contains(event.Error, "broken.example.com") {
+		t.Errorf("batch event = %+v", event)
+	}
+}
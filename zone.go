@@ -0,0 +1,76 @@
+// ipv6-ddns-cloudflare - IPv6 Dynamic DNS updater for CloudFlare
+// Copyright (C) 2025 João Sena Ribeiro <sena@smux.net>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// zone returns the ID of the provider's zone. Without zone_id in the
+// config, it is looked up from the record name on first use and kept.
+func (p *cloudflareProvider) zone() (string, error) {
+	p.zoneMu.Lock()
+	defer p.zoneMu.Unlock()
+	if p.zoneID != "" {
+		return p.zoneID, nil
+	}
+	if p.recordName == "" {
+		return "", fmt.Errorf("cloudflare.zone_id is not set and there is no record name to look it up from")
+	}
+	id, name, err := p.findZone(p.recordName)
+	if err != nil {
+		return "", err
+	}
+	logInfo("Using CloudFlare zone %s (%s) for %s", name, id, p.recordName)
+	p.zoneID = id
+	return id, nil
+}
+
+// findZone looks up the zone holding name, trying name itself and then
+// each parent domain, so zones of delegated subdomains are found before
+// the domain's own.
+func (p *cloudflareProvider) findZone(name string) (id, zoneName string, err error) {
+	for _, candidate := range zoneCandidates(name) {
+		var zones []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		}
+		if err := p.callAPI("GET", "/zones?name="+url.QueryEscape(candidate), nil, &zones); err != nil {
+			return "", "", fmt.Errorf("looking up the zone of %s: %w", name, err)
+		}
+		if len(zones) > 0 {
+			return zones[0].ID, zones[0].Name, nil
+		}
+	}
+	return "", "", fmt.Errorf("no CloudFlare zone the API token can access holds %s; set cloudflare.zone_id or check the token's zone resources", name)
+}
+
+// zoneCandidates returns the names the zone of name can have, longest
+// first: name and its parents down to two labels. Walking up instead of
+// cutting at the registrable domain needs no public suffix list and still
+// ends at example.co.uk, since there is no zone co.uk.
+func zoneCandidates(name string) []string {
+	name = strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(name, "*."), "."))
+	labels := strings.Split(name, ".")
+	var candidates []string
+	for i := 0; i+2 <= len(labels); i++ {
+		candidates = append(candidates, strings.Join(labels[i:], "."))
+	}
+	return candidates
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestZoneCandidates(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"home.example.com", []string{"home.example.com", "example.com"}},
+		{"Home.Example.co.uk.", []string{"home.example.co.uk", "example.co.uk", "co.uk"}},
+		{"*.dyn.example.com", []string{"dyn.example.com", "example.com"}},
+		{"example.com", []string{"example.com"}},
+		{"localhost", nil},
+	}
+	for _, tt := range tests {
+		if got := zoneCandidates(tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("zoneCandidates(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCloudFlareZoneLookup(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path+" "+r.URL.Query().Get("name"))
+		switch {
+		case r.URL.Path == "/zones" && r.URL.Query().Get("name") == "example.com":
+			w.Write([]byte(`{"success": true, "result": [{"id": "zone-1", "name": "example.com"}]}`))
+		case r.URL.Path == "/zones":
+			w.Write([]byte(`{"success": true, "result": []}`))
+		case r.URL.Path == "/zones/zone-1/dns_records":
+			w.Write([]byte(`{"success": true, "result": [{"id": "rec-1", "content": "2001:db8::1"}]}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	}))
+	defer server.Close()
+
+	p := newCloudFlareProvider(CloudFlareConfig{APIToken: "token", RecordName: "home.dyn.example.com"}, server.Client())
+	p.baseURL = server.URL
+	for i := 0; i < 2; i++ {
+		record, err := p.FetchRecord("AAAA", "home.dyn.example.com")
+		if err != nil || record == nil || record.ID != "rec-1" {
+			t.Fatalf("FetchRecord() = %+v, %v", record, err)
+		}
+	}
+	want := []string{
+		"/zones home.dyn.example.com",
+		"/zones dyn.example.com",
+		"/zones example.com",
+		"/zones/zone-1/dns_records home.dyn.example.com",
+		"/zones/zone-1/dns_records home.dyn.example.com",
+	}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests = %v, want %v (the zone looked up once)", requests, want)
+	}
+
+	p = newCloudFlareProvider(CloudFlareConfig{APIToken: "token", RecordName: "home.example.net"}, server.Client())
+	p.baseURL = server.URL
+	if _, err := p.FetchRecord("AAAA", "home.example.net"); err == nil || !strings.Contains(err.Error(), "set cloudflare.zone_id") {
+		t.Errorf("FetchRecord() in an unknown zone: %v, want a zone_id hint", err)
+	}
+}